@@ -0,0 +1,149 @@
+package netaddr
+
+import (
+	"net"
+)
+
+// The address families in the binary encoding of a network
+const (
+	binaryFamilyIPv4 byte = 4
+	binaryFamilyIPv6 byte = 6
+)
+
+// appendBinary appends the encoding of the prefix to b: a family byte (4 or
+// 6), the prefix length and the address with the host part zeroed. A compact
+// encoding has only the ceil(prefix length / 8) significant bytes of the
+// address.
+func (p ipPrefix) appendBinary(b []byte, compact bool) []byte {
+	family := binaryFamilyIPv6
+	if p.addrLen == net.IPv4len {
+		family = binaryFamilyIPv4
+	}
+	size := int(p.addrLen)
+	if compact {
+		size = (int(p.ones) + 7) / 8
+	}
+	addr := p.hostBits(false)
+	return append(append(b, family, p.ones), addr[:size]...)
+}
+
+// prefixFromBinary decodes a prefix encoded by appendBinary. It returns an
+// error if the data has the wrong length or an unknown family, the prefix
+// length doesn't fit the family or the host part of the address isn't zero.
+func prefixFromBinary(data []byte, compact bool) (p ipPrefix, err error) {
+	if len(data) < 2 {
+		return p, errorf(ErrInvalidEncoding, "network encoding is truncated: %d bytes", len(data))
+	}
+	switch data[0] {
+	case binaryFamilyIPv4:
+		p.addrLen = net.IPv4len
+	case binaryFamilyIPv6:
+		p.addrLen = net.IPv6len
+	default:
+		return p, errorf(ErrInvalidEncoding, "unknown address family in network encoding: %d", data[0])
+	}
+	p.ones = data[1]
+	if int(p.ones) > p.bits() {
+		return p, errorf(ErrInvalidEncoding, "prefix length %d is too long for address family %d", data[1], data[0])
+	}
+	size := int(p.addrLen)
+	if compact {
+		size = (int(p.ones) + 7) / 8
+	}
+	if len(data) != 2+size {
+		return p, errorf(ErrInvalidEncoding, "network encoding has %d bytes, want %d", len(data), 2+size)
+	}
+	copy(p.addr[:], data[2:])
+	if !p.valid() {
+		return p, errorf(ErrHostBitsSet, "host part of %s is not zero", p)
+	}
+	return p, nil
+}
+
+// MarshalNetBinary encodes the given network as a family byte (4 or 6), the
+// prefix length and the masked address bytes. An IPv4 network in the 16 byte
+// form, with either length of mask, is encoded like the 4 byte form, so the
+// encoding of a network is canonical. It is safe to use with any encoder
+// that takes bytes, including gob.
+func MarshalNetBinary(n *net.IPNet) ([]byte, error) {
+	if n == nil {
+		return nil, errorf(ErrInvalidCIDR, "cannot encode nil network")
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 0 || !validIPLen(n.IP) || bits-ones > 8*len(n.IP) {
+		return nil, errorf(ErrInvalidCIDR, "cannot encode invalid network %s", n)
+	}
+	return prefixFromNet(n).appendBinary(nil, false), nil
+}
+
+// UnmarshalNetBinary decodes a network encoded by MarshalNetBinary. IPv4
+// networks are returned in the 4 byte form. It returns an error if the data
+// is truncated or the host part of the address is not zero.
+func UnmarshalNetBinary(data []byte) (*net.IPNet, error) {
+	p, err := prefixFromBinary(data, false)
+	if err != nil {
+		return nil, err
+	}
+	return p.toNet(), nil
+}
+
+// ToBytes returns a compact encoding of the network: a family byte (4 or 6),
+// the prefix length and only the significant bytes of the address, of which
+// there are ceil(prefix length / 8). Equal networks have equal encodings, so
+// they can be compared and used as keys. It returns nil for the zero value.
+func (n IPNet) ToBytes() []byte {
+	if !n.IsValid() {
+		return nil
+	}
+	return n.p.appendBinary(nil, true)
+}
+
+// Key returns the encoding from ToBytes as a string for use as a map key
+func (n IPNet) Key() string {
+	return string(n.ToBytes())
+}
+
+// IPNetFromBytes decodes a network encoded by ToBytes. It returns an error if
+// the length doesn't match the prefix length or any bits after the prefix
+// are set.
+func IPNetFromBytes(b []byte) (IPNet, error) {
+	p, err := prefixFromBinary(b, true)
+	if err != nil {
+		return IPNet{}, err
+	}
+	return IPNet{p}, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler with the encoding of
+// MarshalNetBinary. The zero value encodes as no bytes.
+func (n IPNet) MarshalBinary() ([]byte, error) {
+	if !n.IsValid() {
+		return []byte{}, nil
+	}
+	return n.p.appendBinary(nil, false), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It decodes a network
+// like UnmarshalNetBinary. No bytes give the zero value.
+func (n *IPNet) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		*n = IPNet{}
+		return nil
+	}
+	p, err := prefixFromBinary(data, false)
+	if err != nil {
+		return err
+	}
+	*n = IPNet{p}
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder like MarshalBinary
+func (n IPNet) GobEncode() ([]byte, error) {
+	return n.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder like UnmarshalBinary
+func (n *IPNet) GobDecode(data []byte) error {
+	return n.UnmarshalBinary(data)
+}
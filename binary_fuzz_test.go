@@ -0,0 +1,26 @@
+//go:build go1.18
+// +build go1.18
+
+package netaddr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzIPNetFromBytes(f *testing.F) {
+	f.Add([]byte{4, 24, 10, 0, 0})
+	f.Add([]byte{4, 24, 10, 0})
+	f.Add([]byte{4, 24, 10, 0, 0, 0})
+	f.Add([]byte{6, 32, 0x20, 0x01, 0x0d, 0xb8})
+	f.Add([]byte{6, 128, 0x20, 0x01, 0x0d, 0xb8})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		n, err := IPNetFromBytes(b)
+		if err != nil {
+			return
+		}
+		if encoded := n.ToBytes(); !bytes.Equal(encoded, b) {
+			t.Errorf("%v decoded to %s which encodes to %v", b, n, encoded)
+		}
+	})
+}
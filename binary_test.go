@@ -0,0 +1,181 @@
+package netaddr
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalNetBinary(t *testing.T) {
+	data, err := MarshalNetBinary(Ten24)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 24, 10, 0, 0, 0}, data)
+
+	// The 16 byte form of an IPv4 network encodes the same
+	n := &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}
+	data, err = MarshalNetBinary(n)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 24, 10, 0, 0, 0}, data)
+
+	n, _ = ParseNet("2001:db8::/32")
+	data, err = MarshalNetBinary(n)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{6, 32, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, data)
+
+	// So does one with a 16 byte mask
+	n = &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(120, 128)}
+	data, err = MarshalNetBinary(n)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{4, 24, 10, 0, 0, 0}, data)
+
+	// Only a prefix of at least 96 bits within ::ffff:0:0/96 is IPv4
+	n = &net.IPNet{IP: net.ParseIP("::"), Mask: net.CIDRMask(80, 128)}
+	data, err = MarshalNetBinary(n)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte{6, 80}, make([]byte, 16)...), data)
+
+	_, err = MarshalNetBinary(nil)
+	assert.NotNil(t, err)
+	_, err = MarshalNetBinary(&net.IPNet{IP: ParseIP("10.0.0.0")})
+	assert.NotNil(t, err)
+}
+
+func TestUnmarshalNetBinaryErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		{4},
+		{4, 24, 10, 0, 0},
+		{4, 24, 10, 0, 0, 0, 0},
+		{5, 24, 10, 0, 0, 0},
+		{4, 33, 10, 0, 0, 0},
+		{4, 24, 10, 0, 0, 1},
+	} {
+		n, err := UnmarshalNetBinary(data)
+		assert.NotNil(t, err, "%v", data)
+		assert.Nil(t, n)
+	}
+}
+
+func TestNetBinaryRoundTrip(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		size := net.IPv4len
+		if i%2 == 1 {
+			size = net.IPv6len
+		}
+		ip := make(net.IP, size)
+		rand.Read(ip)
+		mask := net.CIDRMask(rand.Intn(8*size+1), 8*size)
+		n := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+
+		data, err := MarshalNetBinary(n)
+		assert.Nil(t, err)
+
+		// Go through gob as an encoder of the bytes
+		var buf bytes.Buffer
+		assert.Nil(t, gob.NewEncoder(&buf).Encode(data))
+		var decodedData []byte
+		assert.Nil(t, gob.NewDecoder(&buf).Decode(&decodedData))
+
+		decoded, err := UnmarshalNetBinary(decodedData)
+		assert.Nil(t, err)
+		assert.Equal(t, n.String(), decoded.String())
+		assert.Equal(t, len(n.IP), len(decoded.IP))
+		assert.Equal(t, n.Mask, decoded.Mask)
+	}
+}
+
+func TestIPNetToBytes(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		expected []byte
+	}{
+		{"0.0.0.0/0", []byte{4, 0}},
+		{"10.0.0.0/8", []byte{4, 8, 10}},
+		{"10.0.0.0/9", []byte{4, 9, 10, 0}},
+		{"10.0.0.0/24", []byte{4, 24, 10, 0, 0}},
+		{"10.0.0.1/32", []byte{4, 32, 10, 0, 0, 1}},
+		{"::/0", []byte{6, 0}},
+		{"2001:db8::/32", []byte{6, 32, 0x20, 0x01, 0x0d, 0xb8}},
+	}
+	for _, test := range tests {
+		n := MustParseIPNet(test.cidr)
+		assert.Equal(t, test.expected, n.ToBytes(), test.cidr)
+		assert.Equal(t, string(test.expected), n.Key(), test.cidr)
+
+		decoded, err := IPNetFromBytes(test.expected)
+		assert.Nil(t, err)
+		assert.Equal(t, n, decoded)
+	}
+
+	assert.Nil(t, IPNet{}.ToBytes())
+	assert.Equal(t, "", IPNet{}.Key())
+
+	// The 16 byte form of an IPv4 network has the same key
+	n, err := IPNetFromNet(&net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)})
+	assert.Nil(t, err)
+	assert.Equal(t, MustParseIPNet("10.0.0.0/24").Key(), n.Key())
+}
+
+func TestIPNetFromBytesErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		nil,
+		{4},
+		{4, 8},
+		{4, 8, 10, 0},
+		{4, 9, 10, 0x40},
+		{4, 33, 10, 0, 0, 0, 0},
+		{6, 32, 0x20, 0x01, 0x0d},
+		{7, 0},
+	} {
+		n, err := IPNetFromBytes(b)
+		assert.NotNil(t, err, "%v", b)
+		assert.False(t, n.IsValid())
+	}
+}
+
+func TestIPNetBinary(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/24", "0.0.0.0/0", "192.0.2.1/32", "2001:db8::/32", "::/0"} {
+		n := MustParseIPNet(cidr)
+		data, err := n.MarshalBinary()
+		assert.Nil(t, err)
+		expected, _ := MarshalNetBinary(n.Net())
+		assert.Equal(t, expected, data, cidr)
+
+		var decoded IPNet
+		assert.Nil(t, decoded.UnmarshalBinary(data))
+		assert.Equal(t, n, decoded, cidr)
+	}
+
+	// The zero value is no bytes
+	data, err := IPNet{}.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, data)
+	decoded := MustParseIPNet("10.0.0.0/8")
+	assert.Nil(t, decoded.UnmarshalBinary(nil))
+	assert.Equal(t, IPNet{}, decoded)
+
+	assert.True(t, errors.Is(decoded.UnmarshalBinary([]byte{4, 24, 10, 0, 0, 1}), ErrHostBitsSet))
+	assert.True(t, errors.Is(decoded.UnmarshalBinary([]byte{4, 24, 10}), ErrInvalidEncoding))
+}
+
+func TestIPNetGob(t *testing.T) {
+	type record struct {
+		Net  IPNet
+		Nets []IPNet
+		Zero IPNet
+	}
+	in := record{
+		Net:  MustParseIPNet("10.0.0.0/8"),
+		Nets: []IPNet{MustParseIPNet("192.0.2.0/24"), MustParseIPNet("2001:db8::/48")},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, gob.NewEncoder(&buf).Encode(in))
+	var out record
+	assert.Nil(t, gob.NewDecoder(&buf).Decode(&out))
+	assert.Equal(t, in, out)
+}
@@ -0,0 +1,87 @@
+package netaddr
+
+import (
+	"net"
+	"strings"
+)
+
+// appendBinary appends the bits of the given address, in groups of 8 bits
+// separated by dots for IPv4 or of 16 bits separated by colons for IPv6. If
+// mark is between 0 and the number of bits, a '|' goes after that many bits,
+// before the separator at the end of a group.
+func appendBinary(b []byte, addr [16]byte, addrLen uint8, mark int) []byte {
+	sep, group := byte('.'), 8
+	if addrLen == net.IPv6len {
+		sep, group = ':', 16
+	}
+	for i := 0; i < 8*int(addrLen); i++ {
+		if i == mark {
+			b = append(b, '|')
+		}
+		if i > 0 && i%group == 0 {
+			b = append(b, sep)
+		}
+		b = append(b, '0'+addr[i/8]>>(7-i%8)&1)
+	}
+	if mark == 8*int(addrLen) {
+		b = append(b, '|')
+	}
+	return b
+}
+
+// FormatBinary returns the bits of the given IP in groups of 8 separated by
+// dots for IPv4, like 00001010.00000000.00000000.00000001, or in groups of 16
+// separated by colons for IPv6. An IPv4 address in the 16 byte form is
+// formatted as IPv4.
+func FormatBinary(ip net.IP) (string, error) {
+	if !validIPLen(ip) {
+		return "", errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	p := prefixFromIP(ip)
+	return string(appendBinary(nil, p.addr, p.addrLen, -1)), nil
+}
+
+// NetBinaryString returns the bits of the IP of the given network like
+// FormatBinary with a '|' between the network and the host bits, like
+// 00001010.00000000.00000000|.00000000 for 10.0.0.0/24 or
+// 00001010.0000|0000.00000000.00000000 for 10.0.0.0/12. It returns an empty
+// string for a malformed network.
+func NetBinaryString(n *net.IPNet) string {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return ""
+	}
+	return string(appendBinary(nil, p.addr, p.addrLen, int(p.ones)))
+}
+
+// ParseBinaryIP parses an IP in the forms that FormatBinary returns: four
+// groups of 8 binary digits separated by dots for IPv4 or eight groups of 16
+// separated by colons for IPv6. IPv4 addresses are returned in the 4 byte
+// form.
+func ParseBinaryIP(s string) (net.IP, error) {
+	sep, groups, group := ".", 4, 8
+	if strings.Contains(s, ":") {
+		sep, groups, group = ":", 8, 16
+	}
+	parts := strings.Split(s, sep)
+	if len(parts) != groups {
+		return nil, errorf(ErrInvalidIP, "binary IP address %q has %d groups, want %d", s, len(parts), groups)
+	}
+	ip := make(net.IP, groups*group/8)
+	for i, part := range parts {
+		if len(part) != group {
+			return nil, errorf(ErrInvalidIP, "binary IP address %q has group %q, want %d digits", s, part, group)
+		}
+		for j := 0; j < group; j++ {
+			bit := i*group + j
+			switch part[j] {
+			case '1':
+				ip[bit/8] |= 0x80 >> (bit % 8)
+			case '0':
+			default:
+				return nil, errorf(ErrInvalidIP, "binary IP address %q has a digit other than 0 or 1", s)
+			}
+		}
+	}
+	return ip, nil
+}
@@ -0,0 +1,80 @@
+package netaddr
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBinary(t *testing.T) {
+	s, err := FormatBinary(ParseIP("10.0.0.1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "00001010.00000000.00000000.00000001", s)
+
+	s, err = FormatBinary(net.ParseIP("192.168.255.128"))
+	assert.Nil(t, err)
+	assert.Equal(t, "11000000.10101000.11111111.10000000", s)
+
+	s, err = FormatBinary(ParseIP("2001:db8::ffff"))
+	assert.Nil(t, err)
+	assert.Equal(t, "0010000000000001:0000110110111000:"+strings.Repeat("0000000000000000:", 5)+"1111111111111111", s)
+
+	_, err = FormatBinary(net.IP{1, 2, 3})
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+}
+
+func TestNetBinaryString(t *testing.T) {
+	for _, c := range []struct {
+		cidr, expected string
+	}{
+		{"10.0.0.0/24", "00001010.00000000.00000000|.00000000"},
+		{"10.0.0.0/12", "00001010.0000|0000.00000000.00000000"},
+		{"10.0.0.0/8", "00001010|.00000000.00000000.00000000"},
+		{"0.0.0.0/0", "|00000000.00000000.00000000.00000000"},
+		{"10.0.0.1/32", "00001010.00000000.00000000.00000001|"},
+		{"::ffff:10.0.0.0/120", "00001010.00000000.00000000|.00000000"},
+		{"2001:db8::/32", "0010000000000001:0000110110111000|:" + strings.Repeat("0000000000000000:", 5) + "0000000000000000"},
+		{"2001:db8::/36", "0010000000000001:0000110110111000:0000|000000000000:" + strings.Repeat("0000000000000000:", 4) + "0000000000000000"},
+	} {
+		assert.Equal(t, c.expected, NetBinaryString(parse(c.cidr)), c.cidr)
+	}
+	assert.Equal(t, "", NetBinaryString(nil))
+	assert.Equal(t, "", NetBinaryString(&net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.CIDRMask(24, 32)}))
+}
+
+func TestParseBinaryIP(t *testing.T) {
+	ip, err := ParseBinaryIP("00001010.00000000.00000000.00000001")
+	assert.Nil(t, err)
+	assert.Equal(t, net.IP{10, 0, 0, 1}, ip)
+
+	ip, err = ParseBinaryIP("0010000000000001:0000110110111000:" + strings.Repeat("0000000000000000:", 5) + "0000000000000001")
+	assert.Nil(t, err)
+	assert.Equal(t, ParseIP("2001:db8::1"), ip)
+
+	r := rand.New(rand.NewSource(483))
+	for i := 0; i < 100; i++ {
+		ip := make(net.IP, []int{net.IPv4len, net.IPv6len}[i%2])
+		r.Read(ip)
+		s, _ := FormatBinary(ip)
+		parsed, err := ParseBinaryIP(s)
+		assert.Nil(t, err)
+		assert.True(t, ip.Equal(parsed), s)
+	}
+
+	for _, s := range []string{
+		"",
+		"00001010.00000000.00000000",
+		"00001010.00000000.00000000.0000001",
+		"00001010.00000000.00000000.000000012",
+		"00001010.00000000.00000000.00000002",
+		"00001010.00000000.00000000|.00000000",
+		"0010000000000001:0000110110111000::0000000000000001",
+	} {
+		_, err := ParseBinaryIP(s)
+		assert.True(t, errors.Is(err, ErrInvalidIP), s)
+	}
+}
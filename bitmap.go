@@ -0,0 +1,129 @@
+package netaddr
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net"
+)
+
+// bitmapMinPrefixLen is the shortest prefix length of the base network of a
+// bitmap. A bitmap of a /8 takes 2 MiB.
+const bitmapMinPrefixLen = 8
+
+// ToBitmap returns a bitmap of the IPs of the set within the given IPv4 base
+// network, with one bit for each IP of the base network that is set if the IP
+// is in the set. The bits are in order by address, most significant bit
+// first: the first IP of the base network is the 0x80 bit of the first byte.
+// The bitmap has Size(base)/8 bytes, or one byte for networks smaller than a
+// /29 with the unused bits clear. The base network must be a /8 or smaller.
+func (s *IPSet) ToBitmap(base *net.IPNet) ([]byte, error) {
+	p, err := bitmapBase(base)
+	if err != nil {
+		return nil, err
+	}
+	first, last := v4Bounds(p)
+	bitmap := make([]byte, bitmapLen(p))
+
+	// Either a single network contains the base network or all of those that
+	// share IPs with it are within it.
+	if s.root().find(p) != nil {
+		setBits(bitmap, 0, uint64(last-first))
+		return bitmap, nil
+	}
+	for node := s.root().lowerBound(p); node != nil && p.contains(node.prefix); node = node.next() {
+		lo, hi := v4Bounds(node.prefix)
+		setBits(bitmap, uint64(lo-first), uint64(hi-first))
+	}
+	return bitmap, nil
+}
+
+// IPSetFromBitmap returns the set of IPs that the given bitmap of the IPs
+// within the base network has set. The bitmap is in the format of ToBitmap
+// and must have exactly as many bytes, with any unused bits clear.
+func IPSetFromBitmap(base *net.IPNet, bitmap []byte) (*IPSet, error) {
+	p, err := bitmapBase(base)
+	if err != nil {
+		return nil, err
+	}
+	if len(bitmap) != bitmapLen(p) {
+		return nil, errorf(ErrInvalidEncoding, "bitmap of %s has %d bytes, want %d", p, len(bitmap), bitmapLen(p))
+	}
+	size := uint64(1) << (32 - p.ones)
+	if size < 8 && bitmap[0]<<size != 0 {
+		return nil, errorf(ErrInvalidEncoding, "bitmap of %s has bits set past the end", p)
+	}
+
+	// Split each run of set bits into the largest aligned blocks. Runs are
+	// separated by clear bits, so no two of the blocks can be combined.
+	first := uint64(binary.BigEndian.Uint32(p.addr[:4]))
+	var prefixes []ipPrefix
+	for i := uint64(0); i < size; {
+		if bitmap[i/8] == 0 && i%8 == 0 {
+			i += 8
+			continue
+		}
+		if !bitSet(bitmap, i) {
+			i++
+			continue
+		}
+		end := i
+		for end < size && bitSet(bitmap, end) {
+			end++
+		}
+		for i < end {
+			hostBits := bits.TrailingZeros64(i | size)
+			for i+1<<hostBits > end {
+				hostBits--
+			}
+			q := ipPrefix{addrLen: net.IPv4len, ones: uint8(32 - hostBits)}
+			binary.BigEndian.PutUint32(q.addr[:4], uint32(first+i))
+			prefixes = append(prefixes, q)
+			i += 1 << hostBits
+		}
+	}
+	return &IPSet{tree: buildTree(prefixes)}, nil
+}
+
+// bitmapBase checks the base network of a bitmap
+func bitmapBase(base *net.IPNet) (ipPrefix, error) {
+	p, err := checkedPrefixFromNet(base)
+	if err != nil {
+		return ipPrefix{}, err
+	}
+	if p.addrLen != net.IPv4len {
+		return ipPrefix{}, errorf(ErrFamilyMismatch, "base of a bitmap must be IPv4: %s", base)
+	}
+	if p.ones < bitmapMinPrefixLen {
+		return ipPrefix{}, errorf(ErrTooLarge, "base of a bitmap must be a /%d or smaller: %s", bitmapMinPrefixLen, base)
+	}
+	return p, nil
+}
+
+// v4Bounds returns the first and last IPs of the IPv4 prefix p as numbers
+func v4Bounds(p ipPrefix) (first, last uint32) {
+	end := p.last()
+	return binary.BigEndian.Uint32(p.addr[:4]), binary.BigEndian.Uint32(end[:4])
+}
+
+// bitmapLen returns the number of bytes of the bitmap of p
+func bitmapLen(p ipPrefix) int {
+	return (1<<(32-p.ones) + 7) / 8
+}
+
+// bitSet returns true if bit i of the bitmap is set
+func bitSet(bitmap []byte, i uint64) bool {
+	return bitmap[i/8]&(0x80>>(i%8)) != 0
+}
+
+// setBits sets the bits from i to j, inclusive, of the bitmap
+func setBits(bitmap []byte, i, j uint64) {
+	for i <= j {
+		if i%8 == 0 && i+7 <= j {
+			bitmap[i/8] = 0xff
+			i += 8
+		} else {
+			bitmap[i/8] |= 0x80 >> (i % 8)
+			i++
+		}
+	}
+}
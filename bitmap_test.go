@@ -0,0 +1,100 @@
+package netaddr
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToBitmap(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/30"))
+	set.Insert(ParseIP("10.0.0.9"))
+	set.InsertNet(parse("10.0.0.16/28"))
+	set.InsertNet(parse("10.0.1.0/24")) // outside the base
+	set.InsertNet(parse("2001:db8::/32"))
+
+	bitmap, err := set.ToBitmap(parse("10.0.0.0/27"))
+	assert.Nil(t, err)
+	// Most significant bit first
+	assert.Equal(t, []byte{0xf0, 0x40, 0xff, 0xff}, bitmap)
+
+	// A network containing the base
+	bitmap, err = set.ToBitmap(parse("10.0.1.32/27"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff}, bitmap)
+
+	// Smaller than a byte
+	bitmap, err = set.ToBitmap(parse("10.0.0.8/30"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x40}, bitmap)
+
+	bitmap, err = (&IPSet{}).ToBitmap(parse("10.0.0.0/16"))
+	assert.Nil(t, err)
+	assert.Equal(t, make([]byte, 8192), bitmap)
+
+	_, err = set.ToBitmap(parse("2001:db8::/120"))
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, err = set.ToBitmap(parse("0.0.0.0/7"))
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	_, err = set.ToBitmap(parse("10.0.0.1/24"))
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+}
+
+func TestIPSetFromBitmap(t *testing.T) {
+	set, err := IPSetFromBitmap(parse("10.0.0.0/27"), []byte{0xf0, 0x40, 0xff, 0xff})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/30", "10.0.0.9/32", "10.0.0.16/28"}, set.String())
+	assert.Nil(t, set.Validate())
+
+	// Runs that aren't aligned
+	set, err = IPSetFromBitmap(parse("192.168.0.0/29"), []byte{0x7e})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.168.0.1/32", "192.168.0.2/31", "192.168.0.4/31", "192.168.0.6/32"}, set.String())
+
+	set, err = IPSetFromBitmap(parse("10.0.0.0/24"), bytesOf(32, 0xff))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/24"}, set.String())
+	set, err = IPSetFromBitmap(parse("10.0.0.4/30"), []byte{0xf0})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.4/30"}, set.String())
+
+	_, err = IPSetFromBitmap(parse("10.0.0.0/27"), []byte{0xff})
+	assert.True(t, errors.Is(err, ErrInvalidEncoding))
+	_, err = IPSetFromBitmap(parse("10.0.0.4/30"), []byte{0xf8})
+	assert.True(t, errors.Is(err, ErrInvalidEncoding))
+	_, err = IPSetFromBitmap(parse("2001:db8::/120"), bytesOf(32, 0))
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+}
+
+func bytesOf(n int, b byte) []byte {
+	bytes := make([]byte, n)
+	for i := range bytes {
+		bytes[i] = b
+	}
+	return bytes
+}
+
+func TestBitmapRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	set := randomSet(r, 20000)
+	base := parse("10.64.0.0/12")
+	bitmap, err := set.ToBitmap(base)
+	assert.Nil(t, err)
+	decoded, err := IPSetFromBitmap(base, bitmap)
+	assert.Nil(t, err)
+	assert.Nil(t, decoded.Validate())
+
+	within := &IPSet{}
+	within.InsertNet(base)
+	assert.Equal(t, "", ExplainDifference(set.Intersection(within), decoded))
+
+	for i := 0; i < 1000; i++ {
+		ip := net.IP{10, byte(64 + r.Intn(16)), byte(r.Intn(256)), byte(r.Intn(256))}
+		offset := uint64(ip[1]-64)<<16 | uint64(ip[2])<<8 | uint64(ip[3])
+		assert.Equal(t, set.Contains(ip), bitSet(bitmap, offset), ip)
+	}
+}
@@ -0,0 +1,199 @@
+package netaddr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"net"
+)
+
+// IPBloom is a Bloom filter of the networks in an IPSet. It takes much less
+// memory than the set and never reports that an IP of the set isn't in it,
+// but it may report that other IPs are.
+//
+// Each network is added to the filter as it is, with its own prefix length,
+// rather than being broken up into blocks of a fixed size. A lookup probes
+// the filter once for each prefix length that the set has networks of, so
+// the filter only adds false positives, at the requested rate, to the exact
+// membership of the set.
+type IPBloom struct {
+	bits []uint64
+	m    uint64
+	k    uint8
+
+	// The prefix lengths of the IPv4 and IPv6 networks in the filter
+	lengths [2][]uint8
+}
+
+// BloomFilter returns a Bloom filter of the networks in the set, sized so
+// that the chance of it reporting that an IP not in the set is in it is
+// about fpRate. The rate must be between 0 and 1.
+func (s *IPSet) BloomFilter(fpRate float64) (*IPBloom, error) {
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, errorf(ErrInvalidArgument, "false positive rate must be between 0 and 1: %v", fpRate)
+	}
+
+	var n int
+	var seen [2][129]bool
+	b := &IPBloom{}
+	for node := s.root().first(); node != nil; node = node.next() {
+		n++
+		f := bloomFamily(node.prefix.addrLen)
+		if !seen[f][node.prefix.ones] {
+			seen[f][node.prefix.ones] = true
+			b.lengths[f] = append(b.lengths[f], node.prefix.ones)
+		}
+	}
+
+	// A lookup probes the filter once for each prefix length, so each probe
+	// gets its share of the rate.
+	probes := len(b.lengths[0])
+	if len(b.lengths[1]) > probes {
+		probes = len(b.lengths[1])
+	}
+	if probes > 1 {
+		fpRate /= float64(probes)
+	}
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	b.m = 64 * (uint64(m)/64 + 1)
+	b.k = 1
+	if n > 0 {
+		b.k = uint8(math.Max(1, math.Min(32, math.Round(float64(b.m)/float64(n)*math.Ln2))))
+	}
+	b.bits = make([]uint64, b.m/64)
+
+	for node := s.root().first(); node != nil; node = node.next() {
+		h1, h2 := bloomHashes(node.prefix)
+		for i := uint64(0); i < uint64(b.k); i++ {
+			bit := (h1 + i*h2) % b.m
+			b.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return b, nil
+}
+
+// Contains returns true if the given IP may be in the set the filter was made
+// from. It is always true for the IPs that are.
+func (b *IPBloom) Contains(ip net.IP) bool {
+	if !validIPLen(ip) {
+		return false
+	}
+	host := prefixFromIP(ip)
+	for _, ones := range b.lengths[bloomFamily(host.addrLen)] {
+		p := host
+		p.ones = ones
+		p.addr = p.hostBits(false)
+		if b.probe(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// probe returns true if all of the bits of the given prefix are set
+func (b *IPBloom) probe(p ipPrefix) bool {
+	h1, h2 := bloomHashes(p)
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomFamily returns the index of the lengths of the given address length
+func bloomFamily(addrLen uint8) int {
+	if addrLen == net.IPv4len {
+		return 0
+	}
+	return 1
+}
+
+// bloomHashes returns the two hashes of the prefix from which the bits of the
+// prefix are derived. They are part of the binary encoding, so they must not
+// change.
+func bloomHashes(p ipPrefix) (h1, h2 uint64) {
+	key := make([]byte, 0, 18)
+	key = append(key, p.addrLen, p.ones)
+	key = append(key, p.addr[:p.addrLen]...)
+
+	f1, f2 := fnv.New64a(), fnv.New64()
+	f1.Write(key)
+	f2.Write(key)
+	return f1.Sum64(), f2.Sum64() | 1
+}
+
+// bloomMagic starts the binary encoding of an IPBloom, followed by a version
+var bloomMagic = [4]byte{'I', 'P', 'B', 'F'}
+
+const bloomVersion = 1
+
+// MarshalBinary encodes the filter as the magic "IPBF", a version byte, the
+// number of hashes, the number of bits as 8 bytes, the count and list of the
+// IPv4 and then the IPv6 prefix lengths and finally the bits, 8 bytes at a
+// time. Numbers are big endian.
+func (b *IPBloom) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 16+len(b.lengths[0])+len(b.lengths[1])+8*len(b.bits))
+	data = append(data, bloomMagic[:]...)
+	data = append(data, bloomVersion, b.k)
+	data = appendUint64(data, b.m)
+	for _, lengths := range b.lengths {
+		data = append(data, uint8(len(lengths)))
+		data = append(data, lengths...)
+	}
+	for _, word := range b.bits {
+		data = appendUint64(data, word)
+	}
+	return data, nil
+}
+
+// appendUint64 appends v to b as 8 big endian bytes
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary
+func (b *IPBloom) UnmarshalBinary(data []byte) error {
+	if len(data) < 14 || !bytes.Equal(data[:4], bloomMagic[:]) {
+		return errorf(ErrInvalidEncoding, "not an IPBloom encoding")
+	}
+	if data[4] != bloomVersion {
+		return errorf(ErrInvalidEncoding, "unknown IPBloom encoding version: %d", data[4])
+	}
+	k, m := data[5], binary.BigEndian.Uint64(data[6:14])
+	if k == 0 || m == 0 || m%64 != 0 {
+		return errorf(ErrInvalidEncoding, "invalid IPBloom parameters: %d hashes and %d bits", k, m)
+	}
+	data = data[14:]
+
+	var lengths [2][]uint8
+	for f, max := range []uint8{32, 128} {
+		if len(data) == 0 || len(data) < 1+int(data[0]) {
+			return errorf(ErrInvalidEncoding, "IPBloom encoding is truncated")
+		}
+		if data[0] > 0 {
+			lengths[f] = append([]uint8{}, data[1:1+data[0]]...)
+		}
+		data = data[1+data[0]:]
+		for _, ones := range lengths[f] {
+			if ones > max {
+				return errorf(ErrInvalidEncoding, "invalid prefix length in IPBloom encoding: %d", ones)
+			}
+		}
+	}
+
+	if uint64(len(data)) != m/8 {
+		return errorf(ErrInvalidEncoding, "IPBloom encoding has %d bytes of bits, want %d", len(data), m/8)
+	}
+	bits := make([]uint64, m/64)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+
+	*b = IPBloom{bits: bits, m: m, k: k, lengths: lengths}
+	return nil
+}
@@ -0,0 +1,109 @@
+package netaddr
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	set := randomSet(r, 5000)
+	const fpRate = 0.01
+	bloom, err := set.BloomFilter(fpRate)
+	assert.Nil(t, err)
+
+	// No false negatives
+	for _, ip := range set.GetIPs(0) {
+		if !bloom.Contains(ip) {
+			t.Fatalf("%s is in the set but not in the filter", ip)
+		}
+		assert.True(t, bloom.Contains(ip.To16()))
+	}
+
+	// False positives at about the requested rate
+	var samples, positives int
+	for samples < 100000 {
+		var ip net.IP
+		if r.Intn(2) == 0 {
+			ip = IPv4(10, byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+		} else {
+			ip = ParseIP("2001:db8::")
+			ip[13], ip[14], ip[15] = byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))
+		}
+		if set.Contains(ip) {
+			continue
+		}
+		samples++
+		if bloom.Contains(ip) {
+			positives++
+		}
+	}
+	assert.True(t, float64(positives)/float64(samples) < 2*fpRate, "%d of %d", positives, samples)
+
+	// Round trip
+	data, err := bloom.MarshalBinary()
+	assert.Nil(t, err)
+	decoded := &IPBloom{}
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, bloom, decoded)
+}
+
+func TestBloomFilterLargeNetworks(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	set.InsertNet(parse("2001:db8::/32"))
+	set.Insert(ParseIP("192.0.2.1"))
+	bloom, err := set.BloomFilter(0.001)
+	assert.Nil(t, err)
+	for _, ip := range []string{"10.0.0.0", "10.255.255.255", "10.1.2.3", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", "192.0.2.1"} {
+		assert.True(t, bloom.Contains(ParseIP(ip)), ip)
+	}
+	assert.False(t, bloom.Contains(nil))
+	assert.False(t, bloom.Contains(net.IP{1, 2, 3}))
+}
+
+func TestBloomFilterEmpty(t *testing.T) {
+	bloom, err := (&IPSet{}).BloomFilter(0.5)
+	assert.Nil(t, err)
+	assert.False(t, bloom.Contains(ParseIP("10.0.0.1")))
+	data, _ := bloom.MarshalBinary()
+	decoded := &IPBloom{}
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, bloom, decoded)
+
+	for _, rate := range []float64{0, 1, -0.1, 2} {
+		_, err = (&IPSet{}).BloomFilter(rate)
+		assert.True(t, errors.Is(err, ErrInvalidArgument), "%v", rate)
+	}
+}
+
+func TestIPBloomUnmarshalBinaryErrors(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(Ten24)
+	bloom, _ := set.BloomFilter(0.01)
+	data, _ := bloom.MarshalBinary()
+
+	corrupt := func(i int, b byte) []byte {
+		c := append([]byte{}, data...)
+		c[i] = b
+		return c
+	}
+	for _, bad := range [][]byte{
+		nil,
+		data[:10],
+		data[:len(data)-1],
+		append(append([]byte{}, data...), 0),
+		corrupt(0, 'X'),
+		corrupt(4, 2),   // version
+		corrupt(5, 0),   // no hashes
+		corrupt(13, 65), // bits not a multiple of 64
+		corrupt(15, 33), // IPv4 prefix length
+	} {
+		err := (&IPBloom{}).UnmarshalBinary(bad)
+		assert.True(t, errors.Is(err, ErrInvalidEncoding), "%x: %v", bad, err)
+	}
+}
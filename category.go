@@ -0,0 +1,147 @@
+package netaddr
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Category is the broad kind of use of an address, like private or
+// documentation, as told by the special-purpose registries
+type Category int
+
+// The categories of addresses
+const (
+	// CategoryInvalid is the category of a malformed IP or network
+	CategoryInvalid Category = iota
+	// CategoryGlobal is the category of the addresses that aren't in any of
+	// the other categories, which includes the special-purpose blocks that
+	// don't fit any of them
+	CategoryGlobal
+	// CategoryUnspecified is 0.0.0.0/8, "this network", and ::
+	CategoryUnspecified
+	// CategoryLoopback is 127.0.0.0/8 and ::1
+	CategoryLoopback
+	// CategoryPrivate is the private-use blocks of RFC 1918 and the unique
+	// local addresses, fc00::/7
+	CategoryPrivate
+	// CategoryShared is the shared address space of carrier-grade NAT,
+	// 100.64.0.0/10
+	CategoryShared
+	// CategoryLinkLocal is 169.254.0.0/16 and fe80::/10
+	CategoryLinkLocal
+	// CategoryDocumentation is the blocks reserved for documentation
+	CategoryDocumentation
+	// CategoryBenchmarking is 198.18.0.0/15 and 2001:2::/48
+	CategoryBenchmarking
+	// CategoryMulticast is 224.0.0.0/4 and ff00::/8
+	CategoryMulticast
+	// CategoryReserved is 240.0.0.0/4, including the limited broadcast
+	// address
+	CategoryReserved
+)
+
+var categoryNames = []string{
+	"invalid", "global", "unspecified", "loopback", "private", "shared",
+	"link-local", "documentation", "benchmarking", "multicast", "reserved",
+}
+
+func (c Category) String() string {
+	if c < 0 || int(c) >= len(categoryNames) {
+		return fmt.Sprintf("Category(%d)", int(c))
+	}
+	return categoryNames[c]
+}
+
+// registryCategory returns the category of the addresses of the given entry
+// of the special-purpose registries, or CategoryGlobal if they don't fit any
+// of the others
+func registryCategory(e *RegistryEntry) Category {
+	switch {
+	case e.Name == "\"This network\"" || e.Name == "\"This host on this network\"" || e.Name == "Unspecified Address":
+		return CategoryUnspecified
+	case strings.HasPrefix(e.Name, "Loopback"):
+		return CategoryLoopback
+	case e.Name == "Private-Use" || e.Name == "Unique-Local":
+		return CategoryPrivate
+	case e.Name == "Shared Address Space":
+		return CategoryShared
+	case e.Name == "Link Local" || e.Name == "Link-Local Unicast":
+		return CategoryLinkLocal
+	case strings.HasPrefix(e.Name, "Documentation"):
+		return CategoryDocumentation
+	case e.Name == "Benchmarking":
+		return CategoryBenchmarking
+	case e.Name == "Reserved" || e.Name == "Limited Broadcast":
+		return CategoryReserved
+	}
+	return CategoryGlobal
+}
+
+// categorySets holds the set of the addresses of each category other than
+// CategoryInvalid and CategoryGlobal, indexed by category. The multicast
+// blocks aren't in the special-purpose registries.
+var categorySets = buildCategorySets(SpecialPurposeRegistry)
+
+func buildCategorySets(entries []*RegistryEntry) []*IPSet {
+	sets := make([]*IPSet, len(categoryNames))
+	add := func(c Category, n *net.IPNet) {
+		if sets[c] == nil {
+			sets[c] = &IPSet{}
+		}
+		sets[c].InsertNet(n)
+	}
+	for _, e := range entries {
+		if c := registryCategory(e); c != CategoryGlobal {
+			add(c, e.Net)
+		}
+	}
+	add(CategoryMulticast, registryNet("224.0.0.0/4"))
+	add(CategoryMulticast, registryNet("ff00::/8"))
+	return sets
+}
+
+// Classify returns the category of the given IP. An IPv4 address in the 16
+// byte form is classified as IPv4.
+func Classify(ip net.IP) Category {
+	if !validIPLen(ip) {
+		return CategoryInvalid
+	}
+	return classifyPrefix(prefixFromIP(ip))
+}
+
+// classifyPrefix returns the category of the given host prefix
+func classifyPrefix(p ipPrefix) Category {
+	for c, set := range categorySets {
+		if set != nil && set.tree.contains(p) {
+			return Category(c)
+		}
+	}
+	return CategoryGlobal
+}
+
+// ClassifyNet returns the category of the first address of the given
+// network and true if all of its addresses are of that category. Otherwise,
+// the network straddles categories, which is usually a mistake, and it
+// returns false. For example, 10.0.0.0/7 is partly private and partly
+// global, so it returns CategoryPrivate and false. It returns
+// CategoryInvalid and false for a malformed network, including one with host
+// bits set.
+func ClassifyNet(n *net.IPNet) (Category, bool) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return CategoryInvalid, false
+	}
+	first := p
+	first.ones = 8 * p.addrLen
+	c := classifyPrefix(first)
+	if c != CategoryGlobal {
+		return c, categorySets[c].tree.contains(p)
+	}
+	for _, set := range categorySets {
+		if set != nil && set.tree.overlap(p).Sign() != 0 {
+			return c, false
+		}
+	}
+	return c, true
+}
@@ -0,0 +1,93 @@
+package netaddr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	for _, c := range []struct {
+		ip       string
+		category Category
+	}{
+		{"8.8.8.8", CategoryGlobal},
+		{"0.0.0.0", CategoryUnspecified},
+		{"0.1.2.3", CategoryUnspecified},
+		{"127.0.0.1", CategoryLoopback},
+		{"10.1.2.3", CategoryPrivate},
+		{"172.31.255.255", CategoryPrivate},
+		{"172.32.0.0", CategoryGlobal},
+		{"100.64.0.1", CategoryShared},
+		{"169.254.1.1", CategoryLinkLocal},
+		{"198.51.100.7", CategoryDocumentation},
+		{"198.19.0.1", CategoryBenchmarking},
+		{"239.255.255.250", CategoryMulticast},
+		{"255.255.255.255", CategoryReserved},
+		{"192.0.0.9", CategoryGlobal},
+		{"2606:4700::1111", CategoryGlobal},
+		{"::", CategoryUnspecified},
+		{"::1", CategoryLoopback},
+		{"fd00::1", CategoryPrivate},
+		{"fe80::1", CategoryLinkLocal},
+		{"2001:db8::1", CategoryDocumentation},
+		{"3fff::1", CategoryDocumentation},
+		{"ff02::1", CategoryMulticast},
+	} {
+		assert.Equal(t, c.category, Classify(ParseIP(c.ip)), c.ip)
+		assert.Equal(t, c.category, Classify(net.ParseIP(c.ip)), c.ip)
+	}
+	assert.Equal(t, CategoryInvalid, Classify(net.IP{1, 2, 3}))
+}
+
+func TestClassifyNet(t *testing.T) {
+	for _, c := range []struct {
+		cidr     string
+		category Category
+		whole    bool
+	}{
+		{"10.0.0.0/8", CategoryPrivate, true},
+		{"10.0.0.0/7", CategoryPrivate, false},
+		{"10.255.255.0/24", CategoryPrivate, true},
+		{"11.0.0.0/8", CategoryGlobal, true},
+		{"8.0.0.0/6", CategoryGlobal, false},
+		{"172.16.0.0/11", CategoryGlobal, false},
+		{"172.16.0.0/12", CategoryPrivate, true},
+		{"192.0.2.0/25", CategoryDocumentation, true},
+		{"192.0.0.0/22", CategoryGlobal, false},
+		{"198.18.0.0/15", CategoryBenchmarking, true},
+		{"198.16.0.0/14", CategoryGlobal, false},
+		{"224.0.0.0/4", CategoryMulticast, true},
+		{"224.0.0.0/3", CategoryMulticast, false},
+		{"0.0.0.0/0", CategoryUnspecified, false},
+		{"2001:db8::/32", CategoryDocumentation, true},
+		{"2001:db8::/31", CategoryDocumentation, false},
+		{"2001:db6::/31", CategoryGlobal, true},
+		{"2001:db0::/28", CategoryGlobal, false},
+		{"fc00::/6", CategoryPrivate, false},
+		{"fc00::/7", CategoryPrivate, true},
+		{"ff02::/16", CategoryMulticast, true},
+		{"::/0", CategoryUnspecified, false},
+		{"::ffff:10.0.0.0/104", CategoryPrivate, true},
+	} {
+		_, n, err := net.ParseCIDR(c.cidr)
+		assert.Nil(t, err, c.cidr)
+		category, whole := ClassifyNet(n)
+		assert.Equal(t, c.category, category, c.cidr)
+		assert.Equal(t, c.whole, whole, c.cidr)
+	}
+
+	category, whole := ClassifyNet(&net.IPNet{IP: net.IP{10, 255, 255, 0}, Mask: net.CIDRMask(23, 32)})
+	assert.Equal(t, CategoryInvalid, category)
+	assert.False(t, whole)
+	category, _ = ClassifyNet(nil)
+	assert.Equal(t, CategoryInvalid, category)
+}
+
+func TestCategoryString(t *testing.T) {
+	assert.Equal(t, "private", CategoryPrivate.String())
+	assert.Equal(t, "link-local", CategoryLinkLocal.String())
+	assert.Equal(t, "reserved", CategoryReserved.String())
+	assert.Equal(t, "Category(42)", Category(42).String())
+}
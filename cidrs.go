@@ -0,0 +1,89 @@
+package netaddr
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+// setFromCIDRs parses the given CIDRs or bare IPs into a new set. It returns
+// an error for each one that doesn't parse, identified by the name of the
+// list and its position in it.
+func setFromCIDRs(name string, cidrs []string) (*IPSet, []error) {
+	set := &IPSet{}
+	errs := []error{}
+	for i, cidr := range cidrs {
+		n, err := ParseNetOrIP(cidr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d] (%q): %w", name, i, cidr, err))
+			continue
+		}
+		set.InsertNet(n)
+	}
+	return set, errs
+}
+
+// setStrings returns the networks in the set as strings, or an empty slice
+// rather than nil.
+func setStrings(set *IPSet) []string {
+	if str := set.String(); str != nil {
+		return str
+	}
+	return []string{}
+}
+
+// IntersectCIDRs returns the IPs in both lists as the fewest CIDRs that
+// cover them, sorted by address. The lists may hold CIDRs or bare IPs. If
+// any fail to parse, it returns an error listing all of them with their
+// positions.
+func IntersectCIDRs(a, b []string) ([]string, error) {
+	setA, errs := setFromCIDRs("a", a)
+	setB, errsB := setFromCIDRs("b", b)
+	if errs = append(errs, errsB...); len(errs) != 0 {
+		return nil, joinErrors(errs)
+	}
+	return setStrings(setA.Intersection(setB)), nil
+}
+
+// MergeCIDRs returns the fewest CIDRs that cover the IPs in the given list,
+// sorted by address. Siblings are merged and networks contained by others
+// are dropped. The list may hold CIDRs or bare IPs. If any fail to parse, it
+// returns an error listing all of them with their positions.
+func MergeCIDRs(cidrs []string) ([]string, error) {
+	set, errs := setFromCIDRs("cidrs", cidrs)
+	if len(errs) != 0 {
+		return nil, joinErrors(errs)
+	}
+	return setStrings(set), nil
+}
+
+// SummarizeIPs returns the fewest networks that cover exactly the given IPs,
+// sorted like GetNetworks. The IPs may be in any order, repeat and be of both
+// IP versions. IPv4 addresses in the 16 byte form are taken as IPv4 and IPs
+// of an invalid length are ignored. It sorts a compact copy of the IPs in a
+// single pass rather than building a set, so it suits very long lists.
+func SummarizeIPs(ips []net.IP) []*net.IPNet {
+	hosts := make([]ipPrefix, 0, len(ips))
+	for _, ip := range ips {
+		if validIPLen(ip) {
+			hosts = append(hosts, prefixFromIP(ip))
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].compare(hosts[j]) < 0
+	})
+
+	// Cover each run of consecutive IPs
+	nets := []*net.IPNet{}
+	for i := 0; i < len(hosts); {
+		j := i
+		for j+1 < len(hosts) && (hosts[j+1] == hosts[j] || adjacent(hosts[j], hosts[j+1])) {
+			j++
+		}
+		for _, p := range rangePrefixes(hosts[i], hosts[j]) {
+			nets = append(nets, p.toNet())
+		}
+		i = j + 1
+	}
+	return nets
+}
@@ -0,0 +1,120 @@
+package netaddr
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntersectCIDRs(t *testing.T) {
+	tests := []struct {
+		a, b, expected []string
+	}{
+		{[]string{"10.0.0.0/8"}, []string{"10.1.0.0/16", "192.168.0.0/16"}, []string{"10.1.0.0/16"}},
+		// Partial overlaps
+		{
+			[]string{"10.0.0.0/23", "10.0.4.0/22"},
+			[]string{"10.0.1.0/24", "10.0.2.0/23", "10.0.6.0/23", "10.0.8.0/24"},
+			[]string{"10.0.1.0/24", "10.0.6.0/23"},
+		},
+		{[]string{"10.0.0.1", "2001:db8::/32"}, []string{"10.0.0.0/24", "2001:db8:1::/48"}, []string{"10.0.0.1/32", "2001:db8:1::/48"}},
+		{[]string{"10.0.0.0/24"}, []string{"10.0.1.0/24"}, []string{}},
+		{nil, nil, []string{}},
+	}
+	for _, test := range tests {
+		result, err := IntersectCIDRs(test.a, test.b)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, result)
+
+		// The intersection is symmetric
+		result, err = IntersectCIDRs(test.b, test.a)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, result)
+	}
+}
+
+func TestIntersectCIDRsErrors(t *testing.T) {
+	result, err := IntersectCIDRs(
+		[]string{"10.0.0.0/8", "bogus", "10.0.0.1/8"},
+		[]string{"10.0.0.0/33"},
+	)
+	assert.Nil(t, result)
+	assert.Equal(t, `a[1] ("bogus"): invalid IP address: bogus`+"\n"+
+		`a[2] ("10.0.0.1/8"): Host part is not zero`+"\n"+
+		`b[0] ("10.0.0.0/33"): invalid CIDR address: 10.0.0.0/33`, err.Error())
+}
+
+func TestMergeCIDRs(t *testing.T) {
+	tests := []struct {
+		cidrs, expected []string
+	}{
+		{[]string{"10.0.0.0/25", "10.0.0.128/25"}, []string{"10.0.0.0/24"}},
+		{[]string{"10.0.0.0/24", "10.0.0.64/26", "10.0.0.1"}, []string{"10.0.0.0/24"}},
+		{
+			[]string{"2001:db8::/33", "192.168.0.1", "2001:db8:8000::/33", "10.0.0.0/8", "192.168.0.0"},
+			[]string{"10.0.0.0/8", "192.168.0.0/31", "2001:db8::/32"},
+		},
+		{[]string{"::ffff:10.0.0.0/104"}, []string{"10.0.0.0/8"}},
+		{[]string{}, []string{}},
+	}
+	for _, test := range tests {
+		result, err := MergeCIDRs(test.cidrs)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, result)
+	}
+}
+
+func ExampleMergeCIDRs() {
+	merged, _ := MergeCIDRs([]string{"10.0.1.0/24", "10.0.0.0/24", "10.0.0.7", "2001:db8::/32"})
+	fmt.Println(merged)
+	// Output: [10.0.0.0/23 2001:db8::/32]
+}
+
+func TestMergeCIDRsErrors(t *testing.T) {
+	result, err := MergeCIDRs([]string{"10.0.0.0/8", "", "10.0.0.0/8/8"})
+	assert.Nil(t, result)
+	assert.Equal(t, `cidrs[1] (""): invalid IP address: `+"\n"+
+		`cidrs[2] ("10.0.0.0/8/8"): invalid CIDR address: 10.0.0.0/8/8`, err.Error())
+}
+
+func TestSummarizeIPs(t *testing.T) {
+	ips := []net.IP{}
+	for _, s := range []string{
+		"10.0.0.7", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6",
+		"10.0.0.3", // repeated
+		"2001:db8::1", "2001:db8::",
+		"192.168.0.255", "192.168.1.0",
+	} {
+		ips = append(ips, ParseIP(s))
+	}
+	// The 4 byte form of one that is already there and one in the 16 byte
+	// form that isn't
+	ips = append(ips, net.IP{10, 0, 0, 5}, net.ParseIP("10.0.0.8"))
+	// Invalid
+	ips = append(ips, nil, net.IP{1, 2, 3})
+
+	var str []string
+	for _, n := range SummarizeIPs(ips) {
+		str = append(str, n.String())
+	}
+	assert.Equal(t, []string{
+		"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/32",
+		"192.168.0.255/32", "192.168.1.0/32",
+		"2001:db8::/127",
+	}, str)
+
+	assert.Equal(t, []*net.IPNet{}, SummarizeIPs(nil))
+	assert.Equal(t, []*net.IPNet{parse("255.255.255.255/32")}, SummarizeIPs([]net.IP{ParseIP("255.255.255.255")}))
+}
+
+func TestSummarizeIPsRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	set := randomSet(r, 2000)
+	ips := set.GetIPs(0)
+	r.Shuffle(len(ips), func(i, j int) { ips[i], ips[j] = ips[j], ips[i] })
+	ips = append(ips, ips[:100]...)
+	assert.Equal(t, set.GetNetworks(), SummarizeIPs(ips))
+}
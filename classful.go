@@ -0,0 +1,67 @@
+package netaddr
+
+import (
+	"net"
+)
+
+// The helpers in this file describe IPv4 addresses in terms of the classful
+// addressing that CIDR replaced in 1993. They are only meant for diagnosing
+// and auditing legacy configurations.
+
+// IPv4Class returns the class, 'A' through 'E', of the given IPv4 address
+// from its leading bits. It returns an error if the IP is not IPv4.
+func IPv4Class(ip net.IP) (rune, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0, errorf(ErrFamilyMismatch, "not an IPv4 address: %s", ip)
+	}
+	switch {
+	case ip4[0] < 128:
+		return 'A', nil
+	case ip4[0] < 192:
+		return 'B', nil
+	case ip4[0] < 224:
+		return 'C', nil
+	case ip4[0] < 240:
+		return 'D', nil
+	}
+	return 'E', nil
+}
+
+// NaturalMask returns the mask implied by the class of the given IPv4
+// address: /8 for class A, /16 for class B and /24 for class C. It returns an
+// error for the multicast class D and reserved class E, which have none, and
+// for an IP that isn't IPv4.
+func NaturalMask(ip net.IP) (net.IPMask, error) {
+	class, err := IPv4Class(ip)
+	if err != nil {
+		return nil, err
+	}
+	switch class {
+	case 'A':
+		return net.CIDRMask(8, 32), nil
+	case 'B':
+		return net.CIDRMask(16, 32), nil
+	case 'C':
+		return net.CIDRMask(24, 32), nil
+	}
+	return nil, errorf(ErrInvalidArgument, "class %c address %s has no natural mask", class, ip)
+}
+
+// IsClassfulBoundary returns true if the given network is exactly a class A,
+// B or C network, such as 10.0.0.0/8 or 192.168.1.0/24.
+func IsClassfulBoundary(n *net.IPNet) bool {
+	if n == nil {
+		return false
+	}
+	mask, err := NaturalMask(n.IP)
+	if err != nil {
+		return false
+	}
+	p, err := checkedPrefixFromNet(n)
+	if err != nil || p.addrLen != net.IPv4len {
+		return false
+	}
+	ones, _ := mask.Size()
+	return int(p.ones) == ones
+}
@@ -0,0 +1,84 @@
+package netaddr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPv4Class(t *testing.T) {
+	tests := []struct {
+		ip    string
+		class rune
+	}{
+		{"0.0.0.0", 'A'},
+		{"10.1.2.3", 'A'},
+		{"127.255.255.255", 'A'},
+		{"128.0.0.0", 'B'},
+		{"172.16.0.1", 'B'},
+		{"191.255.255.255", 'B'},
+		{"192.0.0.0", 'C'},
+		{"223.255.255.255", 'C'},
+		{"224.0.0.1", 'D'},
+		{"239.255.255.255", 'D'},
+		{"240.0.0.0", 'E'},
+		{"255.255.255.255", 'E'},
+	}
+	for _, test := range tests {
+		class, err := IPv4Class(ParseIP(test.ip))
+		assert.Nil(t, err)
+		assert.Equal(t, string(test.class), string(class), test.ip)
+	}
+
+	// The 16 byte form is IPv4
+	class, err := IPv4Class(net.ParseIP("10.1.2.3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 'A', class)
+
+	for _, ip := range []net.IP{ParseIP("2001:db8::1"), nil} {
+		_, err = IPv4Class(ip)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestNaturalMask(t *testing.T) {
+	tests := []struct {
+		ip   string
+		ones int
+	}{
+		{"10.1.2.3", 8},
+		{"172.16.0.1", 16},
+		{"192.168.1.1", 24},
+	}
+	for _, test := range tests {
+		mask, err := NaturalMask(ParseIP(test.ip))
+		assert.Nil(t, err)
+		assert.Equal(t, net.CIDRMask(test.ones, 32), mask, test.ip)
+	}
+
+	for _, ip := range []string{"224.0.0.1", "240.0.0.1", "2001:db8::1"} {
+		mask, err := NaturalMask(ParseIP(ip))
+		assert.NotNil(t, err, ip)
+		assert.Nil(t, mask, ip)
+	}
+	_, err := NaturalMask(ParseIP("224.0.0.1"))
+	assert.Equal(t, "class D address 224.0.0.1 has no natural mask", err.Error())
+}
+
+func TestIsClassfulBoundary(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/16", "192.168.1.0/24", "0.0.0.0/8"} {
+		assert.True(t, IsClassfulBoundary(parse(cidr)), cidr)
+	}
+	for _, cidr := range []string{
+		"10.0.0.0/16",    // subnet of class A
+		"172.16.0.0/12",  // supernet of class B
+		"192.168.0.0/16", // supernet of class C
+		"10.0.0.1/8",     // not a network address
+		"224.0.0.0/4",    // class D
+		"2001:db8::/32",
+	} {
+		assert.False(t, IsClassfulBoundary(parse(cidr)), cidr)
+	}
+	assert.False(t, IsClassfulBoundary(nil))
+}
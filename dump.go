@@ -0,0 +1,105 @@
+package netaddr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpTree writes the tree underlying the set to w for debugging. Each node
+// is written on its own line, indented by its depth below the top, with its
+// network, depth, priority and the network of the node its up link points
+// to. The lines are in pre-order and each one starts with L or R to tell
+// which child of the line's parent it is. A node is marked if its up link
+// doesn't point at that parent and, if the tree has a loop, a node that has
+// already been written is marked instead of being written again. The output
+// only depends on the contents of the tree. Errors writing to w are ignored.
+func (s *IPSet) DumpTree(w io.Writer) {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	if s == nil || s.tree == nil {
+		fmt.Fprintln(bw, "(empty)")
+		return
+	}
+
+	type item struct {
+		node, parent *ipTree
+		depth        int
+		side         string
+	}
+	seen := map[*ipTree]bool{}
+	stack := []item{{node: s.tree}}
+	for len(stack) != 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if it.node == nil {
+			continue
+		}
+
+		fmt.Fprintf(bw, "%s%s%s", strings.Repeat("  ", it.depth), it.side, it.node.prefix)
+		if seen[it.node] {
+			fmt.Fprintln(bw, " (loop)")
+			continue
+		}
+		seen[it.node] = true
+
+		up := "-"
+		if it.node.up != nil {
+			up = it.node.up.prefix.String()
+		}
+		fmt.Fprintf(bw, " depth=%d priority=%08x up=%s", it.depth, it.node.priority, up)
+		if it.node.up != it.parent {
+			fmt.Fprint(bw, " (up link mismatch)")
+		}
+		fmt.Fprintln(bw)
+
+		stack = append(stack,
+			item{it.node.right, it.node, it.depth + 1, "R "},
+			item{it.node.left, it.node, it.depth + 1, "L "})
+	}
+}
+
+// TreeString returns the shape of the tree underlying the set on one line,
+// for logs. A node with children is written as (left network right), a node
+// without any as just its network and a missing child as -. An empty set is
+// written as -.
+func (s *IPSet) TreeString() string {
+	if s == nil {
+		return "-"
+	}
+
+	// The stack holds the nodes still to be written and the text between them
+	type item struct {
+		node *ipTree
+		text string
+	}
+	var b strings.Builder
+	seen := map[*ipTree]bool{}
+	stack := []item{{node: s.tree}}
+	for len(stack) != 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch {
+		case it.text != "":
+			b.WriteString(it.text)
+		case it.node == nil:
+			b.WriteString("-")
+		case seen[it.node]:
+			b.WriteString(it.node.prefix.String() + "!loop")
+		case it.node.left == nil && it.node.right == nil:
+			seen[it.node] = true
+			b.WriteString(it.node.prefix.String())
+		default:
+			seen[it.node] = true
+			stack = append(stack,
+				item{text: ")"},
+				item{node: it.node.right},
+				item{text: " " + it.node.prefix.String() + " "},
+				item{node: it.node.left},
+				item{text: "("})
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package netaddr
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpTree(t *testing.T) {
+	set := &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/24", "10.0.2.0/24", "10.0.4.0/24", "10.0.6.0/24", "2001:db8::/64"} {
+		set.InsertNet(parse(cidr))
+	}
+	before := set.GetNetworks()
+
+	// Priorities differ from one process to the next, but not after Compact
+	set.Compact()
+	var b bytes.Buffer
+	set.DumpTree(&b)
+	assert.Equal(t, `10.0.4.0/24 depth=0 priority=ffffffff up=-
+  L 10.0.2.0/24 depth=1 priority=fffffffe up=10.0.4.0/24
+    L 10.0.0.0/24 depth=2 priority=fffffffd up=10.0.2.0/24
+  R 2001:db8::/64 depth=1 priority=fffffffe up=10.0.4.0/24
+    L 10.0.6.0/24 depth=2 priority=fffffffd up=2001:db8::/64
+`, b.String())
+	assert.Equal(t, "((10.0.0.0/24 10.0.2.0/24 -) 10.0.4.0/24 (10.0.6.0/24 2001:db8::/64 -))", set.TreeString())
+
+	assert.Equal(t, before, set.GetNetworks())
+	assert.Nil(t, set.Validate())
+}
+
+func TestDumpTreeEmpty(t *testing.T) {
+	var b bytes.Buffer
+	(&IPSet{}).DumpTree(&b)
+	var nilSet *IPSet
+	nilSet.DumpTree(&b)
+	assert.Equal(t, "(empty)\n(empty)\n", b.String())
+
+	assert.Equal(t, "-", (&IPSet{}).TreeString())
+	assert.Equal(t, "-", nilSet.TreeString())
+
+	set := &IPSet{}
+	set.InsertNet(Ten24)
+	assert.Equal(t, "10.0.0.0/24", set.TreeString())
+}
+
+func TestDumpTreeBroken(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.InsertNet(parse("10.0.2.0/24"))
+	top := set.tree
+	child := top.left
+	if child == nil {
+		child = top.right
+	}
+
+	// An up link that points at the wrong node
+	child.up = nil
+	var b bytes.Buffer
+	set.DumpTree(&b)
+	assert.Contains(t, b.String(), child.prefix.String()+" depth=1 priority=")
+	assert.Contains(t, b.String(), "up=- (up link mismatch)\n")
+
+	// A loop back to the top
+	child.up = top
+	child.left = top
+	b.Reset()
+	set.DumpTree(&b)
+	assert.Contains(t, b.String(), "L "+top.prefix.String()+" (loop)\n")
+	assert.Contains(t, set.TreeString(), top.prefix.String()+"!loop")
+}
@@ -0,0 +1,211 @@
+package netaddr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// The errors returned by the functions and methods of this package match one
+// of the following with errors.Is, which tells what kind of problem it is.
+// The message of the returned error gives the details.
+var (
+	// ErrInvalidIP means that an IP address doesn't parse or has an invalid
+	// length.
+	ErrInvalidIP = errors.New("invalid IP address")
+	// ErrInvalidCIDR means that a network doesn't parse or is malformed.
+	ErrInvalidCIDR = errors.New("invalid CIDR")
+	// ErrHostBitsSet means that a network has bits set in the host part of
+	// its IP.
+	ErrHostBitsSet = errors.New("host part is not zero")
+	// ErrInvalidMask means that a mask has an invalid length or isn't
+	// contiguous.
+	ErrInvalidMask = errors.New("invalid mask")
+	// ErrInvalidPrefixLength means that a prefix length doesn't fit the
+	// address family.
+	ErrInvalidPrefixLength = errors.New("invalid prefix length")
+	// ErrFamilyMismatch means that an IP or network is of the wrong IP
+	// version for the operation.
+	ErrFamilyMismatch = errors.New("IP version mismatch")
+	// ErrNotInNetwork means that an IP is not in the given network or set.
+	ErrNotInNetwork = errors.New("IP not in network")
+	// ErrEmptySet means that an operation needs at least one IP in the set.
+	ErrEmptySet = errors.New("set is empty")
+	// ErrNotAggregated means that networks are not sorted, disjoint and
+	// aggregated when they must be.
+	ErrNotAggregated = errors.New("networks are not sorted and aggregated")
+	// ErrInvalidArgument means that an argument other than an IP or a network,
+	// like a limit or a stride, is out of range.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrTooLarge means that the result would hold more IPs than allowed.
+	ErrTooLarge = errors.New("too many IPs")
+	// ErrInvalidEncoding means that the encoding of a network is malformed.
+	ErrInvalidEncoding = errors.New("invalid network encoding")
+	// ErrInvalidMAC means that a MAC address doesn't parse or has an invalid
+	// length.
+	ErrInvalidMAC = errors.New("invalid MAC address")
+	// ErrCorruptFile means that a file saved by IPSet.SaveFile is cut short
+	// or doesn't match its checksum.
+	ErrCorruptFile = errors.New("corrupt IPSet file")
+	// ErrNoFreeBlock means that a set has no block of the requested size to
+	// allocate.
+	ErrNoFreeBlock = errors.New("no free block")
+)
+
+// kindError gives an error the identity of one of the errors above without
+// changing its message.
+type kindError struct {
+	kind, err error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is the kind of the error
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// errorf formats an error like fmt.Errorf that also matches kind
+func errorf(kind error, format string, args ...interface{}) error {
+	return &kindError{kind, fmt.Errorf(format, args...)}
+}
+
+// wrapKind returns err so that it also matches kind
+func wrapKind(kind, err error) error {
+	return &kindError{kind, err}
+}
+
+// errorList is a list of errors reported together, one per line
+type errorList []error
+
+func (e errorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Is reports whether any of the errors matches target
+func (e errorList) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinErrors returns the errors as one error, or nil if there are none
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errorList(errs)
+}
+
+// FragmentLimitError is returned by the bounded differences when the exact
+// result would take more networks than allowed. It matches ErrTooLarge.
+type FragmentLimitError struct {
+	Fragments, Max int
+}
+
+func (e *FragmentLimitError) Error() string {
+	return fmt.Sprintf("difference has %d networks which is more than %d", e.Fragments, e.Max)
+}
+
+// Is reports whether target is ErrTooLarge
+func (e *FragmentLimitError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+// ValidationErrors is the error that IPSet.Validate returns, with one error
+// for each problem found, each of one of the types below.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors, so that errors.As can find them with Go 1.20
+// and later
+func (e ValidationErrors) Unwrap() []error {
+	return e
+}
+
+// The following error types describe the problems that IPSet.Validate can
+// find in the tree underlying a set. They are the elements of the
+// ValidationErrors that it returns.
+
+// LinkageError is reported when a node and its parent or child don't point
+// to each other.
+type LinkageError struct {
+	Net    *net.IPNet
+	Reason string
+}
+
+func (e *LinkageError) Error() string {
+	return "linkage error: " + e.Reason
+}
+
+// PriorityError is reported when a node outranks its parent, which means the
+// tree may not be balanced.
+type PriorityError struct {
+	Net *net.IPNet
+}
+
+func (e *PriorityError) Error() string {
+	return "heap error: node priority must not exceed up node priority"
+}
+
+// InvalidNetError is reported when a node doesn't hold a proper network. Net
+// is nil when the node has no network at all.
+type InvalidNetError struct {
+	Net *net.IPNet
+}
+
+func (e *InvalidNetError) Error() string {
+	if e.Net == nil {
+		return "each node in tree must have a network"
+	}
+	return "cidr invalid: " + e.Net.String()
+}
+
+// OrderError is reported when two consecutive nodes are out of order.
+type OrderError struct {
+	Prev, Next *net.IPNet
+}
+
+func (e *OrderError) Error() string {
+	return "nodes must be in order: " + e.Prev.IP.String() + " !< " + e.Next.IP.String()
+}
+
+// OverlapError is reported when two consecutive nodes share addresses.
+type OverlapError struct {
+	Prev, Next *net.IPNet
+}
+
+func (e *OverlapError) Error() string {
+	return "nodes must not overlap: " + e.Prev.String() + " and " + e.Next.String()
+}
+
+// UncombinedError is reported when two consecutive nodes are the halves of a
+// larger network and should have been combined into it.
+type UncombinedError struct {
+	Prev, Next *net.IPNet
+}
+
+func (e *UncombinedError) Error() string {
+	return "nodes must be combined: " + e.Prev.String() + " and " + e.Next.String()
+}
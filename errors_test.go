@@ -0,0 +1,74 @@
+package netaddr
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKinds(t *testing.T) {
+	errorOf := func(_ interface{}, err error) error { return err }
+	errorOf3 := func(_ interface{}, _ interface{}, err error) error { return err }
+	large := &IPSet{}
+	large.InsertNet(parse("10.0.0.0/16"))
+
+	cases := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"ParseIPZone", errorOf3(ParseIPZone("10.0.0.256")), ErrInvalidIP},
+		{"ParseNet syntax", errorOf(ParseNet("10.0.0.0/33")), ErrInvalidCIDR},
+		{"ParseNet host bits", errorOf(ParseNet("10.0.0.1/24")), ErrHostBitsSet},
+		{"ParseNetOrIP", errorOf(ParseNetOrIP("bogus")), ErrInvalidIP},
+		{"ParseIPStrict", errorOf(ParseIPStrict("10.1")), ErrInvalidIP},
+		{"ParseNetStrict", errorOf(ParseNetStrict("10.0.0.0/08")), ErrInvalidCIDR},
+		{"MaskFromPrefix bits", errorOf(MaskFromPrefix(8, 30)), ErrInvalidMask},
+		{"MaskFromPrefix length", errorOf(MaskFromPrefix(33, 32)), ErrInvalidPrefixLength},
+		{"ParseDottedMask", errorOf(ParseDottedMask("255.0.255.0")), ErrInvalidMask},
+		{"RoundDownToPrefix length", errorOf(RoundDownToPrefix(net.ParseIP("10.0.0.1"), 129)), ErrInvalidPrefixLength},
+		{"RoundUpToPrefix IP", errorOf3(RoundUpToPrefix(net.IP{1, 2, 3}, 8)), ErrInvalidIP},
+		{"InsertNetE nil", (&IPSet{}).InsertNetE(nil), ErrInvalidCIDR},
+		{"InsertNetE mask", (&IPSet{}).InsertNetE(&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}}), ErrInvalidMask},
+		{"InsertNetE host bits", (&IPSet{}).InsertNetE(&net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.CIDRMask(24, 32)}), ErrHostBitsSet},
+		{"NewIPSetFromSorted", errorOf(NewIPSetFromSorted([]*net.IPNet{parse("10.0.1.0/24"), parse("10.0.0.0/24")})), ErrNotAggregated},
+		{"GetAllIPs", errorOf(large.GetAllIPs(10)), ErrTooLarge},
+		{"GetAllIPs max", errorOf((&IPSet{}).GetAllIPs(-1)), ErrInvalidArgument},
+		{"WriteNetIPs", errorOf(WriteNetIPs(&bytes.Buffer{}, parse("::/64"), "", 0)), ErrTooLarge},
+		{"WriteNetIPs limit", errorOf(WriteNetIPs(&bytes.Buffer{}, parse("10.0.0.0/24"), "", -1)), ErrInvalidArgument},
+		{"ExpandNetStride start", errorOf(ExpandNetStride(parse("10.0.0.0/24"), net.ParseIP("10.0.1.0"), big.NewInt(1), 10)), ErrNotInNetwork},
+		{"ExpandNetStride stride", errorOf(ExpandNetStride(parse("10.0.0.0/24"), net.ParseIP("10.0.0.0"), big.NewInt(0), 10)), ErrInvalidArgument},
+		{"IPNetFromBytes", errorOf(IPNetFromBytes([]byte{4})), ErrInvalidEncoding},
+		{"UnmarshalNetBinary", errorOf(UnmarshalNetBinary([]byte{7, 0})), ErrInvalidEncoding},
+		{"NaturalMask IPv6", errorOf(NaturalMask(net.ParseIP("2001:db8::"))), ErrFamilyMismatch},
+		{"NaturalMask class D", errorOf(NaturalMask(net.ParseIP("224.0.0.1"))), ErrInvalidArgument},
+		{"MergeCIDRs", errorOf(MergeCIDRs([]string{"10.0.0.1/24"})), ErrHostBitsSet},
+		{"IntersectCIDRs", errorOf(IntersectCIDRs([]string{"10.0.0.0/8"}, []string{"bogus"})), ErrInvalidIP},
+		{"Scan", (&IPSet{}).Scan("10.0.0.0/8,10.0.0.1/24"), ErrHostBitsSet},
+		{"Scan type", (&IPSet{}).Scan(42), ErrInvalidArgument},
+		{"ParseMAC", errorOf(ParseMAC("01:23:45:67:89")), ErrInvalidMAC},
+	}
+	for _, c := range cases {
+		assert.NotNil(t, c.err, c.name)
+		assert.True(t, errors.Is(c.err, c.kind), "%s: %v", c.name, c.err)
+	}
+}
+
+func TestErrorKindsKeepMessage(t *testing.T) {
+	_, err := ParseNet("10.0.0.1/24")
+	assert.Equal(t, "Host part is not zero", err.Error())
+
+	_, _, err = ParseIPZone("bogus")
+	assert.Equal(t, "invalid IP address: bogus", err.Error())
+	var parseErr *net.ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, "bogus", parseErr.Text)
+
+	_, err = ParseNet("bogus")
+	assert.True(t, errors.As(err, &parseErr))
+	assert.False(t, errors.Is(err, ErrHostBitsSet))
+}
@@ -0,0 +1,43 @@
+package netaddr
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ExplainDifference describes how two sets differ, for use in tests. It
+// returns "" when they hold the same addresses. Otherwise, it returns a
+// report of three lines: the networks only in expected, the networks only in
+// actual, each aggregated and sorted like GetNetworks with the number of
+// addresses they hold, and the number of addresses actual has more than
+// expected. A nil set is the same as an empty one.
+func ExplainDifference(expected, actual *IPSet) string {
+	if expected == nil {
+		expected = &IPSet{}
+	}
+	if actual == nil {
+		actual = &IPSet{}
+	}
+	onlyExpected := expected.Difference(actual)
+	onlyActual := actual.Difference(expected)
+	if onlyExpected.tree == nil && onlyActual.tree == nil {
+		return ""
+	}
+
+	delta := big.NewInt(0).Sub(onlyActual.tree.size(), onlyExpected.tree.size())
+	sign := ""
+	if delta.Sign() > 0 {
+		sign = "+"
+	}
+	return fmt.Sprintf("only in expected: %s\nonly in actual: %s\naddress delta: %s%s\n",
+		explainNets(onlyExpected), explainNets(onlyActual), sign, delta)
+}
+
+// explainNets lists the networks in the set and counts their addresses
+func explainNets(s *IPSet) string {
+	if s.tree == nil {
+		return "(none)"
+	}
+	return fmt.Sprintf("%s (%s addresses)", strings.Join(s.String(), ", "), s.tree.size())
+}
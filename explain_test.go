@@ -0,0 +1,32 @@
+package netaddr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainDifference(t *testing.T) {
+	expected, actual := &IPSet{}, &IPSet{}
+	assert.Equal(t, "", ExplainDifference(expected, actual))
+	assert.Equal(t, "", ExplainDifference(nil, actual))
+
+	// The same addresses inserted differently
+	expected.InsertNet(parse("10.0.0.0/23"))
+	actual.InsertNet(parse("10.0.1.0/24"))
+	actual.InsertNet(parse("10.0.0.0/24"))
+	assert.Equal(t, "", ExplainDifference(expected, actual))
+
+	actual.RemoveNet(parse("10.0.0.0/25"))
+	actual.RemoveNet(parse("10.0.1.0/26"))
+	actual.InsertNet(parse("2001:db8::/126"))
+	assert.Equal(t, `only in expected: 10.0.0.0/25, 10.0.1.0/26 (192 addresses)
+only in actual: 2001:db8::/126 (4 addresses)
+address delta: -188
+`, ExplainDifference(expected, actual))
+
+	assert.Equal(t, `only in expected: (none)
+only in actual: 10.0.0.0/23 (512 addresses)
+address delta: +512
+`, ExplainDifference(nil, expected))
+}
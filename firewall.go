@@ -0,0 +1,312 @@
+package netaddr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// DefaultNftElementsPerCommand is a number of elements per command for
+// WriteNftElements that the nft CLI accepts
+const DefaultNftElementsPerCommand = 1000
+
+// familySetName returns the name of the firewall set that the networks of the
+// IP version of p go in. The kernel keeps IPv4 and IPv6 in separate sets, so
+// IPv6 networks go in the set named setName followed by "6".
+func familySetName(setName string, p ipPrefix) string {
+	if p.addrLen == net.IPv6len {
+		return setName + "6"
+	}
+	return setName
+}
+
+// appendElement appends the network p as firewall tools write it, as a
+// single IP if it has just one
+func appendElement(b []byte, p ipPrefix) []byte {
+	if p.ones == 8*p.addrLen {
+		return appendAddr(b, p.addr, p.addrLen)
+	}
+	return append(b, p.String()...)
+}
+
+// WriteNftElements writes the networks of the set to w as nft commands that
+// add them to a set in the inet filter table, like
+//
+//	add element inet filter blocklist { 10.0.0.0/8, 192.0.2.1 }
+//
+// The IPv4 networks go in the set named setName and the IPv6 networks in the
+// one named setName followed by "6", such as blocklist6. Those sets must be
+// of type ipv4_addr and ipv6_addr, with the interval flag unless the set has
+// only single IPs. The networks are written in order by address, at most
+// perCommand in each command. The nft CLI rejects commands that are too long,
+// so large sets are split across several. A perCommand of 0 puts all of the
+// elements of a set in one command. An empty set writes nothing.
+func (s *IPSet) WriteNftElements(w io.Writer, setName string, perCommand int) error {
+	if setName == "" {
+		return errorf(ErrInvalidArgument, "set name must not be empty")
+	}
+	if perCommand < 0 {
+		return errorf(ErrInvalidArgument, "elements per command must not be negative: %d", perCommand)
+	}
+	bw := bufio.NewWriter(w)
+	var line []byte
+	var name string
+	count := 0
+	for node := s.root().first(); node != nil; node = node.next() {
+		n := familySetName(setName, node.prefix)
+		if count != 0 && (count == perCommand || n != name) {
+			line = append(line, " }\n"...)
+			bw.Write(line)
+			count = 0
+		}
+		if count == 0 {
+			line = append(line[:0], "add element inet filter "...)
+			line = append(line, n...)
+			line = append(line, " { "...)
+		} else {
+			line = append(line, ", "...)
+		}
+		line = appendElement(line, node.prefix)
+		name = n
+		count++
+	}
+	if count != 0 {
+		line = append(line, " }\n"...)
+		bw.Write(line)
+	}
+	return bw.Flush()
+}
+
+// WriteIPSetRestore writes the networks of the set to w as add commands for
+// ipset restore, like
+//
+//	add blocklist 10.0.0.0/8
+//	add blocklist 192.0.2.1
+//	add blocklist6 2001:db8::/32
+//
+// The IPv4 networks go in the set named setName and the IPv6 networks in the
+// one named setName followed by "6". Those sets must already exist, or be
+// created by earlier commands in the input to ipset restore, with family
+// inet and inet6. The type must be that of the sets, hash:net or hash:ip. A
+// hash:ip set only holds single IPs, so the networks are written one IP at a
+// time, and if there are more than MaxUnlimitedWrite of those it returns an
+// error without writing anything.
+func (s *IPSet) WriteIPSetRestore(w io.Writer, setName string, setType string) error {
+	if setName == "" {
+		return errorf(ErrInvalidArgument, "set name must not be empty")
+	}
+	if setType != "hash:net" && setType != "hash:ip" {
+		return errorf(ErrInvalidArgument, "set type must be hash:net or hash:ip: %s", setType)
+	}
+	single := setType == "hash:ip"
+	if size := s.root().size(); single && size.Cmp(big.NewInt(MaxUnlimitedWrite)) > 0 {
+		return errorf(ErrTooLarge, "a hash:ip set of %s IPs is too large to write", size)
+	}
+
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for node := s.root().first(); node != nil; node = node.next() {
+		p := node.prefix
+		name := familySetName(setName, p)
+		if !single {
+			line = append(line[:0], "add "+name+" "...)
+			line = appendElement(line, p)
+			bw.Write(append(line, '\n'))
+			continue
+		}
+		addr, last := p.addr, p.last()
+		for {
+			line = append(line[:0], "add "+name+" "...)
+			line = appendAddr(line, addr, p.addrLen)
+			bw.Write(append(line, '\n'))
+			if addr == last {
+				break
+			}
+			for i := int(p.addrLen) - 1; i >= 0; i-- {
+				addr[i]++
+				if addr[i] != 0 {
+					break
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// parseElement returns the prefixes of an element of a firewall set, which is
+// an IP, a network or a range of IPs like 10.0.0.1-10.0.0.5
+func parseElement(s string) ([]ipPrefix, error) {
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		first, last, err := rangeFromRecord([]string{s[:i], s[i+1:]}, [2]int{0, 1})
+		if err != nil {
+			return nil, err
+		}
+		return rangePrefixes(first, last), nil
+	}
+	if strings.Contains(s, "/") {
+		n, err := ParseNet(s)
+		if err != nil {
+			return nil, err
+		}
+		return []ipPrefix{prefixFromNet(n)}, nil
+	}
+	ip := ParseIP(s)
+	if ip == nil {
+		return nil, wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: s})
+	}
+	return []ipPrefix{prefixFromIP(ip)}, nil
+}
+
+// ipsetTypes are the types of ipset sets that ReadIPSetSave reads
+var ipsetTypes = map[string]bool{"hash:ip": true, "hash:net": true, "bitmap:ip": true}
+
+// ReadIPSetSave reads the sets in the output of ipset save, keyed by name.
+// It reads the sets of type hash:ip, hash:net and bitmap:ip and ignores the
+// options of the sets and their entries, like timeouts and counters, except
+// that it leaves out the IPs of entries marked nomatch. It skips other lines,
+// including the sets of other types, and returns a warning for each one. It
+// returns an error, with its line number, for the first line it can't make
+// sense of, like an entry that isn't an IP, a network or a range of IPs.
+func ReadIPSetSave(r io.Reader) (map[string]*IPSet, []error, error) {
+	sets := map[string]*IPSet{}
+	nomatch := map[string]*IPSet{}
+	skipped := map[string]bool{}
+	warnings := []error{}
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "create" && fields[0] != "add" {
+			warnings = append(warnings, errorf(ErrInvalidEncoding, "line %d: skipped unknown directive %s", line, fields[0]))
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, warnings, errorf(ErrInvalidEncoding, "line %d: %s needs a set name and %s", line, fields[0],
+				map[string]string{"create": "a type", "add": "an entry"}[fields[0]])
+		}
+
+		name := fields[1]
+		if fields[0] == "create" {
+			if !ipsetTypes[fields[2]] {
+				skipped[name] = true
+				warnings = append(warnings, errorf(ErrInvalidEncoding, "line %d: skipped set %s of type %s", line, name, fields[2]))
+				continue
+			}
+			sets[name] = &IPSet{}
+			continue
+		}
+
+		if skipped[name] {
+			continue
+		}
+		set, ok := sets[name]
+		if !ok {
+			return nil, warnings, errorf(ErrInvalidEncoding, "line %d: set %s is added to before it is created", line, name)
+		}
+		prefixes, err := parseElement(fields[2])
+		if err != nil {
+			return nil, warnings, fmt.Errorf("line %d: %w", line, err)
+		}
+		for _, option := range fields[3:] {
+			if option == "nomatch" {
+				if nomatch[name] == nil {
+					nomatch[name] = &IPSet{}
+				}
+				set = nomatch[name]
+			}
+		}
+		for _, p := range prefixes {
+			set.insertPrefix(p)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, warnings, err
+	}
+
+	for name, exceptions := range nomatch {
+		sets[name] = sets[name].Difference(exceptions)
+	}
+	return sets, warnings, nil
+}
+
+// nftElementsStart matches the start of a list of elements in the output of
+// nft list, or in an add element command
+var nftElementsStart = regexp.MustCompile(`(?m)(?:\belements\s*=|^\s*add\s+element\b[^{;]*)\s*\{`)
+
+// ReadNftElements reads the set of IPs in the lists of elements in the
+// output of nft list set, or nft list ruleset, like
+//
+//	elements = { 10.0.0.0/8, 192.0.2.1,
+//		     198.51.100.1-198.51.100.9 }
+//
+// or in add element commands like those that WriteNftElements writes. The
+// elements of all of the lists go in the one set. It ignores the options of
+// the elements, like timeouts, counters and comments. It skips the elements
+// that aren't an IP, a network or a range of IPs, like concatenations, and
+// returns a warning for each one. It returns an error if a list doesn't end.
+func ReadNftElements(r io.Reader) (*IPSet, []error, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Blanking out the backslashes of continued lines keeps the line numbers
+	text := strings.ReplaceAll(string(data), "\\\n", " \n")
+
+	set := &IPSet{}
+	warnings := []error{}
+	for _, loc := range nftElementsStart.FindAllStringIndex(text, -1) {
+		line := strings.Count(text[:loc[1]], "\n") + 1
+		elements, ok := splitNftElements(text[loc[1]:])
+		if !ok {
+			return nil, warnings, errorf(ErrInvalidEncoding, "line %d: list of elements doesn't end", line)
+		}
+		for _, element := range elements {
+			fields := strings.Fields(element)
+			if len(fields) != 0 {
+				at := line + strings.Count(element[:strings.Index(element, fields[0])], "\n")
+				prefixes, err := parseElement(fields[0])
+				if err != nil || (len(fields) > 1 && fields[1] == ".") {
+					warnings = append(warnings, errorf(ErrInvalidEncoding, "line %d: skipped element %s", at, strings.Join(fields, " ")))
+				} else {
+					for _, p := range prefixes {
+						set.insertPrefix(p)
+					}
+				}
+			}
+			line += strings.Count(element, "\n")
+		}
+	}
+	return set, warnings, nil
+}
+
+// splitNftElements splits the list of elements at the start of s at the
+// commas outside of quotes up to the closing brace. It returns false if the
+// list doesn't end.
+func splitNftElements(s string) ([]string, bool) {
+	var elements []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case s[i] == ',':
+			elements = append(elements, s[start:i])
+			start = i + 1
+		case s[i] == '}':
+			return append(elements, s[start:i]), true
+		}
+	}
+	return nil, false
+}
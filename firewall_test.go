@@ -0,0 +1,212 @@
+package netaddr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func firewallTestSet() *IPSet {
+	set := &IPSet{}
+	for _, cidr := range []string{"2001:db8::/32", "10.0.0.0/8", "192.0.2.1/32", "2001:db8:ffff::1/128"} {
+		set.InsertNet(parse(cidr))
+	}
+	return set
+}
+
+func TestWriteNftElements(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, firewallTestSet().WriteNftElements(&buf, "blocklist", DefaultNftElementsPerCommand))
+	assert.Equal(t, ""+
+		"add element inet filter blocklist { 10.0.0.0/8, 192.0.2.1 }\n"+
+		"add element inet filter blocklist6 { 2001:db8::/32 }\n",
+		buf.String())
+
+	buf.Reset()
+	assert.Nil(t, (&IPSet{}).WriteNftElements(&buf, "blocklist", DefaultNftElementsPerCommand))
+	assert.Equal(t, "", buf.String())
+
+	assert.True(t, errors.Is((&IPSet{}).WriteNftElements(&buf, "", DefaultNftElementsPerCommand), ErrInvalidArgument))
+	assert.True(t, errors.Is((&IPSet{}).WriteNftElements(&buf, "blocklist", -1), ErrInvalidArgument))
+}
+
+func TestWriteNftElementsChunks(t *testing.T) {
+	set := &IPSet{}
+	for i := 0; i < 5; i++ {
+		set.Insert(ParseIP(fmt.Sprintf("10.0.0.%d", 2*i)))
+	}
+	set.Insert(ParseIP("2001:db8::1"))
+
+	var buf bytes.Buffer
+	assert.Nil(t, set.WriteNftElements(&buf, "hosts", 2))
+	assert.Equal(t, ""+
+		"add element inet filter hosts { 10.0.0.0, 10.0.0.2 }\n"+
+		"add element inet filter hosts { 10.0.0.4, 10.0.0.6 }\n"+
+		"add element inet filter hosts { 10.0.0.8 }\n"+
+		"add element inet filter hosts6 { 2001:db8::1 }\n",
+		buf.String())
+
+	buf.Reset()
+	assert.Nil(t, set.WriteNftElements(&buf, "hosts", 0))
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	assert.NotNil(t, set.WriteNftElements(&failingWriter{}, "hosts", 2))
+}
+
+func TestWriteIPSetRestore(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, firewallTestSet().WriteIPSetRestore(&buf, "blocklist", "hash:net"))
+	assert.Equal(t, ""+
+		"add blocklist 10.0.0.0/8\n"+
+		"add blocklist 192.0.2.1\n"+
+		"add blocklist6 2001:db8::/32\n",
+		buf.String())
+
+	set := &IPSet{}
+	set.InsertNet(parse("2001:db8::/126"))
+	buf.Reset()
+	assert.Nil(t, set.WriteIPSetRestore(&buf, "v6", "hash:ip"))
+	assert.Equal(t, ""+
+		"add v66 2001:db8::\n"+
+		"add v66 2001:db8::1\n"+
+		"add v66 2001:db8::2\n"+
+		"add v66 2001:db8::3\n",
+		buf.String())
+
+	buf.Reset()
+	assert.Nil(t, (&IPSet{}).WriteIPSetRestore(&buf, "empty", "hash:net"))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestWriteIPSetRestoreErrors(t *testing.T) {
+	var buf bytes.Buffer
+	set := firewallTestSet()
+	assert.True(t, errors.Is(set.WriteIPSetRestore(&buf, "", "hash:net"), ErrInvalidArgument))
+	assert.True(t, errors.Is(set.WriteIPSetRestore(&buf, "s", "list:set"), ErrInvalidArgument))
+	assert.True(t, errors.Is(set.WriteIPSetRestore(&buf, "s", "hash:ip"), ErrTooLarge))
+	assert.Equal(t, "", buf.String())
+	assert.NotNil(t, set.WriteIPSetRestore(&failingWriter{}, "s", "hash:net"))
+}
+
+func TestReadIPSetSave(t *testing.T) {
+	input := `create blocklist hash:net family inet hashsize 1024 maxelem 65536 timeout 300 counters
+add blocklist 10.0.0.0/8 timeout 120 packets 0 bytes 0
+add blocklist 10.1.0.0/16 nomatch
+add blocklist 192.0.2.1 timeout 60 packets 4 bytes 240
+create hosts hash:ip family inet6 hashsize 1024 maxelem 65536
+add hosts 2001:db8::1
+add hosts 2001:db8::2
+create ports hash:ip,port family inet hashsize 1024 maxelem 65536
+add ports 192.0.2.1,tcp:80
+create range bitmap:ip range 192.0.2.0-192.0.2.255
+add range 192.0.2.8-192.0.2.15
+
+flush blocklist
+`
+	sets, warnings, err := ReadIPSetSave(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(sets))
+	assert.Equal(t, []string{
+		"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12",
+		"10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9", "192.0.2.1/32",
+	}, sets["blocklist"].String())
+	assert.Equal(t, []string{"2001:db8::1/128", "2001:db8::2/128"}, sets["hosts"].String())
+	assert.Equal(t, []string{"192.0.2.8/29"}, sets["range"].String())
+
+	if assert.Equal(t, 2, len(warnings)) {
+		assert.Equal(t, "line 8: skipped set ports of type hash:ip,port", warnings[0].Error())
+		assert.Equal(t, "line 13: skipped unknown directive flush", warnings[1].Error())
+		assert.True(t, errors.Is(warnings[0], ErrInvalidEncoding))
+	}
+}
+
+func TestReadIPSetSaveRoundTrip(t *testing.T) {
+	set := firewallTestSet()
+	buf := bytes.NewBufferString("create blocklist hash:net family inet\ncreate blocklist6 hash:net family inet6\n")
+	assert.Nil(t, set.WriteIPSetRestore(buf, "blocklist", "hash:net"))
+	sets, warnings, err := ReadIPSetSave(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(warnings))
+	assert.Equal(t, "", ExplainDifference(set, sets["blocklist"].Union(sets["blocklist6"])))
+}
+
+func TestReadIPSetSaveErrors(t *testing.T) {
+	for _, c := range []struct {
+		in, err string
+		kind    error
+	}{
+		{"create blocklist", "line 1: create needs a set name and a type", ErrInvalidEncoding},
+		{"create s hash:ip\nadd s", "line 2: add needs a set name and an entry", ErrInvalidEncoding},
+		{"add s 10.0.0.1", "line 1: set s is added to before it is created", ErrInvalidEncoding},
+		{"create s hash:ip\nadd s 10.0.0.256", "line 2: invalid IP address: 10.0.0.256", ErrInvalidIP},
+		{"create s hash:net\nadd s 10.0.0.1/24", "line 2: ", ErrHostBitsSet},
+		{"create s hash:ip\nadd s 10.0.0.9-10.0.0.1", "line 2: range from 10.0.0.9 to 10.0.0.1 ends before it starts", ErrInvalidArgument},
+	} {
+		_, _, err := ReadIPSetSave(strings.NewReader(c.in))
+		if assert.NotNil(t, err, c.in) {
+			assert.True(t, strings.HasPrefix(err.Error(), c.err), err.Error())
+			assert.True(t, errors.Is(err, c.kind), "%s: %v", c.in, err)
+		}
+	}
+}
+
+func TestReadNftElements(t *testing.T) {
+	input := `table inet filter {
+	set blocklist {
+		type ipv4_addr
+		flags interval
+		elements = { 10.0.0.0/8, 192.0.2.1 timeout 1h expires 59m,
+			     198.51.100.1-198.51.100.9 comment "bad, bad hosts",
+			     203.0.113.7 counter packets 0 bytes 0 }
+	}
+	set blocklist6 {
+		type ipv6_addr
+		elements = { 2001:db8::/32 }
+	}
+	set services {
+		type ipv4_addr . inet_service
+		elements = { 192.0.2.1 . 80,
+			     192.0.2.2 . 443 }
+	}
+}
+add element inet filter extra \
+	{ 10.0.0.1, 172.16.0.0/12 }
+`
+	set, warnings, err := ReadNftElements(strings.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.0/8", "172.16.0.0/12", "192.0.2.1/32",
+		"198.51.100.1/32", "198.51.100.2/31", "198.51.100.4/30", "198.51.100.8/31",
+		"203.0.113.7/32", "2001:db8::/32",
+	}, set.String())
+	if assert.Equal(t, 2, len(warnings)) {
+		assert.Equal(t, "line 15: skipped element 192.0.2.1 . 80", warnings[0].Error())
+		assert.Equal(t, "line 16: skipped element 192.0.2.2 . 443", warnings[1].Error())
+	}
+}
+
+func TestReadNftElementsRoundTrip(t *testing.T) {
+	set := randomSet(rand.New(rand.NewSource(1)), 100)
+	var buf bytes.Buffer
+	assert.Nil(t, set.WriteNftElements(&buf, "s", 7))
+	read, warnings, err := ReadNftElements(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(warnings))
+	assert.Equal(t, "", ExplainDifference(set, read))
+}
+
+func TestReadNftElementsErrors(t *testing.T) {
+	_, _, err := ReadNftElements(strings.NewReader("set s {\n\telements = { 10.0.0.1,\n"))
+	assert.True(t, errors.Is(err, ErrInvalidEncoding))
+	assert.Equal(t, "line 2: list of elements doesn't end", err.Error())
+
+	set, warnings, err := ReadNftElements(strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(warnings))
+	assert.Equal(t, 0, len(set.GetNetworks()))
+}
@@ -0,0 +1,48 @@
+package netaddr
+
+import (
+	"net"
+	"strings"
+)
+
+// IPSetFlag is a flag.Value that accumulates the networks given in repeated
+// flags into an IPSet. Each value may be a CIDR, a bare IP address or a
+// comma-separated list of them. The zero value is ready to use and creates
+// the IPSet when the first value is set.
+type IPSetFlag struct {
+	IPSet *IPSet
+}
+
+// NewIPSetFlag returns an IPSetFlag that inserts into the given set
+func NewIPSetFlag(set *IPSet) *IPSetFlag {
+	return &IPSetFlag{IPSet: set}
+}
+
+// Set parses the given value and inserts its networks into the set. If any
+// of them fails to parse, it returns the parse error and inserts nothing.
+func (f *IPSetFlag) Set(value string) error {
+	nets := []*net.IPNet{}
+	for _, s := range strings.Split(value, ",") {
+		n, err := ParseNetOrIP(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		nets = append(nets, n)
+	}
+
+	if f.IPSet == nil {
+		f.IPSet = &IPSet{}
+	}
+	for _, n := range nets {
+		f.IPSet.InsertNet(n)
+	}
+	return nil
+}
+
+// String returns the networks in the set, aggregated and separated by commas
+func (f *IPSetFlag) String() string {
+	if f == nil || f.IPSet == nil {
+		return ""
+	}
+	return strings.Join(f.IPSet.String(), ",")
+}
@@ -0,0 +1,62 @@
+package netaddr
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPSetFlag(t *testing.T) {
+	f := &IPSetFlag{}
+	assert.Equal(t, "", f.String())
+
+	assert.Nil(t, f.Set("10.0.0.0/25"))
+	assert.Nil(t, f.Set("10.0.0.128/25, 192.168.0.1"))
+	assert.Nil(t, f.Set("2001:db8::/32"))
+	assert.Equal(t, "10.0.0.0/24,192.168.0.1/32,2001:db8::/32", f.String())
+	assert.Equal(t, []error{}, f.IPSet.tree.validate())
+
+	set := &IPSet{}
+	f = NewIPSetFlag(set)
+	assert.Nil(t, f.Set("10.0.0.1"))
+	assert.True(t, set.Contains(ParseIP("10.0.0.1")))
+}
+
+func TestIPSetFlagErrors(t *testing.T) {
+	f := &IPSetFlag{}
+	for _, value := range []string{"", "10.0.0.1/24", "10.0.0.0/24,bogus", "10.0.0.0/24,", "300.0.0.0"} {
+		assert.NotNil(t, f.Set(value), value)
+	}
+	// Nothing is inserted from a list that fails to parse
+	assert.Nil(t, f.IPSet)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(f, "allow", "")
+	err := fs.Parse([]string{"-allow", "10.0.0.0/8", "-allow", "bogus"})
+	assert.Equal(t, `invalid value "bogus" for flag -allow: invalid IP address: bogus`, err.Error())
+	assert.Equal(t, "10.0.0.0/8", f.String())
+}
+
+func TestIPSetFlagZone(t *testing.T) {
+	f := &IPSetFlag{}
+	assert.Nil(t, f.Set("fe80::1%eth0"))
+	assert.True(t, f.IPSet.Contains(ParseIP("fe80::1%25eth1")))
+	assert.Equal(t, "fe80::1/128", f.String())
+}
+
+func ExampleIPSetFlag() {
+	allow := &IPSetFlag{}
+	fs := flag.NewFlagSet("example", flag.ExitOnError)
+	fs.Var(allow, "allow", "networks to allow (repeatable)")
+	fs.Parse([]string{"-allow", "10.0.0.0/8", "-allow", "192.168.0.0/16,2001:db8::/32", "-allow", "203.0.113.7"})
+
+	fmt.Println(allow)
+	fmt.Println(allow.IPSet.Contains(ParseIP("10.1.2.3")))
+	// Output:
+	// 10.0.0.0/8,192.168.0.0/16,203.0.113.7/32,2001:db8::/32
+	// true
+}
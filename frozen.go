@@ -0,0 +1,133 @@
+package netaddr
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+)
+
+// FrozenIPSet is an immutable copy of an IPSet that is faster to look up.
+// It keeps the ranges of consecutive IPs in the set in sorted slices of
+// fixed-size keys, one for each IP version, and finds an IP or a network by
+// binary search without allocating. It is safe for concurrent use. The zero
+// value is an empty set.
+type FrozenIPSet struct {
+	ranges [2][]frozenRange
+}
+
+// frozenKey is an address as a 128-bit number. An IPv4 address is in lo.
+type frozenKey struct {
+	hi, lo uint64
+}
+
+// frozenRange is a range of consecutive IPs from first to last, inclusive
+type frozenRange struct {
+	first, last frozenKey
+}
+
+// keyFromAddr returns the address of the given length in bytes as a key
+func keyFromAddr(addr [16]byte, addrLen uint8) frozenKey {
+	if addrLen == net.IPv4len {
+		return frozenKey{lo: uint64(binary.BigEndian.Uint32(addr[:4]))}
+	}
+	return frozenKey{binary.BigEndian.Uint64(addr[:8]), binary.BigEndian.Uint64(addr[8:])}
+}
+
+// hostPrefix returns the key as a host prefix of the given length in bytes
+func (k frozenKey) hostPrefix(addrLen uint8) ipPrefix {
+	p := ipPrefix{addrLen: addrLen, ones: 8 * addrLen}
+	if addrLen == net.IPv4len {
+		binary.BigEndian.PutUint32(p.addr[:4], uint32(k.lo))
+	} else {
+		binary.BigEndian.PutUint64(p.addr[:8], k.hi)
+		binary.BigEndian.PutUint64(p.addr[8:], k.lo)
+	}
+	return p
+}
+
+func (k frozenKey) less(l frozenKey) bool {
+	return k.hi < l.hi || (k.hi == l.hi && k.lo < l.lo)
+}
+
+// next returns the key of the address after k. It wraps around after the
+// last IPv6 address, but not after the last IPv4 address.
+func (k frozenKey) next() frozenKey {
+	k.lo++
+	if k.lo == 0 {
+		k.hi++
+	}
+	return k
+}
+
+// familyIndex returns the index of the ranges of the prefix's IP version
+func familyIndex(p ipPrefix) int {
+	if p.addrLen == net.IPv6len {
+		return 1
+	}
+	return 0
+}
+
+// Freeze returns an immutable copy of the set for fast lookups. It takes
+// time in proportion to the number of networks in the set. Freezing a nil
+// set gives an empty one.
+func (s *IPSet) Freeze() *FrozenIPSet {
+	f := &FrozenIPSet{}
+	for node := s.root().first(); node != nil; node = node.next() {
+		p := node.prefix
+		ranges := &f.ranges[familyIndex(p)]
+		first, last := keyFromAddr(p.addr, p.addrLen), keyFromAddr(p.last(), p.addrLen)
+		if n := len(*ranges); n != 0 && (*ranges)[n-1].last.next() == first {
+			(*ranges)[n-1].last = last
+			continue
+		}
+		*ranges = append(*ranges, frozenRange{first, last})
+	}
+	return f
+}
+
+// Thaw returns a new IPSet holding the IPs in the frozen set
+func (f *FrozenIPSet) Thaw() *IPSet {
+	if f == nil {
+		return &IPSet{}
+	}
+	prefixes := []ipPrefix{}
+	for i, addrLen := range []uint8{net.IPv4len, net.IPv6len} {
+		for _, r := range f.ranges[i] {
+			prefixes = append(prefixes, rangePrefixes(r.first.hostPrefix(addrLen), r.last.hostPrefix(addrLen))...)
+		}
+	}
+	return &IPSet{tree: buildTree(prefixes)}
+}
+
+// contains returns true if the IPs from first to last of the IP version of
+// the given index are all in one range
+func (f *FrozenIPSet) contains(i int, first, last frozenKey) bool {
+	if f == nil {
+		return false
+	}
+	ranges := f.ranges[i]
+	j := sort.Search(len(ranges), func(j int) bool {
+		return !ranges[j].last.less(first)
+	})
+	return j < len(ranges) && !first.less(ranges[j].first) && !ranges[j].last.less(last)
+}
+
+// Contains returns true if the given IP is in the set
+func (f *FrozenIPSet) Contains(ip net.IP) bool {
+	if !validIPLen(ip) {
+		return false
+	}
+	p := prefixFromIP(ip)
+	k := keyFromAddr(p.addr, p.addrLen)
+	return f.contains(familyIndex(p), k, k)
+}
+
+// ContainsNet returns true if all of the IPs in the given network are in the
+// set. It returns false for a nil or malformed network.
+func (f *FrozenIPSet) ContainsNet(n *net.IPNet) bool {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return false
+	}
+	return f.contains(familyIndex(p), keyFromAddr(p.addr, p.addrLen), keyFromAddr(p.last(), p.addrLen))
+}
@@ -0,0 +1,109 @@
+package netaddr
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrozenIPSet(t *testing.T) {
+	set := &IPSet{}
+	for _, cidr := range []string{"0.0.0.0/32", "10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "192.0.2.0/24",
+		"255.255.255.255/32", "2001:db8::/64", "2001:db8:0:1::/64", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"} {
+		set.InsertNet(parse(cidr))
+	}
+	f := set.Freeze()
+
+	// Adjacent networks make up one range
+	assert.Equal(t, 4, len(f.ranges[0]))
+	assert.Equal(t, 2, len(f.ranges[1]))
+
+	for _, ip := range []string{"0.0.0.0", "10.0.0.1", "10.0.0.7", "192.0.2.128", "255.255.255.255",
+		"2001:db8::", "2001:db8:0:1:ffff:ffff:ffff:ffff", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"} {
+		assert.True(t, f.Contains(ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"0.0.0.1", "10.0.0.0", "10.0.0.8", "192.0.3.0", "255.255.255.254", "::",
+		"::a00:1", "2001:db8:0:2::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"} {
+		assert.False(t, f.Contains(ParseIP(ip)), ip)
+	}
+	assert.True(t, f.Contains(net.ParseIP("10.0.0.1")))
+	assert.False(t, f.Contains(nil))
+
+	// A network that spans two adjacent networks of the set
+	assert.True(t, f.ContainsNet(parse("10.0.0.2/31")))
+	assert.True(t, f.ContainsNet(parse("10.0.0.4/30")))
+	assert.True(t, f.ContainsNet(parse("2001:db8::/63")))
+	assert.True(t, f.ContainsNet(parse("192.0.2.0/24")))
+	assert.False(t, f.ContainsNet(parse("10.0.0.0/29")))
+	assert.False(t, f.ContainsNet(parse("192.0.2.0/23")))
+	assert.False(t, f.ContainsNet(parse("2001:db8::/62")))
+	assert.False(t, f.ContainsNet(parse("::/0")))
+	assert.False(t, f.ContainsNet(nil))
+	assert.False(t, f.ContainsNet(&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(31, 32)}))
+
+	assert.True(t, set.Equal(f.Thaw()))
+	thawed := f.Thaw()
+	thawed.Insert(ParseIP("10.0.0.0"))
+	assert.False(t, f.Contains(ParseIP("10.0.0.0")))
+}
+
+func TestFrozenIPSetEmpty(t *testing.T) {
+	var nilSet *IPSet
+	var nilFrozen *FrozenIPSet
+	for _, f := range []*FrozenIPSet{nilSet.Freeze(), (&IPSet{}).Freeze(), {}, nilFrozen} {
+		assert.False(t, f.Contains(ParseIP("10.0.0.1")))
+		assert.False(t, f.ContainsNet(parse("::/0")))
+		assert.True(t, f.Thaw().IsEmpty())
+	}
+}
+
+func TestFrozenIPSetRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(522))
+	for i := 0; i < 100; i++ {
+		set := randomSet(r, 1+r.Intn(500))
+		f := set.Freeze()
+		assert.True(t, set.Equal(f.Thaw()))
+		for j := 0; j < 100; j++ {
+			n := randomSet(r, 1).GetNetworks()[0]
+			n.Mask = net.CIDRMask(r.Intn(12)+8*len(n.IP)-12, 8*len(n.IP))
+			n.IP = n.IP.Mask(n.Mask)
+			assert.Equal(t, set.ContainsNet(n), f.ContainsNet(n), n.String())
+			assert.Equal(t, set.Contains(n.IP), f.Contains(n.IP), n.IP.String())
+		}
+	}
+}
+
+func TestFrozenIPSetNoAllocs(t *testing.T) {
+	set := randomSet(rand.New(rand.NewSource(522)), 1000)
+	f := set.Freeze()
+	ip, n := ParseIP("10.1.2.3"), parse("2001:db8::/126")
+	allocs := testing.AllocsPerRun(100, func() {
+		f.Contains(ip)
+		f.ContainsNet(n)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func benchmarkContains(b *testing.B, contains func(net.IP) bool) {
+	r := rand.New(rand.NewSource(522))
+	ips := make([]net.IP, 1024)
+	for i := range ips {
+		ips[i] = IPv4(10, byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		contains(ips[i%len(ips)])
+	}
+}
+
+func BenchmarkIPSetContains(b *testing.B) {
+	set := randomSet(rand.New(rand.NewSource(522)), 100000)
+	benchmarkContains(b, set.Contains)
+}
+
+func BenchmarkFrozenIPSetContains(b *testing.B) {
+	f := randomSet(rand.New(rand.NewSource(522)), 100000).Freeze()
+	benchmarkContains(b, f.Contains)
+}
@@ -0,0 +1,220 @@
+package netaddr
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"text/template"
+)
+
+// ReverseName returns the name of the PTR record of the given IP, like
+// "4.3.2.1.in-addr.arpa." for 1.2.3.4 or the nibble form under "ip6.arpa."
+// for IPv6.
+func ReverseName(ip net.IP) (string, error) {
+	if !validIPLen(ip) {
+		return "", errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	p := prefixFromIP(ip)
+	return string(appendReverseName(nil, p.addr, p.addrLen)), nil
+}
+
+// appendReverseName appends the name of the PTR record of the given address
+func appendReverseName(b []byte, addr [16]byte, addrLen uint8) []byte {
+	const hex = "0123456789abcdef"
+	if addrLen == net.IPv4len {
+		for i := 3; i >= 0; i-- {
+			b = appendUint(b, addr[i])
+			b = append(b, '.')
+		}
+		return append(b, "in-addr.arpa."...)
+	}
+	for i := 15; i >= 0; i-- {
+		b = append(b, hex[addr[i]&0x0f], '.', hex[addr[i]>>4], '.')
+	}
+	return append(b, "ip6.arpa."...)
+}
+
+// appendUint appends the decimal form of the given byte
+func appendUint(b []byte, v byte) []byte {
+	if v >= 100 {
+		b = append(b, '0'+v/100)
+	}
+	if v >= 10 {
+		b = append(b, '0'+v/10%10)
+	}
+	return append(b, '0'+v%10)
+}
+
+// HostRecord is the PTR record name and the host name of an IP
+type HostRecord struct {
+	IP      net.IP
+	PTRName string
+	Name    string
+}
+
+// hostData is what the host name template of a HostRecord is executed with
+type hostData struct {
+	Index    uint64
+	IP       string
+	IPDashed string
+}
+
+// hostRecorder makes the records of the hosts of a network
+type hostRecorder struct {
+	tmpl   *template.Template
+	p      ipPrefix
+	addr   [16]byte
+	last   [16]byte
+	index  uint64
+	done   bool
+	buf    bytes.Buffer
+	ipText []byte
+}
+
+func newHostRecorder(n *net.IPNet, text string) (*hostRecorder, error) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("host").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, wrapKind(ErrInvalidArgument, err)
+	}
+	r := &hostRecorder{tmpl: tmpl, p: p, addr: p.addr, last: p.last()}
+
+	// The network and broadcast addresses of IPv4 networks aren't hosts
+	if p.addrLen == net.IPv4len && p.ones < 31 {
+		r.next()
+		for i := net.IPv4len - 1; i >= 0; i-- {
+			r.last[i]--
+			if r.last[i] != 0xff {
+				break
+			}
+		}
+	}
+	return r, nil
+}
+
+// next moves on to the next host
+func (r *hostRecorder) next() {
+	if r.addr == r.last {
+		r.done = true
+		return
+	}
+	for i := int(r.p.addrLen) - 1; i >= 0; i-- {
+		r.addr[i]++
+		if r.addr[i] != 0 {
+			break
+		}
+	}
+	r.index++
+}
+
+// render executes the template for the current host and leaves the host name
+// in buf
+func (r *hostRecorder) render() error {
+	r.ipText = appendAddr(r.ipText[:0], r.addr, r.p.addrLen)
+	ip := string(r.ipText)
+	sep := "."
+	if r.p.addrLen == net.IPv6len {
+		sep = ":"
+	}
+	r.buf.Reset()
+	err := r.tmpl.Execute(&r.buf, hostData{
+		Index:    r.index,
+		IP:       ip,
+		IPDashed: strings.ReplaceAll(ip, sep, "-"),
+	})
+	if err != nil {
+		return wrapKind(ErrInvalidArgument, err)
+	}
+	return nil
+}
+
+// HostRecords returns the record of each host in the given network, in order
+// by address, up to limit records. A limit of 0 returns them all unless there
+// are more than MaxUnlimitedWrite, in which case it returns an error. The
+// PTRName of each is its ReverseName and the Name is the given text/template
+// executed with these fields:
+//
+//	{{.Index}}     the offset of the IP from the start of the network
+//	{{.IP}}        the IP, like 10.0.0.5 or 2001:db8::5
+//	{{.IPDashed}}  the IP with dashes for dots or colons, like 10-0-0-5
+//
+// The network and broadcast addresses of IPv4 networks larger than a /31
+// aren't hosts, so the first record of 10.0.0.0/24 is for 10.0.0.1 with an
+// Index of 1. An invalid template returns an error before any record is made.
+func HostRecords(n *net.IPNet, text string, limit int) ([]HostRecord, error) {
+	if limit < 0 {
+		return nil, errorf(ErrInvalidArgument, "limit must not be negative: %d", limit)
+	}
+	r, err := newHostRecorder(n, text)
+	if err != nil {
+		return nil, err
+	}
+	if size := hostCount(r.p); limit == 0 && size.Cmp(big.NewInt(MaxUnlimitedWrite)) > 0 {
+		return nil, errorf(ErrTooLarge, "a limit is required to make %s records", size)
+	}
+	var records []HostRecord
+	for ; !r.done && (limit == 0 || len(records) < limit); r.next() {
+		if err := r.render(); err != nil {
+			return nil, err
+		}
+		records = append(records, HostRecord{
+			IP:      net.IP(append([]byte{}, r.addr[:r.p.addrLen]...)),
+			PTRName: string(appendReverseName(nil, r.addr, r.p.addrLen)),
+			Name:    r.buf.String(),
+		})
+	}
+	return records, nil
+}
+
+// WriteHostRecords writes the records of the hosts in the given network, as
+// HostRecords makes them, to w one line at a time without keeping them. Each
+// line has the IP, the PTRName and the Name separated by tabs. It stops after
+// limit records. A limit of 0 writes them all unless there are more than
+// MaxUnlimitedWrite, in which case it returns an error without writing
+// anything. It returns the number of records written, including when the
+// writer returns an error.
+func WriteHostRecords(w io.Writer, n *net.IPNet, text string, limit int) (int64, error) {
+	if limit < 0 {
+		return 0, errorf(ErrInvalidArgument, "limit must not be negative: %d", limit)
+	}
+	r, err := newHostRecorder(n, text)
+	if err != nil {
+		return 0, err
+	}
+	if size := hostCount(r.p); limit == 0 && size.Cmp(big.NewInt(MaxUnlimitedWrite)) > 0 {
+		return 0, errorf(ErrTooLarge, "a limit is required to write %s records", size)
+	}
+
+	var count int64
+	var line []byte
+	for ; !r.done && (limit == 0 || count < int64(limit)); r.next() {
+		if err := r.render(); err != nil {
+			return count, err
+		}
+		line = appendAddr(line[:0], r.addr, r.p.addrLen)
+		line = append(line, '\t')
+		line = appendReverseName(line, r.addr, r.p.addrLen)
+		line = append(line, '\t')
+		line = append(line, r.buf.Bytes()...)
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// hostCount returns the number of hosts HostRecords makes for the prefix
+func hostCount(p ipPrefix) *big.Int {
+	size := p.size()
+	if p.addrLen == net.IPv4len && p.ones < 31 {
+		size.Sub(size, big.NewInt(2))
+	}
+	return size
+}
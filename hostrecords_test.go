@@ -0,0 +1,168 @@
+package netaddr
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseName(t *testing.T) {
+	name, err := ReverseName(ParseIP("192.0.2.10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.2.0.192.in-addr.arpa.", name)
+
+	name, err = ReverseName(net.ParseIP("192.0.2.10"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.2.0.192.in-addr.arpa.", name)
+
+	name, err = ReverseName(ParseIP("2001:db8::567:89ab"))
+	assert.Nil(t, err)
+	assert.Equal(t, "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", name)
+
+	_, err = ReverseName(net.IP{1, 2, 3})
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+}
+
+func TestHostRecords(t *testing.T) {
+	n, _ := ParseNet("10.0.1.0/29")
+	records, err := HostRecords(n, "host{{.Index}}-{{.IPDashed}}.example.com", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(records))
+	assert.Equal(t, HostRecord{
+		IP:      ParseIP("10.0.1.1"),
+		PTRName: "1.1.0.10.in-addr.arpa.",
+		Name:    "host1-10-0-1-1.example.com",
+	}, records[0])
+	assert.Equal(t, "10.0.1.6", records[5].IP.String())
+	assert.Equal(t, "host6-10-0-1-6.example.com", records[5].Name)
+
+	records, err = HostRecords(n, "{{.IP}}", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []HostRecord{
+		{IP: ParseIP("10.0.1.1"), PTRName: "1.1.0.10.in-addr.arpa.", Name: "10.0.1.1"},
+		{IP: ParseIP("10.0.1.2"), PTRName: "2.1.0.10.in-addr.arpa.", Name: "10.0.1.2"},
+	}, records)
+}
+
+func TestHostRecordsLimit(t *testing.T) {
+	n, _ := ParseNet("10.0.1.0/24")
+	records, err := HostRecords(n, "{{.Index}}", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 254, len(records))
+	records, err = HostRecords(n, "{{.Index}}", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	records, err = HostRecords(n, "{{.Index}}", 254)
+	assert.Nil(t, err)
+	assert.Equal(t, 254, len(records))
+
+	// More than MaxUnlimitedWrite hosts need a limit
+	n, _ = ParseNet("2001:db8::/95")
+	_, err = HostRecords(n, "{{.Index}}", 0)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	records, err = HostRecords(n, "{{.Index}}", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+}
+
+func TestHostRecordsSmallNetworks(t *testing.T) {
+	// A /31 and a /32 have no network or broadcast address
+	n, _ := ParseNet("10.0.0.0/31")
+	records, err := HostRecords(n, "{{.Index}}", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "0", records[0].Name)
+	assert.Equal(t, "10.0.0.1", records[1].IP.String())
+
+	n, _ = ParseNet("10.0.0.7/32")
+	records, err = HostRecords(n, "{{.Index}}", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "10.0.0.7", records[0].IP.String())
+}
+
+func TestHostRecordsIPv6(t *testing.T) {
+	n, _ := ParseNet("2001:db8::/126")
+	records, err := HostRecords(n, "h-{{.IPDashed}}", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, "2001:db8::", records[0].IP.String())
+	assert.Equal(t, "h-2001-db8--", records[0].Name)
+	assert.Equal(t, "h-2001-db8--3", records[3].Name)
+	assert.True(t, strings.HasPrefix(records[3].PTRName, "3.0.0.0.0.0.0.0."))
+	assert.True(t, strings.HasSuffix(records[3].PTRName, ".8.b.d.0.1.0.0.2.ip6.arpa."))
+
+	n, _ = ParseNet("2001:db8::/64")
+	records, err = HostRecords(n, "{{.Index}}", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, "2", records[2].Name)
+}
+
+func TestHostRecordsErrors(t *testing.T) {
+	n, _ := ParseNet("10.0.0.0/24")
+
+	_, err := HostRecords(n, "{{.IP}}", -1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	_, err = HostRecords(n, "{{.IP", 10)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	_, err = HostRecords(n, "{{.Hostname}}", 10)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	_, err = HostRecords(&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)}, "{{.IP}}", 10)
+	assert.NotNil(t, err)
+}
+
+func TestWriteHostRecords(t *testing.T) {
+	n, _ := ParseNet("192.168.0.0/30")
+	var buf bytes.Buffer
+	count, err := WriteHostRecords(&buf, n, "h{{.Index}}.example.com.", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, "192.168.0.1\t1.0.168.192.in-addr.arpa.\th1.example.com.\n"+
+		"192.168.0.2\t2.0.168.192.in-addr.arpa.\th2.example.com.\n", buf.String())
+
+	// It writes the same records as HostRecords
+	n, _ = ParseNet("10.0.0.0/23")
+	records, _ := HostRecords(n, "{{.IPDashed}}", 1000)
+	buf.Reset()
+	count, err = WriteHostRecords(&buf, n, "{{.IPDashed}}", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(records)), count)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, record := range records {
+		assert.Equal(t, record.IP.String()+"\t"+record.PTRName+"\t"+record.Name, lines[i])
+	}
+
+	buf.Reset()
+	count, err = WriteHostRecords(&buf, n, "{{.IP}}", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestWriteHostRecordsErrors(t *testing.T) {
+	n, _ := ParseNet("2001:db8::/64")
+	var buf bytes.Buffer
+	count, err := WriteHostRecords(&buf, n, "{{.IP}}", 0)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	assert.Equal(t, int64(0), count)
+
+	_, err = WriteHostRecords(&buf, n, "{{.IP}}", -1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	// A template that fails fails before anything is written
+	count, err = WriteHostRecords(&buf, n, "{{.Nope}}", 10)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, "", buf.String())
+
+	count, err = WriteHostRecords(&failingWriter{n: 2}, n, "{{.IP}}", 10)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -0,0 +1,208 @@
+package netaddr
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IPNet is an IP network held by value. Unlike a *net.IPNet, it is
+// comparable, so it works as a map key and in a slice without pointers to
+// check for nil. An IPv4 network has one form, whether it was made from an
+// IP in the 4 or the 16 byte form, so equal networks are ==. The zero value
+// isn't a valid network.
+type IPNet struct {
+	p ipPrefix
+}
+
+// NewIPNet returns the network with the given IP and prefix length. An IPv4
+// address in the 16 byte form is taken as IPv4, so the prefix length must be
+// at most 32 for it. It returns an error if the IP has an invalid length, the
+// prefix length doesn't fit it or the host part of the IP isn't zero.
+func NewIPNet(ip net.IP, prefixLen int) (IPNet, error) {
+	if !validIPLen(ip) {
+		return IPNet{}, errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	p := prefixFromIP(ip)
+	if prefixLen < 0 || prefixLen > p.bits() {
+		return IPNet{}, errorf(ErrInvalidPrefixLength, "invalid prefix length for %s: %d", ip, prefixLen)
+	}
+	p.ones = uint8(prefixLen)
+	if !p.valid() {
+		return IPNet{}, errorf(ErrHostBitsSet, "host part of network %s/%d is not zero", ip, prefixLen)
+	}
+	return IPNet{p}, nil
+}
+
+// ParseIPNet parses a network in CIDR notation like ParseNet
+func ParseIPNet(cidr string) (IPNet, error) {
+	n, err := ParseNet(cidr)
+	if err != nil {
+		return IPNet{}, err
+	}
+	return IPNet{prefixFromNet(n)}, nil
+}
+
+// MustParseIPNet is like ParseIPNet but panics if the network doesn't parse.
+// It is meant for networks that are known to be valid, as in tests.
+func MustParseIPNet(cidr string) IPNet {
+	n, err := ParseIPNet(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// IPNetFromNet returns the given network as an IPNet. It returns an error if
+// the network is nil or malformed like IPSet.InsertNetE does.
+func IPNetFromNet(n *net.IPNet) (IPNet, error) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return IPNet{}, err
+	}
+	return IPNet{p}, nil
+}
+
+// IsValid returns true unless the network is the zero value
+func (n IPNet) IsValid() bool {
+	return n.p.addrLen != 0
+}
+
+// Net returns the network as a new *net.IPNet, or nil for the zero value.
+// IPv4 networks are in the 4 byte form.
+func (n IPNet) Net() *net.IPNet {
+	if !n.IsValid() {
+		return nil
+	}
+	return n.p.toNet()
+}
+
+// PrefixLen returns the number of bits in the network part of the network
+func (n IPNet) PrefixLen() int {
+	return int(n.p.ones)
+}
+
+// Size returns the number of addresses in the network, including the network
+// and broadcast addresses, or 0 for the zero value
+func (n IPNet) Size() *big.Int {
+	if !n.IsValid() {
+		return big.NewInt(0)
+	}
+	return n.p.size()
+}
+
+// NetworkAddr returns the first address in the network, or nil for the zero
+// value
+func (n IPNet) NetworkAddr() net.IP {
+	if !n.IsValid() {
+		return nil
+	}
+	return n.p.ip()
+}
+
+// BroadcastAddr returns the last address in the network, or nil for the zero
+// value
+func (n IPNet) BroadcastAddr() net.IP {
+	if !n.IsValid() {
+		return nil
+	}
+	return n.p.lastIP().ip()
+}
+
+// ContainsNet returns true if m is a subset of n, including when they are
+// equal. Networks of different IP versions never contain each other.
+func (n IPNet) ContainsNet(m IPNet) bool {
+	return n.IsValid() && n.p.contains(m.p)
+}
+
+// Overlaps returns true if n and m have at least one address in common,
+// which means one of them contains the other
+func (n IPNet) Overlaps(m IPNet) bool {
+	return n.ContainsNet(m) || m.ContainsNet(n)
+}
+
+// String returns the network in CIDR notation, like 10.0.0.0/8, or "invalid
+// IPNet" for the zero value
+func (n IPNet) String() string {
+	if !n.IsValid() {
+		return "invalid IPNet"
+	}
+	return n.p.String()
+}
+
+// MarshalText implements encoding.TextMarshaler. It writes the network in
+// CIDR notation like String, or nothing for the zero value.
+func (n IPNet) MarshalText() ([]byte, error) {
+	if !n.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(n.p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It parses a network like
+// ParseIPNet, so the host part must be zero, and names the network in the
+// error if it doesn't parse. Empty text gives the zero value.
+func (n *IPNet) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*n = IPNet{}
+		return nil
+	}
+	parsed, err := ParseIPNet(string(text))
+	if err != nil {
+		return fmt.Errorf("network %q: %w", text, err)
+	}
+	*n = parsed
+	return nil
+}
+
+// Format implements fmt.Formatter. The verbs are:
+//
+//	%v, %s  the CIDR notation, like 10.0.0.0/8
+//	%#v     a Go expression, like netaddr.MustParseIPNet("10.0.0.0/8")
+//	%b      the bits, with a '|' after the network bits, like NetBinaryString
+//	%x, %X  the address in hex and the prefix length, like 0a000000/8, with
+//	        a leading 0x for %#x
+//	%d      the address as a number, like 167772160
+//
+// A width pads the result with spaces on the left, or on the right with the
+// '-' flag. The zero value formats as "invalid IPNet" for all of them but
+// %#v, which gives netaddr.IPNet{}.
+func (n IPNet) Format(f fmt.State, verb rune) {
+	var s string
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		s = "netaddr.IPNet{}"
+		if n.IsValid() {
+			s = "netaddr.MustParseIPNet(" + strconv.Quote(n.String()) + ")"
+		}
+	case verb == 'v' || verb == 's' || !n.IsValid() && strings.ContainsRune("bxXd", verb):
+		s = n.String()
+	case verb == 'b':
+		s = string(appendBinary(nil, n.p.addr, n.p.addrLen, int(n.p.ones)))
+	case verb == 'x' || verb == 'X':
+		s = hex.EncodeToString(n.p.addr[:n.p.addrLen]) + "/" + strconv.Itoa(n.PrefixLen())
+		if verb == 'X' {
+			s = strings.ToUpper(s)
+		}
+		if f.Flag('#') {
+			s = "0x" + s
+		}
+	case verb == 'd':
+		s = new(big.Int).SetBytes(n.p.addr[:n.p.addrLen]).String()
+	default:
+		s = "%!" + string(verb) + "(netaddr.IPNet=" + n.String() + ")"
+	}
+
+	if width, ok := f.Width(); ok && width > len(s) {
+		padding := strings.Repeat(" ", width-len(s))
+		if f.Flag('-') {
+			s += padding
+		} else {
+			s = padding + s
+		}
+	}
+	fmt.Fprint(f, s)
+}
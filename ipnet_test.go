@@ -0,0 +1,173 @@
+package netaddr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIPNet(t *testing.T) {
+	n, err := NewIPNet(ParseIP("10.0.0.0"), 8)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.0/8", n.String())
+	assert.Equal(t, 8, n.PrefixLen())
+
+	// Both forms of an IPv4 network are equal
+	m, err := NewIPNet(net.ParseIP("10.0.0.0"), 8)
+	assert.Nil(t, err)
+	assert.True(t, n == m)
+	m, err = IPNetFromNet(parse("::ffff:10.0.0.0/104"))
+	assert.Nil(t, err)
+	assert.True(t, n == m)
+
+	n, err = NewIPNet(ParseIP("2001:db8::"), 32)
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::/32", n.String())
+	assert.Equal(t, parse("2001:db8::/32"), n.Net())
+
+	_, err = NewIPNet(net.IP{1, 2, 3}, 8)
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+	_, err = NewIPNet(net.ParseIP("10.0.0.0"), 33)
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	_, err = NewIPNet(ParseIP("2001:db8::"), -1)
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	_, err = NewIPNet(ParseIP("10.0.0.1"), 24)
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	_, err = IPNetFromNet(nil)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
+
+func TestIPNetMethods(t *testing.T) {
+	n, _ := IPNetFromNet(parse("192.168.0.0/22"))
+	assert.Equal(t, big.NewInt(1024), n.Size())
+	assert.Equal(t, net.IP{192, 168, 0, 0}, n.NetworkAddr())
+	assert.Equal(t, net.IP{192, 168, 3, 255}, n.BroadcastAddr())
+
+	inner, _ := IPNetFromNet(parse("192.168.2.0/24"))
+	outside, _ := IPNetFromNet(parse("192.168.4.0/24"))
+	v6, _ := IPNetFromNet(parse("::/0"))
+	assert.True(t, n.ContainsNet(inner))
+	assert.True(t, n.ContainsNet(n))
+	assert.False(t, inner.ContainsNet(n))
+	assert.False(t, n.ContainsNet(outside))
+	assert.False(t, v6.ContainsNet(n))
+	assert.True(t, n.Overlaps(inner))
+	assert.True(t, inner.Overlaps(n))
+	assert.False(t, n.Overlaps(outside))
+	assert.False(t, n.Overlaps(v6))
+}
+
+func TestIPNetZero(t *testing.T) {
+	var zero IPNet
+	n, _ := IPNetFromNet(parse("0.0.0.0/0"))
+	assert.False(t, zero.IsValid())
+	assert.True(t, n.IsValid())
+	assert.Equal(t, "invalid IPNet", zero.String())
+	assert.Nil(t, zero.Net())
+	assert.Equal(t, big.NewInt(0), zero.Size())
+	assert.Nil(t, zero.NetworkAddr())
+	assert.Nil(t, zero.BroadcastAddr())
+	assert.False(t, zero.ContainsNet(zero))
+	assert.False(t, n.ContainsNet(zero))
+	assert.False(t, zero.Overlaps(n))
+}
+
+func TestIPNetMapKey(t *testing.T) {
+	counts := map[IPNet]int{}
+	for _, cidr := range []string{"10.0.0.0/8", "::ffff:10.0.0.0/104", "10.0.0.0/16", "2001:db8::/32"} {
+		n, _ := IPNetFromNet(parse(cidr))
+		counts[n]++
+	}
+	n, _ := NewIPNet(IPv4(10, 0, 0, 0), 8)
+	assert.Equal(t, 3, len(counts))
+	assert.Equal(t, 2, counts[n])
+}
+
+func TestParseIPNet(t *testing.T) {
+	n, err := ParseIPNet("10.0.0.0/8")
+	assert.Nil(t, err)
+	assert.Equal(t, MustParseIPNet("10.0.0.0/8"), n)
+	_, err = ParseIPNet("10.0.0.1/8")
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	assert.Panics(t, func() { MustParseIPNet("bogus") })
+}
+
+func TestIPNetMarshalText(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32", "::/0"} {
+		text, err := MustParseIPNet(cidr).MarshalText()
+		assert.Nil(t, err)
+		assert.Equal(t, cidr, string(text))
+		var n IPNet
+		assert.Nil(t, n.UnmarshalText(text))
+		assert.Equal(t, MustParseIPNet(cidr), n)
+	}
+	text, err := IPNet{}.MarshalText()
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(text))
+
+	n := MustParseIPNet("10.0.0.0/8")
+	assert.Nil(t, n.UnmarshalText(nil))
+	assert.Equal(t, IPNet{}, n)
+
+	n = MustParseIPNet("10.0.0.0/8")
+	err = n.UnmarshalText([]byte("10.0.0.1/8"))
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	assert.True(t, strings.Contains(err.Error(), "10.0.0.1/8"), err.Error())
+	err = n.UnmarshalText([]byte("bogus"))
+	assert.True(t, strings.Contains(err.Error(), "bogus"), err.Error())
+	assert.Equal(t, MustParseIPNet("10.0.0.0/8"), n)
+
+	// As a map key in JSON
+	data, err := json.Marshal(map[IPNet]string{MustParseIPNet("10.0.0.0/8"): "lan"})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"10.0.0.0/8":"lan"}`, string(data))
+	var names map[IPNet]string
+	assert.Nil(t, json.Unmarshal(data, &names))
+	assert.Equal(t, "lan", names[MustParseIPNet("10.0.0.0/8")])
+}
+
+func TestIPNetFormat(t *testing.T) {
+	v4 := MustParseIPNet("10.0.0.0/12")
+	v6 := MustParseIPNet("2001:db8::/32")
+	var zero IPNet
+	for _, c := range []struct {
+		format   string
+		n        IPNet
+		expected string
+	}{
+		{"%v", v4, "10.0.0.0/12"},
+		{"%s", v6, "2001:db8::/32"},
+		{"%#v", v4, `netaddr.MustParseIPNet("10.0.0.0/12")`},
+		{"%#v", zero, "netaddr.IPNet{}"},
+		{"%b", v4, "00001010.0000|0000.00000000.00000000"},
+		{"%b", MustParseIPNet("0.0.0.0/0"), "|00000000.00000000.00000000.00000000"},
+		{"%x", v4, "0a000000/12"},
+		{"%X", MustParseIPNet("172.16.0.0/12"), "AC100000/12"},
+		{"%#x", v4, "0x0a000000/12"},
+		{"%x", v6, "20010db8000000000000000000000000/32"},
+		{"%d", v4, "167772160"},
+		{"%d", v6, "42540766411282592856903984951653826560"},
+		{"%d", MustParseIPNet("0.0.0.0/0"), "0"},
+		{"%20v", v4, "         10.0.0.0/12"},
+		{"%-20s|", v4, "10.0.0.0/12         |"},
+		{"%5v", v4, "10.0.0.0/12"},
+		{"%14d", v4, "     167772160"},
+		{"%v", zero, "invalid IPNet"},
+		{"%x", zero, "invalid IPNet"},
+		{"%q", v4, "%!q(netaddr.IPNet=10.0.0.0/12)"},
+		{"%t", zero, "%!t(netaddr.IPNet=invalid IPNet)"},
+	} {
+		assert.Equal(t, c.expected, fmt.Sprintf(c.format, c.n), c.format)
+	}
+
+	// Pointers and containers format the same way
+	assert.Equal(t, "10.0.0.0/12", fmt.Sprintf("%v", &v4))
+	assert.Equal(t, "[10.0.0.0/12 2001:db8::/32]", fmt.Sprintf("%v", []IPNet{v4, v6}))
+	assert.Equal(t, "map[10.0.0.0/12:1]", fmt.Sprintf("%v", map[IPNet]int{v4: 1}))
+}
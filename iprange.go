@@ -2,7 +2,9 @@ package netaddr
 
 import (
 	"fmt"
+	"math/big"
 	"net"
+	"strings"
 )
 
 // IPRange range of ips not necessarily aligned to a power of 2
@@ -14,6 +16,26 @@ func (r *IPRange) String() string {
 	return fmt.Sprintf("[%s,%s]", r.First, r.Last)
 }
 
+// ParseIPRange parses a range of IPs written as the first and the last
+// separated by a dash, like "10.0.0.5-10.0.0.73". The IPs must be of the same
+// version with the first not after the last.
+func ParseIPRange(s string) (*IPRange, error) {
+	dash := strings.Index(s, "-")
+	if dash < 0 {
+		return nil, errorf(ErrInvalidArgument, "IP range %q is not two IPs separated by a dash", s)
+	}
+	r := &IPRange{First: ParseIP(strings.TrimSpace(s[:dash])), Last: ParseIP(strings.TrimSpace(s[dash+1:]))}
+	for _, ip := range []net.IP{r.First, r.Last} {
+		if ip == nil {
+			return nil, wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address range", Text: s})
+		}
+	}
+	if _, _, err := rangeBounds(r.First, r.Last); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 // IPRangeFromIPNet get an IPRange from an *ip.Net
 func IPRangeFromIPNet(cidr *net.IPNet) *IPRange {
 	return &IPRange{
@@ -26,11 +48,15 @@ func IPRangeFromIPNet(cidr *net.IPNet) *IPRange {
 func (r *IPRange) Minus(b *IPRange) []*IPRange {
 	diff := []*IPRange{}
 	if IPLessThan(r.First, b.First) {
-		diff = append(diff, &IPRange{First: r.First, Last: IPMin(r.Last, decrementIP(b.First))})
+		// b.First can't be the first IP so this doesn't underflow
+		prev, _ := decrementIP(b.First)
+		diff = append(diff, &IPRange{First: r.First, Last: IPMin(r.Last, prev)})
 	}
 
 	if IPLessThan(b.Last, r.Last) {
-		diff = append(diff, &IPRange{First: IPMax(r.First, incrementIP(b.Last)), Last: r.Last})
+		// b.Last can't be the last IP so this doesn't overflow
+		next, _ := incrementIP(b.Last)
+		diff = append(diff, &IPRange{First: IPMax(r.First, next), Last: r.Last})
 	}
 	return diff
 }
@@ -43,3 +69,39 @@ func (r *IPRange) Contains(b *IPRange) bool {
 	}
 	return false
 }
+
+// Size returns the number of IPs in the range, or 0 if the range isn't valid
+func (r *IPRange) Size() *big.Int {
+	first, last, err := rangeBounds(r.First, r.Last)
+	if err != nil {
+		return big.NewInt(0)
+	}
+	size := addrToInt(last)
+	size.Sub(size, addrToInt(first))
+	return size.Add(size, big.NewInt(1))
+}
+
+// ContainsIP returns true if the given IP is in the range
+func (r *IPRange) ContainsIP(ip net.IP) bool {
+	first, last, err := rangeBounds(r.First, r.Last)
+	if err != nil || !validIPLen(ip) {
+		return false
+	}
+	p := prefixFromIP(ip)
+	return first.compare(p) <= 0 && p.compare(last) <= 0
+}
+
+// ToIPNets returns the fewest networks that together hold exactly the IPs in
+// the range, in order by address, or nil if the range isn't valid
+func (r *IPRange) ToIPNets() []*net.IPNet {
+	first, last, err := rangeBounds(r.First, r.Last)
+	if err != nil {
+		return nil
+	}
+	prefixes := rangePrefixes(first, last)
+	nets := make([]*net.IPNet, len(prefixes))
+	for i, p := range prefixes {
+		nets[i] = p.toNet()
+	}
+	return nets
+}
@@ -1,7 +1,10 @@
 package netaddr
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -88,3 +91,88 @@ func TestIPRangeContains(t *testing.T) {
 		}
 	}
 }
+
+func TestParseIPRange(t *testing.T) {
+	r, err := ParseIPRange("10.0.0.5-10.0.0.73")
+	assert.Nil(t, err)
+	assert.Equal(t, "[10.0.0.5,10.0.0.73]", r.String())
+	assert.Equal(t, big.NewInt(69), r.Size())
+
+	r, err = ParseIPRange(" 2001:db8::1 - 2001:db8::ffff ")
+	assert.Nil(t, err)
+	assert.Equal(t, "[2001:db8::1,2001:db8::ffff]", r.String())
+	assert.Equal(t, big.NewInt(0xffff), r.Size())
+
+	for _, c := range []struct {
+		s    string
+		kind error
+	}{
+		{"10.0.0.5", ErrInvalidArgument},
+		{"10.0.0.5-", ErrInvalidIP},
+		{"10.0.0.5-10.0.0.256", ErrInvalidIP},
+		{"10.0.0.5-10.0.0.7-10.0.0.9", ErrInvalidIP},
+		{"10.0.0.5-10.0.0.4", ErrInvalidArgument},
+		{"10.0.0.5-2001:db8::1", ErrFamilyMismatch},
+	} {
+		_, err := ParseIPRange(c.s)
+		assert.True(t, errors.Is(err, c.kind), "%s: %v", c.s, err)
+	}
+}
+
+func TestIPRangeSize(t *testing.T) {
+	r := &IPRange{ParseIP("::"), ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")}
+	assert.Equal(t, big.NewInt(0).Lsh(big.NewInt(1), 128), r.Size())
+	r = &IPRange{ParseIP("10.0.0.1"), ParseIP("10.0.0.1")}
+	assert.Equal(t, big.NewInt(1), r.Size())
+
+	// Invalid ranges are empty
+	assert.Equal(t, big.NewInt(0), (&IPRange{ParseIP("10.0.0.2"), ParseIP("10.0.0.1")}).Size())
+	assert.Equal(t, big.NewInt(0), (&IPRange{ParseIP("10.0.0.2"), nil}).Size())
+	assert.Equal(t, big.NewInt(0), (&IPRange{ParseIP("10.0.0.2"), ParseIP("::1")}).Size())
+}
+
+func TestIPRangeContainsIP(t *testing.T) {
+	r, _ := ParseIPRange("10.0.0.5-10.0.0.73")
+	assert.True(t, r.ContainsIP(ParseIP("10.0.0.5")))
+	assert.True(t, r.ContainsIP(net.ParseIP("10.0.0.40")))
+	assert.True(t, r.ContainsIP(ParseIP("10.0.0.73")))
+	assert.False(t, r.ContainsIP(ParseIP("10.0.0.4")))
+	assert.False(t, r.ContainsIP(ParseIP("10.0.0.74")))
+	assert.False(t, r.ContainsIP(ParseIP("::a00:28")))
+	assert.False(t, r.ContainsIP(nil))
+
+	r, _ = ParseIPRange("2001:db8::1-2001:db8::ffff")
+	assert.True(t, r.ContainsIP(ParseIP("2001:db8::1")))
+	assert.False(t, r.ContainsIP(ParseIP("2001:db8::1:0")))
+	assert.False(t, r.ContainsIP(ParseIP("10.0.0.1")))
+}
+
+func TestIPRangeToIPNets(t *testing.T) {
+	for _, c := range []struct {
+		r    string
+		nets []string
+	}{
+		{"10.0.0.5-10.0.0.73", []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/29", "10.0.0.72/31"}},
+		{"10.0.0.0-10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.7-10.0.0.7", []string{"10.0.0.7/32"}},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+		{"9.255.255.255-10.0.0.0", []string{"9.255.255.255/32", "10.0.0.0/32"}},
+		{"2001:db8::1-2001:db8::ffff", []string{"2001:db8::1/128", "2001:db8::2/127", "2001:db8::4/126", "2001:db8::8/125", "2001:db8::10/124", "2001:db8::20/123", "2001:db8::40/122", "2001:db8::80/121", "2001:db8::100/120", "2001:db8::200/119", "2001:db8::400/118", "2001:db8::800/117", "2001:db8::1000/116", "2001:db8::2000/115", "2001:db8::4000/114", "2001:db8::8000/113"}},
+		{"::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", nil},
+	} {
+		r, err := ParseIPRange(c.r)
+		assert.Nil(t, err)
+		nets := r.ToIPNets()
+		if c.nets != nil {
+			assert.Equal(t, c.nets, netStrings(nets), c.r)
+		} else {
+			assert.Equal(t, 128, len(nets))
+		}
+		size := big.NewInt(0)
+		for _, n := range nets {
+			size.Add(size, NetSize(n))
+		}
+		assert.Equal(t, r.Size(), size, c.r)
+	}
+	assert.Nil(t, (&IPRange{ParseIP("10.0.0.2"), ParseIP("10.0.0.1")}).ToIPNets())
+}
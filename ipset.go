@@ -1,149 +1,876 @@
 package netaddr
 
 import (
+	"fmt"
+	"math/big"
 	"net"
+	"sort"
+	"strings"
 )
 
-// IPSet is a set of IP addresses
+// IPSet is a set of IP addresses. The zero value is an empty set. A nil
+// *IPSet can be read like an empty set, but not changed.
 type IPSet struct {
-	tree *ipTree
+	tree     *ipTree
+	observer Observer
 }
 
-// InsertNet ensures this IPSet has the entire given IP network
-func (s *IPSet) InsertNet(net *net.IPNet) {
-	if net == nil {
-		return
+// NewIPSetFromSorted returns a new IPSet holding the given networks, which
+// must already be in the order and the aggregated form that GetNetworks
+// returns them in: sorted, disjoint and with no two networks that could be
+// combined into one. Given such input, it builds the set in linear time
+// instead of inserting the networks one by one. It returns an error if the
+// input doesn't meet these conditions.
+func NewIPSetFromSorted(nets []*net.IPNet) (*IPSet, error) {
+	prefixes := make([]ipPrefix, len(nets))
+	for i, n := range nets {
+		p, err := checkedPrefixFromNet(n)
+		if err != nil {
+			return nil, fmt.Errorf("network %d: %w", i, err)
+		}
+		if i > 0 {
+			prev := prefixes[i-1]
+			if prev.compare(p) >= 0 {
+				return nil, errorf(ErrNotAggregated, "network %d (%s) is out of order", i, n)
+			}
+			if prev.contains(p) {
+				return nil, errorf(ErrNotAggregated, "network %d (%s) overlaps %s", i, n, prev)
+			}
+			if _, ok := prev.combine(p); ok {
+				return nil, errorf(ErrNotAggregated, "network %d (%s) can be combined with %s", i, n, prev)
+			}
+		}
+		prefixes[i] = p
 	}
+	return &IPSet{tree: buildTree(prefixes)}, nil
+}
 
-	newNet := net
-	for {
-		newNode := &ipTree{net: newNet}
-		s.tree = s.tree.insert(newNode)
+// NewIPSetFromStrings returns a new IPSet holding the given networks, each a
+// CIDR or a single IP. If any of them fails to parse, it returns no set and
+// an error listing all of those that don't, with their indexes.
+func NewIPSetFromStrings(cidrs []string) (*IPSet, error) {
+	set, errs := setFromCIDRs("cidrs", cidrs)
+	if len(errs) != 0 {
+		return nil, joinErrors(errs)
+	}
+	return set, nil
+}
 
-		if s.tree != newNode && newNode.up == nil {
-			break
+// NewIPSet returns a new IPSet holding the given networks, like
+// NewIPSetFromNets. It takes them as a *net.IPNet, as from net.ParseCIDR,
+// like the other functions of this package that take networks.
+func NewIPSet(nets ...*net.IPNet) *IPSet {
+	return NewIPSetFromNets(nets)
+}
+
+// NewIPSetFromNets returns a new IPSet holding the given networks, which may
+// be in any order and overlap. It ignores a network which is nil or
+// malformed like InsertNet does. Rather than inserting the networks one by
+// one, it sorts them and builds the set in one pass, which is much faster
+// for long lists.
+func NewIPSetFromNets(nets []*net.IPNet) *IPSet {
+	prefixes := make([]ipPrefix, 0, len(nets))
+	for _, n := range nets {
+		if p, err := checkedPrefixFromNet(n); err == nil {
+			prefixes = append(prefixes, p)
 		}
+	}
+	return &IPSet{tree: buildTree(aggregatePrefixes(prefixes))}
+}
 
-		// The new node was inserted. See if it can be combined with the previous and/or next ones
-		prev := newNode.prev()
-		if prev != nil {
-			if ok, n := canCombineNets(prev.net, newNet); ok {
-				newNet = n
+// aggregatePrefixes sorts the given prefixes in place and returns them in the
+// form that buildTree takes: in order, disjoint and with no two that could be
+// combined. It reuses the slice.
+func aggregatePrefixes(prefixes []ipPrefix) []ipPrefix {
+	// A prefix comes before the ones it contains
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].compare(prefixes[j]); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].ones < prefixes[j].ones
+	})
+	result := prefixes[:0]
+	for _, p := range prefixes {
+		if len(result) != 0 && result[len(result)-1].contains(p) {
+			continue
+		}
+		result = append(result, p)
+		for len(result) > 1 {
+			parent, ok := result[len(result)-2].combine(result[len(result)-1])
+			if !ok {
+				break
 			}
+			result = result[:len(result)-1]
+			result[len(result)-1] = parent
 		}
-		next := newNode.next()
-		if next != nil {
-			if ok, n := canCombineNets(newNet, next.net); ok {
-				newNet = n
+	}
+	return result
+}
+
+// InsertNet ensures this IPSet has the entire given IP network. It ignores a
+// network which is nil or malformed. Use InsertNetE to find out why.
+func (s *IPSet) InsertNet(net *net.IPNet) {
+	s.InsertNetE(net)
+}
+
+// InsertNetE is like InsertNet except that it returns an error, leaving the
+// set alone, if the network is nil or malformed: the IP and mask must be 4
+// or 16 bytes long, the mask must be contiguous and the host part of the IP
+// must be zero.
+func (s *IPSet) InsertNetE(net *net.IPNet) error {
+	p, err := checkedPrefixFromNet(net)
+	if err != nil {
+		return err
+	}
+	s.insertPrefix(p)
+	return nil
+}
+
+// insertPrefix adds the given prefix to the tree and aggregates it with its
+// neighbors.
+func (s *IPSet) insertPrefix(p ipPrefix) {
+	if s.observer != nil {
+		delta := p.size()
+		defer s.sizeChanged(p.family(), delta.Sub(delta, s.tree.overlap(p)))
+	}
+
+	node := &ipTree{prefix: p}
+	s.tree = s.tree.insert(node)
+	if s.tree != node && node.up == nil {
+		// The network was already in the set
+		return
+	}
+
+	// The new node was inserted. Combine it with the previous and/or next
+	// ones in place for as long as they are its siblings.
+	for {
+		if prev := node.prev(); prev != nil {
+			if p, ok := prev.prefix.combine(node.prefix); ok {
+				s.tree, node = s.tree.merge(prev, node, p)
+				continue
 			}
 		}
-		if newNet == newNode.net {
-			break
+		if next := node.next(); next != nil {
+			if p, ok := node.prefix.combine(next.prefix); ok {
+				s.tree, node = s.tree.merge(node, next, p)
+				continue
+			}
 		}
+		return
 	}
 }
 
+// removePrefix removes the IPs in the given prefix from the tree
+func (s *IPSet) removePrefix(p ipPrefix) {
+	if s.observer != nil {
+		delta := s.tree.overlap(p)
+		defer s.sizeChanged(p.family(), delta.Neg(delta))
+	}
+	s.tree = s.tree.removePrefix(p)
+}
+
 // RemoveNet ensures that all of the IPs in the given network are removed from
 // the set if present.
 func (s *IPSet) RemoveNet(net *net.IPNet) {
-	if net == nil {
-		return
+	s.RemoveNetE(net)
+}
+
+// RemoveNetE is like RemoveNet except that it returns an error, leaving the
+// set alone, if the network is nil or malformed like InsertNetE does.
+func (s *IPSet) RemoveNetE(net *net.IPNet) error {
+	p, err := checkedPrefixFromNet(net)
+	if err != nil {
+		return err
+	}
+	s.removePrefix(p)
+	return nil
+}
+
+// InsertRange ensures this IPSet has all of the IPs from start to end,
+// inclusive. It returns an error, leaving the set alone, if they aren't IPs
+// of the same version or end is before start.
+func (s *IPSet) InsertRange(start, end net.IP) error {
+	first, last, err := rangeBounds(start, end)
+	if err != nil {
+		return err
+	}
+	for _, p := range rangePrefixes(first, last) {
+		s.insertPrefix(p)
+	}
+	return nil
+}
+
+// RemoveRange ensures that all of the IPs from start to end, inclusive, are
+// removed from the set if present. It returns an error, leaving the set
+// alone, if they aren't IPs of the same version or end is before start.
+func (s *IPSet) RemoveRange(start, end net.IP) error {
+	first, last, err := rangeBounds(start, end)
+	if err != nil {
+		return err
+	}
+	for _, p := range rangePrefixes(first, last) {
+		s.removePrefix(p)
 	}
+	return nil
+}
+
+// PopFirst removes the first IP in the set, in the order of GetIPs, and
+// returns it. IPv4 addresses come before IPv6 ones. It returns false if the
+// set is empty.
+func (s *IPSet) PopFirst() (net.IP, bool) {
+	node := s.root().first()
+	if node == nil {
+		return nil, false
+	}
+	return s.popHost(node.prefix.addr, node.prefix.addrLen), true
+}
 
-	s.tree = s.tree.removeNet(net)
+// PopFirstInNet is like PopFirst for the first IP of the set in the given
+// network. It returns false if there is none or the network is nil or
+// malformed.
+func (s *IPSet) PopFirstInNet(n *net.IPNet) (net.IP, bool) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return nil, false
+	}
+	if s.root().contains(p) {
+		return s.popHost(p.addr, p.addrLen), true
+	}
+	node := s.root().lowerBound(p)
+	if node == nil || !p.contains(node.prefix) {
+		return nil, false
+	}
+	return s.popHost(node.prefix.addr, node.prefix.addrLen), true
 }
 
-// ContainsNet returns true iff this IPSet contains all IPs in the given network
+// AllocateCIDR removes the first network of the given prefix length that is
+// all in the set, among those of the given IP version, 4 or 6, and returns
+// it. It returns an error that matches ErrNoFreeBlock, and tells the
+// observer, if there is no such network, and one that matches
+// ErrInvalidPrefixLength if the prefix length doesn't fit the IP version.
+func (s *IPSet) AllocateCIDR(prefixLen int, version int) (*net.IPNet, error) {
+	var addrLen uint8
+	switch version {
+	case 4:
+		addrLen = net.IPv4len
+	case 6:
+		addrLen = net.IPv6len
+	default:
+		return nil, errorf(ErrInvalidArgument, "IP version must be 4 or 6: %d", version)
+	}
+	if prefixLen < 0 || prefixLen > 8*int(addrLen) {
+		return nil, errorf(ErrInvalidPrefixLength, "invalid prefix length for IPv%d: %d", version, prefixLen)
+	}
+
+	// A free network is all in one network of the set since the set is
+	// aggregated, so the first one that is large enough starts with it
+	v := IPSetView{set: s, addrLen: addrLen}
+	for node := v.first(); node != nil && node.prefix.addrLen == addrLen; node = node.next() {
+		if int(node.prefix.ones) <= prefixLen {
+			p := node.prefix
+			p.ones = uint8(prefixLen)
+			s.removePrefix(p)
+			return p.toNet(), nil
+		}
+	}
+	if s != nil && s.observer != nil {
+		s.observer.AllocationFailed(prefixLen)
+	}
+	return nil, errorf(ErrNoFreeBlock, "no free /%d of IPv%d in the set", prefixLen, version)
+}
+
+// popHost removes the given IP, which must be in the set, and returns it
+func (s *IPSet) popHost(addr [16]byte, addrLen uint8) net.IP {
+	host := ipPrefix{addr: addr, addrLen: addrLen, ones: 8 * addrLen}
+	s.removePrefix(host)
+	return host.ip()
+}
+
+// InsertNetDelta inserts the given network like InsertNet and returns the
+// networks of IPs that weren't in the set before, which is the given network
+// less the parts of it that were. They are in the order of GetNetworks and
+// as few as can be. It returns nil if the set already had all of the IPs or
+// the network is nil or malformed.
+func (s *IPSet) InsertNetDelta(n *net.IPNet) []*net.IPNet {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil || s.tree.contains(p) {
+		return nil
+	}
+	added := &IPSet{}
+	added.insertPrefix(p)
+	for node := s.tree.lowerBound(p); node != nil && p.contains(node.prefix); node = node.next() {
+		added.removePrefix(node.prefix)
+	}
+	s.insertPrefix(p)
+	return added.GetNetworks()
+}
+
+// RemoveNetDelta removes the given network like RemoveNet and returns the
+// networks of IPs that were in the set before, which is the given network
+// less the parts of it that weren't. They are in the order of GetNetworks and
+// as few as can be. It returns nil if the set had none of the IPs or the
+// network is nil or malformed.
+func (s *IPSet) RemoveNetDelta(n *net.IPNet) []*net.IPNet {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return nil
+	}
+	var removed []*net.IPNet
+	if s.root().contains(p) {
+		removed = []*net.IPNet{p.toNet()}
+	} else {
+		for node := s.root().lowerBound(p); node != nil && p.contains(node.prefix); node = node.next() {
+			removed = append(removed, node.prefix.toNet())
+		}
+	}
+	if removed != nil {
+		s.removePrefix(p)
+	}
+	return removed
+}
+
+// ContainsNet returns true iff this IPSet contains all IPs in the given network.
+// It returns false for a nil or malformed network.
 func (s *IPSet) ContainsNet(net *net.IPNet) bool {
-	if s == nil || net == nil {
-		return false
+	contains, _ := s.ContainsNetE(net)
+	return contains
+}
+
+// ContainsNetE is like ContainsNet except that it returns an error if the
+// network is nil or malformed like InsertNetE does.
+func (s *IPSet) ContainsNetE(net *net.IPNet) (bool, error) {
+	p, err := checkedPrefixFromNet(net)
+	if err != nil {
+		return false, err
 	}
-	return s.tree.contains(&ipTree{net: net})
+	if s == nil {
+		return false, nil
+	}
+	return s.tree.contains(p), nil
+}
+
+// WithinNet returns true if every IP in this IPSet is in the given network.
+// This is the inverse of ContainsNet. Otherwise, it returns false and the
+// first network in the set, in the order of GetNetworks, which isn't
+// contained by the given one. Networks of the other IP version are never
+// contained. An empty set is within any network, and nothing else is within
+// a malformed one.
+func (s *IPSet) WithinNet(n *net.IPNet) (bool, *net.IPNet) {
+	if s == nil || s.tree == nil {
+		return true, nil
+	}
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return false, s.tree.first().prefix.toNet()
+	}
+
+	// Since the networks are in order, only the first one and the first one
+	// after the end of n can be outside of it.
+	if first := s.tree.first(); !p.contains(first.prefix) {
+		return false, first.prefix.toNet()
+	}
+	last := p.lastIP()
+	node := s.tree.lowerBound(last)
+	if node != nil && node.prefix.compare(last) == 0 && p.contains(node.prefix) {
+		node = node.next()
+	}
+	if node != nil {
+		return false, node.prefix.toNet()
+	}
+	return true, nil
+}
+
+// FindOverlapping returns the networks of this IPSet, in the order of
+// GetNetworks, that have at least one IP in common with the given network.
+// That is either the one network that contains the given one or the networks
+// it contains. It returns nil if there are none, including for a network of
+// the other IP version or a malformed network.
+func (s *IPSet) FindOverlapping(n *net.IPNet) []*net.IPNet {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil || s == nil {
+		return nil
+	}
+	if node := s.tree.find(p); node != nil {
+		return []*net.IPNet{node.prefix.toNet()}
+	}
+	var nets []*net.IPNet
+	for node := s.tree.lowerBound(p); node != nil && p.contains(node.prefix); node = node.next() {
+		nets = append(nets, node.prefix.toNet())
+	}
+	return nets
+}
+
+// CountWithin returns the number of IPs of this IPSet that are in the given
+// network, which is the size of their intersection. It returns 0 for a
+// malformed network.
+func (s *IPSet) CountWithin(n *net.IPNet) *big.Int {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil || s == nil {
+		return big.NewInt(0)
+	}
+	return s.tree.overlap(p)
 }
 
 // Insert ensures this IPSet has the given IP
 func (s *IPSet) Insert(ip net.IP) {
-	s.InsertNet(ipToNet(ip))
+	if !validIPLen(ip) {
+		return
+	}
+	s.insertPrefix(prefixFromIP(ip))
 }
 
 // Remove ensures this IPSet does not contain the given IP
 func (s *IPSet) Remove(ip net.IP) {
-	s.RemoveNet(ipToNet(ip))
+	if !validIPLen(ip) {
+		return
+	}
+	s.removePrefix(prefixFromIP(ip))
 }
 
 // Contains returns true iff this IPSet contains the the given IP address
 func (s *IPSet) Contains(ip net.IP) bool {
-	return s.ContainsNet(ipToNet(ip))
+	if s == nil || !validIPLen(ip) {
+		return false
+	}
+	return s.tree.contains(prefixFromIP(ip))
+}
+
+// validIPLen returns true if the IP is 4 or 16 bytes long
+func validIPLen(ip net.IP) bool {
+	return len(ip) == net.IPv4len || len(ip) == net.IPv6len
 }
 
 // Union computes the union of this IPSet and another set. It returns the
 // result as a new set.
 func (s *IPSet) Union(other *IPSet) (newSet *IPSet) {
-	newSet = &IPSet{}
-	s.tree.walk(func(node *ipTree) {
-		newSet.InsertNet(node.net)
-	})
-	other.tree.walk(func(node *ipTree) {
-		newSet.InsertNet(node.net)
-	})
+	// Copy the larger set and insert the networks of the smaller one. Which
+	// one is smaller is found by stepping through both until one runs out.
+	larger, smaller := s, other
+	a, b := s.root().first(), other.root().first()
+	for a != nil && b != nil {
+		a, b = a.next(), b.next()
+	}
+	if a == nil {
+		larger, smaller = other, s
+	}
+	newSet = &IPSet{tree: larger.root().clone()}
+	newSet.UnionWith(smaller)
 	return
 }
 
+// UnionWith inserts all of the networks in the other set into this one
+func (s *IPSet) UnionWith(other *IPSet) {
+	if other == s {
+		return
+	}
+	other.root().walk(func(node *ipTree) {
+		s.insertPrefix(node.prefix)
+	})
+}
+
 // Difference computes the set difference between this IPSet and another one
 // It returns the result as a new set.
 func (s *IPSet) Difference(other *IPSet) (newSet *IPSet) {
 	newSet = &IPSet{}
-	s.tree.walk(func(node *ipTree) {
-		newSet.InsertNet(node.net)
+	s.root().walk(func(node *ipTree) {
+		newSet.insertPrefix(node.prefix)
 	})
-	other.tree.walk(func(node *ipTree) {
-		newSet.RemoveNet(node.net)
+	other.root().walk(func(node *ipTree) {
+		newSet.tree = newSet.tree.removePrefix(node.prefix)
 	})
 	return
 }
 
+// DifferenceBounded is like Difference except that it returns a
+// *FragmentLimitError, and no set, if the result would take more than
+// maxFragments networks.
+func (s *IPSet) DifferenceBounded(other *IPSet, maxFragments int) (*IPSet, error) {
+	if maxFragments < 0 {
+		return nil, errorf(ErrInvalidArgument, "maxFragments must not be negative: %d", maxFragments)
+	}
+	newSet := s.Difference(other)
+	if n := newSet.tree.numNodes(); n > maxFragments {
+		return nil, &FragmentLimitError{Fragments: n, Max: maxFragments}
+	}
+	return newSet, nil
+}
+
+// Complement returns a new set of the IPs in the given network that aren't
+// in this set. Instead of copying the network and removing the networks of
+// the set one by one, it cuts the network in halves, down to where each half
+// is either all in the set or has none of it. It returns an empty set for a
+// nil or malformed network.
+func (s *IPSet) Complement(universe *net.IPNet) *IPSet {
+	p, err := checkedPrefixFromNet(universe)
+	if err != nil {
+		return &IPSet{}
+	}
+	return &IPSet{tree: buildTree(s.root().gaps(p, nil))}
+}
+
 // GetIPs retrieves a slice of the first IPs in the set ordered by address up
-// to the given limit.
+// to the given limit. A limit of 0 means no limit, which isn't safe for sets
+// that may hold large IPv6 networks. Prefer GetIPsE or GetAllIPs.
 func (s *IPSet) GetIPs(limit int) (ips []net.IP) {
 	if limit == 0 {
 		limit = int(^uint(0) >> 1) // MaxInt
 	}
-	for node := s.tree.first(); node != nil; node = node.next() {
-		ips = append(ips, expandNet(node.net, limit-len(ips))...)
+	return s.getIPs(limit)
+}
+
+// GetIPsE is like GetIPs except that the limit must be positive. It returns
+// an error otherwise, so that no limit can't be asked for by mistake.
+func (s *IPSet) GetIPsE(limit int) ([]net.IP, error) {
+	if limit <= 0 {
+		return nil, errorf(ErrInvalidArgument, "limit must be positive: %d", limit)
+	}
+	return s.getIPs(limit), nil
+}
+
+// GetAllIPs returns all of the IPs in the set ordered by address. If there
+// are more than max, it returns an error without expanding any of them.
+func (s *IPSet) GetAllIPs(max int) ([]net.IP, error) {
+	if max < 0 {
+		return nil, errorf(ErrInvalidArgument, "max must not be negative: %d", max)
+	}
+	size := s.root().size()
+	if size.Cmp(big.NewInt(int64(max))) > 0 {
+		return nil, errorf(ErrTooLarge, "set has %s IPs which is more than %d", size, max)
+	}
+	return s.getIPs(int(size.Int64())), nil
+}
+
+// getIPs returns the first IPs in the set up to the given limit
+func (s *IPSet) getIPs(limit int) (ips []net.IP) {
+	for node := s.root().first(); node != nil && len(ips) < limit; node = node.next() {
+		ips = append(ips, expandNet(node.prefix.toNet(), limit-len(ips))...)
 	}
 	return
 }
 
-// GetNetworks retrieves a list of all networks included in the ipTree
+// AppendGetIPs appends the first IPs in the set ordered by address, up to
+// the given limit, to dst like AppendNetIPs and returns the extended slice
+func (s *IPSet) AppendGetIPs(dst []net.IP, limit int) []net.IP {
+	dst, _ = s.AppendGetIPsBuf(dst, nil, limit)
+	return dst
+}
+
+// AppendGetIPsBuf is like AppendGetIPs except that it appends the bytes of
+// the IPs to buf like AppendNetIPsBuf
+func (s *IPSet) AppendGetIPsBuf(dst []net.IP, buf []byte, limit int) ([]net.IP, []byte) {
+	for node := s.root().first(); node != nil && limit > 0; node = node.next() {
+		n := len(dst)
+		dst, buf = appendPrefixIPs(dst, buf, node.prefix, limit)
+		limit -= len(dst) - n
+	}
+	return dst, buf
+}
+
+// GetNetworks retrieves a list of all networks included in the ipTree, in
+// order by address. Each is a new copy which the caller may change without
+// affecting the set.
 func (s *IPSet) GetNetworks() []*net.IPNet {
 	networks := []*net.IPNet{}
-	s.tree.walk(func(node *ipTree) {
-		networks = append(networks, node.net)
+	s.root().walk(func(node *ipTree) {
+		networks = append(networks, node.prefix.toNet())
+	})
+	return networks
+}
+
+// GetIPNets is like GetNetworks except that it returns the networks as
+// IPNet values, which share nothing with the set or each other
+func (s *IPSet) GetIPNets() []IPNet {
+	networks := []IPNet{}
+	s.root().walk(func(node *ipTree) {
+		networks = append(networks, IPNet{node.prefix})
 	})
 	return networks
 }
 
+// WalkNets calls fn with each network in the set, in the order of
+// GetNetworks and String, until it returns false
+func (s *IPSet) WalkNets(fn func(*net.IPNet) bool) {
+	for node := s.root().first(); node != nil; node = node.next() {
+		if !fn(node.prefix.toNet()) {
+			return
+		}
+	}
+}
+
+// WalkIPs calls fn with each IP in the set, in order, until it returns
+// false. It doesn't expand the networks, so it can stop early in a set too
+// large for GetIPs. The IPs are carved out of buffers that are allocated a
+// few hundred bytes at a time, but none of them can grow into another, so fn
+// may keep them.
+func (s *IPSet) WalkIPs(fn func(net.IP) bool) {
+	var buf []byte
+	ok := true
+	for node := s.root().first(); node != nil && ok; node = node.next() {
+		buf, ok = walkPrefixIPs(node.prefix, buf, fn)
+	}
+}
+
+// walkPrefixIPs calls fn with each IP in the prefix like WalkIPs, carving
+// them out of buf and new buffers as needed. It returns what is left of the
+// last buffer and false if fn did.
+func walkPrefixIPs(p ipPrefix, buf []byte, fn func(net.IP) bool) ([]byte, bool) {
+	last := p.last()
+	for addr := p.addr; ; addr = incrementAddr(addr, p.addrLen) {
+		if len(buf) < int(p.addrLen) {
+			buf = make([]byte, 512)
+		}
+		ip := net.IP(buf[:p.addrLen:p.addrLen])
+		buf = buf[p.addrLen:]
+		copy(ip, addr[:p.addrLen])
+		if !fn(ip) {
+			return buf, false
+		}
+		if addr == last {
+			return buf, true
+		}
+	}
+}
+
 // Intersection computes the set intersect between this IPSet and another one
 // It returns a new set which is the intersection.
 func (s *IPSet) Intersection(set1 *IPSet) (interSect *IPSet) {
-	interSect = &IPSet{}
-	s.tree.walk(func(node *ipTree) {
-		if set1.ContainsNet(node.net) {
-			interSect.InsertNet(node.net)
+	// Walk both sets in order at once. Two networks either don't overlap or
+	// one contains the other, which is then in the intersection. Since each
+	// set is aggregated, so is the result and it comes out in order.
+	prefixes := []ipPrefix{}
+	a, b := s.root().first(), set1.root().first()
+	for a != nil && b != nil {
+		switch {
+		case a.prefix.contains(b.prefix):
+			prefixes = append(prefixes, b.prefix)
+			b = b.next()
+		case b.prefix.contains(a.prefix):
+			prefixes = append(prefixes, a.prefix)
+			a = a.next()
+		case a.prefix.compare(b.prefix) < 0:
+			a = a.next()
+		default:
+			b = b.next()
 		}
-	})
-	set1.tree.walk(func(node *ipTree) {
-		if s.ContainsNet(node.net) {
-			interSect.InsertNet(node.net)
+	}
+	return &IPSet{tree: buildTree(prefixes)}
+}
+
+// Overlaps returns true if the two sets have any IP in common. Unlike
+// Intersection, it stops at the first one without building a set.
+func (s *IPSet) Overlaps(other *IPSet) bool {
+	a, b := s.root().first(), other.root().first()
+	for a != nil && b != nil {
+		switch {
+		case a.prefix.contains(b.prefix) || b.prefix.contains(a.prefix):
+			return true
+		case a.prefix.compare(b.prefix) < 0:
+			a = a.next()
+		default:
+			b = b.next()
 		}
-	})
-	return
+	}
+	return false
+}
+
+// OverlapsNet returns true if the set has any IP in the given network. It
+// returns false for a nil or malformed network.
+func (s *IPSet) OverlapsNet(n *net.IPNet) bool {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return false
+	}
+	if s.root().contains(p) {
+		return true
+	}
+	node := s.root().lowerBound(p)
+	return node != nil && p.contains(node.prefix)
+}
+
+// Clone returns a copy of the set that changes independently of it. It
+// copies the tree as it is, without inserting the networks again. The copy
+// doesn't have the set's observer. Cloning a nil set gives an empty one.
+func (s *IPSet) Clone() *IPSet {
+	return &IPSet{tree: s.root().clone()}
+}
+
+// Clear removes all of the IPs from the set, leaving it like a new one
+// except that it keeps its observer, which is told of the IPs removed
+func (s *IPSet) Clear() {
+	s.replaceTree(nil)
+}
+
+// IsEmpty returns true if the set has no IPs, or is nil
+func (s *IPSet) IsEmpty() bool {
+	return s.root() == nil
+}
+
+// Size returns the number of IPs in the set, which is 0 for a nil set. It
+// adds up the sizes of all of the networks on every call. To keep track of
+// the size as the set changes, such as for metrics, use an Observer.
+func (s *IPSet) Size() *big.Int {
+	return s.root().size()
+}
+
+// root returns the tree underlying the set, which is nil for a nil set
+func (s *IPSet) root() *ipTree {
+	if s == nil {
+		return nil
+	}
+	return s.tree
+}
+
+// Equal returns true if the two sets hold the same IPs. A nil set is the same
+// as an empty one.
+func (s *IPSet) Equal(other *IPSet) bool {
+	a, b := s.root().first(), other.root().first()
+	for ; a != nil && b != nil; a, b = a.next(), b.next() {
+		if a.prefix.compare(b.prefix) != 0 || a.prefix.ones != b.prefix.ones {
+			return false
+		}
+	}
+	return a == nil && b == nil
+}
+
+// IsSubsetOf returns true if every IP in this set is also in the other one. It
+// is true for equal sets and for an empty set. A nil set is the same as an
+// empty one.
+func (s *IPSet) IsSubsetOf(other *IPSet) bool {
+	// Since the other set is aggregated, a network of this set is covered
+	// only if one network of the other contains it
+	b := other.root().first()
+	for a := s.root().first(); a != nil; a = a.next() {
+		for b != nil && !b.prefix.contains(a.prefix) && b.prefix.compare(a.prefix) < 0 {
+			b = b.next()
+		}
+		if b == nil || !b.prefix.contains(a.prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSupersetOf returns true if every IP in the other set is also in this one
+func (s *IPSet) IsSupersetOf(other *IPSet) bool {
+	return other.IsSubsetOf(s)
 }
 
 // String returns a list of IP Networks
 func (s *IPSet) String() (str []string) {
-	for node := s.tree.first(); node != nil; node = node.next() {
-		str = append(str, node.net.String())
+	for node := s.root().first(); node != nil; node = node.next() {
+		str = append(str, node.prefix.String())
 	}
 	return
 }
+
+// MarshalText implements encoding.TextMarshaler. It writes the networks in
+// the set separated by commas, like "10.0.0.0/24,2001:db8::/64".
+func (s *IPSet) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(s.String(), ",")), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It parses networks
+// separated by commas, newlines or both, and replaces the contents of the
+// set with them. Each may be a CIDR or a single IP. Blank ones are skipped.
+// If any of them fails to parse, it returns an error that names it and
+// leaves the set alone.
+func (s *IPSet) UnmarshalText(text []byte) error {
+	set := &IPSet{}
+	tokens := strings.FieldsFunc(string(text), func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		n, err := ParseNetOrIP(token)
+		if err != nil {
+			return fmt.Errorf("network %q: %w", token, err)
+		}
+		set.insertPrefix(prefixFromNet(n))
+	}
+	s.replaceTree(set.tree)
+	return nil
+}
+
+// Compact rebuilds the tree underlying this IPSet into a perfectly balanced
+// one without changing the contents of the set. The tree balances itself as
+// it changes so this is rarely needed, but it can be called from a
+// maintenance hook after heavy churn to restore the shortest lookups.
+func (s *IPSet) Compact() {
+	if s == nil {
+		return
+	}
+	nodes := []*ipTree{}
+	s.tree.walk(func(node *ipTree) {
+		nodes = append(nodes, node)
+	})
+	s.tree = balanceTree(nodes)
+}
+
+// Validate checks the consistency of the tree underlying this IPSet. It
+// returns nil for a healthy set. Otherwise, it returns ValidationErrors with
+// one error per problem found, each of one of the types defined in
+// errors.go. It is safe to call on a nil or empty set.
+func (s *IPSet) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if errs := s.tree.validate(); len(errs) != 0 {
+		return ValidationErrors(errs)
+	}
+	return nil
+}
+
+// FreeCIDRs returns the fewest networks that cover the IPs in pool that are
+// not in used, sorted like GetNetworks. Every used IP must be in pool and it
+// returns an error listing all of those that aren't otherwise. If
+// reserveEnds is true, the network and broadcast addresses of an IPv4 pool
+// larger than a /31 are not free either. IPv6 has no such addresses.
+func FreeCIDRs(pool *net.IPNet, used []net.IP, reserveEnds bool) ([]*net.IPNet, error) {
+	p, err := checkedPrefixFromNet(pool)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &IPSet{}
+	set.insertPrefix(p)
+	errs := []error{}
+	for i, ip := range used {
+		if !validIPLen(ip) {
+			errs = append(errs, errorf(ErrInvalidIP, "used[%d] has invalid length %d", i, len(ip)))
+			continue
+		}
+		host := prefixFromIP(ip)
+		if !p.contains(host) {
+			errs = append(errs, errorf(ErrNotInNetwork, "used[%d] (%s) is not in %s", i, ip, p))
+			continue
+		}
+		set.tree = set.tree.removePrefix(host)
+	}
+	if len(errs) != 0 {
+		return nil, joinErrors(errs)
+	}
+
+	if reserveEnds && p.addrLen == net.IPv4len && p.ones < 31 {
+		set.tree = set.tree.removePrefix(ipPrefix{addr: p.addr, addrLen: p.addrLen, ones: 32})
+		set.tree = set.tree.removePrefix(p.lastIP())
+	}
+	return set.GetNetworks(), nil
+}
+
+// SubtractNets returns the networks in from that are not in remove as the
+// fewest networks that cover them, sorted like GetNetworks. The networks in
+// either list may overlap each other and may be of both IP versions. It
+// returns an empty slice when nothing remains.
+func SubtractNets(from, remove []*net.IPNet) []*net.IPNet {
+	set := &IPSet{}
+	for _, n := range from {
+		set.InsertNet(n)
+	}
+	for _, n := range remove {
+		set.RemoveNet(n)
+	}
+	return set.GetNetworks()
+}
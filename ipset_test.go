@@ -1,10 +1,17 @@
 package netaddr
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"math/bits"
 	"math/rand"
 	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,6 +52,59 @@ func TestNetDifference(t *testing.T) {
 	assert.Equal(t, []*net.IPNet{cidr1, cidr2, cidr3, cidr4, cidr5}, diff)
 }
 
+func TestNetDifferenceMappedIPv4(t *testing.T) {
+	mapped := &net.IPNet{IP: net.ParseIP("10.0.0.128"), Mask: net.CIDRMask(121, 128)}
+	cidr, _ := ParseNet("10.0.0.0/25")
+	assert.Equal(t, []*net.IPNet{cidr}, netDifference(Ten24, mapped))
+}
+
+func TestIPSetMappedIPv4(t *testing.T) {
+	// The 16 byte forms of Ten24 with either length of mask
+	mapped := &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(120, 128)}
+	mappedShort := &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)}
+
+	set := &IPSet{}
+	set.InsertNet(mapped)
+	assert.True(t, set.ContainsNet(Ten24))
+	assert.True(t, set.ContainsNet(mappedShort))
+	assert.True(t, set.Contains(Ten24Router))
+	assert.True(t, set.Contains(Ten24Router.To16()))
+	assert.Equal(t, []*net.IPNet{Ten24}, set.GetNetworks())
+
+	// Both forms are the same network
+	set.InsertNet(Ten24)
+	assert.Equal(t, 1, set.tree.numNodes())
+
+	// Halves in different forms are combined
+	set.InsertNet(&net.IPNet{IP: net.ParseIP("10.0.1.0"), Mask: net.CIDRMask(120, 128)})
+	cidr, _ := ParseNet("10.0.0.0/23")
+	assert.Equal(t, []*net.IPNet{cidr}, set.GetNetworks())
+	assert.Equal(t, []error{}, set.tree.validate())
+
+	other := &IPSet{}
+	other.InsertNet(mappedShort)
+	assert.Equal(t, []*net.IPNet{TenOne24}, set.Difference(other).GetNetworks())
+	assert.Equal(t, []*net.IPNet{Ten24}, set.Intersection(other).GetNetworks())
+	assert.Equal(t, []*net.IPNet{cidr}, other.Union(set).GetNetworks())
+
+	set.Remove(Ten24Router.To16())
+	assert.False(t, set.Contains(Ten24Router))
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
+func TestIPSetMappedIPv4CIDR(t *testing.T) {
+	mapped, _ := ParseNet("::ffff:10.0.0.0/120")
+	set := &IPSet{}
+	set.InsertNet(mapped)
+	assert.True(t, set.ContainsNet(Ten24))
+	assert.True(t, set.Contains(Ten24Router))
+	assert.Equal(t, []string{"10.0.0.0/24"}, set.String())
+
+	set.RemoveNet(Ten24)
+	assert.False(t, set.ContainsNet(mapped))
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
 func TestIPSetInit(t *testing.T) {
 	set := IPSet{}
 
@@ -246,6 +306,186 @@ func TestIPSetInsertOverlapping(t *testing.T) {
 	assert.Equal(t, []error{}, set.tree.validate())
 }
 
+func TestIPSetWithinNet(t *testing.T) {
+	delegated, _ := ParseNet("10.32.0.0/12")
+	set := &IPSet{}
+	within, offender := set.WithinNet(delegated)
+	assert.True(t, within)
+	assert.Nil(t, offender)
+
+	for _, cidr := range []string{"10.32.0.0/24", "10.40.0.0/16", "10.47.255.255/32"} {
+		n, _ := ParseNet(cidr)
+		set.InsertNet(n)
+	}
+	within, offender = set.WithinNet(delegated)
+	assert.True(t, within)
+	assert.Nil(t, offender)
+
+	within, _ = set.WithinNet(parse("0.0.0.0/0"))
+	assert.True(t, within)
+
+	tests := []struct {
+		insert, offender string
+	}{
+		{"10.31.255.0/24", "10.31.255.0/24"},
+		{"10.48.0.0/24", "10.48.0.0/24"},
+		{"192.168.0.0/16", "192.168.0.0/16"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"2001:db8::/32", "2001:db8::/32"},
+	}
+	for _, test := range tests {
+		other := set.Union(&IPSet{})
+		other.InsertNet(parse(test.insert))
+		within, offender = other.WithinNet(delegated)
+		assert.False(t, within, test.insert)
+		assert.Equal(t, parse(test.offender), offender, test.insert)
+	}
+
+	// Nothing is within a malformed network, except an empty set
+	for _, n := range []*net.IPNet{
+		nil,
+		{IP: ParseIP("10.32.0.0"), Mask: net.IPMask{255, 0, 255, 0}},
+		{IP: ParseIP("10.32.0.1"), Mask: net.CIDRMask(12, 32)},
+		{IP: net.IP{10, 32, 0}, Mask: net.CIDRMask(12, 32)},
+	} {
+		within, offender = set.WithinNet(n)
+		assert.False(t, within, "%v", n)
+		assert.Equal(t, parse("10.32.0.0/24"), offender, "%v", n)
+		within, offender = (&IPSet{}).WithinNet(n)
+		assert.True(t, within, "%v", n)
+		assert.Nil(t, offender)
+	}
+
+	// The first offender is reported
+	other := set.Union(&IPSet{})
+	other.InsertNet(parse("10.48.0.0/24"))
+	other.InsertNet(parse("10.49.0.0/24"))
+	_, offender = other.WithinNet(delegated)
+	assert.Equal(t, parse("10.48.0.0/24"), offender)
+
+	// IPv4 networks are never within an IPv6 one
+	within, offender = set.WithinNet(parse("::/0"))
+	assert.False(t, within)
+	assert.Equal(t, parse("10.32.0.0/24"), offender)
+}
+
+func TestIPSetFindOverlapping(t *testing.T) {
+	set := &IPSet{}
+	assert.Nil(t, set.FindOverlapping(parse("10.0.0.0/8")))
+
+	for _, cidr := range []string{"10.0.0.0/24", "10.0.2.0/23", "10.0.16.0/20", "10.1.0.0/16", "2001:db8::/48"} {
+		set.InsertNet(parse(cidr))
+	}
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"10.0.0.0/20", []string{"10.0.0.0/24", "10.0.2.0/23"}},
+		{"10.0.0.0/8", []string{"10.0.0.0/24", "10.0.2.0/23", "10.0.16.0/20", "10.1.0.0/16"}},
+		{"10.0.16.0/24", []string{"10.0.16.0/20"}},
+		{"10.0.3.7/32", []string{"10.0.2.0/23"}},
+		{"10.0.2.0/23", []string{"10.0.2.0/23"}},
+		{"10.0.1.0/24", nil},
+		{"10.0.32.0/19", nil},
+		{"0.0.0.0/0", []string{"10.0.0.0/24", "10.0.2.0/23", "10.0.16.0/20", "10.1.0.0/16"}},
+		{"2001:db8::/32", []string{"2001:db8::/48"}},
+		{"::/0", []string{"2001:db8::/48"}},
+		{"::ffff:10.0.0.0/104", []string{"10.0.0.0/24", "10.0.2.0/23", "10.0.16.0/20", "10.1.0.0/16"}},
+	}
+	for _, test := range tests {
+		var found []string
+		for _, n := range set.FindOverlapping(parse(test.query)) {
+			found = append(found, n.String())
+		}
+		assert.Equal(t, test.expected, found, test.query)
+	}
+
+	assert.Nil(t, set.FindOverlapping(nil))
+	assert.Nil(t, set.FindOverlapping(&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)}))
+	assert.Nil(t, (*IPSet)(nil).FindOverlapping(parse("10.0.0.0/8")))
+}
+
+func TestIPSetMalformedNets(t *testing.T) {
+	tests := []struct {
+		n   *net.IPNet
+		err string
+	}{
+		{nil, "network is nil"},
+		{&net.IPNet{Mask: net.CIDRMask(24, 32)}, "invalid IP length in network: 0 bytes"},
+		{&net.IPNet{IP: net.IP{10, 0, 0}, Mask: net.CIDRMask(24, 32)}, "invalid IP length in network: 3 bytes"},
+		{&net.IPNet{IP: ParseIP("10.0.0.0")}, "invalid mask in network 10.0.0.0: <nil>"},
+		{&net.IPNet{IP: ParseIP("10.0.0.0"), Mask: net.IPMask{255, 255}}, "invalid mask in network 10.0.0.0: ffff"},
+		{&net.IPNet{IP: ParseIP("10.0.0.0"), Mask: net.IPMask{255, 0, 255, 0}}, "invalid mask in network 10.0.0.0: 255.0.255.0"},
+		{&net.IPNet{IP: ParseIP("10.0.0.0"), Mask: net.CIDRMask(64, 128)}, "mask /64 is too short for IP 10.0.0.0"},
+		{&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)}, "host part of network 10.0.0.1/24 is not zero"},
+	}
+	for _, test := range tests {
+		set := &IPSet{}
+		set.InsertNet(Ten24)
+
+		assert.Equal(t, test.err, set.InsertNetE(test.n).Error())
+		assert.Equal(t, test.err, set.RemoveNetE(test.n).Error())
+		contains, err := set.ContainsNetE(test.n)
+		assert.Equal(t, test.err, err.Error())
+		assert.False(t, contains)
+
+		set.InsertNet(test.n)
+		set.RemoveNet(test.n)
+		assert.False(t, set.ContainsNet(test.n))
+		assert.Equal(t, []*net.IPNet{Ten24}, set.GetNetworks())
+		assert.Nil(t, set.Validate())
+	}
+
+	// Malformed IPs are ignored too
+	set := &IPSet{}
+	set.InsertNet(Ten24)
+	for _, ip := range []net.IP{nil, {10, 0, 0}, make(net.IP, 17)} {
+		set.Insert(ip)
+		set.Remove(ip)
+		assert.False(t, set.Contains(ip))
+	}
+	assert.Equal(t, []*net.IPNet{Ten24}, set.GetNetworks())
+	assert.Nil(t, set.Validate())
+
+	// A 4 byte IP with an equivalent 16 byte mask is fine
+	assert.Nil(t, set.InsertNetE(&net.IPNet{IP: ParseIP("10.0.1.0"), Mask: net.CIDRMask(120, 128)}))
+	assert.Equal(t, []*net.IPNet{parse("10.0.0.0/23")}, set.GetNetworks())
+}
+
+func TestSubtractNets(t *testing.T) {
+	nets := func(cidrs ...string) []*net.IPNet {
+		result := []*net.IPNet{}
+		for _, cidr := range cidrs {
+			result = append(result, parse(cidr))
+		}
+		return result
+	}
+
+	tests := []struct {
+		from, remove, expected []*net.IPNet
+	}{
+		{nets("10.0.0.0/24"), nets("10.0.0.128/25"), nets("10.0.0.0/25")},
+		// Overlapping and adjacent networks in from
+		{nets("10.0.0.0/24", "10.0.0.0/25", "10.0.1.0/24"), nets("10.0.0.64/26"), nets("10.0.0.0/26", "10.0.0.128/25", "10.0.1.0/24")},
+		// Removals that don't intersect anything
+		{nets("10.0.0.0/24"), nets("192.168.0.0/16", "2001:db8::/32"), nets("10.0.0.0/24")},
+		// Mixed families
+		{
+			nets("2001:db8::/32", "10.0.0.0/8"),
+			nets("2001:db8:8000::/33", "10.128.0.0/9"),
+			nets("10.0.0.0/9", "2001:db8::/33"),
+		},
+		{nets("10.0.0.0/24"), nets("10.0.0.0/8"), nets()},
+		{nets(), nets("10.0.0.0/8"), nets()},
+		{nil, nil, nets()},
+	}
+	for _, test := range tests {
+		result := SubtractNets(test.from, test.remove)
+		assert.NotNil(t, result)
+		assert.Equal(t, test.expected, result)
+	}
+}
+
 func TestIPSetUnion(t *testing.T) {
 	set1, set2 := &IPSet{}, &IPSet{}
 
@@ -384,6 +624,96 @@ func TestIPSetInsertV6(t *testing.T) {
 	assert.Equal(t, []error{}, set.tree.validate())
 }
 
+func TestIPSetGetIPsMixed(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/30"))
+	set.InsertNet(parse("2001:db8::/64"))
+
+	ips, err := set.GetIPsE(6)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "2001:db8::", "2001:db8::1",
+	}, ipStrings(ips))
+
+	ips, err = set.GetIPsE(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.1", "10.0.0.2"}, ipStrings(ips))
+
+	for _, limit := range []int{0, -1} {
+		ips, err = set.GetIPsE(limit)
+		assert.NotNil(t, err)
+		assert.Nil(t, ips)
+	}
+
+	ips, err = set.GetAllIPs(1 << 20)
+	assert.Equal(t, "set has 18446744073709551620 IPs which is more than 1048576", err.Error())
+	assert.Nil(t, ips)
+
+	set.RemoveNet(parse("2001:db8::/64"))
+	ips, err = set.GetAllIPs(4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}, ipStrings(ips))
+	_, err = set.GetAllIPs(3)
+	assert.NotNil(t, err)
+	_, err = set.GetAllIPs(-1)
+	assert.NotNil(t, err)
+
+	ips, err = (&IPSet{}).GetAllIPs(0)
+	assert.Nil(t, err)
+	assert.Empty(t, ips)
+}
+
+func TestIPSetGetIPsTopOfSpace(t *testing.T) {
+	set := &IPSet{}
+	n, _ := ParseNet("255.255.255.254/31")
+	set.InsertNet(n)
+	n, _ = ParseNet("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127")
+	set.InsertNet(n)
+
+	ips := set.GetIPs(0)
+	assert.Equal(t, []net.IP{
+		ParseIP("255.255.255.254"),
+		ParseIP("255.255.255.255"),
+		ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"),
+		ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"),
+	}, ips)
+}
+
+func TestIPSetAppendGetIPs(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/30"))
+	set.InsertNet(parse("2001:db8::/64"))
+
+	dst := []net.IP{ParseIP("192.0.2.1")}
+	dst = set.AppendGetIPs(dst, 6)
+	assert.Equal(t, []string{
+		"192.0.2.1", "10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "2001:db8::", "2001:db8::1",
+	}, ipStrings(dst))
+	assert.Equal(t, 0, len(set.AppendGetIPs(nil, 0)))
+
+	r := rand.New(rand.NewSource(5))
+	for i := 0; i < 20; i++ {
+		set := randomSet(r, 10)
+		limit := r.Intn(500)
+		ips := set.AppendGetIPs(nil, limit)
+		if limit == 0 {
+			assert.Equal(t, 0, len(ips))
+			continue
+		}
+		expected, _ := set.GetIPsE(limit)
+		assert.Equal(t, expected, ips)
+	}
+
+	dst = make([]net.IP, 0, 4)
+	buf := make([]byte, 0, 16)
+	set.RemoveNet(parse("2001:db8::/64"))
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, buf = set.AppendGetIPsBuf(dst[:0], buf[:0], 4)
+	})
+	assert.Equal(t, 0.0, allocs)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}, ipStrings(dst))
+}
+
 func TestIPSetAllocateDeallocate(t *testing.T) {
 	rand.Seed(29)
 
@@ -431,3 +761,1577 @@ func TestGetNetworks(t *testing.T) {
 	s.Remove(ParseIP("10.0.0.129"))
 	assert.Equal(t, "[10.0.0.128/32 10.0.0.130/31 10.0.0.132/30 10.0.0.136/29 10.0.0.144/28 10.0.0.160/27 10.0.0.192/26]", fmt.Sprintf("%s", s.GetNetworks()))
 }
+
+func TestGetNetworksCopies(t *testing.T) {
+	s := &IPSet{}
+	s.InsertNet(parse("10.0.0.0/24"))
+	nets := s.GetNetworks()
+	nets[0].IP[0] = 11
+	nets[0].Mask[3] = 0xff
+	assert.Equal(t, []string{"10.0.0.0/24"}, s.String())
+	assert.Nil(t, s.Validate())
+}
+
+func TestGetIPNets(t *testing.T) {
+	var nilSet *IPSet
+	assert.Equal(t, []IPNet{}, nilSet.GetIPNets())
+
+	r := rand.New(rand.NewSource(523))
+	s := randomSet(r, 50)
+	s.InsertNet(parse("2001:db8::/64"))
+	nets := s.GetIPNets()
+	assert.Equal(t, len(s.String()), len(nets))
+	for i, n := range s.GetNetworks() {
+		assert.Equal(t, n, nets[i].Net())
+	}
+	assert.Equal(t, MustParseIPNet("2001:db8::/64"), nets[len(nets)-1])
+	stdNets := []*net.IPNet{}
+	for _, n := range nets {
+		stdNets = append(stdNets, n.Net())
+	}
+	assert.True(t, s.Equal(NewIPSet(stdNets...)))
+}
+
+// sortedNets returns n non-adjacent /32s in increasing order, like a sorted
+// feed that can't be aggregated.
+func sortedNets(n int) []*net.IPNet {
+	nets := make([]*net.IPNet, n)
+	ip := ParseIP("10.0.0.0")
+	for i := range nets {
+		nets[i] = ipToNet(ip)
+		ip, _ = incrementIP(ip)
+		ip, _ = incrementIP(ip)
+	}
+	return nets
+}
+
+func BenchmarkIPSetInsertSorted(b *testing.B) {
+	nets := sortedNets(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := &IPSet{}
+		for _, n := range nets {
+			set.InsertNet(n)
+		}
+	}
+}
+
+func BenchmarkIPSetContainsSorted(b *testing.B) {
+	nets := sortedNets(10000)
+	set := &IPSet{}
+	for _, n := range nets {
+		set.InsertNet(n)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set.ContainsNet(nets[i%len(nets)])
+	}
+}
+
+func TestIPSetInsertSortedBalanced(t *testing.T) {
+	set := IPSet{}
+	for _, n := range sortedNets(1000000) {
+		set.InsertNet(n)
+	}
+	assert.Equal(t, 1000000, set.tree.numNodes())
+	assert.True(t, set.tree.height() <= 60, "height %d", set.tree.height())
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
+func TestIPSetRandomBalanced(t *testing.T) {
+	r := rand.New(rand.NewSource(418))
+	set := IPSet{}
+	for i := 0; i < 20000; i++ {
+		ip := IPv4(10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256)))
+		n := &net.IPNet{IP: ip, Mask: net.CIDRMask(24+r.Intn(9), 32)}
+		n.IP = n.IP.Mask(n.Mask)
+		if r.Intn(3) == 0 {
+			set.RemoveNet(n)
+		} else {
+			set.InsertNet(n)
+		}
+	}
+	assert.True(t, set.tree.height() <= uint(3*bits.Len(uint(set.tree.numNodes()))), "height %d", set.tree.height())
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
+func BenchmarkIPSetInsertSequential(b *testing.B) {
+	nets := make([]*net.IPNet, 4096)
+	for i := range nets {
+		nets[i] = &net.IPNet{IP: IPv4(10, byte(i>>8), byte(i), 0), Mask: net.CIDRMask(24, 32)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := &IPSet{}
+		for _, n := range nets {
+			set.InsertNet(n)
+		}
+	}
+}
+
+func TestIPSetValidate(t *testing.T) {
+	var set *IPSet
+	assert.Nil(t, set.Validate())
+
+	set = &IPSet{}
+	assert.Nil(t, set.Validate())
+
+	set.InsertNet(Ten24)
+	set.InsertNet(TenTwo24)
+	set.InsertNet(V6Net1)
+	assert.Nil(t, set.Validate())
+
+	// Break the tree behind the set's back
+	set.tree.first().next().prefix = prefixFromNet(TenOne24)
+	errs, ok := set.Validate().(ValidationErrors)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(errs))
+	uncombined, ok := errs[0].(*UncombinedError)
+	assert.True(t, ok)
+	assert.Equal(t, Ten24, uncombined.Prev)
+	assert.Equal(t, TenOne24, uncombined.Next)
+	assert.Equal(t, "nodes must be combined: 10.0.0.0/24 and 10.0.1.0/24", errs.Error())
+}
+
+func BenchmarkIPSetMemory(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		// Like parsed input, the networks are not kept by the caller
+		set := &IPSet{}
+		for j := 0; j < 500000; j++ {
+			set.InsertNet(&net.IPNet{IP: IPv4(10, byte(j>>15), byte(j>>7), byte(j<<1)), Mask: net.CIDRMask(32, 32)})
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/500000, "B/node")
+		runtime.KeepAlive(set)
+	}
+}
+
+func TestNewIPSetFromSorted(t *testing.T) {
+	nets := sortedNets(10000)
+	set, err := NewIPSetFromSorted(nets)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{}, set.tree.validate())
+	assert.Equal(t, 10000, set.tree.numNodes())
+
+	// It builds the same tree as inserting the networks does
+	inserted := &IPSet{}
+	for _, n := range nets {
+		inserted.InsertNet(n)
+	}
+	assert.Equal(t, inserted.String(), set.String())
+	assert.Equal(t, inserted.tree.height(), set.tree.height())
+	assert.Equal(t, inserted.tree.prefix, set.tree.prefix)
+
+	set, err = NewIPSetFromSorted(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, set.tree.numNodes())
+
+	mixed := []*net.IPNet{parse("10.0.0.0/24"), parse("10.0.2.0/24"), V6Net1, V6Net2}
+	set, err = NewIPSetFromSorted(mixed)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{Ten24, TenTwo24, V6Net1, V6Net2}, set.GetNetworks())
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
+func TestNewIPSetFromSortedErrors(t *testing.T) {
+	for _, tc := range []struct {
+		nets []string
+		err  string
+	}{
+		{[]string{"10.0.1.0/24", "10.0.0.0/24"}, "network 1 (10.0.0.0/24) is out of order"},
+		{[]string{"10.0.0.0/24", "10.0.0.0/24"}, "network 1 (10.0.0.0/24) is out of order"},
+		{[]string{"10.0.0.0/23", "10.0.1.0/24"}, "network 1 (10.0.1.0/24) overlaps 10.0.0.0/23"},
+		{[]string{"10.0.0.0/24", "10.0.1.0/24"}, "network 1 (10.0.1.0/24) can be combined with 10.0.0.0/24"},
+		{[]string{"10.0.0.1/24"}, "network 0: host part of network 10.0.0.1/24 is not zero"},
+		{[]string{"10.1.0.0/16", "a00::/8", "a01::/16"}, "network 2 (a01::/16) overlaps a00::/8"},
+		// IPv4 networks come before all IPv6 ones
+		{[]string{"a00::/8", "10.1.0.0/16"}, "network 1 (10.1.0.0/16) is out of order"},
+	} {
+		nets := []*net.IPNet{}
+		for _, n := range tc.nets {
+			nets = append(nets, parse(n))
+		}
+		set, err := NewIPSetFromSorted(nets)
+		assert.Nil(t, set)
+		if assert.NotNil(t, err) {
+			assert.Equal(t, tc.err, err.Error())
+		}
+	}
+
+	for _, tc := range []struct {
+		n    *net.IPNet
+		kind error
+	}{
+		{nil, ErrInvalidCIDR},
+		{&net.IPNet{IP: net.IP{10, 0, 0}, Mask: net.CIDRMask(8, 32)}, ErrInvalidCIDR},
+		{&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.IPMask{255, 0, 255, 0}}, ErrInvalidMask},
+		{&net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 128)}, ErrInvalidMask},
+		{&net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.CIDRMask(8, 32)}, ErrHostBitsSet},
+	} {
+		set, err := NewIPSetFromSorted([]*net.IPNet{Ten24, tc.n})
+		assert.Nil(t, set)
+		assert.True(t, errors.Is(err, tc.kind), "%v", err)
+	}
+}
+
+func BenchmarkIPSetInsertSnapshot(b *testing.B) {
+	nets := sortedNets(250000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := &IPSet{}
+		for _, n := range nets {
+			set.InsertNet(n)
+		}
+	}
+}
+
+func BenchmarkNewIPSetFromSorted(b *testing.B) {
+	nets := sortedNets(250000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewIPSetFromSorted(nets); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIPSetCompact(t *testing.T) {
+	var set *IPSet
+	set.Compact()
+
+	set = &IPSet{}
+	set.Compact()
+	assert.Equal(t, 0, set.tree.numNodes())
+
+	// A degenerate tree like one built without balancing
+	set = &IPSet{tree: deepTree(1000)}
+	before := set.String()
+	set.Compact()
+	assert.Equal(t, before, set.String())
+	assert.Equal(t, uint(10), set.tree.height())
+	assert.Equal(t, []error{}, set.tree.validate())
+
+	// The set keeps working afterwards
+	set.InsertNet(parse("10.0.0.0/22"))
+	set.RemoveNet(parse("10.0.1.0/24"))
+	assert.Equal(t, big.NewInt(768+1000-512), set.tree.size())
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
+func TestIPSetCompactChurn(t *testing.T) {
+	r := rand.New(rand.NewSource(424))
+	set := IPSet{}
+	for i := 0; i < 100000; i++ {
+		ip := IPv4(10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256)))
+		if r.Intn(2) == 0 {
+			set.Remove(ip)
+		} else {
+			set.Insert(ip)
+		}
+	}
+	before := set.String()
+	set.Compact()
+	assert.Equal(t, before, set.String())
+	assert.Equal(t, uint(bits.Len(uint(set.tree.numNodes()))), set.tree.height())
+	assert.Equal(t, []error{}, set.tree.validate())
+}
+
+// randomSet returns a set of the given number of random networks from
+// 10.0.0.0/8 and 2001:db8::/104 with prefixes up to 4 bits shorter than /32
+// and /128.
+func randomSet(r *rand.Rand, n int) *IPSet {
+	set := &IPSet{}
+	for i := 0; i < n; i++ {
+		var cidr *net.IPNet
+		if r.Intn(4) == 0 {
+			ip := ParseIP("2001:db8::")
+			ip[13], ip[14], ip[15] = byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))
+			cidr = &net.IPNet{IP: ip, Mask: net.CIDRMask(124+r.Intn(5), 128)}
+		} else {
+			ip := IPv4(10, byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+			cidr = &net.IPNet{IP: ip, Mask: net.CIDRMask(28+r.Intn(5), 32)}
+		}
+		cidr.IP = cidr.IP.Mask(cidr.Mask)
+		set.InsertNet(cidr)
+	}
+	return set
+}
+
+// intersectionByLookup is the intersection as it was computed before the
+// simultaneous walk, by looking up each network in the other set.
+func intersectionByLookup(s, other *IPSet) *IPSet {
+	result := &IPSet{}
+	s.tree.walk(func(node *ipTree) {
+		if other.tree.contains(node.prefix) {
+			result.insertPrefix(node.prefix)
+		}
+	})
+	other.tree.walk(func(node *ipTree) {
+		if s.tree.contains(node.prefix) {
+			result.insertPrefix(node.prefix)
+		}
+	})
+	return result
+}
+
+func TestIPSetIntersectionRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(447))
+	for i := 0; i < 5; i++ {
+		a, b := randomSet(r, 20000), randomSet(r, 20000)
+		expected := intersectionByLookup(a, b).String()
+		assert.Equal(t, expected, a.Intersection(b).String())
+		assert.Equal(t, expected, b.Intersection(a).String())
+		assert.Nil(t, a.Intersection(b).Validate())
+	}
+
+	empty := &IPSet{}
+	a := randomSet(r, 100)
+	assert.Nil(t, a.Intersection(empty).String())
+	assert.Nil(t, empty.Intersection(a).String())
+	assert.Equal(t, a.String(), a.Intersection(a).String())
+}
+
+func netStrings(nets []*net.IPNet) []string {
+	var strs []string
+	for _, n := range nets {
+		strs = append(strs, n.String())
+	}
+	return strs
+}
+
+func TestNewIPSetFromStrings(t *testing.T) {
+	set, err := NewIPSetFromStrings([]string{"10.0.0.0/24", "192.0.2.1", "10.0.1.0/24", "2001:db8::1", "2001:db8::/64"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/23", "192.0.2.1/32", "2001:db8::/64"}, set.String())
+
+	set, err = NewIPSetFromStrings(nil)
+	assert.Nil(t, err)
+	assert.True(t, set.IsEmpty())
+
+	// Every bad entry is reported
+	set, err = NewIPSetFromStrings([]string{"10.0.0.0/24", "10.0.1.1/24", "192.0.2.1", "bogus", "2001:db8::/129"})
+	assert.Nil(t, set)
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+	lines := strings.Split(err.Error(), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], `cidrs[1] ("10.0.1.1/24"): `), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], `cidrs[3] ("bogus"): `), lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], `cidrs[4] ("2001:db8::/129"): `), lines[2])
+}
+
+func TestNewIPSet(t *testing.T) {
+	assert.True(t, NewIPSet().IsEmpty())
+	set := NewIPSet(parse("2001:db8::/64"), parse("10.0.1.0/24"), nil, parse("10.0.0.0/24"), parse("10.0.0.7/32"))
+	assert.Equal(t, []string{"10.0.0.0/23", "2001:db8::/64"}, set.String())
+	assert.Nil(t, set.Validate())
+
+	// Networks straight from net.ParseCIDR
+	_, a, _ := net.ParseCIDR("192.0.2.0/25")
+	_, b, _ := net.ParseCIDR("192.0.2.128/25")
+	assert.Equal(t, []string{"192.0.2.0/24"}, NewIPSet(a, b).String())
+}
+
+func TestNewIPSetFromNets(t *testing.T) {
+	assert.True(t, NewIPSetFromNets(nil).IsEmpty())
+	set := NewIPSetFromNets([]*net.IPNet{
+		parse("10.0.0.128/25"), parse("10.0.0.0/26"), nil, parse("10.0.0.64/26"),
+		{IP: ParseIP("10.0.1.1"), Mask: net.CIDRMask(24, 32)}, parse("10.0.1.0/24"),
+		parse("10.0.1.5/32"), parse("::ffff:10.0.2.0/120"), parse("2001:db8::/64"), parse("2001:db8::/48"),
+	})
+	assert.Equal(t, []string{"10.0.0.0/23", "10.0.2.0/24", "2001:db8::/48"}, set.String())
+	assert.Nil(t, set.Validate())
+
+	// Siblings that combine on and on
+	set = NewIPSetFromNets([]*net.IPNet{parse("10.0.0.3/32"), parse("10.0.0.2/32"), parse("10.0.0.1/32"),
+		parse("10.0.0.0/32"), parse("10.0.0.4/30"), parse("10.0.0.8/29")})
+	assert.Equal(t, []string{"10.0.0.0/28"}, set.String())
+	set = NewIPSetFromNets([]*net.IPNet{parse("0.0.0.0/1"), parse("128.0.0.0/1"), parse("::/1"), parse("8000::/1")})
+	assert.Equal(t, []string{"0.0.0.0/0", "::/0"}, set.String())
+}
+
+func TestNewIPSetFromNetsRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(518))
+	for i := 0; i < 200; i++ {
+		var nets []*net.IPNet
+		expected := &IPSet{}
+		for j := r.Intn(200); j >= 0; j-- {
+			n := randomSet(r, 1).GetNetworks()[0]
+			if r.Intn(4) == 0 {
+				n.Mask = net.CIDRMask(r.Intn(8)+8*len(n.IP)-12, 8*len(n.IP))
+				n.IP = n.IP.Mask(n.Mask)
+			}
+			nets = append(nets, n)
+			expected.InsertNet(n)
+		}
+		set := NewIPSetFromNets(nets)
+		assert.Equal(t, "", ExplainDifference(expected, set))
+		assert.Nil(t, set.Validate())
+	}
+}
+
+func BenchmarkNewIPSetFromNets(b *testing.B) {
+	r := rand.New(rand.NewSource(518))
+	nets := randomSet(r, 100000).GetNetworks()
+	r.Shuffle(len(nets), func(i, j int) { nets[i], nets[j] = nets[j], nets[i] })
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewIPSetFromNets(nets)
+	}
+}
+
+func BenchmarkNewIPSetFromNetsByInsert(b *testing.B) {
+	r := rand.New(rand.NewSource(518))
+	nets := randomSet(r, 100000).GetNetworks()
+	r.Shuffle(len(nets), func(i, j int) { nets[i], nets[j] = nets[j], nets[i] })
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := &IPSet{}
+		for _, n := range nets {
+			set.InsertNet(n)
+		}
+	}
+}
+
+func TestIPSetInsertRange(t *testing.T) {
+	set := &IPSet{}
+	assert.Nil(t, set.InsertRange(ParseIP("192.168.1.10"), ParseIP("192.168.1.200")))
+	assert.Equal(t, []string{"192.168.1.10/31", "192.168.1.12/30", "192.168.1.16/28", "192.168.1.32/27",
+		"192.168.1.64/26", "192.168.1.128/26", "192.168.1.192/29", "192.168.1.200/32"}, set.String())
+	assert.Equal(t, big.NewInt(191), set.tree.size())
+
+	// It merges with what's already there
+	assert.Nil(t, set.InsertRange(net.ParseIP("192.168.1.0"), ParseIP("192.168.1.9")))
+	assert.Nil(t, set.InsertRange(ParseIP("192.168.1.201"), ParseIP("192.168.1.255")))
+	assert.Equal(t, []string{"192.168.1.0/24"}, set.String())
+
+	// Across power of two boundaries
+	assert.Nil(t, set.InsertRange(ParseIP("10.255.255.255"), ParseIP("11.0.0.0")))
+	assert.True(t, set.Contains(ParseIP("10.255.255.255")))
+	assert.True(t, set.Contains(ParseIP("11.0.0.0")))
+
+	assert.Nil(t, set.InsertRange(ParseIP("172.16.0.1"), ParseIP("172.16.0.1")))
+	assert.Equal(t, []string{"10.255.255.255/32", "11.0.0.0/32", "172.16.0.1/32", "192.168.1.0/24"}, set.String())
+
+	// An IPv6 range of more IPs than fit in an int64
+	assert.Nil(t, set.InsertRange(ParseIP("2001:db8::1"), ParseIP("2001:db8:0:1::")))
+	size := big.NewInt(0).Lsh(big.NewInt(1), 64)
+	assert.Equal(t, size, set.V6().Size())
+	assert.Nil(t, set.Validate())
+
+	before := set.String()
+	for _, c := range []struct {
+		start, end net.IP
+		kind       error
+	}{
+		{ParseIP("10.0.0.2"), ParseIP("10.0.0.1"), ErrInvalidArgument},
+		{ParseIP("10.0.0.1"), ParseIP("2001:db8::1"), ErrFamilyMismatch},
+		{nil, ParseIP("10.0.0.1"), ErrInvalidIP},
+		{ParseIP("10.0.0.1"), net.IP{10, 0, 0}, ErrInvalidIP},
+	} {
+		err := set.InsertRange(c.start, c.end)
+		assert.True(t, errors.Is(err, c.kind), "%s-%s: %v", c.start, c.end, err)
+	}
+	assert.Equal(t, before, set.String())
+}
+
+func TestIPSetRemoveRange(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/16"))
+	assert.Nil(t, set.RemoveRange(ParseIP("10.0.0.100"), ParseIP("10.0.0.149")))
+	assert.Nil(t, set.Validate())
+	assert.Equal(t, big.NewInt(65536-50), set.tree.size())
+	assert.True(t, set.Contains(ParseIP("10.0.0.99")))
+	assert.False(t, set.Contains(ParseIP("10.0.0.100")))
+	assert.False(t, set.Contains(ParseIP("10.0.0.149")))
+	assert.True(t, set.Contains(ParseIP("10.0.0.150")))
+
+	// A range that straddles several networks and runs past the set
+	set = &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/24", "10.0.2.0/25", "10.0.3.0/24", "10.0.5.7/32"} {
+		set.InsertNet(parse(cidr))
+	}
+	assert.Nil(t, set.RemoveRange(ParseIP("9.255.255.0"), ParseIP("10.0.0.9")))
+	assert.Nil(t, set.RemoveRange(ParseIP("10.0.2.100"), ParseIP("10.0.3.200")))
+	assert.Nil(t, set.Validate())
+	assert.Equal(t, []string{"10.0.0.10/31", "10.0.0.12/30", "10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/25",
+		"10.0.2.0/26", "10.0.2.64/27", "10.0.2.96/30", "10.0.3.201/32", "10.0.3.202/31", "10.0.3.204/30", "10.0.3.208/28",
+		"10.0.3.224/27", "10.0.5.7/32"}, set.String())
+
+	assert.Nil(t, set.RemoveRange(ParseIP("0.0.0.0"), ParseIP("255.255.255.255")))
+	assert.Equal(t, 0, len(set.String()))
+	assert.Nil(t, set.Validate())
+
+	set.InsertNet(parse("2001:db8::/32"))
+	assert.Nil(t, set.RemoveRange(ParseIP("2001:db8::1"), ParseIP("2001:db8:ffff:ffff:ffff:ffff:ffff:fffe")))
+	assert.Equal(t, []string{"2001:db8::/128", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff/128"}, set.String())
+
+	err := set.RemoveRange(ParseIP("2001:db8::"), ParseIP("10.0.0.1"))
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	err = set.RemoveRange(ParseIP("2001:db8::1"), ParseIP("2001:db8::"))
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	assert.Equal(t, 2, len(set.String()))
+}
+
+func TestIPSetRangeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(503))
+	set, mirror := &IPSet{}, &IPSet{}
+	for i := 0; i < 2000; i++ {
+		a, b := prefixFromIP(ParseIP("10.0.0.0")), prefixFromIP(ParseIP("10.0.0.0"))
+		a.addr[2], a.addr[3] = byte(r.Intn(4)), byte(r.Intn(256))
+		b.addr[2], b.addr[3] = byte(r.Intn(4)), byte(r.Intn(256))
+		if a.compare(b) > 0 {
+			a, b = b, a
+		}
+		// The mirror adds or removes the IPs one at a time
+		insert := r.Intn(2) == 0
+		if insert {
+			assert.Nil(t, set.InsertRange(a.ip(), b.ip()))
+		} else {
+			assert.Nil(t, set.RemoveRange(a.ip(), b.ip()))
+		}
+		for p := a; ; p.addr = incrementAddr(p.addr, p.addrLen) {
+			if insert {
+				mirror.insertPrefix(p)
+			} else {
+				mirror.removePrefix(p)
+			}
+			if p == b {
+				break
+			}
+		}
+		if i%100 == 0 {
+			assert.Equal(t, "", ExplainDifference(set, mirror))
+			assert.Nil(t, set.Validate())
+		}
+	}
+	assert.Equal(t, "", ExplainDifference(set, mirror))
+}
+
+func TestIPSetEqual(t *testing.T) {
+	var nilSet *IPSet
+	a, b := &IPSet{}, &IPSet{}
+	assert.True(t, a.Equal(b))
+	assert.True(t, a.Equal(nil))
+	assert.True(t, nilSet.Equal(a))
+	assert.True(t, nilSet.Equal(nil))
+
+	// The same IPs inserted in different ways
+	for _, cidr := range []string{"10.0.0.0/24", "2001:db8::/64", "10.0.1.0/24", "192.0.2.7/32"} {
+		a.InsertNet(parse(cidr))
+	}
+	for _, cidr := range []string{"192.0.2.7/32", "10.0.1.128/25", "2001:db8::8000:0:0:0/65", "10.0.0.0/24", "10.0.1.0/25", "2001:db8::/65"} {
+		b.InsertNet(parse(cidr))
+	}
+	assert.True(t, a.Equal(b))
+	assert.True(t, b.Equal(a))
+	assert.True(t, a.Equal(a))
+	assert.False(t, a.Equal(nil))
+	assert.False(t, nilSet.Equal(b))
+
+	// A difference in one family only
+	b.Remove(ParseIP("2001:db8::1"))
+	assert.False(t, a.Equal(b))
+	b.Insert(ParseIP("2001:db8::1"))
+	assert.True(t, a.Equal(b))
+	b.InsertNet(parse("10.0.2.0/24"))
+	assert.False(t, a.Equal(b))
+	assert.False(t, b.Equal(a))
+
+	// Same number of networks but different ones
+	c, d := &IPSet{}, &IPSet{}
+	c.InsertNet(parse("10.0.0.0/24"))
+	d.InsertNet(parse("10.0.0.0/25"))
+	assert.False(t, c.Equal(d))
+	d.InsertNet(parse("10.0.0.128/25"))
+	assert.True(t, c.Equal(d))
+	d = &IPSet{}
+	d.InsertNet(parse("::ffff:10.0.0.0/120"))
+	assert.True(t, c.Equal(d))
+}
+
+func TestIPSetEqualRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(504))
+	for i := 0; i < 500; i++ {
+		a, b := randomSet(r, 1+r.Intn(20)), randomSet(r, 1+r.Intn(20))
+		assert.Equal(t, ExplainDifference(a, b) == "", a.Equal(b))
+		union := a.Union(b)
+		assert.True(t, union.Equal(b.Union(a)))
+		assert.True(t, union.Difference(b).Union(b).Equal(union))
+		assert.True(t, a.Intersection(b).Union(a.Difference(b)).Equal(a))
+	}
+}
+
+func TestIPSetIsSubsetOf(t *testing.T) {
+	var nilSet *IPSet
+	org, tenant := &IPSet{}, &IPSet{}
+	assert.True(t, tenant.IsSubsetOf(org))
+	assert.True(t, nilSet.IsSubsetOf(org))
+	assert.True(t, org.IsSubsetOf(nil))
+
+	org.InsertNet(parse("10.0.0.0/16"))
+	org.InsertNet(parse("2001:db8::/32"))
+	assert.True(t, nilSet.IsSubsetOf(org))
+	assert.False(t, org.IsSubsetOf(nil))
+	assert.True(t, org.IsSupersetOf(nil))
+	assert.True(t, org.IsSubsetOf(org))
+
+	tenant.InsertNet(parse("10.0.1.0/24"))
+	tenant.InsertNet(parse("10.0.3.7/32"))
+	tenant.InsertNet(parse("2001:db8:1::/48"))
+	assert.True(t, tenant.IsSubsetOf(org))
+	assert.True(t, org.IsSupersetOf(tenant))
+	assert.False(t, org.IsSubsetOf(tenant))
+	assert.False(t, tenant.IsSupersetOf(org))
+
+	// One IP outside is enough
+	tenant.Insert(ParseIP("2001:db9::1"))
+	assert.False(t, tenant.IsSubsetOf(org))
+	tenant.Remove(ParseIP("2001:db9::1"))
+	tenant.Insert(ParseIP("10.1.0.0"))
+	assert.False(t, tenant.IsSubsetOf(org))
+	tenant.Remove(ParseIP("10.1.0.0"))
+
+	// A network that only partly overlaps
+	org.Remove(ParseIP("10.0.1.77"))
+	assert.False(t, tenant.IsSubsetOf(org))
+	org.Insert(ParseIP("10.0.1.77"))
+	assert.True(t, tenant.IsSubsetOf(org))
+	tenant.InsertNet(parse("10.0.0.0/15"))
+	assert.False(t, tenant.IsSubsetOf(org))
+}
+
+func TestIPSetIsSubsetOfRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(505))
+	for i := 0; i < 500; i++ {
+		a, b := randomSet(r, 1+r.Intn(20)), randomSet(r, 1+r.Intn(20))
+		assert.Equal(t, a.Difference(b).tree == nil, a.IsSubsetOf(b))
+		assert.True(t, a.IsSubsetOf(a.Union(b)))
+		assert.True(t, a.Intersection(b).IsSubsetOf(b))
+		assert.True(t, a.Union(b).IsSupersetOf(b))
+	}
+}
+
+func TestIPSetOverlaps(t *testing.T) {
+	var nilSet *IPSet
+	a, b := &IPSet{}, &IPSet{}
+	assert.False(t, a.Overlaps(b))
+	assert.False(t, nilSet.Overlaps(a))
+
+	a.InsertNet(parse("10.0.0.0/16"))
+	a.InsertNet(parse("2001:db8::/64"))
+	assert.False(t, a.Overlaps(nil))
+	assert.True(t, a.Overlaps(a))
+
+	b.InsertNet(parse("10.1.0.0/16"))
+	b.InsertNet(parse("2001:db8:1::/64"))
+	assert.False(t, a.Overlaps(b))
+
+	// Only one family overlaps and one network contains the other
+	b.Insert(ParseIP("2001:db8::5"))
+	assert.True(t, a.Overlaps(b))
+	assert.True(t, b.Overlaps(a))
+	b.Remove(ParseIP("2001:db8::5"))
+	b.InsertNet(parse("10.0.0.0/8"))
+	assert.True(t, a.Overlaps(b))
+	assert.True(t, b.Overlaps(a))
+}
+
+func TestIPSetOverlapsNet(t *testing.T) {
+	var nilSet *IPSet
+	assert.False(t, nilSet.OverlapsNet(parse("0.0.0.0/0")))
+
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.1.0/24"))
+	set.InsertNet(parse("2001:db8::/64"))
+	assert.True(t, set.OverlapsNet(parse("10.0.1.0/24")))
+	assert.True(t, set.OverlapsNet(parse("10.0.1.128/25")))
+	assert.True(t, set.OverlapsNet(parse("10.0.0.0/16")))
+	assert.True(t, set.OverlapsNet(parse("0.0.0.0/0")))
+	assert.False(t, set.OverlapsNet(parse("10.0.0.0/24")))
+	assert.False(t, set.OverlapsNet(parse("10.0.2.0/23")))
+	assert.True(t, set.OverlapsNet(parse("2001:db8::1/128")))
+	assert.False(t, set.OverlapsNet(parse("2001:db8:0:1::/64")))
+	assert.False(t, set.OverlapsNet(nil))
+	assert.False(t, set.OverlapsNet(&net.IPNet{IP: ParseIP("10.0.1.1"), Mask: net.CIDRMask(24, 32)}))
+}
+
+func TestIPSetOverlapsRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(506))
+	for i := 0; i < 500; i++ {
+		a, b := randomSet(r, 1+r.Intn(20)), randomSet(r, 1+r.Intn(20))
+		if r.Intn(2) == 0 {
+			// Share an IP at the end of one of the networks
+			nets := a.GetNetworks()
+			b.Insert(BroadcastAddr(nets[r.Intn(len(nets))]))
+		}
+		assert.Equal(t, a.Intersection(b).tree != nil, a.Overlaps(b))
+		n := b.GetNetworks()[0]
+		assert.Equal(t, a.CountWithin(n).Sign() != 0, a.OverlapsNet(n))
+	}
+}
+
+func TestIPSetSize(t *testing.T) {
+	var nilSet *IPSet
+	assert.Equal(t, big.NewInt(0), nilSet.Size())
+	set := &IPSet{}
+	assert.Equal(t, big.NewInt(0), set.Size())
+
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.Insert(ParseIP("192.0.2.1"))
+	assert.Equal(t, big.NewInt(257), set.Size())
+	set.InsertNet(parse("2001:db8::/64"))
+	assert.Equal(t, big.NewInt(0).Add(V6NetSize, big.NewInt(257)), set.Size())
+
+	set.InsertNet(parse("::/0"))
+	set.InsertNet(parse("0.0.0.0/0"))
+	expected := big.NewInt(0).Lsh(big.NewInt(1), 128)
+	assert.Equal(t, expected.Add(expected, big.NewInt(1<<32)), set.Size())
+
+	// The result is the caller's to change
+	set.Size().SetInt64(0)
+	assert.Equal(t, expected, set.Size())
+
+	set.RemoveNet(parse("0.0.0.0/0"))
+	set.RemoveNet(parse("::/0"))
+	assert.Equal(t, big.NewInt(0), set.Size())
+}
+
+func TestIPSetIsEmpty(t *testing.T) {
+	var nilSet *IPSet
+	assert.True(t, nilSet.IsEmpty())
+	set := &IPSet{}
+	assert.True(t, set.IsEmpty())
+
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.InsertNet(parse("2001:db8::/64"))
+	assert.False(t, set.IsEmpty())
+	set.RemoveNet(parse("10.0.0.0/25"))
+	set.RemoveNet(parse("2001:db8::/64"))
+	assert.False(t, set.IsEmpty())
+	set.RemoveNet(parse("10.0.0.128/25"))
+	assert.True(t, set.IsEmpty())
+	assert.Nil(t, set.Validate())
+
+	set.Insert(ParseIP("10.0.0.1"))
+	assert.False(t, set.IsEmpty())
+	set.Remove(ParseIP("10.0.0.1"))
+	assert.True(t, set.IsEmpty())
+}
+
+func TestIPSetNilReads(t *testing.T) {
+	var nilSet *IPSet
+	assert.False(t, nilSet.Contains(ParseIP("10.0.0.1")))
+	assert.False(t, nilSet.ContainsNet(parse("10.0.0.0/8")))
+	assert.Nil(t, nilSet.GetIPs(0))
+	ips, err := nilSet.GetIPsE(10)
+	assert.Nil(t, err)
+	assert.Nil(t, ips)
+	ips, err = nilSet.GetAllIPs(10)
+	assert.Nil(t, err)
+	assert.Nil(t, ips)
+	assert.Nil(t, nilSet.AppendGetIPs(nil, 10))
+	assert.Equal(t, []*net.IPNet{}, nilSet.GetNetworks())
+	assert.Nil(t, nilSet.String())
+
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/30"))
+	assert.Equal(t, []string{"10.0.0.0/30"}, set.Union(nil).String())
+	assert.Equal(t, []string{"10.0.0.0/30"}, nilSet.Union(set).String())
+	assert.Equal(t, []string{"10.0.0.0/30"}, set.Difference(nil).String())
+	assert.True(t, nilSet.Difference(set).IsEmpty())
+	assert.True(t, set.Intersection(nil).IsEmpty())
+	assert.True(t, nilSet.Intersection(set).IsEmpty())
+	set.UnionWith(nil)
+	assert.Equal(t, big.NewInt(4), set.Size())
+
+	// Every other read of a nil set gives what it does for an empty one
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	results := func(values ...interface{}) []interface{} { return values }
+	written := func(write func(w *strings.Builder) error) []interface{} {
+		var b strings.Builder
+		err := write(&b)
+		return results(b.String(), err)
+	}
+	net10 := parse("10.0.0.0/8")
+	reads := map[string]func(s *IPSet) interface{}{
+		"ToBitmap":    func(s *IPSet) interface{} { return results(s.ToBitmap(parse("10.0.0.0/24"))) },
+		"BloomFilter": func(s *IPSet) interface{} { return results(s.BloomFilter(0.01)) },
+		"DumpTree": func(s *IPSet) interface{} {
+			return written(func(w *strings.Builder) error { s.DumpTree(w); return nil })
+		},
+		"TreeString": func(s *IPSet) interface{} { return s.TreeString() },
+		"WriteNftElements": func(s *IPSet) interface{} {
+			return written(func(w *strings.Builder) error { return s.WriteNftElements(w, "blocked", DefaultNftElementsPerCommand) })
+		},
+		"WriteIPSetRestore": func(s *IPSet) interface{} {
+			return written(func(w *strings.Builder) error { return s.WriteIPSetRestore(w, "blocked", "hash:net") })
+		},
+		"Freeze":          func(s *IPSet) interface{} { return s.Freeze().Thaw().String() },
+		"PopFirst":        func(s *IPSet) interface{} { return results(s.PopFirst()) },
+		"PopFirstInNet":   func(s *IPSet) interface{} { return results(s.PopFirstInNet(net10)) },
+		"AllocateCIDR":    func(s *IPSet) interface{} { return results(s.AllocateCIDR(24, 4)) },
+		"RemoveNetDelta":  func(s *IPSet) interface{} { return s.RemoveNetDelta(net10) },
+		"ContainsNetE":    func(s *IPSet) interface{} { return results(s.ContainsNetE(net10)) },
+		"WithinNet":       func(s *IPSet) interface{} { return results(s.WithinNet(net10)) },
+		"FindOverlapping": func(s *IPSet) interface{} { return s.FindOverlapping(net10) },
+		"CountWithin":     func(s *IPSet) interface{} { return s.CountWithin(net10) },
+		"Complement":      func(s *IPSet) interface{} { return s.Complement(net10).String() },
+		"DifferenceBounded": func(s *IPSet) interface{} {
+			d, err := s.DifferenceBounded(set, 10)
+			return results(d.String(), err)
+		},
+		"AppendGetIPsBuf": func(s *IPSet) interface{} { return results(s.AppendGetIPsBuf(nil, nil, 10)) },
+		"GetIPNets":       func(s *IPSet) interface{} { return s.GetIPNets() },
+		"WalkNets": func(s *IPSet) interface{} {
+			var nets []*net.IPNet
+			s.WalkNets(func(n *net.IPNet) bool { nets = append(nets, n); return true })
+			return nets
+		},
+		"WalkIPs": func(s *IPSet) interface{} {
+			var ips []net.IP
+			s.WalkIPs(func(ip net.IP) bool { ips = append(ips, ip); return true })
+			return ips
+		},
+		"Overlaps":     func(s *IPSet) interface{} { return s.Overlaps(set) },
+		"OverlapsNet":  func(s *IPSet) interface{} { return s.OverlapsNet(net10) },
+		"Clone":        func(s *IPSet) interface{} { return s.Clone().String() },
+		"IsEmpty":      func(s *IPSet) interface{} { return s.IsEmpty() },
+		"Size":         func(s *IPSet) interface{} { return s.Size() },
+		"Equal":        func(s *IPSet) interface{} { return s.Equal(set) },
+		"IsSubsetOf":   func(s *IPSet) interface{} { return s.IsSubsetOf(set) },
+		"IsSupersetOf": func(s *IPSet) interface{} { return s.IsSupersetOf(set) },
+		"MarshalText":  func(s *IPSet) interface{} { return results(s.MarshalText()) },
+		"Validate":     func(s *IPSet) interface{} { return s.Validate() },
+		"MarshalJSON":  func(s *IPSet) interface{} { return results(s.MarshalJSON()) },
+		"MarshalYAML":  func(s *IPSet) interface{} { return results(s.MarshalYAML()) },
+		"Partition":    func(s *IPSet) interface{} { return results(s.Partition(1)) },
+		"PickIP":       func(s *IPSet) interface{} { return results(s.PickIP([]byte("key"))) },
+		"WriteRangeCSV": func(s *IPSet) interface{} {
+			return written(func(w *strings.Builder) error { return s.WriteRangeCSV(w) })
+		},
+		"AggregateWithSlack": func(s *IPSet) interface{} {
+			aggregated, extra := s.AggregateWithSlack(big.NewInt(0))
+			return results(aggregated.String(), extra.String())
+		},
+		"SaveFile": func(s *IPSet) interface{} {
+			path := filepath.Join(dir, "set")
+			err := s.SaveFile(path)
+			data, _ := ioutil.ReadFile(path)
+			return results(data, err)
+		},
+		"ExpandStride": func(s *IPSet) interface{} {
+			return results(s.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(1), 10))
+		},
+		"TranslatePrefix": func(s *IPSet) interface{} {
+			translated, err := s.TranslatePrefix(net10, parse("11.0.0.0/8"), false)
+			return results(translated.String(), err)
+		},
+		"V4":   func(s *IPSet) interface{} { return s.V4().Size() },
+		"V6":   func(s *IPSet) interface{} { return s.V6().Span() },
+		"Span": func(s *IPSet) interface{} { return results(s.Span()) },
+		"WriteIPs": func(s *IPSet) interface{} {
+			var b strings.Builder
+			n, err := s.WriteIPs(&b, "", 0)
+			return results(b.String(), n, err)
+		},
+	}
+	for name, read := range reads {
+		assert.Equal(t, read(&IPSet{}), read(nilSet), name)
+	}
+}
+
+func TestIPSetClone(t *testing.T) {
+	var nilSet *IPSet
+	clone := nilSet.Clone()
+	assert.True(t, clone.IsEmpty())
+	clone.InsertNet(parse("10.0.0.0/24"))
+	assert.Equal(t, []string{"10.0.0.0/24"}, clone.String())
+	assert.True(t, (&IPSet{}).Clone().IsEmpty())
+
+	r := rand.New(rand.NewSource(509))
+	set := randomSet(r, 100)
+	set.InsertNet(parse("2001:db8::/64"))
+	clone = set.Clone()
+	assert.True(t, set.Equal(clone))
+	assert.Nil(t, clone.Validate())
+	assert.Equal(t, set.tree.numNodes(), clone.tree.numNodes())
+	assert.Equal(t, set.tree.height(), clone.tree.height())
+
+	// Changing either one leaves the other alone
+	before := set.String()
+	clone.RemoveNet(parse("2001:db8::/65"))
+	clone.InsertNet(parse("192.0.2.0/24"))
+	assert.Equal(t, before, set.String())
+	assert.False(t, set.Equal(clone))
+	set.InsertNet(parse("10.0.0.0/8"))
+	assert.False(t, clone.ContainsNet(parse("10.0.0.0/8")))
+	assert.Nil(t, set.Validate())
+	assert.Nil(t, clone.Validate())
+
+	// The observer stays with the original
+	o := newRecordingObserver()
+	set.SetObserver(o)
+	clone = set.Clone()
+	clone.Insert(ParseIP("198.51.100.1"))
+	assert.Equal(t, 0, len(o.calls))
+}
+
+func TestIPSetClear(t *testing.T) {
+	r := rand.New(rand.NewSource(510))
+	set := randomSet(r, 200)
+	set.InsertNet(parse("2001:db8::/64"))
+	set.Clear()
+	assert.True(t, set.IsEmpty())
+	assert.Equal(t, big.NewInt(0), set.Size())
+	assert.False(t, set.Contains(ParseIP("2001:db8::1")))
+	assert.Nil(t, set.Validate())
+
+	// It behaves like a new set afterwards
+	fresh := &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/24", "10.0.1.0/24", "2001:db8::/64", "10.0.0.128/25"} {
+		set.InsertNet(parse(cidr))
+		fresh.InsertNet(parse(cidr))
+	}
+	assert.Nil(t, set.Validate())
+	assert.Equal(t, fresh.Size(), set.Size())
+	assert.Equal(t, fresh.String(), set.String())
+	assert.True(t, set.Contains(ParseIP("10.0.1.1")))
+
+	// The observer hears of the IPs that were removed
+	o := newRecordingObserver()
+	set.SetObserver(o)
+	set.Clear()
+	assert.Equal(t, []string{"v4 -512", "v6 -18446744073709551616"}, o.calls)
+	set.Clear()
+	assert.Equal(t, 2, len(o.calls))
+}
+
+func TestIPSetWalkNets(t *testing.T) {
+	var nilSet *IPSet
+	nilSet.WalkNets(func(n *net.IPNet) bool {
+		t.Errorf("called with %s", n)
+		return true
+	})
+
+	r := rand.New(rand.NewSource(511))
+	set := randomSet(r, 50)
+	set.InsertNet(parse("2001:db8::/64"))
+	var walked []string
+	set.WalkNets(func(n *net.IPNet) bool {
+		walked = append(walked, n.String())
+		return true
+	})
+	assert.Equal(t, set.String(), walked)
+
+	// It stops when fn returns false
+	walked = nil
+	set.WalkNets(func(n *net.IPNet) bool {
+		walked = append(walked, n.String())
+		return len(walked) < 3
+	})
+	assert.Equal(t, set.String()[:3], walked)
+
+	// The networks are the caller's to change
+	set.WalkNets(func(n *net.IPNet) bool {
+		n.IP[0] = 0
+		return true
+	})
+	assert.Nil(t, set.Validate())
+	assert.True(t, strings.HasPrefix(set.String()[0], "10."))
+}
+
+func TestIPSetWalkIPs(t *testing.T) {
+	var nilSet *IPSet
+	nilSet.WalkIPs(func(ip net.IP) bool {
+		t.Errorf("called with %s", ip)
+		return true
+	})
+
+	r := rand.New(rand.NewSource(512))
+	set := randomSet(r, 50)
+	set.InsertNet(parse("2001:db8::/126"))
+	set.Insert(ParseIP("255.255.255.255"))
+	var walked []net.IP
+	set.WalkIPs(func(ip net.IP) bool {
+		walked = append(walked, ip)
+		return true
+	})
+	assert.Equal(t, set.GetIPs(0), walked)
+
+	// The IPs kept didn't change as the walk went on, nor do they when
+	// appended to
+	assert.Equal(t, 4, cap(walked[0]))
+	_ = append(walked[0], 1)
+	assert.Equal(t, set.GetIPs(1)[0], walked[0])
+	assert.Equal(t, set.GetIPs(2)[1], walked[1])
+
+	// It stops when fn returns false, even in a huge set
+	set.InsertNet(parse("::/0"))
+	count := 0
+	set.WalkIPs(func(ip net.IP) bool {
+		count++
+		return !ip.Equal(ParseIP("::1:0"))
+	})
+	assert.Equal(t, set.V4().Size().Int64()+0x10001, int64(count))
+}
+
+func BenchmarkIPSetWalkIPs(b *testing.B) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/16"))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		set.WalkIPs(func(ip net.IP) bool {
+			return true
+		})
+	}
+}
+
+func TestIPSetMarshalText(t *testing.T) {
+	var nilSet *IPSet
+	text, err := nilSet.MarshalText()
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(text))
+
+	set := &IPSet{}
+	set.InsertNet(parse("2001:db8::/64"))
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.Insert(ParseIP("192.0.2.1"))
+	text, err = set.MarshalText()
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.0/24,192.0.2.1/32,2001:db8::/64", string(text))
+
+	parsed := &IPSet{}
+	assert.Nil(t, parsed.UnmarshalText(text))
+	assert.True(t, set.Equal(parsed))
+
+	// Newlines, spaces and blanks, as in a config file
+	assert.Nil(t, parsed.UnmarshalText([]byte("10.0.0.0/25\n 10.0.0.128/25 ,192.0.2.1\n\n2001:db8::/64,\n")))
+	assert.True(t, set.Equal(parsed))
+	assert.Nil(t, parsed.UnmarshalText(nil))
+	assert.True(t, parsed.IsEmpty())
+
+	err = set.UnmarshalText([]byte("10.0.0.0/8,\n10.1.2.3/16"))
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	assert.True(t, strings.HasPrefix(err.Error(), `network "10.1.2.3/16": `), err.Error())
+	err = set.UnmarshalText([]byte("10.0.0.0/8 192.0.2.1"))
+	assert.True(t, errors.Is(err, ErrInvalidCIDR), err.Error())
+	assert.Equal(t, "10.0.0.0/24,192.0.2.1/32,2001:db8::/64", strings.Join(set.String(), ","))
+
+	// JSON keeps to an array
+	data, err := json.Marshal(set)
+	assert.Nil(t, err)
+	assert.Equal(t, `["10.0.0.0/24","192.0.2.1/32","2001:db8::/64"]`, string(data))
+}
+
+func TestIPSetPopFirst(t *testing.T) {
+	var nilSet *IPSet
+	_, ok := nilSet.PopFirst()
+	assert.False(t, ok)
+
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/16"))
+	set.InsertNet(parse("2001:db8::/127"))
+	ip, ok := set.PopFirst()
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.0", ip.String())
+	assert.Equal(t, 4, len(ip))
+	assert.Nil(t, set.Validate())
+	assert.Equal(t, big.NewInt(65535+2), set.Size())
+	ip, _ = set.PopFirst()
+	assert.Equal(t, "10.0.0.1", ip.String())
+	assert.Equal(t, "10.0.0.2/31", set.String()[0])
+
+	// Then the IPv6 ones, and then none
+	set.RemoveNet(parse("10.0.0.0/16"))
+	ip, _ = set.PopFirst()
+	assert.Equal(t, "2001:db8::", ip.String())
+	ip, _ = set.PopFirst()
+	assert.Equal(t, "2001:db8::1", ip.String())
+	ip, ok = set.PopFirst()
+	assert.False(t, ok)
+	assert.Nil(t, ip)
+	assert.True(t, set.IsEmpty())
+
+	// The observer hears of each one
+	o := newRecordingObserver()
+	set.SetObserver(o)
+	set.Insert(ParseIP("192.0.2.1"))
+	set.PopFirst()
+	assert.Equal(t, []string{"v4 +1", "v4 -1"}, o.calls)
+}
+
+func TestIPSetPopFirstInNet(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/16"))
+	set.InsertNet(parse("10.2.0.128/25"))
+
+	ip, ok := set.PopFirstInNet(parse("10.0.4.0/24"))
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.4.0", ip.String())
+	ip, _ = set.PopFirstInNet(parse("10.0.4.0/24"))
+	assert.Equal(t, "10.0.4.1", ip.String())
+	ip, _ = set.PopFirstInNet(parse("10.2.0.0/16"))
+	assert.Equal(t, "10.2.0.128", ip.String())
+	ip, _ = set.PopFirstInNet(parse("0.0.0.0/0"))
+	assert.Equal(t, "10.0.0.0", ip.String())
+	assert.Nil(t, set.Validate())
+	assert.Equal(t, big.NewInt(65536+128-4), set.Size())
+
+	_, ok = set.PopFirstInNet(parse("10.1.0.0/16"))
+	assert.False(t, ok)
+	_, ok = set.PopFirstInNet(parse("2001:db8::/32"))
+	assert.False(t, ok)
+	_, ok = set.PopFirstInNet(nil)
+	assert.False(t, ok)
+	_, ok = set.PopFirstInNet(&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)})
+	assert.False(t, ok)
+
+	ip, ok = set.PopFirstInNet(parse("10.2.0.255/32"))
+	assert.True(t, ok)
+	assert.Equal(t, "10.2.0.255", ip.String())
+	_, ok = set.PopFirstInNet(parse("10.2.0.255/32"))
+	assert.False(t, ok)
+}
+
+func TestIPSetPopFirstDrains(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/22"))
+	set.Remove(ParseIP("10.0.1.7"))
+	expected := set.GetIPs(0)
+	var popped []net.IP
+	for ip, ok := set.PopFirst(); ok; ip, ok = set.PopFirst() {
+		popped = append(popped, ip)
+		if len(popped)%100 == 0 {
+			assert.Nil(t, set.Validate())
+		}
+	}
+	assert.Equal(t, expected, popped)
+	assert.True(t, set.IsEmpty())
+}
+
+func BenchmarkIPSetPopFirst(b *testing.B) {
+	set := &IPSet{}
+	for i := 0; i < b.N; i++ {
+		if set.IsEmpty() {
+			set.InsertNet(parse("10.0.0.0/16"))
+		}
+		set.PopFirst()
+	}
+}
+
+func TestIPSetAllocateCIDR(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.64/26"))
+	set.InsertNet(parse("10.0.1.0/24"))
+	set.InsertNet(parse("10.0.2.0/25"))
+	set.InsertNet(parse("2001:db8::/56"))
+
+	// The first block that fits, even if a later one is a closer fit
+	n, err := set.AllocateCIDR(25, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.1.0/25", n.String())
+	n, _ = set.AllocateCIDR(26, 4)
+	assert.Equal(t, "10.0.0.64/26", n.String())
+	n, _ = set.AllocateCIDR(26, 4)
+	assert.Equal(t, "10.0.1.128/26", n.String())
+	n, _ = set.AllocateCIDR(64, 6)
+	assert.Equal(t, "2001:db8::/64", n.String())
+	assert.Nil(t, set.Validate())
+	assert.Equal(t, []string{"10.0.1.192/26", "10.0.2.0/25", "2001:db8:0:1::/64", "2001:db8:0:2::/63",
+		"2001:db8:0:4::/62", "2001:db8:0:8::/61", "2001:db8:0:10::/60", "2001:db8:0:20::/59",
+		"2001:db8:0:40::/58", "2001:db8:0:80::/57"}, set.String())
+
+	// Larger than any network in the set, though not than all of it
+	o := newRecordingObserver()
+	var failed []int
+	set.SetObserver(&allocationObserver{o, &failed})
+	_, err = set.AllocateCIDR(24, 4)
+	assert.True(t, errors.Is(err, ErrNoFreeBlock))
+	assert.Equal(t, []int{24}, failed)
+	_, err = set.AllocateCIDR(56, 6)
+	assert.True(t, errors.Is(err, ErrNoFreeBlock))
+	assert.Equal(t, []int{24, 56}, failed)
+
+	// Exactly one block of the size
+	n, err = set.AllocateCIDR(25, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.2.0/25", n.String())
+	_, err = set.AllocateCIDR(25, 4)
+	assert.True(t, errors.Is(err, ErrNoFreeBlock))
+	assert.Equal(t, []string{"v4 -128"}, o.calls)
+
+	for _, c := range []struct {
+		prefixLen, version int
+		kind               error
+	}{
+		{33, 4, ErrInvalidPrefixLength},
+		{-1, 4, ErrInvalidPrefixLength},
+		{129, 6, ErrInvalidPrefixLength},
+		{24, 5, ErrInvalidArgument},
+	} {
+		_, err := set.AllocateCIDR(c.prefixLen, c.version)
+		assert.True(t, errors.Is(err, c.kind), "/%d IPv%d: %v", c.prefixLen, c.version, err)
+		assert.False(t, errors.Is(err, ErrNoFreeBlock))
+	}
+	assert.Equal(t, []int{24, 56, 25}, failed)
+
+	// An empty set has nothing to allocate
+	_, err = (&IPSet{}).AllocateCIDR(32, 4)
+	assert.True(t, errors.Is(err, ErrNoFreeBlock))
+}
+
+// allocationObserver records the prefix lengths of failed allocations
+type allocationObserver struct {
+	*recordingObserver
+	failed *[]int
+}
+
+func (o *allocationObserver) AllocationFailed(prefixLen int) {
+	*o.failed = append(*o.failed, prefixLen)
+}
+
+func TestIPSetAllocateCIDRRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(525))
+	for i := 0; i < 200; i++ {
+		set := randomSet(r, 1+r.Intn(50))
+		before := set.Clone()
+		prefixLen := 28 + r.Intn(5)
+		n, err := set.AllocateCIDR(prefixLen, 4)
+		if err != nil {
+			assert.True(t, errors.Is(err, ErrNoFreeBlock))
+			assert.True(t, before.Equal(set))
+			continue
+		}
+		// It was all in the set and starts the first network that is large
+		// enough
+		assert.True(t, before.ContainsNet(n))
+		assert.False(t, set.OverlapsNet(n))
+		assert.Equal(t, "", ExplainDifference(before.Difference(NewIPSetFromNets([]*net.IPNet{n})), set))
+		for _, m := range before.GetNetworks() {
+			if ones, bits := m.Mask.Size(); bits == 32 && ones <= prefixLen {
+				assert.Equal(t, m.IP.String(), n.IP.String())
+				break
+			}
+		}
+	}
+}
+
+func TestIPSetInsertNetDelta(t *testing.T) {
+	set := &IPSet{}
+	assert.Equal(t, []string{"10.0.1.0/24"}, netStrings(set.InsertNetDelta(parse("10.0.1.0/24"))))
+	assert.Nil(t, set.InsertNetDelta(parse("10.0.1.0/24")))
+	assert.Nil(t, set.InsertNetDelta(parse("10.0.1.128/25")))
+	set.InsertNet(parse("10.0.6.0/23"))
+
+	// The existing networks are left out, so what's added is split
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.2.0/23", "10.0.4.0/23"},
+		netStrings(set.InsertNetDelta(parse("10.0.0.0/21"))))
+	assert.Equal(t, []string{"10.0.0.0/21"}, set.String())
+
+	assert.Nil(t, set.InsertNetDelta(nil))
+	assert.Nil(t, set.InsertNetDelta(&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)}))
+}
+
+func TestIPSetRemoveNetDelta(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/16"))
+	assert.Equal(t, []string{"10.0.1.0/24"}, netStrings(set.RemoveNetDelta(parse("10.0.1.0/24"))))
+	assert.Nil(t, set.RemoveNetDelta(parse("10.0.1.0/24")))
+	assert.Nil(t, set.RemoveNetDelta(parse("10.1.0.0/16")))
+
+	set.InsertNet(parse("10.2.0.0/24"))
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.2.0/23", "10.0.4.0/22", "10.0.8.0/21", "10.0.16.0/20",
+		"10.0.32.0/19", "10.0.64.0/18", "10.0.128.0/17", "10.2.0.0/24"},
+		netStrings(set.RemoveNetDelta(parse("10.0.0.0/14"))))
+	assert.Equal(t, 0, len(set.GetNetworks()))
+
+	assert.Nil(t, set.RemoveNetDelta(nil))
+}
+
+func TestIPSetNetDeltaRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(489))
+	set, mirror := &IPSet{}, &IPSet{}
+	for i := 0; i < 5000; i++ {
+		n := randomSet(r, 1).GetNetworks()[0]
+		if r.Intn(8) == 0 {
+			n.Mask = net.CIDRMask(r.Intn(8)+20, 8*len(n.IP))
+			n.IP = n.IP.Mask(n.Mask)
+		}
+		if r.Intn(2) == 0 {
+			added := set.InsertNetDelta(n)
+			for _, a := range added {
+				assert.False(t, mirror.tree.overlap(prefixFromNet(a)).Sign() != 0, a.String())
+				mirror.InsertNet(a)
+			}
+		} else {
+			removed := set.RemoveNetDelta(n)
+			for _, m := range removed {
+				assert.True(t, mirror.ContainsNet(m), m.String())
+				mirror.RemoveNet(m)
+			}
+		}
+		if i%100 == 0 {
+			assert.Equal(t, "", ExplainDifference(set, mirror))
+		}
+	}
+	assert.Equal(t, "", ExplainDifference(set, mirror))
+}
+
+func TestIPSetCountWithin(t *testing.T) {
+	set := &IPSet{}
+	assert.Equal(t, big.NewInt(0), set.CountWithin(parse("10.0.0.0/8")))
+
+	set.InsertNet(parse("10.0.4.0/26"))
+	set.InsertNet(parse("10.0.4.128/31"))
+	set.InsertNet(parse("10.0.0.0/22"))
+	assert.Equal(t, big.NewInt(66), set.CountWithin(parse("10.0.4.0/24")))
+	assert.Equal(t, big.NewInt(256), set.CountWithin(parse("10.0.1.0/24")))
+	assert.Equal(t, big.NewInt(1), set.CountWithin(parse("10.0.3.255/32")))
+	assert.Equal(t, big.NewInt(1024+66), set.CountWithin(parse("10.0.0.0/16")))
+	assert.Equal(t, big.NewInt(0), set.CountWithin(parse("10.0.5.0/24")))
+	assert.Equal(t, big.NewInt(0), set.CountWithin(parse("::/0")))
+	assert.Equal(t, big.NewInt(0), set.CountWithin(nil))
+	assert.Equal(t, big.NewInt(0), (*IPSet)(nil).CountWithin(parse("10.0.0.0/8")))
+}
+
+func TestIPSetCountWithinRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(479))
+	set := randomSet(r, 20000)
+	for i := 0; i < 1000; i++ {
+		var n *net.IPNet
+		if i%4 == 0 {
+			ip := ParseIP("2001:db8::")
+			ip[13], ip[14] = byte(r.Intn(256)), byte(r.Intn(256))
+			n = &net.IPNet{IP: ip, Mask: net.CIDRMask(104+r.Intn(25), 128)}
+		} else {
+			ip := IPv4(10, byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+			n = &net.IPNet{IP: ip, Mask: net.CIDRMask(8+r.Intn(25), 32)}
+		}
+		n.IP = n.IP.Mask(n.Mask)
+		query := &IPSet{}
+		query.InsertNet(n)
+		assert.Equal(t, set.Intersection(query).tree.size(), set.CountWithin(n), n.String())
+	}
+}
+
+func benchmarkIntersection(b *testing.B, intersect func(s, other *IPSet) *IPSet) {
+	r := rand.New(rand.NewSource(447))
+	s1, s2 := randomSet(r, 100000), randomSet(r, 100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intersect(s1, s2)
+	}
+}
+
+func BenchmarkIPSetIntersection(b *testing.B) {
+	benchmarkIntersection(b, (*IPSet).Intersection)
+}
+
+func BenchmarkIPSetIntersectionByLookup(b *testing.B) {
+	benchmarkIntersection(b, intersectionByLookup)
+}
+
+// unionByInsert is the union as it was computed before, by inserting both
+// sets into a new one.
+func unionByInsert(s, other *IPSet) *IPSet {
+	result := &IPSet{}
+	s.tree.walk(func(node *ipTree) {
+		result.insertPrefix(node.prefix)
+	})
+	other.tree.walk(func(node *ipTree) {
+		result.insertPrefix(node.prefix)
+	})
+	return result
+}
+
+func TestIPSetUnionRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(448))
+	for _, sizes := range [][2]int{{20000, 20000}, {20000, 10}, {10, 20000}, {0, 100}, {100, 0}} {
+		a, b := randomSet(r, sizes[0]), randomSet(r, sizes[1])
+		aNets, bNets := a.String(), b.String()
+		expected := unionByInsert(a, b)
+
+		union := a.Union(b)
+		assert.Equal(t, expected.String(), union.String())
+		assert.True(t, union.tree.height() <= uint(3*bits.Len(uint(union.tree.numNodes()))), "height %d", union.tree.height())
+		assert.Nil(t, union.Validate())
+
+		// The operands are left alone
+		assert.Equal(t, aNets, a.String())
+		assert.Equal(t, bNets, b.String())
+		union.InsertNet(parse("0.0.0.0/0"))
+		assert.Equal(t, aNets, a.String())
+		assert.Equal(t, bNets, b.String())
+
+		a.UnionWith(b)
+		assert.Equal(t, expected.String(), a.String())
+		assert.Nil(t, a.Validate())
+		assert.Equal(t, bNets, b.String())
+	}
+}
+
+func TestIPSetUnionWithSelf(t *testing.T) {
+	set := randomSet(rand.New(rand.NewSource(448)), 1000)
+	nets := set.String()
+	set.UnionWith(set)
+	assert.Equal(t, nets, set.String())
+	assert.Equal(t, nets, set.Union(set).String())
+}
+
+func benchmarkUnion(b *testing.B, union func(s, other *IPSet) *IPSet) {
+	r := rand.New(rand.NewSource(448))
+	large, small := randomSet(r, 300000), randomSet(r, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		union(small, large)
+	}
+}
+
+func BenchmarkIPSetUnion(b *testing.B) {
+	benchmarkUnion(b, (*IPSet).Union)
+}
+
+func BenchmarkIPSetUnionByInsert(b *testing.B) {
+	benchmarkUnion(b, unionByInsert)
+}
+
+func BenchmarkIPSetUnionWith(b *testing.B) {
+	r := rand.New(rand.NewSource(448))
+	large, small := randomSet(r, 300000), randomSet(r, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		large.UnionWith(small)
+	}
+}
+
+func TestIPSetComplement(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.InsertNet(parse("10.0.3.0/24"))
+	set.InsertNet(parse("10.0.7.255/32"))
+	set.InsertNet(parse("2001:db8::/64"))
+
+	for _, c := range []struct {
+		universe string
+		expected []string
+	}{
+		// Covered at both edges
+		{"10.0.0.0/21", []string{"10.0.1.0/24", "10.0.2.0/24", "10.0.4.0/23", "10.0.6.0/24", "10.0.7.0/25",
+			"10.0.7.128/26", "10.0.7.192/27", "10.0.7.224/28", "10.0.7.240/29", "10.0.7.248/30", "10.0.7.252/31",
+			"10.0.7.254/32"}},
+		{"10.0.0.0/22", []string{"10.0.1.0/24", "10.0.2.0/24"}},
+		// Fully covered
+		{"10.0.0.0/24", nil},
+		{"10.0.3.128/25", nil},
+		{"2001:db8::/80", nil},
+		// Not covered at all
+		{"10.1.0.0/16", []string{"10.1.0.0/16"}},
+		{"192.0.2.0/24", []string{"192.0.2.0/24"}},
+		{"2001:db8::/62", []string{"2001:db8:0:1::/64", "2001:db8:0:2::/63"}},
+	} {
+		complement := set.Complement(parse(c.universe))
+		assert.Equal(t, c.expected, complement.String(), c.universe)
+		assert.Nil(t, complement.Validate())
+	}
+
+	var nilSet *IPSet
+	assert.Equal(t, []string{"10.0.0.0/8"}, nilSet.Complement(parse("10.0.0.0/8")).String())
+	assert.True(t, set.Complement(nil).IsEmpty())
+	assert.True(t, set.Complement(&net.IPNet{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(8, 32)}).IsEmpty())
+}
+
+func TestIPSetComplementRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(519))
+	for i := 0; i < 500; i++ {
+		set := randomSet(r, 1+r.Intn(50))
+		n := set.GetNetworks()[0]
+		n.Mask = net.CIDRMask(r.Intn(8)+8*len(n.IP)-16, 8*len(n.IP))
+		n.IP = n.IP.Mask(n.Mask)
+		universe := &IPSet{}
+		universe.InsertNet(n)
+		assert.Equal(t, "", ExplainDifference(universe.Difference(set), set.Complement(n)))
+	}
+}
+
+func TestIPSetDifferenceBounded(t *testing.T) {
+	s1, s2 := &IPSet{}, &IPSet{}
+	s1.InsertNet(parse("10.0.0.0/24"))
+	s1.InsertNet(parse("10.0.2.0/24"))
+	s2.InsertNet(parse("10.0.0.0/25"))
+	s2.InsertNet(parse("10.0.2.0/26"))
+
+	diff, err := s1.DifferenceBounded(s2, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, s1.Difference(s2).GetNetworks(), diff.GetNetworks())
+
+	diff, err = s1.DifferenceBounded(s2, 2)
+	assert.Nil(t, diff)
+	var limitErr *FragmentLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 3, limitErr.Fragments)
+	assert.Equal(t, "difference has 3 networks which is more than 2", err.Error())
+
+	diff, err = s1.DifferenceBounded(s1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{}, diff.GetNetworks())
+
+	_, err = s1.DifferenceBounded(s2, -1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+func TestFreeCIDRs(t *testing.T) {
+	used := []net.IP{ParseIP("10.0.4.1"), ParseIP("10.0.4.2"), ParseIP("10.0.5.0"), ParseIP("10.0.4.1"), net.ParseIP("10.0.7.255")}
+	free, err := FreeCIDRs(parse("10.0.4.0/22"), used, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{
+		parse("10.0.4.0/32"), parse("10.0.4.3/32"), parse("10.0.4.4/30"), parse("10.0.4.8/29"),
+		parse("10.0.4.16/28"), parse("10.0.4.32/27"), parse("10.0.4.64/26"), parse("10.0.4.128/25"),
+		parse("10.0.5.1/32"), parse("10.0.5.2/31"), parse("10.0.5.4/30"), parse("10.0.5.8/29"),
+		parse("10.0.5.16/28"), parse("10.0.5.32/27"), parse("10.0.5.64/26"), parse("10.0.5.128/25"),
+		parse("10.0.6.0/24"),
+		parse("10.0.7.0/25"), parse("10.0.7.128/26"), parse("10.0.7.192/27"), parse("10.0.7.224/28"),
+		parse("10.0.7.240/29"), parse("10.0.7.248/30"), parse("10.0.7.252/31"), parse("10.0.7.254/32"),
+	}, free)
+
+	// Without the network and broadcast addresses
+	free, err = FreeCIDRs(parse("10.0.4.0/29"), []net.IP{ParseIP("10.0.4.3")}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{parse("10.0.4.1/32"), parse("10.0.4.2/32"), parse("10.0.4.4/31"), parse("10.0.4.6/32")}, free)
+	free, _ = FreeCIDRs(parse("10.0.4.0/31"), nil, true)
+	assert.Equal(t, []*net.IPNet{parse("10.0.4.0/31")}, free)
+	free, _ = FreeCIDRs(parse("2001:db8::/126"), nil, true)
+	assert.Equal(t, []*net.IPNet{parse("2001:db8::/126")}, free)
+
+	// All used
+	free, err = FreeCIDRs(parse("10.0.4.0/31"), []net.IP{ParseIP("10.0.4.0"), ParseIP("10.0.4.1")}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{}, free)
+}
+
+func TestFreeCIDRsErrors(t *testing.T) {
+	used := []net.IP{ParseIP("10.0.4.1"), ParseIP("10.0.8.1"), nil, ParseIP("2001:db8::1")}
+	free, err := FreeCIDRs(parse("10.0.4.0/22"), used, false)
+	assert.Nil(t, free)
+	assert.True(t, errors.Is(err, ErrNotInNetwork))
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+	assert.EqualError(t, err, `used[1] (10.0.8.1) is not in 10.0.4.0/22
+used[2] has invalid length 0
+used[3] (2001:db8::1) is not in 10.0.4.0/22`)
+
+	_, err = FreeCIDRs(parse("10.0.4.1/22"), nil, false)
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+}
@@ -1,14 +1,20 @@
 package netaddr
 
 import (
-	"bytes"
-	"errors"
+	"math"
 	"math/big"
 	"net"
 )
 
+// ipTree is a treap of disjoint networks. It is ordered by network address
+// like a binary search tree and, to keep it balanced no matter the order of
+// insertion, no node has a higher priority than its parent. A new node gets a
+// keyed hash of its network as its priority, so the expected depth is
+// logarithmic even for networks chosen to unbalance it.
 type ipTree struct {
-	net             *net.IPNet
+	// The prefix and priority come first so that they pack into 24 bytes
+	prefix          ipPrefix
+	priority        uint32
 	left, right, up *ipTree
 }
 
@@ -36,29 +42,141 @@ func (t *ipTree) setRight(child *ipTree) {
 	}
 }
 
-// trimLeft trims CIDRs that overlap top from the left child
-func (t *ipTree) trimLeft(top *ipTree) *ipTree {
+// rotateUp moves the node above its parent without changing the order of the
+// tree.
+func (t *ipTree) rotateUp() {
+	parent := t.up
+	grandparent := parent.up
+	if t == parent.left {
+		parent.setLeft(t.right)
+		t.setRight(parent)
+	} else {
+		parent.setRight(t.left)
+		t.setLeft(parent)
+	}
+
+	switch {
+	case grandparent == nil:
+		t.up = nil
+	case parent == grandparent.left:
+		grandparent.setLeft(t)
+	default:
+		grandparent.setRight(t)
+	}
+}
+
+// outranks returns true if t belongs above other in the tree. Priorities can
+// be equal, so ties go to the lower network, which keeps the shape of the tree
+// deterministic for a given sequence of operations within one process.
+func (t *ipTree) outranks(other *ipTree) bool {
+	if t.priority != other.priority {
+		return t.priority > other.priority
+	}
+	return t.prefix.compare(other.prefix) < 0
+}
+
+// buildTree builds a tree from prefixes that are already in order, disjoint
+// and aggregated. It is the treap that inserting them would produce, built in
+// linear time by keeping the right spine of the tree on a stack.
+func buildTree(prefixes []ipPrefix) *ipTree {
+	spine := []*ipTree{}
+	for _, p := range prefixes {
+		node := &ipTree{prefix: p, priority: p.priority()}
+
+		// Nodes on the spine that node outranks become its left subtree
+		var left *ipTree
+		for len(spine) != 0 && node.outranks(spine[len(spine)-1]) {
+			left = spine[len(spine)-1]
+			spine = spine[:len(spine)-1]
+		}
+		node.setLeft(left)
+		if len(spine) != 0 {
+			spine[len(spine)-1].setRight(node)
+		}
+		spine = append(spine, node)
+	}
+
+	if len(spine) == 0 {
+		return nil
+	}
+	return spine[0]
+}
+
+// balanceTree links the given nodes, which must be in order, into a perfectly
+// balanced tree and returns its top. The priorities of the nodes are replaced
+// with ones that decrease with depth so that it remains a valid treap.
+func balanceTree(nodes []*ipTree) *ipTree {
+	for _, node := range nodes {
+		node.left, node.right, node.up = nil, nil, nil
+	}
+
+	var balance func(nodes []*ipTree, depth uint32) *ipTree
+	balance = func(nodes []*ipTree, depth uint32) *ipTree {
+		if len(nodes) == 0 {
+			return nil
+		}
+		mid := len(nodes) / 2
+		top := nodes[mid]
+		top.priority = math.MaxUint32 - depth
+		top.setLeft(balance(nodes[:mid], depth+1))
+		top.setRight(balance(nodes[mid+1:], depth+1))
+		return top
+	}
+	return balance(nodes, 0)
+}
+
+// clone returns a copy of the tree with the same shape and priorities
+func (t *ipTree) clone() *ipTree {
 	if t == nil {
 		return nil
 	}
+	type pair struct {
+		node, copy *ipTree
+	}
+	top := &ipTree{prefix: t.prefix, priority: t.priority}
+	stack := []pair{{t, top}}
+	for len(stack) != 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if left := p.node.left; left != nil {
+			p.copy.setLeft(&ipTree{prefix: left.prefix, priority: left.priority})
+			stack = append(stack, pair{left, p.copy.left})
+		}
+		if right := p.node.right; right != nil {
+			p.copy.setRight(&ipTree{prefix: right.prefix, priority: right.priority})
+			stack = append(stack, pair{right, p.copy.right})
+		}
+	}
+	return top
+}
 
-	if ContainsNet(top.net, t.net) {
-		return t.left.trimLeft(top)
+// trimLeft trims CIDRs that overlap top from the left child
+func (t *ipTree) trimLeft(top *ipTree) *ipTree {
+	for t != nil && top.prefix.contains(t.prefix) {
+		t = t.left
+	}
+	for node := t; node != nil; node = node.right {
+		right := node.right
+		for right != nil && top.prefix.contains(right.prefix) {
+			right = right.left
+		}
+		node.setRight(right)
 	}
-	t.setRight(t.right.trimLeft(top))
 	return t
 }
 
 // trimRight trims CIDRs that overlap top from the right child
 func (t *ipTree) trimRight(top *ipTree) *ipTree {
-	if t == nil {
-		return nil
+	for t != nil && top.prefix.contains(t.prefix) {
+		t = t.right
 	}
-
-	if ContainsNet(top.net, t.net) {
-		return t.right.trimRight(top)
+	for node := t; node != nil; node = node.left {
+		left := node.left
+		for left != nil && top.prefix.contains(left.prefix) {
+			left = left.right
+		}
+		node.setLeft(left)
 	}
-	t.setLeft(t.left.trimRight(top))
 	return t
 }
 
@@ -67,50 +185,114 @@ func (t *ipTree) trimRight(top *ipTree) *ipTree {
 // subsets are removed from the tree. This method does not optimize the tree by
 // adding CIDRs that can be combined.
 func (t *ipTree) insert(newNode *ipTree) *ipTree {
-	if t == nil {
-		return newNode
-	}
+	var parent *ipTree
+	newNode.priority = newNode.prefix.priority()
+	for node := t; node != nil; {
+		if node.prefix.contains(newNode.prefix) {
+			return t
+		}
 
-	if ContainsNet(t.net, newNode.net) {
-		return t
-	}
+		if newNode.prefix.contains(node.prefix) {
+			// Replace the node and trim its subtrees. Taking over its
+			// priority keeps the heap in order.
+			newNode.priority = node.priority
+			newNode.setLeft(node.left.trimLeft(newNode))
+			newNode.setRight(node.right.trimRight(newNode))
+			break
+		}
 
-	if ContainsNet(newNode.net, t.net) {
-		// Replace the current top node and trim the tree
-		newNode.setLeft(t.left.trimLeft(newNode))
-		newNode.setRight(t.right.trimRight(newNode))
+		parent = node
+		if newNode.prefix.compare(node.prefix) < 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
 
-		// Check the left-most leaf to see if it can be combined with this one
+	if parent == nil {
 		return newNode
 	}
-
-	if bytes.Compare(newNode.net.IP, t.net.IP) < 0 {
-		t.setLeft(t.left.insert(newNode))
+	if newNode.prefix.compare(parent.prefix) < 0 {
+		parent.setLeft(newNode)
 	} else {
-		t.setRight(t.right.insert(newNode))
+		parent.setRight(newNode)
+	}
+
+	for newNode.up != nil && newNode.outranks(newNode.up) {
+		newNode.rotateUp()
+	}
+	if newNode.up == nil {
+		return newNode
 	}
 	return t
 }
 
-// contains returns true if the given IP is in the set.
-func (t *ipTree) contains(newNode *ipTree) bool {
-	if t == nil || newNode == nil {
-		return false
+// contains returns true if the given prefix is in the set.
+func (t *ipTree) contains(p ipPrefix) bool {
+	return t.find(p) != nil
+}
+
+// find returns the node whose prefix contains the given one or nil if there
+// is none.
+func (t *ipTree) find(p ipPrefix) *ipTree {
+	for node := t; node != nil; {
+		if node.prefix.contains(p) {
+			return node
+		}
+		if p.contains(node.prefix) {
+			return nil
+		}
+		if p.compare(node.prefix) < 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
 	}
+	return nil
+}
 
-	if ContainsNet(t.net, newNode.net) {
-		return true
+// lowerBound returns the first node in the tree whose address is not less
+// than that of p or nil if there is none.
+func (t *ipTree) lowerBound(p ipPrefix) (lb *ipTree) {
+	for node := t; node != nil; {
+		if node.prefix.compare(p) >= 0 {
+			lb = node
+			node = node.left
+		} else {
+			node = node.right
+		}
 	}
-	if ContainsNet(newNode.net, t.net) {
-		return false
+	return
+}
+
+// overlap returns the number of IPs of the given prefix that are in the set
+func (t *ipTree) overlap(p ipPrefix) *big.Int {
+	if t.find(p) != nil {
+		return p.size()
+	}
+	n := big.NewInt(0)
+	for node := t.lowerBound(p); node != nil && p.contains(node.prefix); node = node.next() {
+		n.Add(n, node.prefix.size())
+	}
+	return n
+}
+
+// gaps appends the prefixes that cover the IPs of p that aren't in the tree,
+// in order and aggregated, to dst
+func (t *ipTree) gaps(p ipPrefix, dst []ipPrefix) []ipPrefix {
+	if t.find(p) != nil {
+		return dst
 	}
-	if bytes.Compare(newNode.net.IP, t.net.IP) < 0 {
-		return t.left.contains(newNode)
+	if node := t.lowerBound(p); node == nil || !p.contains(node.prefix) {
+		return append(dst, p)
 	}
-	return t.right.contains(newNode)
+	lo, hi := p.halves()
+	return t.gaps(hi, t.gaps(lo, dst))
 }
 
-// remove takes out the node and adjusts the tree recursively
+// remove takes out the node and adjusts the tree. When the node has two
+// children, it takes the network of the next node, which is removed instead,
+// and keeps its own priority.
 func (t *ipTree) remove() *ipTree {
 	replaceMe := func(newChild *ipTree) *ipTree {
 		if t.up != nil {
@@ -127,7 +309,7 @@ func (t *ipTree) remove() *ipTree {
 
 	if t.left != nil && t.right != nil {
 		next := t.next()
-		t.net = next.net
+		t.prefix = next.prefix
 		next.remove()
 		return t
 	}
@@ -140,36 +322,69 @@ func (t *ipTree) remove() *ipTree {
 	return replaceMe(nil)
 }
 
-// removeNet removes all of the IPs in the given net from the set
-func (t *ipTree) removeNet(net *net.IPNet) (top *ipTree) {
-	if t == nil {
-		return
-	}
-	// If net starts before me.net, recursively remove net from the left
-	if bytes.Compare(net.IP, t.net.IP) < 0 {
-		t.left = t.left.removeNet(net)
+// merge gives p, the combination of the neighboring prefixes in lo and hi, to
+// one of the two nodes and removes the other. Since p covers exactly the two
+// prefixes, no other node needs to move. It returns the new top and the node
+// holding p.
+func (t *ipTree) merge(lo, hi *ipTree, p ipPrefix) (top, merged *ipTree) {
+	merged, removed := hi, lo
+	if lo.right != nil {
+		// hi is the left-most node under lo.right so it has no left child
+		merged, removed = lo, hi
+	}
+	merged.prefix = p
+	return t.removeNode(removed), merged
+}
+
+// removeNode takes the given node out of the tree and returns the new top
+func (t *ipTree) removeNode(node *ipTree) *ipTree {
+	replacement := node.remove()
+	if node == t {
+		return replacement
 	}
+	return t
+}
 
-	// If any CIDRs in `net - me.net` come after me.net, remove net from
-	// the right
-	diff := netDifference(net, t.net)
-	for _, n := range diff {
-		if bytes.Compare(t.net.IP, n.IP) < 0 {
-			t.right = t.right.removeNet(net)
+// removePrefix removes all of the IPs in the given prefix from the set
+func (t *ipTree) removePrefix(p ipPrefix) (top *ipTree) {
+	top = t
+
+	// If a node contains p, then it is the only one overlapping it. Split it
+	// into the prefixes that remain.
+	for node := t; node != nil; {
+		if node.prefix.contains(p) {
+			diff := node.prefix.difference(p)
+			if len(diff) == 0 {
+				return top.removeNode(node)
+			}
+			node.prefix = diff[0]
+			for _, d := range diff[1:] {
+				top = top.insert(&ipTree{prefix: d})
+			}
+			return
+		}
+		if p.contains(node.prefix) {
 			break
 		}
+		if p.compare(node.prefix) < 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
 	}
 
-	top = t
-	if ContainsNet(net, t.net) {
-		// Remove the current node
-		top = t.remove()
-	} else if ContainsNet(t.net, net) {
-		diff = netDifference(t.net, net)
-		t.net = diff[0]
-		for _, n := range diff[1:] {
-			top = top.insert(&ipTree{net: n})
+	// Otherwise, remove every node that p contains. They are found in order
+	// between the first and last addresses of p.
+	last := p.lastIP()
+	node := t.lowerBound(p)
+	for node != nil && node.prefix.compare(last) <= 0 {
+		next := node.next()
+		if node.left != nil && node.right != nil {
+			// remove() moves the next prefix into this node
+			next = node
 		}
+		top = top.removeNode(node)
+		node = next
 	}
 	return
 }
@@ -180,10 +395,21 @@ func (t *ipTree) first() *ipTree {
 	if t == nil {
 		return nil
 	}
-	if t.left == nil {
-		return t
+	for t.left != nil {
+		t = t.left
 	}
-	return t.left.first()
+	return t
+}
+
+// last returns the last node in the tree or nil if the tree is empty.
+func (t *ipTree) last() *ipTree {
+	if t == nil {
+		return nil
+	}
+	for t.right != nil {
+		t = t.right
+	}
+	return t
 }
 
 // next returns the node following the given one in order or nil if it is the last.
@@ -227,52 +453,63 @@ func (t *ipTree) prev() *ipTree {
 }
 
 // walk visits all of the nodes in order by passing each node, in turn, to the
-// given visit function.
+// given visit function. It keeps its own stack of parents rather than
+// following the up links so that it can be used to validate them.
 func (t *ipTree) walk(visit func(*ipTree)) {
-	if t == nil {
-		return
+	stack := []*ipTree{}
+	for node := t; node != nil || len(stack) != 0; node = node.right {
+		for ; node != nil; node = node.left {
+			stack = append(stack, node)
+		}
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		visit(node)
 	}
-	t.left.walk(visit)
-	visit(t)
-	t.right.walk(visit)
 }
 
-// size returns the number of IPs in the set.
-// It isn't efficient and only meant for testing.
+// size returns the number of IPs in the set. It walks the whole tree.
 func (t *ipTree) size() *big.Int {
 	s := big.NewInt(0)
-	if t != nil {
-		ones, bits := t.net.Mask.Size()
-		s.Lsh(big.NewInt(1), uint(bits-ones))
-		s.Add(s, t.left.size())
-		s.Add(s, t.right.size())
-	}
+	t.walk(func(node *ipTree) {
+		s.Add(s, node.prefix.size())
+	})
 	return s
 }
 
 // height returns the length of the maximum path from top node to leaf
 // It isn't efficient and only meant for testing.
 func (t *ipTree) height() uint {
-	if t == nil {
-		return 0
-	}
-
-	s := t.left.height()
-	if s < t.right.height() {
-		s = t.right.height()
+	type level struct {
+		node  *ipTree
+		depth uint
+	}
+
+	var h uint
+	stack := []level{{t, 1}}
+	for len(stack) != 0 {
+		l := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if l.node == nil {
+			continue
+		}
+		if h < l.depth {
+			h = l.depth
+		}
+		stack = append(stack, level{l.node.left, l.depth + 1}, level{l.node.right, l.depth + 1})
 	}
-	return s + 1
+	return h
 }
 
-// numNodes Return the number of nodes in the underlying tree It isn't
-// efficient and only meant for testing.
-func (t *ipTree) numNodes() int {
-	if t == nil {
-		return 0
-	}
-	return 1 + t.left.numNodes() + t.right.numNodes()
+// numNodes returns the number of nodes in the tree by visiting each of them
+func (t *ipTree) numNodes() (n int) {
+	t.walk(func(*ipTree) {
+		n++
+	})
+	return
 }
 
+// validate returns an error for each problem found in the tree. The errors
+// are of the types defined in errors.go.
 func (t *ipTree) validate() []error {
 	errs := []error{}
 
@@ -283,7 +520,7 @@ func (t *ipTree) validate() []error {
 
 	// assert root's up is nil
 	if t.up != nil {
-		errs = append(errs, errors.New("root up must be nil"))
+		errs = append(errs, &LinkageError{t.prefix.toNet(), "root up must be nil"})
 	}
 
 	// validate each node
@@ -291,22 +528,33 @@ func (t *ipTree) validate() []error {
 	t.walk(func(n *ipTree) {
 		// assert that the node's are linked properly
 		if n.left != nil && n.left.up != n {
-			errs = append(errs, errors.New("linkage error: left.up node must equal node"))
+			errs = append(errs, &LinkageError{n.prefix.toNet(), "left.up node must equal node"})
 		}
 		if n.right != nil && n.right.up != n {
-			errs = append(errs, errors.New("linkage error: right.up node must equal node"))
+			errs = append(errs, &LinkageError{n.prefix.toNet(), "right.up node must equal node"})
+		}
+		if n.up != nil && n.up.priority < n.priority {
+			errs = append(errs, &PriorityError{n.prefix.toNet()})
 		}
 
-		if n.net == nil {
-			errs = append(errs, errors.New("each node in tree must have a network"))
-		} else if !n.net.IP.Mask(n.net.Mask).Equal(n.net.IP) {
-			// verify that the network is valid
-			errs = append(errs, errors.New("cidr invalid: "+n.net.String()))
+		// verify that the network is valid
+		if n.prefix.addrLen != net.IPv4len && n.prefix.addrLen != net.IPv6len {
+			errs = append(errs, &InvalidNetError{})
+			return
+		}
+		if !n.prefix.valid() {
+			errs = append(errs, &InvalidNetError{n.prefix.toNet()})
 		}
 
-		// assert order is correct
-		if lastNode != nil && bytes.Compare(lastNode.net.IP, n.net.IP) >= 0 {
-			errs = append(errs, errors.New("nodes must be in order: "+lastNode.net.IP.String()+" !< "+n.net.IP.String()))
+		// assert order is correct and that neighbors are properly aggregated
+		if lastNode != nil {
+			if lastNode.prefix.compare(n.prefix) >= 0 {
+				errs = append(errs, &OrderError{lastNode.prefix.toNet(), n.prefix.toNet()})
+			} else if lastNode.prefix.contains(n.prefix) || n.prefix.contains(lastNode.prefix) {
+				errs = append(errs, &OverlapError{lastNode.prefix.toNet(), n.prefix.toNet()})
+			} else if _, ok := lastNode.prefix.combine(n.prefix); ok {
+				errs = append(errs, &UncombinedError{lastNode.prefix.toNet(), n.prefix.toNet()})
+			}
 		}
 		lastNode = n
 	})
@@ -1,7 +1,7 @@
 package netaddr
 
 import (
-	"errors"
+	"math/big"
 	"net"
 	"testing"
 
@@ -16,65 +16,122 @@ func TestValidateNilTree(t *testing.T) {
 func TestValidateNoNetwork(t *testing.T) {
 	tree := &ipTree{}
 	assert.Equal(t, []error{
-		errors.New("each node in tree must have a network"),
+		&InvalidNetError{},
 	}, tree.validate())
 }
 
 func TestValidateBadCidrBadUp(t *testing.T) {
 	_, ten24, _ := net.ParseCIDR("10.0.0.0/24")
-	ten24.IP = net.ParseIP("10.0.0.1")
+	ten24.IP = ParseIP("10.0.0.1")
 	tree := &ipTree{
-		net: ten24,
-		up:  &ipTree{},
+		prefix: prefixFromNet(ten24),
+		up:     &ipTree{},
 	}
 	assert.Equal(t, []error{
-		errors.New("root up must be nil"),
-		errors.New("cidr invalid: 10.0.0.1/24"),
+		&LinkageError{ten24, "root up must be nil"},
+		&InvalidNetError{ten24},
 	}, tree.validate())
 }
 
 func TestValidateBadLinkageLeft(t *testing.T) {
 	tree := &ipTree{
-		net: TenOne24,
+		prefix: prefixFromNet(TenOne24),
 		left: &ipTree{
-			net: Ten24,
+			prefix: prefixFromNet(Ten24),
 		},
 	}
 	assert.Equal(t, []error{
-		errors.New("linkage error: left.up node must equal node"),
+		&LinkageError{TenOne24, "left.up node must equal node"},
+		&UncombinedError{Ten24, TenOne24},
 	}, tree.validate())
 }
 
 func TestValidateBadLinkageRight(t *testing.T) {
 	tree := &ipTree{
-		net: Ten24,
+		prefix: prefixFromNet(Ten24),
 		right: &ipTree{
-			net: TenOne24,
+			prefix: prefixFromNet(TenOne24),
 		},
 	}
 	assert.Equal(t, []error{
-		errors.New("linkage error: right.up node must equal node"),
+		&LinkageError{Ten24, "right.up node must equal node"},
+		&UncombinedError{Ten24, TenOne24},
 	}, tree.validate())
 }
 
 func TestValidateOutOfOrder(t *testing.T) {
 	tree := &ipTree{}
 	tree.left = &ipTree{
-		up:  tree,
-		net: TenTwo24,
+		up:     tree,
+		prefix: prefixFromNet(TenTwo24),
 	}
-	tree.net = TenOne24
+	tree.prefix = prefixFromNet(TenOne24)
 	tree.right = &ipTree{
-		up:  tree,
-		net: Ten24,
+		up:     tree,
+		prefix: prefixFromNet(Ten24),
 	}
 	tree.right.right = &ipTree{
-		up:  tree.right,
-		net: Ten24,
+		up:     tree.right,
+		prefix: prefixFromNet(Ten24),
 	}
 	assert.Equal(t, []error{
-		errors.New("nodes must be in order: 10.0.2.0 !< 10.0.1.0"),
-		errors.New("nodes must be in order: 10.0.1.0 !< 10.0.0.0"),
-		errors.New("nodes must be in order: 10.0.0.0 !< 10.0.0.0"),
+		&OrderError{TenTwo24, TenOne24},
+		&OrderError{TenOne24, Ten24},
+		&OrderError{Ten24, Ten24},
+	}, tree.validate())
+}
+
+// deepTree builds a degenerate tree of n non-adjacent /32s in increasing
+// order, which is the shape that inserting a sorted feed produces.
+func deepTree(n int) *ipTree {
+	var top, last *ipTree
+	ip := ParseIP("10.0.0.0")
+	for i := 0; i < n; i++ {
+		node := &ipTree{prefix: prefixFromIP(ip)}
+		if last == nil {
+			top = node
+		} else {
+			last.setRight(node)
+		}
+		last = node
+		ip, _ = incrementIP(ip)
+		ip, _ = incrementIP(ip)
+	}
+	return top
+}
+
+func TestDeepTree(t *testing.T) {
+	tree := deepTree(1000000)
+	assert.Equal(t, []error{}, tree.validate())
+	assert.Equal(t, 1000000, tree.numNodes())
+	assert.Equal(t, uint(1000000), tree.height())
+	assert.Equal(t, big.NewInt(1000000), tree.size())
+
+	last := prefixFromIP(ParseIP("10.30.132.126"))
+	assert.True(t, tree.contains(last))
+	assert.False(t, tree.contains(prefixFromIP(ParseIP("10.30.132.127"))))
+
+	tree = tree.insert(&ipTree{prefix: prefixFromIP(ParseIP("10.30.132.128"))})
+	assert.Equal(t, 1000001, tree.numNodes())
+
+	tree = tree.removePrefix(prefixFromNet(parse("10.30.132.0/24")))
+	assert.Equal(t, 1000001-65, tree.numNodes())
+	assert.False(t, tree.contains(last))
+	assert.Equal(t, []error{}, tree.validate())
+}
+
+func TestValidateOverlap(t *testing.T) {
+	tree := &ipTree{prefix: prefixFromNet(Ten24)}
+	tree.setRight(&ipTree{prefix: prefixFromNet(Ten24128)})
+	assert.Equal(t, []error{
+		&OverlapError{Ten24, Ten24128},
+	}, tree.validate())
+}
+
+func TestValidatePriority(t *testing.T) {
+	tree := &ipTree{prefix: prefixFromNet(Ten24)}
+	tree.setRight(&ipTree{prefix: prefixFromNet(TenTwo24), priority: 1})
+	assert.Equal(t, []error{
+		&PriorityError{TenTwo24},
 	}, tree.validate())
 }
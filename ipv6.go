@@ -0,0 +1,160 @@
+package netaddr
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+)
+
+// SplitV6 splits the given IPv6 address at bit 64. It returns the /64 prefix
+// the address is in, as an address with the last 64 bits cleared, and the
+// interface identifier in the last 64 bits. It returns an error for an IPv4
+// address, including one in the 16 byte form.
+func SplitV6(ip net.IP) (prefix net.IP, iid [8]byte, err error) {
+	if !validIPLen(ip) {
+		return nil, iid, errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	if ip.To4() != nil {
+		return nil, iid, errorf(ErrFamilyMismatch, "not an IPv6 address: %s", ip)
+	}
+	prefix = make(net.IP, net.IPv6len)
+	copy(prefix, ip[:8])
+	copy(iid[:], ip[8:])
+	return prefix, iid, nil
+}
+
+// ComposeV6 returns the address in the given /64 prefix with the given
+// interface identifier. It returns an error if the prefix isn't an IPv6 /64
+// network rather than guessing where to put the identifier.
+func ComposeV6(prefix *net.IPNet, iid [8]byte) (net.IP, error) {
+	p, err := checkPrefix64(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return composeV6(p, iid), nil
+}
+
+// checkPrefix64 converts the given network to an ipPrefix after checking
+// that it is an IPv6 /64
+func checkPrefix64(prefix *net.IPNet) (ipPrefix, error) {
+	p, err := checkedPrefixFromNet(prefix)
+	if err != nil {
+		return ipPrefix{}, err
+	}
+	if p.addrLen != net.IPv6len {
+		return ipPrefix{}, errorf(ErrFamilyMismatch, "not an IPv6 prefix: %s", prefix)
+	}
+	if p.ones != 64 {
+		return ipPrefix{}, errorf(ErrInvalidPrefixLength, "prefix must be a /64: %s", prefix)
+	}
+	return p, nil
+}
+
+// composeV6 returns the address in the /64 prefix p with the given interface
+// identifier
+func composeV6(p ipPrefix, iid [8]byte) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, p.addr[:8])
+	copy(ip[8:], iid[:])
+	return ip
+}
+
+// stableIIDHash is the pseudorandom function of StableIID. Tests replace it.
+var stableIIDHash = sha256.Sum256
+
+// StableIID returns the address in the given /64 prefix with the stable,
+// opaque interface identifier that RFC 7217 derives from the prefix, the
+// name of the interface, the optional network ID, the DAD counter and the
+// secret key. The identifier is the last 64 bits of the SHA-256 of all of
+// them concatenated in that order, the counter as one byte. If it is one of
+// the reserved identifiers (RFC 5453), the counter is incremented and the
+// identifier derived again. It returns an error if the prefix isn't an IPv6
+// /64 network or the counter runs out.
+func StableIID(prefix *net.IPNet, ifaceName string, netID []byte, dadCounter uint8, secret []byte) (net.IP, error) {
+	p, err := checkPrefix64(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for counter := int(dadCounter); counter <= 0xff; counter++ {
+		input := make([]byte, 0, 8+len(ifaceName)+len(netID)+1+len(secret))
+		input = append(input, p.addr[:8]...)
+		input = append(input, ifaceName...)
+		input = append(input, netID...)
+		input = append(input, byte(counter))
+		input = append(input, secret...)
+		rid := stableIIDHash(input)
+
+		var iid [8]byte
+		copy(iid[:], rid[len(rid)-8:])
+		if !reservedIID(iid) {
+			return composeV6(p, iid), nil
+		}
+	}
+	return nil, errorf(ErrInvalidArgument, "no acceptable interface identifier with DAD counter %d or above", dadCounter)
+}
+
+// reservedIID returns true if the given interface identifier is reserved
+// (RFC 5453): the Subnet-Router Anycast one, one of the IANA Ethernet Block
+// ones including the Proxy Mobile IPv6 one, or a Reserved Subnet Anycast one.
+func reservedIID(iid [8]byte) bool {
+	v := binary.BigEndian.Uint64(iid[:])
+	return v == 0 ||
+		v >= 0x02005efffe000000 && v <= 0x02005efffeffffff ||
+		v >= 0xfdffffffffffff80 && v <= 0xfdffffffffffffff
+}
+
+// ulaNet is the block of Unique Local IPv6 Unicast Addresses (RFC 4193)
+var ulaNet = prefixFromNet(&net.IPNet{IP: net.IP{0xfc, 15: 0}, Mask: net.CIDRMask(7, 128)})
+
+// GenerateULA returns a locally assigned fdXX:XXXX:XXXX::/48 prefix with a
+// Global ID read from r, as RFC 4193 allows. It reads from crypto/rand if r
+// is nil.
+func GenerateULA(r io.Reader) (*net.IPNet, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	var globalID [5]byte
+	if _, err := io.ReadFull(r, globalID[:]); err != nil {
+		return nil, fmt.Errorf("cannot read Global ID: %w", err)
+	}
+	return ulaPrefix(globalID), nil
+}
+
+// ULAFromSeed returns the locally assigned /48 prefix that the algorithm
+// suggested by RFC 4193 derives from the given time, in the 64 bit NTP
+// format, and EUI-64 identifier. The same inputs always give the same prefix.
+func ULAFromSeed(ntpTime uint64, eui64 [8]byte) *net.IPNet {
+	var key [16]byte
+	binary.BigEndian.PutUint64(key[:8], ntpTime)
+	copy(key[8:], eui64[:])
+	digest := sha1.Sum(key[:])
+	var globalID [5]byte
+	copy(globalID[:], digest[len(digest)-5:])
+	return ulaPrefix(globalID)
+}
+
+// ulaPrefix returns the locally assigned prefix with the given Global ID
+func ulaPrefix(globalID [5]byte) *net.IPNet {
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfd
+	copy(ip[1:6], globalID[:])
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(48, 128)}
+}
+
+// IsULA returns true if the given IP is a Unique Local IPv6 Unicast Address,
+// one in fc00::/7.
+func IsULA(ip net.IP) bool {
+	return validIPLen(ip) && ulaNet.contains(prefixFromIP(ip))
+}
+
+// IsULANet returns true if the given network is within fc00::/7. It returns
+// false for a malformed network.
+func IsULANet(n *net.IPNet) bool {
+	p, err := checkedPrefixFromNet(n)
+	return err == nil && ulaNet.contains(p)
+}
@@ -0,0 +1,183 @@
+package netaddr
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitV6(t *testing.T) {
+	prefix, iid, err := SplitV6(net.ParseIP("2001:db8:1:2:a8bb:ccff:fedd:eeff"))
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8:1:2::"), prefix)
+	assert.Equal(t, [8]byte{0xa8, 0xbb, 0xcc, 0xff, 0xfe, 0xdd, 0xee, 0xff}, iid)
+
+	_, _, err = SplitV6(net.ParseIP("10.0.0.1"))
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, _, err = SplitV6(net.IP{10, 0, 0, 1})
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, _, err = SplitV6(nil)
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+}
+
+func TestComposeV6(t *testing.T) {
+	iid := [8]byte{0xa8, 0xbb, 0xcc, 0xff, 0xfe, 0xdd, 0xee, 0xff}
+	ip, err := ComposeV6(parse("2001:db8:1:2::/64"), iid)
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8:1:2:a8bb:ccff:fedd:eeff"), ip)
+
+	// Same host, new prefix
+	old := net.ParseIP("2001:db8:1:2::1234")
+	_, iid, _ = SplitV6(old)
+	ip, err = ComposeV6(parse("2001:db8:ffff:1::/64"), iid)
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8:ffff:1::1234"), ip)
+
+	_, err = ComposeV6(parse("2001:db8::/48"), iid)
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	assert.EqualError(t, err, "prefix must be a /64: 2001:db8::/48")
+	_, err = ComposeV6(parse("2001:db8::/96"), iid)
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	_, err = ComposeV6(parse("2001:db8::1/64"), iid)
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	_, err = ComposeV6(parse("10.0.0.0/24"), iid)
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, err = ComposeV6(nil, iid)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
+
+func TestGenerateULA(t *testing.T) {
+	ula, err := GenerateULA(bytes.NewReader([]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc}))
+	assert.Nil(t, err)
+	assert.Equal(t, parse("fd12:3456:789a::/48"), ula)
+	assert.True(t, IsULANet(ula))
+
+	ula, err = GenerateULA(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0xfd), ula.IP[0])
+	assert.True(t, IsULANet(ula))
+
+	_, err = GenerateULA(bytes.NewReader([]byte{1, 2, 3}))
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func TestULAFromSeed(t *testing.T) {
+	eui64 := [8]byte{0x02, 0x11, 0x22, 0xff, 0xfe, 0x33, 0x44, 0x55}
+	ula := ULAFromSeed(0xe5e4d8a712345678, eui64)
+	assert.Equal(t, ula, ULAFromSeed(0xe5e4d8a712345678, eui64))
+	assert.NotEqual(t, ula, ULAFromSeed(0xe5e4d8a712345679, eui64))
+
+	// The Global ID is the last 40 bits of the SHA-1 of the time and EUI-64
+	key := append([]byte{0xe5, 0xe4, 0xd8, 0xa7, 0x12, 0x34, 0x56, 0x78}, eui64[:]...)
+	digest := sha1.Sum(key)
+	expected := append(net.IP{0xfd}, digest[15:]...)
+	expected = append(expected, make(net.IP, 10)...)
+	assert.Equal(t, &net.IPNet{IP: expected, Mask: net.CIDRMask(48, 128)}, ula)
+}
+
+func TestIsULA(t *testing.T) {
+	assert.True(t, IsULA(net.ParseIP("fd12:3456:789a::1")))
+	assert.True(t, IsULA(net.ParseIP("fc00::")))
+	assert.True(t, IsULA(net.ParseIP("fdff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")))
+	assert.False(t, IsULA(net.ParseIP("fe00::")))
+	assert.False(t, IsULA(net.ParseIP("fbff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")))
+	assert.False(t, IsULA(net.ParseIP("10.0.0.1")))
+	assert.False(t, IsULA(nil))
+
+	assert.True(t, IsULANet(parse("fc00::/7")))
+	assert.True(t, IsULANet(parse("fd00::/8")))
+	assert.False(t, IsULANet(parse("fc00::/6")))
+	assert.False(t, IsULANet(parse("10.0.0.0/8")))
+	assert.False(t, IsULANet(parse("fd00::1/8")))
+	assert.False(t, IsULANet(nil))
+}
+
+func TestStableIID(t *testing.T) {
+	prefix := parse("2001:db8:1:2::/64")
+	secret := []byte("0123456789abcdef")
+	ip, err := StableIID(prefix, "eth0", []byte("ssid"), 0, secret)
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8:1:2:12f0:1066:e4c7:df47"), ip)
+
+	// The identifier is the end of the SHA-256 of the inputs in order
+	input := []byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x02}
+	input = append(input, "eth0ssid\x000123456789abcdef"...)
+	rid := sha256.Sum256(input)
+	assert.Equal(t, append(net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x02}, rid[24:]...), ip)
+
+	// Each input changes the identifier
+	for _, other := range []net.IP{
+		mustStableIID(t, parse("2001:db8:1:3::/64"), "eth0", []byte("ssid"), 0, secret),
+		mustStableIID(t, prefix, "eth1", []byte("ssid"), 0, secret),
+		mustStableIID(t, prefix, "eth0", nil, 0, secret),
+		mustStableIID(t, prefix, "eth0", []byte("ssid"), 1, secret),
+		mustStableIID(t, prefix, "eth0", []byte("ssid"), 0, []byte("another secret")),
+	} {
+		assert.NotEqual(t, ip, other)
+	}
+
+	_, err = StableIID(parse("2001:db8::/48"), "eth0", nil, 0, secret)
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	_, err = StableIID(parse("10.0.0.0/24"), "eth0", nil, 0, secret)
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+}
+
+func mustStableIID(t *testing.T, prefix *net.IPNet, ifaceName string, netID []byte, dadCounter uint8, secret []byte) net.IP {
+	ip, err := StableIID(prefix, ifaceName, netID, dadCounter, secret)
+	assert.Nil(t, err)
+	return ip
+}
+
+func TestStableIIDReserved(t *testing.T) {
+	defer func(hash func([]byte) [32]byte) { stableIIDHash = hash }(stableIIDHash)
+
+	// A hash that gives reserved identifiers until the counter reaches 3
+	var counters []byte
+	stableIIDHash = func(input []byte) (rid [32]byte) {
+		counter := input[len(input)-1]
+		counters = append(counters, counter)
+		switch counter {
+		case 0:
+		case 1:
+			copy(rid[24:], []byte{0x02, 0x00, 0x5e, 0xff, 0xfe, 0x00, 0x52, 0x13})
+		case 2:
+			copy(rid[24:], []byte{0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x80})
+		default:
+			rid[31] = counter
+		}
+		return
+	}
+	ip, err := StableIID(parse("2001:db8::/64"), "eth0", nil, 0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("2001:db8::3"), ip)
+	assert.Equal(t, []byte{0, 1, 2, 3}, counters)
+
+	// Running out of counter values
+	stableIIDHash = func([]byte) (rid [32]byte) { return }
+	_, err = StableIID(parse("2001:db8::/64"), "eth0", nil, 250, nil)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+func TestReservedIID(t *testing.T) {
+	for iid, reserved := range map[[8]byte]bool{
+		{}:     true,
+		{7: 1}: false,
+		{0x02, 0x00, 0x5e, 0xff, 0xfd, 0xff, 0xff, 0xff}: false,
+		{0x02, 0x00, 0x5e, 0xff, 0xfe}:                   true,
+		{0x02, 0x00, 0x5e, 0xff, 0xfe, 0xff, 0xff, 0xff}: true,
+		{0x02, 0x00, 0x5e, 0xff, 0xff}:                   false,
+		{0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}: false,
+		{0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x80}: true,
+		{0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}: true,
+		{0xfe}: false,
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}: false,
+	} {
+		assert.Equal(t, reserved, reservedIID(iid), "%x", iid)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build go1.23
+// +build go1.23
+
+package netaddr
+
+import (
+	"iter"
+	"net"
+)
+
+// Networks returns an iterator over the networks in the set, in the order of
+// GetNetworks, like WalkNets
+func (s *IPSet) Networks() iter.Seq[*net.IPNet] {
+	return s.WalkNets
+}
+
+// IPs returns an iterator over the IPs in the set, in order, like WalkIPs
+func (s *IPSet) IPs() iter.Seq[net.IP] {
+	return s.WalkIPs
+}
+
+// IPs returns an iterator over the IPs in the network, in order. It yields
+// none for the zero value. Like those of IPSet.WalkIPs, the IPs may be kept.
+func (n IPNet) IPs() iter.Seq[net.IP] {
+	return func(yield func(net.IP) bool) {
+		if n.IsValid() {
+			walkPrefixIPs(n.p, nil, yield)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build go1.23
+// +build go1.23
+
+package netaddr
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPSetNetworks(t *testing.T) {
+	r := rand.New(rand.NewSource(513))
+	set := randomSet(r, 50)
+	var nets []*net.IPNet
+	for n := range set.Networks() {
+		nets = append(nets, n)
+	}
+	assert.Equal(t, set.GetNetworks(), nets)
+
+	nets = nil
+	for n := range set.Networks() {
+		if len(nets) == 2 {
+			break
+		}
+		nets = append(nets, n)
+	}
+	assert.Equal(t, set.GetNetworks()[:2], nets)
+
+	var nilSet *IPSet
+	for n := range nilSet.Networks() {
+		t.Errorf("got %s", n)
+	}
+}
+
+func TestIPSetIPs(t *testing.T) {
+	r := rand.New(rand.NewSource(513))
+	set := randomSet(r, 50)
+	var ips []net.IP
+	for ip := range set.IPs() {
+		ips = append(ips, ip)
+	}
+	assert.Equal(t, set.GetIPs(0), ips)
+
+	// Breaking out of a huge set
+	set.InsertNet(parse("::/0"))
+	ips = nil
+	for ip := range set.IPs() {
+		if ip.To4() == nil {
+			break
+		}
+		ips = append(ips, ip)
+	}
+	assert.Equal(t, set.V4().Size().Int64(), int64(len(ips)))
+}
+
+func TestIPNetIPs(t *testing.T) {
+	n := MustParseIPNet("192.0.2.252/30")
+	var ips []string
+	for ip := range n.IPs() {
+		ips = append(ips, ip.String())
+	}
+	assert.Equal(t, []string{"192.0.2.252", "192.0.2.253", "192.0.2.254", "192.0.2.255"}, ips)
+
+	ips = nil
+	for ip := range MustParseIPNet("2001:db8::/32").IPs() {
+		ips = append(ips, ip.String())
+		if len(ips) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"2001:db8::", "2001:db8::1", "2001:db8::2"}, ips)
+
+	for ip := range (IPNet{}).IPs() {
+		t.Errorf("got %s", ip)
+	}
+}
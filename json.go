@@ -0,0 +1,123 @@
+package netaddr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MarshalJSON implements json.Marshaler. It writes the set as an array of its
+// networks in the order of GetNetworks, like ["10.0.0.0/24","2001:db8::/64"].
+// An empty set is [].
+func (s *IPSet) MarshalJSON() ([]byte, error) {
+	nets := s.String()
+	if nets == nil {
+		nets = []string{}
+	}
+	return json.Marshal(nets)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It reads an array of networks
+// like InsertFromJSON and replaces the contents of the set with them. If an
+// element is bad, it returns an error with its index and leaves the set
+// alone. Like encoding/json does, it ignores null.
+func (s *IPSet) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	set := &IPSet{}
+	if _, err := set.InsertFromJSON(json.NewDecoder(bytes.NewReader(data))); err != nil {
+		return err
+	}
+	s.replaceTree(set.tree)
+	return nil
+}
+
+// InsertFromJSON reads a JSON array of networks from dec and inserts them
+// into the set one element at a time, so that it never holds more than one
+// of them. Each element is a string with a CIDR or a single IP, like
+// ["10.0.0.0/8", "192.0.2.1"]. It returns the number of elements inserted.
+// If an element is bad, it returns an error with its index, starting at 0,
+// and the elements before it stay in the set.
+func (s *IPSet) InsertFromJSON(dec *json.Decoder) (int, error) {
+	return s.insertFromJSON(dec, "")
+}
+
+// InsertFromJSONField is like InsertFromJSON for an array of objects which
+// hold the networks in the field with the given name, like
+// [{"cidr": "10.0.0.0/8", "source": "feed"}]. Other fields are ignored.
+func (s *IPSet) InsertFromJSONField(dec *json.Decoder, field string) (int, error) {
+	if field == "" {
+		return 0, errorf(ErrInvalidArgument, "field name must not be empty")
+	}
+	return s.insertFromJSON(dec, field)
+}
+
+// insertFromJSON inserts the networks of a JSON array of strings, or of
+// objects with the given field if it isn't empty
+func (s *IPSet) insertFromJSON(dec *json.Decoder, field string) (int, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if token != json.Delim('[') {
+		return 0, errorf(ErrInvalidEncoding, "JSON of networks must be an array, not %v", token)
+	}
+
+	count := 0
+	for ; dec.More(); count++ {
+		text, err := decodeJSONNet(dec, field)
+		if err != nil {
+			return count, fmt.Errorf("element %d: %w", count, err)
+		}
+		n, err := ParseNetOrIP(text)
+		if err != nil {
+			return count, fmt.Errorf("element %d (%q): %w", count, text, err)
+		}
+		s.insertPrefix(prefixFromNet(n))
+	}
+	if _, err := dec.Token(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// decodeJSONNet decodes the next element of an array of networks, a string
+// or an object with the given field, and returns the network in it
+func decodeJSONNet(dec *json.Decoder, field string) (string, error) {
+	// A null leaves a *string nil where it would leave a string empty
+	var text *string
+	if field == "" {
+		err := dec.Decode(&text)
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return "", errorf(ErrInvalidEncoding, "network must be a string, not %s", typeErr.Value)
+		}
+		if err != nil {
+			return "", err
+		}
+		if text == nil {
+			return "", errorf(ErrInvalidEncoding, "network must be a string, not null")
+		}
+		return *text, nil
+	}
+
+	var element map[string]json.RawMessage
+	err := dec.Decode(&element)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return "", errorf(ErrInvalidEncoding, "element must be an object, not %s", typeErr.Value)
+	}
+	if err != nil {
+		return "", err
+	}
+	value, ok := element[field]
+	if !ok {
+		return "", errorf(ErrInvalidEncoding, "object has no field %q", field)
+	}
+	if err := json.Unmarshal(value, &text); err != nil || text == nil {
+		return "", errorf(ErrInvalidEncoding, "field %q must be a string, not %s", field, value)
+	}
+	return *text, nil
+}
@@ -0,0 +1,202 @@
+package netaddr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPSetMarshalJSON(t *testing.T) {
+	for _, c := range []struct {
+		nets []string
+		json string
+	}{
+		{nil, `[]`},
+		{[]string{"10.0.0.0/24", "192.0.2.1/32"}, `["10.0.0.0/24","192.0.2.1/32"]`},
+		{[]string{"2001:db8::/64"}, `["2001:db8::/64"]`},
+		{[]string{"2001:db8::/64", "10.0.0.0/24", "10.0.1.0/24"}, `["10.0.0.0/23","2001:db8::/64"]`},
+	} {
+		set := &IPSet{}
+		for _, cidr := range c.nets {
+			set.InsertNet(parse(cidr))
+		}
+		data, err := json.Marshal(set)
+		assert.Nil(t, err)
+		assert.Equal(t, c.json, string(data))
+
+		parsed := &IPSet{}
+		assert.Nil(t, json.Unmarshal(data, parsed))
+		assert.True(t, set.Equal(parsed), c.json)
+	}
+
+	var nilSet *IPSet
+	data, err := nilSet.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, `[]`, string(data))
+
+	// In a struct, with IPs as well as networks
+	var config struct {
+		Allow *IPSet `json:"allow"`
+		Deny  *IPSet `json:"deny"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(`{"allow": ["10.0.0.0/8", "192.0.2.1"], "deny": null}`), &config))
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.1/32"}, config.Allow.String())
+	assert.Nil(t, config.Deny)
+	data, err = json.Marshal(config)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"allow":["10.0.0.0/8","192.0.2.1/32"],"deny":null}`, string(data))
+}
+
+func TestIPSetUnmarshalJSON(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("192.0.2.0/24"))
+	o := newRecordingObserver()
+	set.SetObserver(o)
+
+	// It replaces what was in the set
+	assert.Nil(t, json.Unmarshal([]byte(`["10.0.0.0/24", "10.0.1.0/25"]`), set))
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.1.0/25"}, set.String())
+	assert.Equal(t, []string{"v4 +128"}, o.calls)
+	assert.Nil(t, set.UnmarshalJSON([]byte(`null`)))
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.1.0/25"}, set.String())
+
+	for _, c := range []struct {
+		json, message string
+		kind          error
+	}{
+		{`["10.0.0.0/24", "10.0.1.1/24"]`, `element 1 ("10.0.1.1/24"): `, ErrHostBitsSet},
+		{`["bogus"]`, `element 0 ("bogus"): `, ErrInvalidIP},
+		{`["10.0.0.0/24", 7]`, `element 1: network must be a string, not number`, ErrInvalidEncoding},
+		{`{"allow": []}`, `JSON of networks must be an array, not {`, ErrInvalidEncoding},
+	} {
+		err := json.Unmarshal([]byte(c.json), set)
+		assert.True(t, errors.Is(err, c.kind), "%s: %v", c.json, err)
+		assert.True(t, strings.HasPrefix(err.Error(), c.message), err.Error())
+		assert.Equal(t, []string{"10.0.0.0/24", "10.0.1.0/25"}, set.String())
+	}
+}
+
+func TestIPSetInsertFromJSON(t *testing.T) {
+	set := &IPSet{}
+	count, err := set.InsertFromJSON(json.NewDecoder(strings.NewReader(`["10.0.0.0/24", "192.0.2.1",
+		"10.0.1.0/24", "2001:db8::/32"] `)))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []string{"10.0.0.0/23", "192.0.2.1/32", "2001:db8::/32"}, set.String())
+
+	set = &IPSet{}
+	count, err = set.InsertFromJSON(json.NewDecoder(strings.NewReader(`[]`)))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	// The decoder can go on to what follows the array
+	dec := json.NewDecoder(strings.NewReader(`["10.0.0.0/8"] ["11.0.0.0/8"]`))
+	count, err = set.InsertFromJSON(dec)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	count, err = set.InsertFromJSON(dec)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"10.0.0.0/7"}, set.String())
+}
+
+func TestIPSetInsertFromJSONField(t *testing.T) {
+	set := &IPSet{}
+	count, err := set.InsertFromJSONField(json.NewDecoder(strings.NewReader(`[
+		{"cidr": "10.0.0.0/8", "source": "feed", "tags": ["a", "b"]},
+		{"source": "other", "cidr": "2001:db8::1"}
+	]`)), "cidr")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"10.0.0.0/8", "2001:db8::1/128"}, set.String())
+
+	_, err = set.InsertFromJSONField(json.NewDecoder(strings.NewReader(`[]`)), "")
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+func TestIPSetInsertFromJSONErrors(t *testing.T) {
+	for _, c := range []struct {
+		json, field string
+		count       int
+		kind        error
+		message     string
+	}{
+		{`{"cidr": "10.0.0.0/8"}`, "", 0, ErrInvalidEncoding, "JSON of networks must be an array, not {"},
+		{`["10.0.0.0/8", "10.0.0.1/8"]`, "", 1, ErrHostBitsSet, ""},
+		{`["10.0.0.0/8", "11.0.0.0/8", "bogus"]`, "", 2, ErrInvalidIP, ""},
+		{`[null]`, "", 0, ErrInvalidEncoding, "element 0: network must be a string, not null"},
+		{`["10.0.0.0/8", 42]`, "", 1, ErrInvalidEncoding, "element 1: network must be a string, not number"},
+		{`["10.0.0.0/8"]`, "cidr", 0, ErrInvalidEncoding, "element 0: element must be an object, not string"},
+		{`[{"cidr": "10.0.0.0/8"}, {"net": "10.0.0.0/8"}]`, "cidr", 1, ErrInvalidEncoding, "element 1: object has no field \"cidr\""},
+		{`[{"cidr": null}]`, "cidr", 0, ErrInvalidEncoding, "element 0: field \"cidr\" must be a string, not null"},
+	} {
+		set := &IPSet{}
+		var count int
+		var err error
+		if c.field == "" {
+			count, err = set.InsertFromJSON(json.NewDecoder(strings.NewReader(c.json)))
+		} else {
+			count, err = set.InsertFromJSONField(json.NewDecoder(strings.NewReader(c.json)), c.field)
+		}
+		assert.Equal(t, c.count, count, c.json)
+		assert.True(t, errors.Is(err, c.kind), "%s: %v", c.json, err)
+		if c.message != "" {
+			assert.Equal(t, c.message, err.Error())
+		}
+	}
+
+	// Syntax errors come from the decoder
+	set := &IPSet{}
+	count, err := set.InsertFromJSON(json.NewDecoder(strings.NewReader(`["10.0.0.0/8", `)))
+	assert.Equal(t, 1, count)
+	assert.NotNil(t, err)
+	count, err = set.InsertFromJSON(json.NewDecoder(strings.NewReader(``)))
+	assert.Equal(t, 0, count)
+	assert.Equal(t, io.EOF, err)
+}
+
+// jsonFeed streams a JSON array of n networks without holding it
+type jsonFeed struct {
+	n, i int
+	buf  []byte
+}
+
+func (f *jsonFeed) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		switch {
+		case f.i > f.n:
+			return 0, io.EOF
+		case f.i == f.n:
+			f.buf = []byte("]")
+		case f.i == 0:
+			f.buf = []byte(`["10.0.0.0/32"`)
+		default:
+			f.buf = []byte(fmt.Sprintf(`, "10.%d.%d.%d/32"`, f.i>>16&0xff, f.i>>8&0xff, f.i&0xff))
+		}
+		f.i++
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+func BenchmarkIPSetInsertFromJSON(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		set := &IPSet{}
+		set.InsertFromJSON(json.NewDecoder(&jsonFeed{n: 1 << 16}))
+	}
+}
+
+func TestIPSetInsertFromJSONFeed(t *testing.T) {
+	set := &IPSet{}
+	count, err := set.InsertFromJSON(json.NewDecoder(&jsonFeed{n: 1 << 16}))
+	assert.Nil(t, err)
+	assert.Equal(t, 1<<16, count)
+	assert.Equal(t, []string{"10.0.0.0/16"}, set.String())
+}
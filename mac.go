@@ -0,0 +1,333 @@
+package netaddr
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// MAC is a 48-bit MAC address (EUI-48) or a 64-bit EUI-64. The zero value
+// isn't a valid address and formats as an empty string.
+type MAC struct {
+	addr [8]byte
+	len  uint8
+}
+
+// ParseMAC parses a 48-bit or 64-bit MAC address in any of these forms, in
+// upper or lower case:
+//
+//	01:23:45:67:89:ab
+//	01-23-45-67-89-ab
+//	0123.4567.89ab
+//	0123456789ab
+//
+// Each group between colons or dashes has exactly two hex digits and each
+// between dots four.
+func ParseMAC(s string) (MAC, error) {
+	var digits string
+	switch {
+	case strings.ContainsAny(s, ":-"):
+		sep := ":"
+		if !strings.Contains(s, sep) {
+			sep = "-"
+		}
+		groups := strings.Split(s, sep)
+		if err := checkMACGroups(s, groups, 2, []int{6, 8}); err != nil {
+			return MAC{}, err
+		}
+		digits = strings.Join(groups, "")
+	case strings.Contains(s, "."):
+		groups := strings.Split(s, ".")
+		if err := checkMACGroups(s, groups, 4, []int{3, 4}); err != nil {
+			return MAC{}, err
+		}
+		digits = strings.Join(groups, "")
+	default:
+		if len(s) != 12 && len(s) != 16 {
+			return MAC{}, errorf(ErrInvalidMAC, "MAC address %q has %d hex digits, want 12 or 16", s, len(s))
+		}
+		digits = s
+	}
+
+	var m MAC
+	n, err := hex.Decode(m.addr[:], []byte(digits))
+	if err != nil {
+		return MAC{}, errorf(ErrInvalidMAC, "MAC address %q is not hex", s)
+	}
+	m.len = uint8(n)
+	return m, nil
+}
+
+// checkMACGroups checks that the groups of a MAC address have the given
+// number of digits each and that there are one of the given numbers of them
+func checkMACGroups(s string, groups []string, digits int, counts []int) error {
+	if len(groups) != counts[0] && len(groups) != counts[1] {
+		return errorf(ErrInvalidMAC, "MAC address %q has %d groups, want %d or %d", s, len(groups), counts[0], counts[1])
+	}
+	for _, group := range groups {
+		if len(group) != digits {
+			return errorf(ErrInvalidMAC, "MAC address %q has group %q, want %d hex digits", s, group, digits)
+		}
+	}
+	return nil
+}
+
+// MACFromBytes returns the MAC address with the given 6 or 8 bytes
+func MACFromBytes(b []byte) (MAC, error) {
+	if len(b) != 6 && len(b) != 8 {
+		return MAC{}, errorf(ErrInvalidMAC, "invalid MAC address length: %d", len(b))
+	}
+	var m MAC
+	m.len = uint8(copy(m.addr[:], b))
+	return m, nil
+}
+
+// Bits returns the length of the address in bits, 48 or 64, or 0 for the
+// zero value
+func (m MAC) Bits() int {
+	return 8 * int(m.len)
+}
+
+// Bytes returns the 6 or 8 bytes of the address
+func (m MAC) Bytes() []byte {
+	return append([]byte{}, m.addr[:m.len]...)
+}
+
+// HardwareAddr returns the address as a net.HardwareAddr
+func (m MAC) HardwareAddr() net.HardwareAddr {
+	return net.HardwareAddr(m.Bytes())
+}
+
+// String returns the address in lower case with colons, like
+// 01:23:45:67:89:ab
+func (m MAC) String() string {
+	return m.Format(MACColon)
+}
+
+// MACDialect is a text form of MAC addresses. It is one of the forms below,
+// optionally combined with MACUpper, like MACDash|MACUpper.
+type MACDialect uint8
+
+// The forms of MAC addresses that ParseMAC accepts
+const (
+	// MACColon is like 01:23:45:67:89:ab
+	MACColon MACDialect = iota
+	// MACDash is like 01-23-45-67-89-ab
+	MACDash
+	// MACCisco is like 0123.4567.89ab
+	MACCisco
+	// MACBare is like 0123456789ab
+	MACBare
+
+	// MACUpper uses upper case hex digits
+	MACUpper MACDialect = 0x80
+)
+
+// DefaultMACDialect is the form in which MarshalText, and so encoding/json,
+// writes MAC addresses
+var DefaultMACDialect = MACColon
+
+// Format returns the address in the given dialect
+func (m MAC) Format(dialect MACDialect) string {
+	digits := "0123456789abcdef"
+	if dialect&MACUpper != 0 {
+		digits = "0123456789ABCDEF"
+	}
+	var sep byte
+	group := 1
+	switch dialect &^ MACUpper {
+	case MACColon:
+		sep = ':'
+	case MACDash:
+		sep = '-'
+	case MACCisco:
+		sep, group = '.', 2
+	}
+
+	b := make([]byte, 0, 3*m.len)
+	for i, v := range m.addr[:m.len] {
+		if i > 0 && i%group == 0 && sep != 0 {
+			b = append(b, sep)
+		}
+		b = append(b, digits[v>>4], digits[v&0x0f])
+	}
+	return string(b)
+}
+
+// MarshalText writes the address in the DefaultMACDialect
+func (m MAC) MarshalText() ([]byte, error) {
+	return []byte(m.Format(DefaultMACDialect)), nil
+}
+
+// UnmarshalText parses the address in any form that ParseMAC accepts. Empty
+// text gives the zero value.
+func (m *MAC) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*m = MAC{}
+		return nil
+	}
+	parsed, err := ParseMAC(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// OUI returns the first three bytes of the address, the Organizationally
+// Unique Identifier of the vendor of a universally administered address
+func (m MAC) OUI() [3]byte {
+	return [3]byte{m.addr[0], m.addr[1], m.addr[2]}
+}
+
+// Split returns the OUI and the three bytes that follow it, which make up the
+// extension identifier of a 48-bit address. The extension of a 64-bit address
+// is five bytes, of which these are the first three.
+func (m MAC) Split() (oui [3]byte, extension [3]byte) {
+	return m.OUI(), [3]byte{m.addr[3], m.addr[4], m.addr[5]}
+}
+
+// The lengths in bits of the prefixes of MAC addresses that the IEEE
+// registration authority assigns
+const (
+	// MALBits is the length of an MA-L assignment, which is an OUI
+	MALBits = 24
+	// MAMBits is the length of an MA-M assignment
+	MAMBits = 28
+	// MASBits is the length of an MA-S assignment, and of an IAB before it
+	MASBits = 36
+)
+
+// Assignment returns the first bits of the address, which must be MALBits,
+// MAMBits or MASBits, as upper case hex digits like the assignments in the
+// IEEE registries, such as "0050C2" for an MA-L, "F40E11D" for an MA-M or
+// "70B3D5F2F" for an MA-S. Which registry, if any, the address belongs to
+// can only be told by looking it up.
+func (m MAC) Assignment(bits int) (string, error) {
+	if bits != MALBits && bits != MAMBits && bits != MASBits {
+		return "", errorf(ErrInvalidArgument, "assignment length must be %d, %d or %d bits: %d", MALBits, MAMBits, MASBits, bits)
+	}
+	if m.len == 0 {
+		return "", errorf(ErrInvalidMAC, "invalid MAC address length: 0")
+	}
+	return m.Format(MACBare | MACUpper)[:bits/4], nil
+}
+
+// iabOUIs are the OUIs that the IEEE assigned IABs from
+var iabOUIs = [][3]byte{{0x00, 0x50, 0xc2}, {0x40, 0xd8, 0x55}}
+
+// IsIAB returns true if the address is in the blocks from which the IEEE
+// assigned Individual Address Blocks, the 36-bit assignments that preceded
+// MA-S. Its Assignment(MASBits) identifies the IAB.
+func (m MAC) IsIAB() bool {
+	for _, oui := range iabOUIs {
+		if m.OUI() == oui && m.len != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMulticast returns true if the address is a group address, which has the
+// least significant bit of its first byte set
+func (m MAC) IsMulticast() bool {
+	return m.addr[0]&0x01 != 0
+}
+
+// IsUnicast returns true if the address is an individual address
+func (m MAC) IsUnicast() bool {
+	return m.len != 0 && !m.IsMulticast()
+}
+
+// IsLocallyAdministered returns true if the address was assigned locally
+// rather than by its vendor, which means the second least significant bit of
+// its first byte is set
+func (m MAC) IsLocallyAdministered() bool {
+	return m.addr[0]&0x02 != 0
+}
+
+// ToEUI64 returns the modified EUI-64 of the address that makes up the
+// interface identifier of a SLAAC address (RFC 4291). It inserts ff:fe in the
+// middle of a 48-bit address and flips the universal/local bit. A 64-bit
+// address only has the bit flipped.
+func (m MAC) ToEUI64() MAC {
+	eui := MAC{len: 8}
+	if m.len == 6 {
+		copy(eui.addr[:3], m.addr[:3])
+		eui.addr[3], eui.addr[4] = 0xff, 0xfe
+		copy(eui.addr[5:], m.addr[3:6])
+	} else {
+		eui.addr = m.addr
+	}
+	eui.addr[0] ^= 0x02
+	return eui
+}
+
+// uint64 returns the address as a number
+func (m MAC) uint64() uint64 {
+	var v uint64
+	for _, b := range m.addr[:m.len] {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// macFromUint64 returns the address of the given length with the value v
+func macFromUint64(v uint64, n uint8) MAC {
+	m := MAC{len: n}
+	for i := int(n) - 1; i >= 0; i-- {
+		m.addr[i] = byte(v)
+		v >>= 8
+	}
+	return m
+}
+
+// maxUint returns the last address of the same length as m as a number
+func (m MAC) maxUint() uint64 {
+	return ^uint64(0) >> (64 - m.Bits())
+}
+
+// Add returns the address delta after m, or before it if delta is negative.
+// It returns an error if that is past ff:ff:ff:ff:ff:ff, or the last EUI-64,
+// or before the first address.
+func (m MAC) Add(delta int64) (MAC, error) {
+	if m.len == 0 {
+		return MAC{}, errorf(ErrInvalidMAC, "invalid MAC address length: 0")
+	}
+	v := m.uint64()
+	if delta >= 0 {
+		if uint64(delta) > m.maxUint()-v {
+			return MAC{}, errorf(ErrInvalidArgument, "%s plus %d is past the last address", m, delta)
+		}
+		return macFromUint64(v+uint64(delta), m.len), nil
+	}
+	abs := uint64(-(delta + 1)) + 1 // -delta without overflowing for math.MinInt64
+	if abs > v {
+		return MAC{}, errorf(ErrInvalidArgument, "%s minus %d is before the first address", m, abs)
+	}
+	return macFromUint64(v-abs, m.len), nil
+}
+
+// NextLocallyAdministered returns the first locally administered unicast
+// address after m. Counting up from one such address crosses into ones with
+// the multicast or the universal bit set when it carries into the first byte,
+// which this skips.
+func (m MAC) NextLocallyAdministered() (MAC, error) {
+	next, err := m.Add(1)
+	if err != nil {
+		return MAC{}, err
+	}
+	if next.addr[0]&0x03 == 0x02 {
+		return next, nil
+	}
+	first := uint(next.addr[0]&^0x03) | 0x02
+	if next.addr[0]&0x03 == 0x03 {
+		first += 4
+	}
+	if first > 0xff {
+		return MAC{}, errorf(ErrInvalidArgument, "no locally administered unicast address after %s", m)
+	}
+	next = MAC{len: m.len}
+	next.addr[0] = byte(first)
+	return next, nil
+}
@@ -0,0 +1,272 @@
+package netaddr
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMAC(t *testing.T) {
+	for _, s := range []string{
+		"01:23:45:67:89:ab",
+		"01:23:45:67:89:AB",
+		"01-23-45-67-89-ab",
+		"0123.4567.89ab",
+		"0123.4567.89AB",
+		"0123456789ab",
+		"0123456789Ab",
+	} {
+		m, err := ParseMAC(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, "01:23:45:67:89:ab", m.String(), s)
+		assert.Equal(t, 48, m.Bits(), s)
+	}
+
+	for _, s := range []string{
+		"01:23:45:67:89:ab:cd:ef",
+		"01-23-45-67-89-AB-CD-EF",
+		"0123.4567.89ab.cdef",
+		"0123456789abcdef",
+	} {
+		m, err := ParseMAC(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, "01:23:45:67:89:ab:cd:ef", m.String(), s)
+		assert.Equal(t, 64, m.Bits(), s)
+	}
+}
+
+func TestParseMACErrors(t *testing.T) {
+	for _, c := range []struct {
+		in, err string
+	}{
+		{"01:23:45:67:89", `MAC address "01:23:45:67:89" has 5 groups, want 6 or 8`},
+		{"01:23:45:67:89:ab:cd", `MAC address "01:23:45:67:89:ab:cd" has 7 groups, want 6 or 8`},
+		{"1:23:45:67:89:ab", `MAC address "1:23:45:67:89:ab" has group "1", want 2 hex digits`},
+		{"01:23-45:67:89:ab", `MAC address "01:23-45:67:89:ab" has 5 groups, want 6 or 8`},
+		{"0123.4567", `MAC address "0123.4567" has 2 groups, want 3 or 4`},
+		{"0123.4567.89a", `MAC address "0123.4567.89a" has group "89a", want 4 hex digits`},
+		{"0123456789a", `MAC address "0123456789a" has 11 hex digits, want 12 or 16`},
+		{"", `MAC address "" has 0 hex digits, want 12 or 16`},
+		{"0123456789ag", `MAC address "0123456789ag" is not hex`},
+		{"01:23:45:67:89:xy", `MAC address "01:23:45:67:89:xy" is not hex`},
+	} {
+		_, err := ParseMAC(c.in)
+		if assert.NotNil(t, err, c.in) {
+			assert.Equal(t, c.err, err.Error())
+			assert.True(t, errors.Is(err, ErrInvalidMAC), c.in)
+		}
+	}
+}
+
+func TestMACFromBytes(t *testing.T) {
+	m, err := MACFromBytes([]byte{0x52, 0x54, 0, 0xab, 0, 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "52:54:00:ab:00:01", m.String())
+	assert.Equal(t, []byte{0x52, 0x54, 0, 0xab, 0, 1}, m.Bytes())
+	assert.Equal(t, net.HardwareAddr{0x52, 0x54, 0, 0xab, 0, 1}, m.HardwareAddr())
+
+	_, err = MACFromBytes([]byte{1, 2, 3})
+	assert.True(t, errors.Is(err, ErrInvalidMAC))
+
+	assert.Equal(t, "", MAC{}.String())
+	assert.Equal(t, 0, MAC{}.Bits())
+}
+
+func TestMACBits(t *testing.T) {
+	m, _ := ParseMAC("00:1b:63:84:45:e6")
+	assert.Equal(t, [3]byte{0x00, 0x1b, 0x63}, m.OUI())
+	assert.True(t, m.IsUnicast())
+	assert.False(t, m.IsMulticast())
+	assert.False(t, m.IsLocallyAdministered())
+
+	m, _ = ParseMAC("01:00:5e:00:00:fb")
+	assert.False(t, m.IsUnicast())
+	assert.True(t, m.IsMulticast())
+	assert.False(t, m.IsLocallyAdministered())
+
+	m, _ = ParseMAC("52:54:00:12:34:56")
+	assert.True(t, m.IsUnicast())
+	assert.True(t, m.IsLocallyAdministered())
+
+	assert.False(t, MAC{}.IsUnicast())
+}
+
+func TestMACToEUI64(t *testing.T) {
+	m, _ := ParseMAC("00:1b:63:84:45:e6")
+	eui := m.ToEUI64()
+	assert.Equal(t, "02:1b:63:ff:fe:84:45:e6", eui.String())
+	assert.Equal(t, 64, eui.Bits())
+
+	// Composed with a prefix it gives the SLAAC address
+	var iid [8]byte
+	copy(iid[:], eui.Bytes())
+	ip, err := ComposeV6(parse("2001:db8::/64"), iid)
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::21b:63ff:fe84:45e6", ip.String())
+
+	m, _ = ParseMAC("52:54:00:12:34:56")
+	assert.Equal(t, "50:54:00:ff:fe:12:34:56", m.ToEUI64().String())
+
+	m, _ = ParseMAC("02:1b:63:ff:fe:84:45:e6")
+	assert.Equal(t, "00:1b:63:ff:fe:84:45:e6", m.ToEUI64().String())
+}
+
+func TestMACFormat(t *testing.T) {
+	m, _ := ParseMAC("0a:1b:2c:3d:4e:5f")
+	for _, c := range []struct {
+		dialect MACDialect
+		out     string
+	}{
+		{MACColon, "0a:1b:2c:3d:4e:5f"},
+		{MACColon | MACUpper, "0A:1B:2C:3D:4E:5F"},
+		{MACDash, "0a-1b-2c-3d-4e-5f"},
+		{MACDash | MACUpper, "0A-1B-2C-3D-4E-5F"},
+		{MACCisco, "0a1b.2c3d.4e5f"},
+		{MACCisco | MACUpper, "0A1B.2C3D.4E5F"},
+		{MACBare, "0a1b2c3d4e5f"},
+		{MACBare | MACUpper, "0A1B2C3D4E5F"},
+	} {
+		out := m.Format(c.dialect)
+		assert.Equal(t, c.out, out)
+		parsed, err := ParseMAC(out)
+		assert.Nil(t, err)
+		assert.Equal(t, m, parsed)
+	}
+
+	m, _ = ParseMAC("0a:1b:2c:3d:4e:5f:60:71")
+	assert.Equal(t, "0a1b.2c3d.4e5f.6071", m.Format(MACCisco))
+	assert.Equal(t, "0A-1B-2C-3D-4E-5F-60-71", m.Format(MACDash|MACUpper))
+
+	assert.Equal(t, "", MAC{}.Format(MACCisco))
+}
+
+func TestMACSplit(t *testing.T) {
+	m, _ := ParseMAC("00:1b:63:84:45:e6")
+	oui, ext := m.Split()
+	assert.Equal(t, [3]byte{0x00, 0x1b, 0x63}, oui)
+	assert.Equal(t, [3]byte{0x84, 0x45, 0xe6}, ext)
+}
+
+func TestMACAssignment(t *testing.T) {
+	m, _ := ParseMAC("70:b3:d5:f2:f1:23")
+	for bits, want := range map[int]string{MALBits: "70B3D5", MAMBits: "70B3D5F", MASBits: "70B3D5F2F"} {
+		got, err := m.Assignment(bits)
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := m.Assignment(32)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = MAC{}.Assignment(MALBits)
+	assert.True(t, errors.Is(err, ErrInvalidMAC))
+
+	assert.False(t, m.IsIAB())
+	m, _ = ParseMAC("00:50:c2:12:34:56")
+	assert.True(t, m.IsIAB())
+	iab, _ := m.Assignment(MASBits)
+	assert.Equal(t, "0050C2123", iab)
+	m, _ = ParseMAC("40-D8-55-01-20-00")
+	assert.True(t, m.IsIAB())
+	assert.False(t, MAC{}.IsIAB())
+}
+
+func TestMACMarshalText(t *testing.T) {
+	type host struct {
+		Name string
+		MAC  MAC
+	}
+	m, _ := ParseMAC("52:54:00:ab:cd:ef")
+	data, err := json.Marshal(host{"vm1", m})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Name":"vm1","MAC":"52:54:00:ab:cd:ef"}`, string(data))
+
+	defer func(d MACDialect) { DefaultMACDialect = d }(DefaultMACDialect)
+	DefaultMACDialect = MACCisco | MACUpper
+	data, err = json.Marshal(host{"vm1", m})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"Name":"vm1","MAC":"5254.00AB.CDEF"}`, string(data))
+
+	var h host
+	assert.Nil(t, json.Unmarshal(data, &h))
+	assert.Equal(t, m, h.MAC)
+	assert.Nil(t, json.Unmarshal([]byte(`{"MAC":"52-54-00-ab-cd-ef"}`), &h))
+	assert.Equal(t, m, h.MAC)
+	assert.Nil(t, json.Unmarshal([]byte(`{"MAC":""}`), &h))
+	assert.Equal(t, MAC{}, h.MAC)
+
+	err = json.Unmarshal([]byte(`{"MAC":"52:54:00"}`), &h)
+	assert.True(t, errors.Is(err, ErrInvalidMAC))
+}
+
+func TestMACAdd(t *testing.T) {
+	m, _ := ParseMAC("52:54:00:ab:00:ff")
+	next, err := m.Add(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "52:54:00:ab:01:00", next.String())
+	prev, err := next.Add(-2)
+	assert.Nil(t, err)
+	assert.Equal(t, "52:54:00:ab:00:fe", prev.String())
+	same, err := m.Add(0)
+	assert.Nil(t, err)
+	assert.Equal(t, m, same)
+
+	m, _ = ParseMAC("ff:ff:ff:ff:ff:fe")
+	last, err := m.Add(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "ff:ff:ff:ff:ff:ff", last.String())
+	_, err = m.Add(2)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = m.Add(math.MaxInt64)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	m, _ = ParseMAC("00:00:00:00:00:01")
+	first, err := m.Add(-1)
+	assert.Nil(t, err)
+	assert.Equal(t, "00:00:00:00:00:00", first.String())
+	_, err = m.Add(-2)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = m.Add(math.MinInt64)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	// EUI-64s go on past 48 bits
+	m, _ = ParseMAC("00:00:ff:ff:ff:ff:ff:ff")
+	next, err = m.Add(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "00:01:00:00:00:00:00:00", next.String())
+	m, _ = ParseMAC("ff:ff:ff:ff:ff:ff:ff:ff")
+	_, err = m.Add(1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	_, err = MAC{}.Add(1)
+	assert.True(t, errors.Is(err, ErrInvalidMAC))
+}
+
+func TestMACNextLocallyAdministered(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+	}{
+		{"52:54:00:ab:00:00", "52:54:00:ab:00:01"},
+		{"02:ff:ff:ff:ff:ff", "06:00:00:00:00:00"},
+		{"00:1b:63:84:45:e6", "02:00:00:00:00:00"},
+		{"01:00:5e:00:00:fb", "02:00:00:00:00:00"},
+		{"03:00:00:00:00:00", "06:00:00:00:00:00"},
+		{"fa:ff:ff:ff:ff:ff", "fe:00:00:00:00:00"},
+		{"02:ff:ff:ff:ff:ff:ff:ff", "06:00:00:00:00:00:00:00"},
+	} {
+		m, _ := ParseMAC(c.in)
+		next, err := m.NextLocallyAdministered()
+		assert.Nil(t, err, c.in)
+		assert.Equal(t, c.out, next.String(), c.in)
+		assert.True(t, next.IsLocallyAdministered() && next.IsUnicast(), c.in)
+	}
+
+	m, _ := ParseMAC("fe:ff:ff:ff:ff:ff")
+	_, err := m.NextLocallyAdministered()
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	m, _ = ParseMAC("ff:ff:ff:ff:ff:ff")
+	_, err = m.NextLocallyAdministered()
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
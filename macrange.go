@@ -0,0 +1,106 @@
+package netaddr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MACRange is a range of consecutive MAC addresses of the same length
+type MACRange struct {
+	First, Last MAC
+}
+
+// ParseMACRange parses a range of MAC addresses written as the first and the
+// last separated by a dash, like "52:54:00:ab:00:00-52:54:00:ab:00:ff". The
+// addresses may be in any form that ParseMAC accepts, including with dashes,
+// and must be of the same length with the first not after the last. When
+// more than one dash splits s into two addresses, it takes the first split
+// that makes a valid range.
+func ParseMACRange(s string) (MACRange, error) {
+	var rangeErr error
+	for i := strings.IndexByte(s, '-'); i >= 0; i = nextDash(s, i) {
+		first, err := ParseMAC(strings.TrimSpace(s[:i]))
+		if err != nil {
+			continue
+		}
+		last, err := ParseMAC(strings.TrimSpace(s[i+1:]))
+		if err != nil {
+			continue
+		}
+		r := MACRange{First: first, Last: last}
+		if err := r.check(); err != nil {
+			if rangeErr == nil {
+				rangeErr = err
+			}
+			continue
+		}
+		return r, nil
+	}
+	if rangeErr != nil {
+		return MACRange{}, rangeErr
+	}
+	return MACRange{}, errorf(ErrInvalidMAC, "MAC range %q is not two addresses separated by a dash", s)
+}
+
+// nextDash returns the index of the dash after the one at i, or -1
+func nextDash(s string, i int) int {
+	j := strings.IndexByte(s[i+1:], '-')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// check returns an error unless the range is valid
+func (r MACRange) check() error {
+	if r.First.len == 0 || r.First.len != r.Last.len {
+		return errorf(ErrInvalidMAC, "MAC range %s has addresses of different lengths", r)
+	}
+	if r.First.uint64() > r.Last.uint64() {
+		return errorf(ErrInvalidArgument, "MAC range %s ends before it starts", r)
+	}
+	return nil
+}
+
+func (r MACRange) String() string {
+	return fmt.Sprintf("[%s,%s]", r.First, r.Last)
+}
+
+// Size returns the number of addresses in the range. The range of all
+// EUI-64s has 2^64, which doesn't fit, so its size is 0.
+func (r MACRange) Size() uint64 {
+	return r.Last.uint64() - r.First.uint64() + 1
+}
+
+// Contains returns true if the given address, which must be of the same
+// length as those of the range, is in the range
+func (r MACRange) Contains(m MAC) bool {
+	v := m.uint64()
+	return m.len == r.First.len && v >= r.First.uint64() && v <= r.Last.uint64()
+}
+
+// Nth returns the address i after the first one in the range. It returns an
+// error if that is past the end of the range.
+func (r MACRange) Nth(i uint64) (MAC, error) {
+	if err := r.check(); err != nil {
+		return MAC{}, err
+	}
+	if i > r.Last.uint64()-r.First.uint64() {
+		return MAC{}, errorf(ErrInvalidArgument, "MAC range %s has no address %d", r, i)
+	}
+	return macFromUint64(r.First.uint64()+i, r.First.len), nil
+}
+
+// Walk calls fn with each address in the range in order until it returns
+// false
+func (r MACRange) Walk(fn func(MAC) bool) {
+	if r.check() != nil {
+		return
+	}
+	first, last := r.First.uint64(), r.Last.uint64()
+	for v := first; ; v++ {
+		if !fn(macFromUint64(v, r.First.len)) || v == last {
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package netaddr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMACRange(t *testing.T) {
+	for _, s := range []string{
+		"52:54:00:ab:00:00-52:54:00:ab:00:ff",
+		"52:54:00:ab:00:00 - 52:54:00:ab:00:ff",
+		"52-54-00-ab-00-00-52-54-00-ab-00-ff",
+		"5254.00ab.0000-5254.00AB.00FF",
+		"525400ab0000-52:54:00:ab:00:ff",
+	} {
+		r, err := ParseMACRange(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, "[52:54:00:ab:00:00,52:54:00:ab:00:ff]", r.String(), s)
+		assert.Equal(t, uint64(256), r.Size(), s)
+	}
+
+	for _, c := range []struct {
+		in   string
+		kind error
+	}{
+		{"52:54:00:ab:00:00", ErrInvalidMAC},
+		{"52:54:00:ab:00:00-", ErrInvalidMAC},
+		{"52:54:00:ab:00:00-52:54:00:ab:00", ErrInvalidMAC},
+		{"52:54:00:ab:00:00-52:54:00:ab:00:00:00:00", ErrInvalidMAC},
+		{"52:54:00:ab:00:ff-52:54:00:ab:00:00", ErrInvalidArgument},
+	} {
+		_, err := ParseMACRange(c.in)
+		assert.True(t, errors.Is(err, c.kind), "%s: %v", c.in, err)
+	}
+
+	// Fourteen groups split into six and eight, or eight and six, so the
+	// addresses are always of different lengths
+	_, err := ParseMACRange("52-54-00-ab-00-00-52-54-00-ff-fe-ab-00-ff")
+	assert.True(t, errors.Is(err, ErrInvalidMAC), "%v", err)
+	assert.Contains(t, err.Error(), "different lengths")
+}
+
+func TestMACRange(t *testing.T) {
+	r, _ := ParseMACRange("52:54:00:ab:00:00-52:54:00:ab:00:ff")
+	m, _ := ParseMAC("52:54:00:ab:00:80")
+	assert.True(t, r.Contains(m))
+	assert.True(t, r.Contains(r.First))
+	assert.True(t, r.Contains(r.Last))
+	m, _ = ParseMAC("52:54:00:ab:01:00")
+	assert.False(t, r.Contains(m))
+	m, _ = ParseMAC("52:54:00:ab:00:80:00:00")
+	assert.False(t, r.Contains(m))
+	assert.False(t, r.Contains(MAC{}))
+
+	nth, err := r.Nth(0)
+	assert.Nil(t, err)
+	assert.Equal(t, r.First, nth)
+	nth, err = r.Nth(255)
+	assert.Nil(t, err)
+	assert.Equal(t, r.Last, nth)
+	nth, err = r.Nth(16)
+	assert.Nil(t, err)
+	assert.Equal(t, "52:54:00:ab:00:10", nth.String())
+	_, err = r.Nth(256)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = MACRange{}.Nth(0)
+	assert.True(t, errors.Is(err, ErrInvalidMAC))
+
+	r, _ = ParseMACRange("00:00:00:00:00:00:00:00-ff:ff:ff:ff:ff:ff:ff:ff")
+	assert.Equal(t, uint64(0), r.Size())
+	nth, err = r.Nth(^uint64(0))
+	assert.Nil(t, err)
+	assert.Equal(t, r.Last, nth)
+}
+
+func TestMACRangeWalk(t *testing.T) {
+	r, _ := ParseMACRange("52:54:00:ab:00:fe-52:54:00:ab:01:01")
+	var macs []string
+	r.Walk(func(m MAC) bool {
+		macs = append(macs, m.String())
+		return true
+	})
+	assert.Equal(t, []string{"52:54:00:ab:00:fe", "52:54:00:ab:00:ff", "52:54:00:ab:01:00", "52:54:00:ab:01:01"}, macs)
+
+	macs = nil
+	r.Walk(func(m MAC) bool {
+		macs = append(macs, m.String())
+		return len(macs) < 2
+	})
+	assert.Equal(t, []string{"52:54:00:ab:00:fe", "52:54:00:ab:00:ff"}, macs)
+
+	// The walk ends at the last address without wrapping around
+	r, _ = ParseMACRange("ff:ff:ff:ff:ff:ff-ff:ff:ff:ff:ff:ff")
+	count := 0
+	r.Walk(func(MAC) bool { count++; return true })
+	assert.Equal(t, 1, count)
+}
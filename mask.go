@@ -0,0 +1,62 @@
+package netaddr
+
+import (
+	"net"
+	"strings"
+)
+
+// MaskFromPrefix returns the mask with the given number of leading ones out
+// of the given number of bits, which must be 32 or 128.
+func MaskFromPrefix(prefixLen, bits int) (net.IPMask, error) {
+	if bits != 8*net.IPv4len && bits != 8*net.IPv6len {
+		return nil, errorf(ErrInvalidMask, "invalid mask length: %d bits", bits)
+	}
+	if prefixLen < 0 || prefixLen > bits {
+		return nil, errorf(ErrInvalidPrefixLength, "invalid prefix length for %d bit mask: %d", bits, prefixLen)
+	}
+	return net.CIDRMask(prefixLen, bits), nil
+}
+
+// IsContiguousMask returns true if the mask is 4 or 16 bytes long and its
+// ones, if any, all come before its zeros.
+func IsContiguousMask(m net.IPMask) bool {
+	if len(m) != net.IPv4len && len(m) != net.IPv6len {
+		return false
+	}
+	_, bits := m.Size()
+	return bits != 0
+}
+
+// PrefixFromMask returns the number of leading ones in the mask. Unlike
+// net.IPMask.Size, which returns 0, 0 for both, it returns an error for a
+// mask that isn't contiguous as opposed to one that is all zeros.
+func PrefixFromMask(m net.IPMask) (int, error) {
+	if !IsContiguousMask(m) {
+		return 0, errorf(ErrInvalidMask, "mask is not contiguous: %s", maskString(m))
+	}
+	ones, _ := m.Size()
+	return ones, nil
+}
+
+// ParseDottedMask parses an IPv4 mask in dotted decimal form, like
+// "255.255.252.0". The mask must be contiguous.
+func ParseDottedMask(s string) (net.IPMask, error) {
+	ip := net.ParseIP(s).To4()
+	if ip == nil || strings.Contains(s, ":") {
+		return nil, errorf(ErrInvalidMask, "invalid dotted mask: %q", s)
+	}
+	m := net.IPMask(ip)
+	if !IsContiguousMask(m) {
+		return nil, errorf(ErrInvalidMask, "mask is not contiguous: %s", s)
+	}
+	return m, nil
+}
+
+// maskString formats the mask in dotted decimal form if it is 4 bytes long
+// and in hexadecimal otherwise.
+func maskString(m net.IPMask) string {
+	if len(m) == net.IPv4len {
+		return net.IP(m).String()
+	}
+	return m.String()
+}
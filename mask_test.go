@@ -0,0 +1,71 @@
+package netaddr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaskFromPrefix(t *testing.T) {
+	m, err := MaskFromPrefix(22, 32)
+	assert.Nil(t, err)
+	assert.Equal(t, net.IPMask{255, 255, 252, 0}, m)
+
+	m, err = MaskFromPrefix(0, 128)
+	assert.Nil(t, err)
+	assert.Equal(t, make(net.IPMask, 16), m)
+
+	for _, test := range [][2]int{{33, 32}, {-1, 32}, {129, 128}, {8, 64}, {0, 0}} {
+		m, err = MaskFromPrefix(test[0], test[1])
+		assert.NotNil(t, err, "%v", test)
+		assert.Nil(t, m)
+	}
+}
+
+func TestIsContiguousMask(t *testing.T) {
+	assert.True(t, IsContiguousMask(net.IPMask{255, 255, 252, 0}))
+	assert.True(t, IsContiguousMask(net.IPMask{0, 0, 0, 0}))
+	assert.True(t, IsContiguousMask(net.IPMask{255, 255, 255, 255}))
+	assert.True(t, IsContiguousMask(net.CIDRMask(64, 128)))
+	assert.False(t, IsContiguousMask(net.IPMask{255, 0, 255, 0}))
+	assert.False(t, IsContiguousMask(net.IPMask{0, 0, 0, 255}))
+	assert.False(t, IsContiguousMask(net.IPMask{255, 255, 255}))
+	assert.False(t, IsContiguousMask(nil))
+}
+
+func TestPrefixFromMask(t *testing.T) {
+	ones, err := PrefixFromMask(net.IPMask{255, 255, 252, 0})
+	assert.Nil(t, err)
+	assert.Equal(t, 22, ones)
+
+	ones, err = PrefixFromMask(net.IPMask{0, 0, 0, 0})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, ones)
+
+	ones, err = PrefixFromMask(net.CIDRMask(127, 128))
+	assert.Nil(t, err)
+	assert.Equal(t, 127, ones)
+
+	_, err = PrefixFromMask(net.IPMask{255, 0, 255, 0})
+	assert.Equal(t, "mask is not contiguous: 255.0.255.0", err.Error())
+
+	_, err = PrefixFromMask(net.IPMask{255, 255})
+	assert.NotNil(t, err)
+}
+
+func TestParseDottedMask(t *testing.T) {
+	m, err := ParseDottedMask("255.255.252.0")
+	assert.Nil(t, err)
+	assert.Equal(t, net.IPMask{255, 255, 252, 0}, m)
+
+	m, err = ParseDottedMask("0.0.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, net.IPMask{0, 0, 0, 0}, m)
+
+	for _, s := range []string{"", "255.255.0", "255.255.0.255", "255.255.256.0", "ffff::", "::ffff:255.255.255.0", "/24"} {
+		m, err = ParseDottedMask(s)
+		assert.NotNil(t, err, s)
+		assert.Nil(t, m, s)
+	}
+}
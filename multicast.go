@@ -0,0 +1,158 @@
+package netaddr
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Scope is the scope of an IPv6 multicast address, as defined by RFC 4291
+// and RFC 7346.
+type Scope uint8
+
+// The scopes with a name. The others are unassigned or reserved.
+const (
+	ScopeInterfaceLocal    Scope = 0x1
+	ScopeLinkLocal         Scope = 0x2
+	ScopeRealmLocal        Scope = 0x3
+	ScopeAdminLocal        Scope = 0x4
+	ScopeSiteLocal         Scope = 0x5
+	ScopeOrganizationLocal Scope = 0x8
+	ScopeGlobal            Scope = 0xe
+)
+
+var scopeNames = map[Scope]string{
+	ScopeInterfaceLocal:    "interface-local",
+	ScopeLinkLocal:         "link-local",
+	ScopeRealmLocal:        "realm-local",
+	ScopeAdminLocal:        "admin-local",
+	ScopeSiteLocal:         "site-local",
+	ScopeOrganizationLocal: "organization-local",
+	ScopeGlobal:            "global",
+}
+
+func (s Scope) String() string {
+	if name, ok := scopeNames[s]; ok {
+		return name
+	}
+	if s == 0x0 || s == 0xf {
+		return fmt.Sprintf("reserved(%#x)", uint8(s))
+	}
+	return fmt.Sprintf("unassigned(%#x)", uint8(s))
+}
+
+// Flags are the flag bits of an IPv6 multicast address
+type Flags uint8
+
+// The flags defined by RFC 4291, RFC 3306 and RFC 3956. The highest bit is
+// reserved.
+const (
+	// FlagTransient marks an address that isn't permanently assigned by IANA
+	FlagTransient Flags = 0x1
+	// FlagPrefix marks an address based on a unicast prefix (RFC 3306)
+	FlagPrefix Flags = 0x2
+	// FlagRP marks an address with the address of a rendezvous point embedded
+	// in it (RFC 3956)
+	FlagRP Flags = 0x4
+)
+
+// String lists the flags that are set, like "R|P|T", or returns "none"
+func (f Flags) String() string {
+	var names []string
+	if f&0x8 != 0 {
+		names = append(names, "0x8")
+	}
+	for _, flag := range []struct {
+		flag Flags
+		name string
+	}{{FlagRP, "R"}, {FlagPrefix, "P"}, {FlagTransient, "T"}} {
+		if f&flag.flag != 0 {
+			names = append(names, flag.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// checkMulticast returns an error unless ip is an IPv6 multicast address
+func checkMulticast(ip net.IP) error {
+	if !validIPLen(ip) {
+		return errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	if ip.To4() != nil {
+		return errorf(ErrFamilyMismatch, "not an IPv6 address: %s", ip)
+	}
+	if ip[0] != 0xff {
+		return errorf(ErrNotInNetwork, "not a multicast address: %s", ip)
+	}
+	return nil
+}
+
+// MulticastScope returns the scope of the given IPv6 multicast address. It
+// returns an error for an IPv4 address or one that isn't multicast.
+func MulticastScope(ip net.IP) (Scope, error) {
+	if err := checkMulticast(ip); err != nil {
+		return 0, err
+	}
+	return Scope(ip[1] & 0x0f), nil
+}
+
+// MulticastFlags returns the flags of the given IPv6 multicast address. It
+// returns an error for an IPv4 address or one that isn't multicast.
+func MulticastFlags(ip net.IP) (Flags, error) {
+	if err := checkMulticast(ip); err != nil {
+		return 0, err
+	}
+	return Flags(ip[1] >> 4), nil
+}
+
+// MulticastPrefix returns the unicast prefix embedded in the given multicast
+// address and true if it is a unicast-prefix-based address (RFC 3306). It
+// returns false for any other address.
+func MulticastPrefix(ip net.IP) (*net.IPNet, bool) {
+	prefixLen, ok := embeddedPrefixLen(ip, FlagPrefix|FlagTransient)
+	if !ok {
+		return nil, false
+	}
+	prefix := make(net.IP, net.IPv6len)
+	copy(prefix, ip[4:12])
+	mask := net.CIDRMask(prefixLen, 128)
+	return &net.IPNet{IP: prefix.Mask(mask), Mask: mask}, true
+}
+
+// EmbeddedRP returns the address of the rendezvous point embedded in the
+// given multicast address and true if it has one (RFC 3956). It returns
+// false for any other address.
+func EmbeddedRP(ip net.IP) (net.IP, bool) {
+	prefixLen, ok := embeddedPrefixLen(ip, FlagRP|FlagPrefix|FlagTransient)
+	if !ok || prefixLen == 0 {
+		return nil, false
+	}
+	rp := make(net.IP, net.IPv6len)
+	copy(rp, ip[4:12])
+	rp = rp.Mask(net.CIDRMask(prefixLen, 128))
+	rp[15] = ip[2] & 0x0f // RIID
+	return rp, true
+}
+
+// embeddedPrefixLen returns the prefix length of a multicast address with a
+// unicast prefix embedded in it and true if the address has exactly the
+// given flags. The prefix length must be at most 64.
+func embeddedPrefixLen(ip net.IP, flags Flags) (int, bool) {
+	f, err := MulticastFlags(ip)
+	if err != nil || f&^0x8 != flags || ip[3] > 64 {
+		return 0, false
+	}
+	// The reserved bits must be zero. With an embedded RP, the last four of
+	// them hold the RIID.
+	reserved := byte(0xff)
+	if flags&FlagRP != 0 {
+		reserved = 0xf0
+	}
+	if ip[2]&reserved != 0 {
+		return 0, false
+	}
+	return int(ip[3]), true
+}
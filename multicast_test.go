@@ -0,0 +1,112 @@
+package netaddr
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMulticastScope(t *testing.T) {
+	for _, test := range []struct {
+		ip    string
+		scope Scope
+		name  string
+	}{
+		{"ff01::1", ScopeInterfaceLocal, "interface-local"},
+		{"ff02::1:ff00:1", ScopeLinkLocal, "link-local"},
+		{"ff03::fc", ScopeRealmLocal, "realm-local"},
+		{"ff14::1", ScopeAdminLocal, "admin-local"},
+		{"ff05::1:3", ScopeSiteLocal, "site-local"},
+		{"ff18::1", ScopeOrganizationLocal, "organization-local"},
+		{"ff3e:30:2001:db8::1", ScopeGlobal, "global"},
+		{"ff00::1", 0, "reserved(0x0)"},
+		{"ff0f::1", 0xf, "reserved(0xf)"},
+		{"ff06::1", 0x6, "unassigned(0x6)"},
+	} {
+		scope, err := MulticastScope(net.ParseIP(test.ip))
+		assert.Nil(t, err)
+		assert.Equal(t, test.scope, scope, test.ip)
+		assert.Equal(t, test.name, scope.String(), test.ip)
+	}
+}
+
+func TestMulticastFlags(t *testing.T) {
+	for _, test := range []struct {
+		ip    string
+		flags Flags
+		name  string
+	}{
+		{"ff05::1:3", 0, "none"},
+		{"ff15::1", FlagTransient, "T"},
+		{"ff3e:30:2001:db8::1", FlagPrefix | FlagTransient, "P|T"},
+		{"ff7e:140:2001:db8::1", FlagRP | FlagPrefix | FlagTransient, "R|P|T"},
+		{"fff2::1", 0xf, "0x8|R|P|T"},
+	} {
+		flags, err := MulticastFlags(net.ParseIP(test.ip))
+		assert.Nil(t, err)
+		assert.Equal(t, test.flags, flags, test.ip)
+		assert.Equal(t, test.name, flags.String(), test.ip)
+	}
+}
+
+func TestMulticastErrors(t *testing.T) {
+	_, err := MulticastScope(net.ParseIP("2001:db8::1"))
+	assert.True(t, errors.Is(err, ErrNotInNetwork))
+	_, err = MulticastFlags(net.ParseIP("fe80::1"))
+	assert.EqualError(t, err, "not a multicast address: fe80::1")
+
+	// IPv4, in either form, isn't IPv6 even when multicast
+	_, err = MulticastScope(net.ParseIP("224.0.0.1"))
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, err = MulticastFlags(net.IP{224, 0, 0, 1})
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+
+	_, err = MulticastScope(nil)
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+}
+
+func TestMulticastPrefix(t *testing.T) {
+	prefix, ok := MulticastPrefix(net.ParseIP("ff3e:30:3ffe:ffff:1::1234"))
+	assert.True(t, ok)
+	assert.Equal(t, parse("3ffe:ffff:1::/48"), prefix)
+
+	// Bits past the prefix length are ignored
+	prefix, ok = MulticastPrefix(net.ParseIP("ff3e:20:2001:db8:ffff:ffff::1"))
+	assert.True(t, ok)
+	assert.Equal(t, parse("2001:db8::/32"), prefix)
+
+	for _, ip := range []string{
+		"ff05::1:3",               // no P flag
+		"ff7e:140:2001:db8::1",    // embedded RP
+		"ff3e:41:2001:db8::1",     // prefix too long
+		"ff3e:130:2001:db8::1",    // reserved bits set
+		"2001:db8::1", "10.0.0.1", // not multicast
+	} {
+		_, ok = MulticastPrefix(net.ParseIP(ip))
+		assert.False(t, ok, ip)
+	}
+}
+
+func TestEmbeddedRP(t *testing.T) {
+	// The example from RFC 3956
+	rp, ok := EmbeddedRP(net.ParseIP("ff7e:140:1234:5678:9abc::4321"))
+	assert.True(t, ok)
+	assert.Equal(t, net.ParseIP("1234:5678:9abc::1"), rp)
+
+	rp, ok = EmbeddedRP(net.ParseIP("ff75:f20:2001:db8:ffff::1"))
+	assert.True(t, ok)
+	assert.Equal(t, net.ParseIP("2001:db8::f"), rp)
+
+	for _, ip := range []string{
+		"ff3e:30:2001:db8::1",   // no R flag
+		"ff7e:100:2001:db8::1",  // no prefix
+		"ff7e:141:2001:db8::1",  // prefix too long
+		"ff7e:1140:2001:db8::1", // reserved bits set
+		"ff05::1:3", "2001:db8::1",
+	} {
+		_, ok = EmbeddedRP(net.ParseIP(ip))
+		assert.False(t, ok, ip)
+	}
+}
@@ -1,10 +1,10 @@
 package netaddr
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"math/big"
 	"net"
+	"sort"
 	"strings"
 )
 
@@ -17,26 +17,75 @@ func NetSize(n *net.IPNet) *big.Int {
 
 // ParseIP is like net.ParseIP except that it parses IPv4 addresses as 4 byte
 // addresses instead of 16-byte mapped IPv6 addresses. This has been one of my
-// biggest gripes against the net package.
+// biggest gripes against the net package. It also accepts IPv6 addresses
+// with a zone, like "fe80::1%eth0", and drops the zone since it doesn't
+// matter for comparing addresses. Use ParseIPZone to keep it.
 func ParseIP(address string) net.IP {
-	if strings.Contains(address, ":") {
-		return net.ParseIP(address)
+	ip, _, err := ParseIPZone(address)
+	if err != nil {
+		return nil
+	}
+	return ip
+}
+
+// ParseIPZone parses an IP address like ParseIP and returns its zone
+// separately. The zone is empty when the address has none. A zone is only
+// allowed on an IPv6 address. A zone which starts with the URL encoded "%25"
+// followed by a non-digit, like "fe80::1%25eth0", is decoded. Otherwise, the
+// digits are taken literally as an interface index.
+func ParseIPZone(address string) (net.IP, string, error) {
+	s, zone := address, ""
+	if i := strings.IndexByte(address, '%'); i >= 0 {
+		s, zone = address[:i], address[i+1:]
+		if len(zone) > 2 && strings.HasPrefix(zone, "25") && (zone[2] < '0' || zone[2] > '9') {
+			zone = zone[2:]
+		}
+		if !strings.Contains(s, ":") || !validZone(zone) {
+			return nil, "", wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: address})
+		}
+	}
+
+	var ip net.IP
+	if strings.Contains(s, ":") {
+		ip = net.ParseIP(s)
+	} else {
+		ip = net.ParseIP(s).To4()
+	}
+	if ip == nil {
+		return nil, "", wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: address})
 	}
-	return net.ParseIP(address).To4()
+	return ip, zone, nil
+}
+
+// validZone returns true if the zone is not empty and has only printable
+// characters other than space, '%' and '/'.
+func validZone(zone string) bool {
+	if zone == "" {
+		return false
+	}
+	for i := 0; i < len(zone); i++ {
+		if c := zone[i]; c <= ' ' || c >= 0x7f || c == '%' || c == '/' {
+			return false
+		}
+	}
+	return true
 }
 
 // ParseCIDR is like net.ParseCIDR except that it parses IPv4 addresses as 4
 // byte addresses instead of 16-byte mapped IPv6 addresses. Much like ParseIP.
+// A CIDR within ::ffff:0:0/96, like "::ffff:10.0.0.0/104", is an IPv4 network
+// written in the IPv6 form. It is translated to the IPv4 network with 96
+// fewer bits in the prefix, 10.0.0.0/8 in this example.
 func ParseCIDR(cidr string) (net.IP, *net.IPNet, error) {
 	ip, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
-		return net.IP{}, nil, err
+		return net.IP{}, nil, wrapKind(ErrInvalidCIDR, err)
 	}
 
-	if strings.Contains(cidr, ":") {
-		return ip, ipNet, nil
+	if p := prefixFromNet(ipNet); p.addrLen == net.IPv4len {
+		return ip.To4(), p.toNet(), nil
 	}
-	return ip.To4(), ipNet, nil
+	return ip, ipNet, nil
 }
 
 // ParseCIDRToNet is like ParseCIDR except that it only returns one *net.IPNet
@@ -57,17 +106,71 @@ func ParseCIDRToNet(cidr string) (*net.IPNet, error) {
 // allow a CIDR where the host part is non-zero. For example, the following
 // CIDRs will result in an error: 203.0.113.1/24, 2001:db8::1/64, 10.0.20.0/20
 func ParseNet(cidr string) (parsed *net.IPNet, err error) {
-	ip, parsed, err := net.ParseCIDR(cidr)
+	ip, parsed, err := ParseCIDR(cidr)
 	if err != nil {
 		return nil, err
 	}
 	if !ip.Equal(parsed.IP) {
-		err = fmt.Errorf("Host part is not zero")
+		err = errorf(ErrHostBitsSet, "Host part is not zero")
 		return nil, err
 	}
 	return
 }
 
+// ParseNetOrIP parses either an IP network from a CIDR, like ParseNet, or a
+// single IP address, which it returns as a /32 or /128 network.
+func ParseNetOrIP(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		return ParseNet(s)
+	}
+	ip := ParseIP(s)
+	if ip == nil {
+		return nil, wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: s})
+	}
+	return ipToNet(ip), nil
+}
+
+// ParseNetShort parses a CIDR like ParseNet but also accepts the shorthand
+// for IPv4 networks that leaves out trailing zero components, as in "10/8"
+// or "172.16/12". The missing components are filled in with zeros before the
+// host part is checked. Each IPv4 component and the prefix length must be
+// decimal without leading zeros, and a prefix length is always required.
+// IPv6 networks are parsed like ParseNetStrict. For example:
+//
+//	"10/8"            10.0.0.0/8
+//	"172.16/12"       172.16.0.0/12
+//	"192.168.1/24"    192.168.1.0/24
+//	"10.1/8"          error: host part is not zero
+//	"10"              error: no prefix length
+//	"010/8"           error: ambiguous component
+//	"2001:db8::/32"   2001:db8::/32
+func ParseNetShort(s string) (*net.IPNet, error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return nil, wrapKind(ErrInvalidCIDR, &net.ParseError{Type: "CIDR address", Text: s})
+	}
+	if strings.Contains(s[:i], ":") {
+		return ParseNetStrict(s)
+	}
+
+	parts := strings.Split(s[:i], ".")
+	if len(parts) > 4 {
+		return nil, errorf(ErrInvalidCIDR, "too many IPv4 components in %q", s)
+	}
+	for _, part := range parts {
+		if !strictDecimal(part, 255) {
+			return nil, errorf(ErrInvalidCIDR, "ambiguous IPv4 component %q in %q", part, s)
+		}
+	}
+	if !strictDecimal(s[i+1:], 32) {
+		return nil, errorf(ErrInvalidCIDR, "ambiguous prefix length in %q", s)
+	}
+	for len(parts) < 4 {
+		parts = append(parts, "0")
+	}
+	return ParseNet(strings.Join(parts, ".") + s[i:])
+}
+
 // NewIP returns a new IP with the given size. The size must be 4 for IPv4 and
 // 16 for IPv6.
 func NewIP(size int) net.IP {
@@ -100,91 +203,58 @@ func BroadcastAddr(n *net.IPNet) net.IP {
 }
 
 // ContainsNet returns true if net2 is a subset of net1. To be clear, it
-// returns true if net1 == net2 also.
+// returns true if net1 == net2 also. IPv4 networks in the 16 byte form are
+// the same as in the 4 byte form.
 func ContainsNet(net1, net2 *net.IPNet) bool {
-	// If the two networks are different IP versions, return false
-	if len(net1.IP) != len(net2.IP) {
-		return false
-	}
-	if !net1.Contains(net2.IP) {
-		return false
-	}
-	if !net1.IP.Equal(net2.IP) {
-		return true
-	}
-	return bytes.Compare(net1.Mask, net2.Mask) <= 0
+	return prefixFromNet(net1).contains(prefixFromNet(net2))
 }
 
 // netDifference returns the set difference a - b. It returns the list of CIDRs
 // in order from largest to smallest. They are *not* sorted by network IP.
 func netDifference(a, b *net.IPNet) (result []*net.IPNet) {
-	// If the two networks are different IP versions, return a
-	if len(a.IP) != len(b.IP) {
-		return []*net.IPNet{a}
+	for _, p := range prefixFromNet(a).difference(prefixFromNet(b)) {
+		result = append(result, p.toNet())
 	}
-
-	// If b contains a then the difference is empty
-	if ContainsNet(b, a) {
-		return
-	}
-	// If a doesn't contain b then the difference is equal to a
-	if !ContainsNet(a, b) {
-		return []*net.IPNet{a}
-	}
-
-	// If two nets overlap then one must contain the other. At this point, we
-	// know a contains b and b is smaller than a. Cut a in half and recurse on
-	// the one that overlaps
-	first, second := divideNetInHalf(a)
-	if bytes.Compare(b.IP, second.IP) < 0 {
-		return append([]*net.IPNet{second}, netDifference(first, b)...)
-	}
-	return append([]*net.IPNet{first}, netDifference(second, b)...)
+	return
 }
 
-// divideNetInHalf returns the given net as two equally sized halves
-func divideNetInHalf(n *net.IPNet) (a, b *net.IPNet) {
-	// Get the size of the original netmask
-	ones, bits := n.Mask.Size()
-
-	// Netmask has one more 1. Net is half the size of original.
-	mask := net.CIDRMask(ones+1, bits)
-
-	// Create a new IP to fill in for the second half
-	ip := net.ParseIP("::")
-	if bits == 32 {
-		ip = net.ParseIP("0.0.0.0").To4()
+// DifferenceNetBounded returns the networks that cover the addresses in n
+// that are not in m, sorted like GetNetworks. If that would take more than
+// maxFragments networks, it returns a *FragmentLimitError instead. Removing
+// a /128 from a /32, for example, takes 96. The count is found without
+// splitting n.
+func DifferenceNetBounded(n, m *net.IPNet, maxFragments int) ([]*net.IPNet, error) {
+	if maxFragments < 0 {
+		return nil, errorf(ErrInvalidArgument, "maxFragments must not be negative: %d", maxFragments)
+	}
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return nil, err
 	}
-	// Fill in the new IP
-	for i := 0; i < bits/8; i++ {
-		// Puts a 1 in the new bit since this is the second half
-		extraOne := mask[i] ^ n.Mask[i]
-		// New IP is the same as old IP with the extra one at the end
-		ip[i] = mask[i] & (n.IP[i] | extraOne)
+	q, err := checkedPrefixFromNet(m)
+	if err != nil {
+		return nil, err
 	}
 
-	a = &net.IPNet{IP: n.IP, Mask: mask}
-	b = &net.IPNet{IP: ip, Mask: mask}
-	return
-}
-
-// canCombineNets returns true if the two networks, a and b, can be combined
-// into one larger cidr twice the size. If true, it returns the combined
-// network.
-func canCombineNets(a, b *net.IPNet) (ok bool, newNet *net.IPNet) {
-	if a.IP.Equal(b.IP) {
-		return
-	}
-	if bytes.Compare(a.Mask, b.Mask) != 0 {
-		return
+	fragments := 1
+	if q.contains(p) {
+		fragments = 0
+	} else if p.contains(q) {
+		fragments = int(q.ones - p.ones)
 	}
-	ones, bits := a.Mask.Size()
-	newNet = &net.IPNet{IP: a.IP, Mask: net.CIDRMask(ones-1, bits)}
-	if newNet.Contains(b.IP) {
-		ok = true
-		return
+	if fragments > maxFragments {
+		return nil, &FragmentLimitError{Fragments: fragments, Max: maxFragments}
 	}
-	return
+
+	prefixes := p.difference(q)
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].compare(prefixes[j]) < 0
+	})
+	nets := make([]*net.IPNet, len(prefixes))
+	for i, prefix := range prefixes {
+		nets[i] = prefix.toNet()
+	}
+	return nets, nil
 }
 
 // ipToNet converts the given IP to a /32 or /128 network depending on the type
@@ -194,8 +264,9 @@ func ipToNet(ip net.IP) *net.IPNet {
 	return &net.IPNet{IP: ip, Mask: net.CIDRMask(size, size)}
 }
 
-// incrementIP returns the given IP + 1
-func incrementIP(ip net.IP) (result net.IP) {
+// incrementIP returns the given IP + 1. If the IP is the last one in the
+// address space, the result wraps around to all zeros and overflow is true.
+func incrementIP(ip net.IP) (result net.IP, overflow bool) {
 	result = make([]byte, len(ip)) // start off with a nice empty ip of proper length
 
 	carry := true
@@ -208,11 +279,12 @@ func incrementIP(ip net.IP) (result net.IP) {
 			}
 		}
 	}
-	return
+	return result, carry
 }
 
-// decrementIP returns the given IP - 1
-func decrementIP(ip net.IP) (result net.IP) {
+// decrementIP returns the given IP - 1. If the IP is the first one in the
+// address space, the result wraps around to all ones and underflow is true.
+func decrementIP(ip net.IP) (result net.IP, underflow bool) {
 	result = make([]byte, len(ip)) // start off with a nice empty ip of proper length
 
 	borrow := true
@@ -225,29 +297,246 @@ func decrementIP(ip net.IP) (result net.IP) {
 			}
 		}
 	}
-	return
+	return result, borrow
+}
+
+// PrevIP returns the IP before the given one and true. It returns false if
+// the IP is the first one of its version, 0.0.0.0 or ::, or if it has an
+// invalid length. IPv4 addresses in the 16 byte form stay IPv4.
+func PrevIP(ip net.IP) (net.IP, bool) {
+	if !validIPLen(ip) {
+		return nil, false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		prev, underflow := decrementIP(ip4)
+		if len(ip) == net.IPv6len {
+			prev = prev.To16()
+		}
+		return prev, !underflow
+	}
+	prev, underflow := decrementIP(ip)
+	return prev, !underflow
 }
 
 // expandNet returns a slice containing all of the IPs in the given net up to
 // the given limit
 func expandNet(n *net.IPNet, limit int) []net.IP {
+	if limit > 1<<30 {
+		limit = 1 << 30
+	}
+	if limit <= 0 {
+		return []net.IP{}
+	}
+	result, _ := ExpandNetContext(context.Background(), n, limit)
+	return result
+}
+
+// ExpandNetDescending returns the IPs in the given network in order from the
+// last, or broadcast, address down to the first, up to the given limit. Like
+// GetIPs, it returns none for a limit that isn't positive and never more than
+// 2^30 of them.
+func ExpandNetDescending(n *net.IPNet, limit int) []net.IP {
+	if limit > 1<<30 {
+		limit = 1 << 30
+	}
+	if limit <= 0 {
+		return []net.IP{}
+	}
+	ones, bits := n.Mask.Size()
+	if bits-ones < 62 && 1<<uint(bits-ones) < limit {
+		limit = 1 << uint(bits-ones)
+	}
+
+	capacity := limit
+	if capacity > expandCheckInterval {
+		capacity = expandCheckInterval
+	}
+	result := make([]net.IP, 0, capacity)
+	for ip := BroadcastAddr(n); len(result) < limit; {
+		result = append(result, ip)
+		var ok bool
+		if ip, ok = PrevIP(ip); !ok {
+			// The net starts at the bottom of the address space
+			break
+		}
+	}
+	return result
+}
+
+// ExpandNetExcluding returns the IPs in the given network that aren't in
+// exclude, in order, up to the given limit. Like GetIPs, it returns none for
+// a limit that isn't positive and never more than 2^30 of them. It returns an
+// error if the network is malformed.
+func ExpandNetExcluding(n *net.IPNet, exclude *IPSet, limit int) ([]net.IP, error) {
+	if limit > 1<<30 {
+		limit = 1 << 30
+	}
+	result := []net.IP{}
+	if _, err := checkedPrefixFromNet(n); err != nil || limit <= 0 {
+		return result, err
+	}
+	err := WalkNetExcluding(n, exclude, func(ip net.IP) bool {
+		result = append(result, ip)
+		return len(result) < limit
+	})
+	return result, err
+}
+
+// WalkNetExcluding calls fn with each IP in the given network that isn't in
+// exclude, in order, until it returns false. It jumps over the networks of
+// exclude rather than checking each IP, so it takes time in proportion to
+// the number of IPs it visits and the networks of exclude in n. It returns an
+// error, without calling fn, if the network is malformed.
+func WalkNetExcluding(n *net.IPNet, exclude *IPSet, fn func(net.IP) bool) error {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return err
+	}
+	last := p.last()
+	var node *ipTree
+	if exclude != nil {
+		if exclude.tree.contains(p) {
+			return nil
+		}
+		node = exclude.tree.lowerBound(p)
+	}
+
+	addr := p.addr
+	for {
+		// Visit the IPs up to the next excluded network or the end of n
+		end := last
+		excluded := node != nil && p.contains(node.prefix)
+		if excluded {
+			end = node.prefix.addr
+		}
+		for addr != end || !excluded {
+			if !fn(net.IP(append([]byte{}, addr[:p.addrLen]...))) || addr == last {
+				return nil
+			}
+			addr = incrementAddr(addr, p.addrLen)
+		}
+
+		// Jump over the excluded network
+		if node.prefix.last() == last {
+			return nil
+		}
+		addr = incrementAddr(node.prefix.last(), p.addrLen)
+		node = node.next()
+	}
+}
+
+// incrementAddr returns the address after the given one of the given length
+// in bytes, wrapping around at the end of the address space
+func incrementAddr(addr [16]byte, addrLen uint8) [16]byte {
+	for i := int(addrLen) - 1; i >= 0; i-- {
+		addr[i]++
+		if addr[i] != 0 {
+			break
+		}
+	}
+	return addr
+}
+
+// AppendNetIPs appends the IPs in the given network, in order, up to the
+// given limit to dst and returns the extended slice. A limit that isn't
+// positive, or a malformed network, appends none and it never appends more
+// than 2^30. The IPs share one new backing array but none of them can grow
+// into another.
+func AppendNetIPs(dst []net.IP, n *net.IPNet, limit int) []net.IP {
+	dst, _ = AppendNetIPsBuf(dst, nil, n, limit)
+	return dst
+}
+
+// AppendNetIPsBuf is like AppendNetIPs except that it appends the bytes of
+// the IPs to buf and returns the extended buf too. Given a buf with room for
+// them, it doesn't allocate anything but dst. The IPs point into buf, so the
+// bytes of buf that were appended must not be changed while they are in use.
+func AppendNetIPsBuf(dst []net.IP, buf []byte, n *net.IPNet, limit int) ([]net.IP, []byte) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return dst, buf
+	}
+	return appendPrefixIPs(dst, buf, p, limit)
+}
+
+// appendPrefixIPs appends the first IPs of p up to the given limit to dst and
+// their bytes to buf, which grows at most once
+func appendPrefixIPs(dst []net.IP, buf []byte, p ipPrefix, limit int) ([]net.IP, []byte) {
+	if limit > 1<<30 {
+		limit = 1 << 30
+	}
+	if hostBits := 8*int(p.addrLen) - int(p.ones); hostBits < 62 && 1<<uint(hostBits) < limit {
+		limit = 1 << uint(hostBits)
+	}
+	if limit <= 0 {
+		return dst, buf
+	}
+	ipLen := int(p.addrLen)
+	if cap(buf)-len(buf) < limit*ipLen {
+		grown := make([]byte, len(buf), len(buf)+limit*ipLen)
+		copy(grown, buf)
+		buf = grown
+	}
+
+	addr := p.addr
+	for i := 0; i < limit; i++ {
+		start := len(buf)
+		buf = append(buf, addr[:ipLen]...)
+		dst = append(dst, net.IP(buf[start:len(buf):len(buf)]))
+		for j := ipLen - 1; j >= 0; j-- {
+			addr[j]++
+			if addr[j] != 0 {
+				break
+			}
+		}
+	}
+	return dst, buf
+}
+
+// expandCheckInterval is the number of IPs ExpandNetContext expands between
+// checks of its context
+const expandCheckInterval = 1 << 16
+
+// ExpandNetContext returns the IPs in the given network in order up to the
+// given limit, which must be positive. The limit is a hard cap, so the
+// caller decides how much may be allocated. It checks the context
+// periodically while it expands and, if it is done, returns the context's
+// error and discards the partial result.
+func ExpandNetContext(ctx context.Context, n *net.IPNet, limit int) ([]net.IP, error) {
+	if limit <= 0 {
+		return nil, errorf(ErrInvalidArgument, "limit must be positive: %d", limit)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	ones, bits := n.Mask.Size()
 
 	size := limit
-	max := 1 << 30
-	if bits-ones < 30 {
-		max = 1 << uint(bits-ones)
+	if bits-ones < 62 && 1<<uint(bits-ones) < size {
+		size = 1 << uint(bits-ones)
 	}
-	if max < size {
-		size = max
+	// Grow the result as it fills so that an abandoned expansion doesn't
+	// allocate everything up front
+	capacity := size
+	if capacity > expandCheckInterval {
+		capacity = expandCheckInterval
 	}
-	result := make([]net.IP, size)
+	result := make([]net.IP, 0, capacity)
 	next := n.IP
 	for i := 0; i < size; i++ {
-		result[i] = next[:]
-		next = incrementIP(next)
+		if i != 0 && i%expandCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, next[:])
+		var overflow bool
+		if next, overflow = incrementIP(next); overflow {
+			// The net ends at the top of the address space
+			break
+		}
 	}
-	return result
+	return result, nil
 }
 
 // IPLessThan compare two ip addresses true
@@ -305,3 +594,61 @@ func IPv4Net(a, b, c, d byte, p int) net.IPNet {
 		Mask: net.CIDRMask(p, 8*net.IPv4len),
 	}
 }
+
+// alignedPrefix returns the given IP with the given prefix length. It returns
+// an error if the IP isn't 4 or 16 bytes long or the prefix length doesn't
+// fit in it. The length is for the IP as given, so a 16 byte IPv4 address
+// with a length of at least 96 gives the IPv4 prefix 96 bits shorter.
+func alignedPrefix(ip net.IP, prefixLen int) (p ipPrefix, err error) {
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return p, errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	if prefixLen < 0 || prefixLen > 8*len(ip) {
+		return p, errorf(ErrInvalidPrefixLength, "invalid prefix length for %s: %d", ip, prefixLen)
+	}
+	p.addrLen = uint8(copy(p.addr[:], ip))
+	p.ones = uint8(prefixLen)
+	return p.to4(), nil
+}
+
+// IsAligned returns true if the given IP is the first address of a network
+// with the given prefix length. For example, 10.0.3.64 is aligned for a /26
+// but not for a /25. The prefix length is checked against the length of the
+// IP, so IPv4 addresses must be in the 4 byte form to use IPv4 lengths. In
+// the 16 byte form they use IPv6 lengths, like /120 for a /24.
+func IsAligned(ip net.IP, prefixLen int) (bool, error) {
+	p, err := alignedPrefix(ip, prefixLen)
+	if err != nil {
+		return false, err
+	}
+	return p.addr == p.hostBits(false), nil
+}
+
+// RoundDownToPrefix returns the first address of the network with the given
+// prefix length that contains ip.
+func RoundDownToPrefix(ip net.IP, prefixLen int) (net.IP, error) {
+	p, err := alignedPrefix(ip, prefixLen)
+	if err != nil {
+		return nil, err
+	}
+	p.addr = p.hostBits(false)
+	return p.ip(), nil
+}
+
+// RoundUpToPrefix returns the first address at or after ip that is aligned
+// for the given prefix length. If there is no such address before the end of
+// the address space, it returns nil and true for overflow.
+func RoundUpToPrefix(ip net.IP, prefixLen int) (net.IP, bool, error) {
+	p, err := alignedPrefix(ip, prefixLen)
+	if err != nil {
+		return nil, false, err
+	}
+	if p.addr == p.hostBits(false) {
+		return p.ip(), false, nil
+	}
+	next, overflow := incrementIP(p.lastIP().ip())
+	if overflow {
+		return nil, true, nil
+	}
+	return next, false, nil
+}
@@ -1,8 +1,11 @@
 package netaddr
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"math/rand"
 	"net"
 	"sort"
 	"testing"
@@ -12,17 +15,37 @@ import (
 
 func TestDecrement(t *testing.T) {
 	for _, tc := range []*struct {
-		in, out net.IP
+		in, out   net.IP
+		underflow bool
+	}{
+		{ParseIP("192.168.2.5"), ParseIP("192.168.2.4"), false},
+		{ParseIP("192.168.0.0"), ParseIP("192.167.255.255"), false},
+		{ParseIP("10.0.0.0"), ParseIP("9.255.255.255"), false},
+		{ParseIP("0.0.0.0"), ParseIP("255.255.255.255"), true},                    // 0 will cycle
+		{ParseIP("::"), ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), true}, // 0 will cycle
+		{ParseIP("1::"), ParseIP("0:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), false},
+	} {
+		actual, underflow := decrementIP(tc.in)
+		assert.Equal(t, tc.out, actual)
+		assert.Equal(t, tc.underflow, underflow)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	for _, tc := range []*struct {
+		in, out  net.IP
+		overflow bool
 	}{
-		{ParseIP("192.168.2.5"), ParseIP("192.168.2.4")},
-		{ParseIP("192.168.0.0"), ParseIP("192.167.255.255")},
-		{ParseIP("10.0.0.0"), ParseIP("9.255.255.255")},
-		{ParseIP("0.0.0.0"), ParseIP("255.255.255.255")},                    // 0 will cycle
-		{ParseIP("::"), ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")}, // 0 will cycle
-		{ParseIP("1::"), ParseIP("0:ffff:ffff:ffff:ffff:ffff:ffff:ffff")},   // 0 will cycle
+		{ParseIP("192.168.2.4"), ParseIP("192.168.2.5"), false},
+		{ParseIP("192.167.255.255"), ParseIP("192.168.0.0"), false},
+		{ParseIP("255.255.255.254"), ParseIP("255.255.255.255"), false},
+		{ParseIP("255.255.255.255"), ParseIP("0.0.0.0"), true},
+		{ParseIP("0:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), ParseIP("1::"), false},
+		{ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), ParseIP("::"), true},
 	} {
-		actual := decrementIP(tc.in)
+		actual, overflow := incrementIP(tc.in)
 		assert.Equal(t, tc.out, actual)
+		assert.Equal(t, tc.overflow, overflow)
 	}
 }
 
@@ -51,6 +74,262 @@ func TestExpandNetLarge(t *testing.T) {
 	assert.Equal(t, net.ParseIP("2001:db8::3e7"), ips[999])
 }
 
+func TestExpandNetTopOfSpace(t *testing.T) {
+	n, _ := ParseNet("255.255.255.254/31")
+	ips := expandNet(n, 10)
+	assert.Equal(t, []net.IP{ParseIP("255.255.255.254"), ParseIP("255.255.255.255")}, ips)
+
+	n, _ = ParseNet("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127")
+	ips = expandNet(n, 10)
+	assert.Equal(t, []net.IP{
+		ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe"),
+		ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"),
+	}, ips)
+}
+
+func TestPrevIP(t *testing.T) {
+	for _, tc := range []struct {
+		in, out net.IP
+		ok      bool
+	}{
+		{ParseIP("10.0.1.0"), ParseIP("10.0.0.255"), true},
+		{net.ParseIP("10.0.1.0"), net.ParseIP("10.0.0.255"), true},
+		{ParseIP("2001:db8::"), ParseIP("2001:db7:ffff:ffff:ffff:ffff:ffff:ffff"), true},
+		{ParseIP("0.0.0.1"), ParseIP("0.0.0.0"), true},
+		{ParseIP("0.0.0.0"), ParseIP("255.255.255.255"), false},
+		{net.ParseIP("0.0.0.0"), net.ParseIP("255.255.255.255"), false},
+		{ParseIP("::"), ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"), false},
+		{net.IP{1, 2, 3}, nil, false},
+	} {
+		prev, ok := PrevIP(tc.in)
+		assert.Equal(t, tc.out, prev, tc.in.String())
+		assert.Equal(t, tc.ok, ok, tc.in.String())
+	}
+}
+
+func TestExpandNetDescending(t *testing.T) {
+	n, _ := ParseNet("203.0.113.0/29")
+	ips := ExpandNetDescending(n, 10)
+	assert.Equal(t, 8, len(ips))
+	assert.Equal(t, ParseIP("203.0.113.7"), ips[0])
+	assert.Equal(t, ParseIP("203.0.113.0"), ips[7])
+
+	ips = ExpandNetDescending(n, 3)
+	assert.Equal(t, []net.IP{ParseIP("203.0.113.7"), ParseIP("203.0.113.6"), ParseIP("203.0.113.5")}, ips)
+
+	n, _ = ParseNet("203.0.113.6/31")
+	assert.Equal(t, []net.IP{ParseIP("203.0.113.7"), ParseIP("203.0.113.6")}, ExpandNetDescending(n, 10))
+	n, _ = ParseNet("203.0.113.6/32")
+	assert.Equal(t, []net.IP{ParseIP("203.0.113.6")}, ExpandNetDescending(n, 10))
+
+	assert.Equal(t, []net.IP{}, ExpandNetDescending(n, 0))
+	assert.Equal(t, []net.IP{}, ExpandNetDescending(n, -1))
+
+	n, _ = ParseNet("2001:db8::/56")
+	ips = ExpandNetDescending(n, 1000)
+	assert.Equal(t, 1000, len(ips))
+	assert.Equal(t, ParseIP("2001:db8:0:ff:ffff:ffff:ffff:ffff"), ips[0])
+	assert.Equal(t, ParseIP("2001:db8:0:ff:ffff:ffff:ffff:fc18"), ips[999])
+}
+
+func TestExpandNetDescendingBottomOfSpace(t *testing.T) {
+	n, _ := ParseNet("0.0.0.0/31")
+	assert.Equal(t, []net.IP{ParseIP("0.0.0.1"), ParseIP("0.0.0.0")}, ExpandNetDescending(n, 10))
+
+	n, _ = ParseNet("::/127")
+	assert.Equal(t, []net.IP{ParseIP("::1"), ParseIP("::")}, ExpandNetDescending(n, 10))
+
+	// It is the reverse of expanding in ascending order
+	n, _ = ParseNet("10.0.0.0/22")
+	ips := ExpandNetDescending(n, 2000)
+	ascending := expandNet(n, 2000)
+	for i := range ips {
+		assert.Equal(t, ascending[len(ascending)-1-i], ips[i])
+	}
+}
+
+// expandExcludingByDifference is ExpandNetExcluding by way of a set
+func expandExcludingByDifference(n *net.IPNet, exclude *IPSet, limit int) ([]net.IP, error) {
+	set := &IPSet{}
+	set.InsertNet(n)
+	return set.Difference(exclude).GetIPs(limit), nil
+}
+
+// expandExcluding is ExpandNetExcluding for networks that are well formed
+func expandExcluding(t *testing.T, n *net.IPNet, exclude *IPSet, limit int) []net.IP {
+	ips, err := ExpandNetExcluding(n, exclude, limit)
+	assert.Nil(t, err)
+	return ips
+}
+
+func TestExpandNetExcluding(t *testing.T) {
+	exclude := &IPSet{}
+	exclude.InsertNet(parse("10.0.4.0/30"))
+	exclude.InsertNet(parse("10.0.4.5/32"))
+	exclude.InsertNet(parse("10.0.4.8/29"))
+	exclude.InsertNet(parse("10.0.5.0/24"))
+	n := parse("10.0.4.0/28")
+	assert.Equal(t, []string{"10.0.4.4", "10.0.4.6", "10.0.4.7"}, ipStrings(expandExcluding(t, n, exclude, 100)))
+	assert.Equal(t, []string{"10.0.4.4", "10.0.4.6"}, ipStrings(expandExcluding(t, n, exclude, 2)))
+	assert.Equal(t, []net.IP{}, expandExcluding(t, n, exclude, 0))
+	assert.Equal(t, []net.IP{}, expandExcluding(t, parse("10.0.5.128/25"), exclude, 100))
+	assert.Equal(t, []net.IP{}, expandExcluding(t, parse("10.0.4.8/29"), exclude, 100))
+	assert.Equal(t, 16, len(expandExcluding(t, n, nil, 100)))
+	assert.Equal(t, 16, len(expandExcluding(t, n, &IPSet{}, 100)))
+
+	// The end of the address space
+	exclude = &IPSet{}
+	exclude.InsertNet(parse("255.255.255.254/32"))
+	assert.Equal(t, []string{"255.255.255.252", "255.255.255.253", "255.255.255.255"},
+		ipStrings(expandExcluding(t, parse("255.255.255.252/30"), exclude, 100)))
+	exclude.InsertNet(parse("255.255.255.255/32"))
+	assert.Equal(t, []string{"255.255.255.252", "255.255.255.253"},
+		ipStrings(expandExcluding(t, parse("255.255.255.252/30"), exclude, 100)))
+	exclude.InsertNet(parse("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/128"))
+	assert.Equal(t, []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffc", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffd",
+		"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		ipStrings(expandExcluding(t, parse("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffc/126"), exclude, 100)))
+
+	// The IPs don't share memory
+	ips := expandExcluding(t, n, nil, 2)
+	ips[0][3] = 99
+	assert.Equal(t, "10.0.4.1", ips[1].String())
+}
+
+func TestWalkNetExcluding(t *testing.T) {
+	exclude := &IPSet{}
+	exclude.InsertNet(parse("2001:db8::/127"))
+	var ips []net.IP
+	err := WalkNetExcluding(parse("2001:db8::/64"), exclude, func(ip net.IP) bool {
+		ips = append(ips, ip)
+		return len(ips) < 3
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::2", "2001:db8::3", "2001:db8::4"}, ipStrings(ips))
+
+	// Malformed networks are errors
+	for _, n := range []*net.IPNet{
+		nil,
+		{IP: ParseIP("10.0.0.0"), Mask: net.IPMask{255, 0, 255, 0}},
+		{IP: net.IP{10, 0, 0}, Mask: net.CIDRMask(24, 32)},
+		{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)},
+	} {
+		called := false
+		err = WalkNetExcluding(n, exclude, func(ip net.IP) bool {
+			called = true
+			return true
+		})
+		assert.NotNil(t, err, "%v", n)
+		assert.False(t, called)
+		ips, err := ExpandNetExcluding(n, exclude, 10)
+		assert.NotNil(t, err, "%v", n)
+		assert.Equal(t, []net.IP{}, ips)
+	}
+	_, err = ExpandNetExcluding(nil, exclude, 10)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
+
+func TestExpandNetExcludingRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(494))
+	exclude := randomSet(r, 20000)
+	for i := 0; i < 500; i++ {
+		var n *net.IPNet
+		if i%4 == 0 {
+			ip := ParseIP("2001:db8::")
+			ip[13], ip[14], ip[15] = byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))
+			n = &net.IPNet{IP: ip, Mask: net.CIDRMask(116+r.Intn(13), 128)}
+		} else {
+			ip := IPv4(10, byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+			n = &net.IPNet{IP: ip, Mask: net.CIDRMask(20+r.Intn(13), 32)}
+		}
+		n.IP = n.IP.Mask(n.Mask)
+		limit := 1 + r.Intn(5000)
+		expected, _ := expandExcludingByDifference(n, exclude, limit)
+		if expected == nil {
+			expected = []net.IP{}
+		}
+		assert.Equal(t, expected, expandExcluding(t, n, exclude, limit), n.String())
+	}
+}
+
+func benchmarkExpandNetExcluding(b *testing.B, expand func(*net.IPNet, *IPSet, int) ([]net.IP, error)) {
+	// Most of a /16 is in a few large networks
+	n := parse("10.0.0.0/16")
+	exclude := &IPSet{}
+	exclude.InsertNet(n)
+	for _, cidr := range []string{"10.0.17.0/24", "10.0.100.0/26", "10.0.200.0/28", "10.0.255.255/32"} {
+		exclude.RemoveNet(parse(cidr))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		expand(n, exclude, 1000)
+	}
+}
+
+func BenchmarkExpandNetExcluding(b *testing.B) {
+	benchmarkExpandNetExcluding(b, ExpandNetExcluding)
+}
+
+func BenchmarkExpandNetExcludingByDifference(b *testing.B) {
+	benchmarkExpandNetExcluding(b, expandExcludingByDifference)
+}
+
+func TestAppendNetIPs(t *testing.T) {
+	n, _ := ParseNet("203.0.113.0/30")
+	dst := []net.IP{ParseIP("10.0.0.1")}
+	dst = AppendNetIPs(dst, n, 10)
+	assert.Equal(t, []net.IP{
+		ParseIP("10.0.0.1"),
+		ParseIP("203.0.113.0"), ParseIP("203.0.113.1"), ParseIP("203.0.113.2"), ParseIP("203.0.113.3"),
+	}, dst)
+
+	// The IPs are independent of each other
+	dst[1] = append(dst[1], 0)
+	assert.Equal(t, ParseIP("203.0.113.1"), dst[2])
+	dst[2][3] = 9
+	assert.Equal(t, ParseIP("203.0.113.3"), dst[4])
+
+	n, _ = ParseNet("2001:db8::/32")
+	assert.Equal(t, expandNet(n, 300), AppendNetIPs(nil, n, 300))
+	assert.Equal(t, 0, len(AppendNetIPs(nil, n, 0)))
+	assert.Equal(t, 0, len(AppendNetIPs(nil, n, -1)))
+}
+
+func TestAppendNetIPsBuf(t *testing.T) {
+	n, _ := ParseNet("10.0.0.0/24")
+	dst := make([]net.IP, 0, 256)
+	buf := make([]byte, 0, 1024)
+	dst, buf = AppendNetIPsBuf(dst, buf, n, 256)
+	assert.Equal(t, 256, len(dst))
+	assert.Equal(t, 1024, len(buf))
+	assert.Equal(t, expandNet(n, 256), dst)
+	assert.Equal(t, []byte{10, 0, 0, 255}, buf[1020:])
+
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, buf = AppendNetIPsBuf(dst[:0], buf[:0], n, 256)
+	})
+	assert.Equal(t, 0.0, allocs)
+
+	// A buf without room grows once and keeps what it had
+	buf = []byte{1, 2}
+	dst, buf = AppendNetIPsBuf(nil, buf, n, 2)
+	assert.Equal(t, []byte{1, 2, 10, 0, 0, 0, 10, 0, 0, 1}, buf)
+	assert.Equal(t, []net.IP{ParseIP("10.0.0.0"), ParseIP("10.0.0.1")}, dst)
+
+	// A malformed network appends nothing
+	for _, n := range []*net.IPNet{
+		nil,
+		{IP: ParseIP("10.0.0.0"), Mask: net.IPMask{255, 0, 255, 0}},
+		{IP: net.IP{10, 0, 0}, Mask: net.CIDRMask(24, 32)},
+	} {
+		dst, buf = AppendNetIPsBuf(dst[:1], buf[:4], n, 10)
+		assert.Equal(t, 1, len(dst), "%v", n)
+		assert.Equal(t, 4, len(buf), "%v", n)
+		assert.Equal(t, 0, len(AppendNetIPs(nil, n, 10)), "%v", n)
+	}
+}
+
 func TestNetSize(t *testing.T) {
 	n, _ := ParseNet("10.0.0.0/24")
 	assert.Equal(t, int64(256), NetSize(n).Int64())
@@ -152,6 +431,35 @@ func TestParseCIDR(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestParseCIDRMappedIPv4(t *testing.T) {
+	ip, n, err := ParseCIDR("::ffff:10.0.0.1/120")
+	assert.Nil(t, err)
+	assert.Equal(t, ParseIP("10.0.0.1"), ip)
+	assert.Equal(t, parse("10.0.0.0/24"), n)
+	assert.Equal(t, 4, len(n.Mask))
+
+	for _, test := range [][2]string{
+		{"::ffff:10.0.0.0/120", "10.0.0.0/24"},
+		{"::ffff:10.0.0.0/104", "10.0.0.0/8"},
+		{"::ffff:0:0/96", "0.0.0.0/0"},
+		{"::ffff:10.0.0.1/128", "10.0.0.1/32"},
+	} {
+		n, err := ParseNet(test[0])
+		assert.Nil(t, err, test[0])
+		expected, _ := ParseNet(test[1])
+		assert.Equal(t, expected, n, test[0])
+	}
+
+	// Networks which aren't within ::ffff:0:0/96 stay IPv6
+	n, err = ParseNet("::fffe:0:0/95")
+	assert.Nil(t, err)
+	assert.Equal(t, "::fffe:0:0/95", n.String())
+	assert.Equal(t, 16, len(n.IP))
+
+	_, err = ParseNet("::ffff:10.0.0.1/120")
+	assert.NotNil(t, err)
+}
+
 func TestParseCIDRToNet(t *testing.T) {
 	ipNet, err := ParseCIDRToNet("10.0.0.1/24")
 	assert.Equal(t, net.ParseIP("10.0.0.1").To4(), ipNet.IP)
@@ -269,3 +577,363 @@ func TestIPv4Net(t *testing.T) {
 	lo, _ := ParseCIDRToNet("127.0.0.1/8")
 	assert.Equal(t, *lo, IPv4Net(127, 0, 0, 1, 8))
 }
+
+func TestParseNetOrIP(t *testing.T) {
+	n, err := ParseNetOrIP("10.0.0.0/24")
+	assert.Nil(t, err)
+	assert.Equal(t, parse("10.0.0.0/24"), n)
+
+	n, err = ParseNetOrIP("10.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, parse("10.0.0.1/32"), n)
+
+	n, err = ParseNetOrIP("2001:db8::1")
+	assert.Nil(t, err)
+	assert.Equal(t, parse("2001:db8::1/128"), n)
+
+	for _, s := range []string{"", "10.0.0.1/24", "10.0.0.256", "2001:db8::/129", "bogus"} {
+		n, err = ParseNetOrIP(s)
+		assert.NotNil(t, err, s)
+		assert.Nil(t, n, s)
+	}
+
+	_, err = ParseNetOrIP("bogus")
+	assert.Equal(t, "invalid IP address: bogus", err.Error())
+}
+
+func TestIsAligned(t *testing.T) {
+	tests := []struct {
+		ip        string
+		prefixLen int
+		aligned   bool
+	}{
+		{"10.0.3.64", 26, true},
+		{"10.0.3.64", 25, false},
+		{"10.0.3.64", 32, true},
+		{"0.0.0.0", 0, true},
+		{"10.0.0.0", 0, false},
+		{"2001:db8::", 32, true},
+		{"2001:db8::", 29, true},
+		{"2001:db8::", 28, false},
+		{"2001:db8::", 16, false},
+		{"2001:db8::8000:0:0:0", 65, true},
+		{"2001:db8::8000:0:0:0", 64, false},
+	}
+	for _, test := range tests {
+		aligned, err := IsAligned(ParseIP(test.ip), test.prefixLen)
+		assert.Nil(t, err)
+		assert.Equal(t, test.aligned, aligned, "%s/%d", test.ip, test.prefixLen)
+	}
+}
+
+func TestAlignmentErrors(t *testing.T) {
+	for _, test := range []struct {
+		ip        net.IP
+		prefixLen int
+	}{
+		{ParseIP("10.0.0.0"), 33},
+		{ParseIP("10.0.0.0"), -1},
+		{ParseIP("2001:db8::"), 129},
+		{nil, 0},
+		{net.IP{10, 0, 0}, 8},
+	} {
+		_, err := IsAligned(test.ip, test.prefixLen)
+		assert.NotNil(t, err)
+		_, err = RoundDownToPrefix(test.ip, test.prefixLen)
+		assert.NotNil(t, err)
+		_, _, err = RoundUpToPrefix(test.ip, test.prefixLen)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestRoundToPrefix(t *testing.T) {
+	tests := []struct {
+		ip        string
+		prefixLen int
+		down, up  string
+		overflow  bool
+	}{
+		{"10.0.3.64", 26, "10.0.3.64", "10.0.3.64", false},
+		{"10.0.3.65", 26, "10.0.3.64", "10.0.3.128", false},
+		{"10.0.3.65", 24, "10.0.3.0", "10.0.4.0", false},
+		{"10.255.255.255", 8, "10.0.0.0", "11.0.0.0", false},
+		{"255.255.255.1", 24, "255.255.255.0", "", true},
+		{"128.0.0.1", 0, "0.0.0.0", "", true},
+		{"0.0.0.0", 0, "0.0.0.0", "0.0.0.0", false},
+		{"2001:db8::1", 64, "2001:db8::", "2001:db8:0:1::", false},
+		{"2001:db8:0:0:ffff:ffff:ffff:ffff", 65, "2001:db8::8000:0:0:0", "2001:db8:0:1::", false},
+		{"ffff::1", 16, "ffff::", "", true},
+	}
+	for _, test := range tests {
+		down, err := RoundDownToPrefix(ParseIP(test.ip), test.prefixLen)
+		assert.Nil(t, err)
+		assert.Equal(t, ParseIP(test.down), down, "%s/%d", test.ip, test.prefixLen)
+
+		up, overflow, err := RoundUpToPrefix(ParseIP(test.ip), test.prefixLen)
+		assert.Nil(t, err)
+		assert.Equal(t, test.overflow, overflow, "%s/%d", test.ip, test.prefixLen)
+		if test.overflow {
+			assert.Nil(t, up)
+		} else {
+			assert.Equal(t, ParseIP(test.up), up, "%s/%d", test.ip, test.prefixLen)
+		}
+	}
+
+	// 16 byte IPv4 addresses use IPv6 lengths
+	mapped := net.ParseIP("10.0.3.65")
+	for _, test := range []struct {
+		prefixLen int
+		aligned   bool
+		down, up  string
+	}{
+		{128, true, "10.0.3.65", "10.0.3.65"},
+		{122, false, "10.0.3.64", "10.0.3.128"},
+		{120, false, "10.0.3.0", "10.0.4.0"},
+		{100, false, "0.0.0.0", "16.0.0.0"},
+		{96, false, "0.0.0.0", ""},
+		{26, false, "::", "0:40::"},
+	} {
+		aligned, err := IsAligned(mapped, test.prefixLen)
+		assert.Nil(t, err)
+		assert.Equal(t, test.aligned, aligned, "/%d", test.prefixLen)
+
+		down, err := RoundDownToPrefix(mapped, test.prefixLen)
+		assert.Nil(t, err)
+		assert.Equal(t, test.down, down.String(), "/%d", test.prefixLen)
+
+		up, overflow, err := RoundUpToPrefix(mapped, test.prefixLen)
+		assert.Nil(t, err)
+		assert.Equal(t, test.up == "", overflow, "/%d", test.prefixLen)
+		if !overflow {
+			assert.Equal(t, test.up, up.String(), "/%d", test.prefixLen)
+		}
+	}
+	_, err := IsAligned(mapped, 129)
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+
+	// The input is not modified
+	ip := ParseIP("10.0.3.65")
+	RoundDownToPrefix(ip, 24)
+	RoundUpToPrefix(ip, 24)
+	assert.Equal(t, ParseIP("10.0.3.65"), ip)
+}
+
+func TestParseIPZone(t *testing.T) {
+	tests := []struct {
+		address, ip, zone string
+	}{
+		{"fe80::1%eth0", "fe80::1", "eth0"},
+		{"fe80::1%25eth0", "fe80::1", "eth0"},
+		{"fe80::1%25", "fe80::1", "25"},
+		{"fe80::1%251", "fe80::1", "251"},
+		{"fe80::1%3", "fe80::1", "3"},
+		{"fe80::1", "fe80::1", ""},
+		{"10.0.0.1", "10.0.0.1", ""},
+	}
+	for _, test := range tests {
+		ip, zone, err := ParseIPZone(test.address)
+		assert.Nil(t, err, test.address)
+		assert.Equal(t, ParseIP(test.ip), ip, test.address)
+		assert.Equal(t, test.zone, zone, test.address)
+
+		// ParseIP drops the zone
+		assert.Equal(t, ip, ParseIP(test.address), test.address)
+	}
+	assert.Equal(t, net.IPv4len, len(ParseIP("10.0.0.1")))
+}
+
+func TestParseIPZoneErrors(t *testing.T) {
+	for _, address := range []string{
+		"fe80::1%",
+		"fe80::1%%eth0",
+		"fe80::1%eth 0",
+		"fe80::1%eth0/64",
+		"fe80::1%eth0%eth1",
+		"10.0.0.1%eth0",
+		"%eth0",
+		"bogus%eth0",
+		"fe80::g%eth0",
+	} {
+		ip, zone, err := ParseIPZone(address)
+		assert.NotNil(t, err, address)
+		assert.Nil(t, ip, address)
+		assert.Equal(t, "", zone, address)
+		assert.Nil(t, ParseIP(address), address)
+	}
+
+	_, _, err := ParseIPZone("10.0.0.1%eth0")
+	assert.Equal(t, "invalid IP address: 10.0.0.1%eth0", err.Error())
+}
+
+func TestContainsNet(t *testing.T) {
+	ten8, _ := ParseNet("10.0.0.0/8")
+	ten24, _ := ParseNet("10.0.0.0/24")
+	assert.True(t, ContainsNet(ten8, ten24))
+	assert.True(t, ContainsNet(ten24, ten24))
+	assert.False(t, ContainsNet(ten24, ten8))
+
+	v6, _ := ParseNet("::/0")
+	assert.False(t, ContainsNet(v6, ten24))
+	assert.False(t, ContainsNet(ten8, v6))
+
+	// The 16 byte form of an IPv4 network, with either length of mask, is
+	// the same network
+	for _, mapped := range []*net.IPNet{
+		{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(120, 128)},
+		{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)},
+	} {
+		assert.True(t, ContainsNet(ten8, mapped))
+		assert.True(t, ContainsNet(mapped, ten24))
+		assert.True(t, ContainsNet(ten24, mapped))
+		assert.False(t, ContainsNet(mapped, ten8))
+	}
+}
+
+// countdownContext is a context which is done after its Err method has been
+// called the given number of times
+type countdownContext struct {
+	context.Context
+	calls int
+}
+
+func (c *countdownContext) Err() error {
+	if c.calls == 0 {
+		return context.DeadlineExceeded
+	}
+	c.calls--
+	return nil
+}
+
+func TestExpandNetContext(t *testing.T) {
+	n, _ := ParseNet("203.0.113.0/29")
+	ips, err := ExpandNetContext(context.Background(), n, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, expandNet(n, 10), ips)
+	assert.Equal(t, 8, len(ips))
+
+	ips, err = ExpandNetContext(context.Background(), n, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"203.0.113.0", "203.0.113.1", "203.0.113.2"}, ipStrings(ips))
+
+	// The limit is the only cap
+	n, _ = ParseNet("2001:db8::/32")
+	ips, err = ExpandNetContext(context.Background(), n, 3*expandCheckInterval)
+	assert.Nil(t, err)
+	assert.Equal(t, 3*expandCheckInterval, len(ips))
+
+	for _, limit := range []int{0, -1} {
+		ips, err = ExpandNetContext(context.Background(), n, limit)
+		assert.NotNil(t, err)
+		assert.Nil(t, ips)
+	}
+}
+
+func TestExpandNetContextDone(t *testing.T) {
+	n, _ := ParseNet("10.0.0.0/8")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ips, err := ExpandNetContext(ctx, n, 1<<24)
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, ips)
+
+	// Done part way through
+	ctx = &countdownContext{Context: context.Background(), calls: 3}
+	ips, err = ExpandNetContext(ctx, n, 1<<24)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, ips)
+
+	// Checked every so often
+	ctx = &countdownContext{Context: context.Background(), calls: 3}
+	ips, err = ExpandNetContext(ctx, n, 3*expandCheckInterval)
+	assert.Nil(t, err)
+	assert.Equal(t, 3*expandCheckInterval, len(ips))
+}
+
+func TestDifferenceNetBounded(t *testing.T) {
+	diff, err := DifferenceNetBounded(Ten24, parse("10.0.0.120/29"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{
+		parse("10.0.0.0/26"),
+		parse("10.0.0.64/27"),
+		parse("10.0.0.96/28"),
+		parse("10.0.0.112/29"),
+		parse("10.0.0.128/25"),
+	}, diff)
+
+	_, err = DifferenceNetBounded(Ten24, parse("10.0.0.120/29"), 4)
+	var limitErr *FragmentLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 5, limitErr.Fragments)
+	assert.Equal(t, 4, limitErr.Max)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+
+	// The count is known without splitting the network
+	_, err = DifferenceNetBounded(parse("2001:db8::/32"), parse("2001:db8::1/128"), 95)
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 96, limitErr.Fragments)
+
+	// Disjoint, covered and other family
+	diff, err = DifferenceNetBounded(Ten24, parse("10.0.1.0/24"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{Ten24}, diff)
+	diff, err = DifferenceNetBounded(Ten24, parse("10.0.0.0/8"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{}, diff)
+	diff, err = DifferenceNetBounded(Ten24, V6Net1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.IPNet{Ten24}, diff)
+
+	_, err = DifferenceNetBounded(Ten24, Ten24, -1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = DifferenceNetBounded(Ten24, nil, 1)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
+
+func TestParseNetShort(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected string
+		kind     error
+	}{
+		{"10/8", "10.0.0.0/8", nil},
+		{"172.16/12", "172.16.0.0/12", nil},
+		{"192.168.1/24", "192.168.1.0/24", nil},
+		{"10.0.0.0/8", "10.0.0.0/8", nil},
+		{"0/0", "0.0.0.0/0", nil},
+		{"10/32", "10.0.0.0/32", nil},
+		{"2001:db8::/32", "2001:db8::/32", nil},
+
+		// The host part must still be zero
+		{"10.1/8", "", ErrHostBitsSet},
+		{"172.17/12", "", ErrHostBitsSet},
+		{"2001:db8::1/32", "", ErrHostBitsSet},
+
+		// Ambiguous or malformed
+		{"10", "", ErrInvalidCIDR},
+		{"010/8", "", ErrInvalidCIDR},
+		{"10/08", "", ErrInvalidCIDR},
+		{"10/33", "", ErrInvalidCIDR},
+		{"256/8", "", ErrInvalidCIDR},
+		{"167772160/8", "", ErrInvalidCIDR},
+		{"10./8", "", ErrInvalidCIDR},
+		{"10..0/8", "", ErrInvalidCIDR},
+		{"/8", "", ErrInvalidCIDR},
+		{"10/", "", ErrInvalidCIDR},
+		{"10.0.0.0.0/8", "", ErrInvalidCIDR},
+		{"0x0a/8", "", ErrInvalidCIDR},
+		{" 10/8", "", ErrInvalidCIDR},
+		{"2001:db8::/32 le 48", "", ErrInvalidCIDR},
+		{"fe80::%eth0/64", "", ErrInvalidIP},
+	}
+	for _, test := range tests {
+		n, err := ParseNetShort(test.s)
+		if test.kind != nil {
+			assert.Nil(t, n, test.s)
+			assert.True(t, errors.Is(err, test.kind), "%q: %v", test.s, err)
+			continue
+		}
+		assert.Nil(t, err, test.s)
+		assert.Equal(t, parse(test.expected), n, test.s)
+	}
+}
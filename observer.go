@@ -0,0 +1,81 @@
+package netaddr
+
+import (
+	"math/big"
+	"net"
+)
+
+// Observer is told about changes to an IPSet, such as to keep metrics of the
+// utilization of a pool of IPs. Its methods are called synchronously, on the
+// goroutine that changes the set, after the change is made. They must not
+// change the set. An observer that is shared by sets that are used from more
+// than one goroutine must be safe for concurrent use.
+type Observer interface {
+	// SetSizeChanged is called when the number of IPs of the given version,
+	// 4 or 6, in the set changes by delta, which is negative if IPs were
+	// removed. It isn't called when a change leaves the set as it was.
+	SetSizeChanged(family int, delta *big.Int)
+	// AllocationFailed is called when the set has no free block of the given
+	// prefix length to allocate.
+	AllocationFailed(prefixLen int)
+}
+
+// NopObserver is an Observer that does nothing. Embed it in an observer that
+// is only interested in some of the calls.
+type NopObserver struct{}
+
+// SetSizeChanged does nothing
+func (NopObserver) SetSizeChanged(family int, delta *big.Int) {}
+
+// AllocationFailed does nothing
+func (NopObserver) AllocationFailed(prefixLen int) {}
+
+// SetObserver sets the observer that is told about the changes to the set. A
+// set has none by default. Setting it to nil removes it. Sets made from this
+// one, such as by Union, don't have its observer.
+func (s *IPSet) SetObserver(o Observer) {
+	s.observer = o
+}
+
+// family returns the IP version of the prefix
+func (p ipPrefix) family() int {
+	if p.addrLen == net.IPv4len {
+		return 4
+	}
+	return 6
+}
+
+// sizeChanged tells the observer that the number of IPs of the given version
+// changed by delta
+func (s *IPSet) sizeChanged(family int, delta *big.Int) {
+	if delta.Sign() != 0 {
+		s.observer.SetSizeChanged(family, delta)
+	}
+}
+
+// replaceTree replaces the contents of the set with the given tree
+func (s *IPSet) replaceTree(t *ipTree) {
+	if s.observer == nil {
+		s.tree = t
+		return
+	}
+	before := s.familySizes()
+	s.tree = t
+	after := s.familySizes()
+	for i, family := range []int{4, 6} {
+		s.sizeChanged(family, after[i].Sub(after[i], before[i]))
+	}
+}
+
+// familySizes returns the number of IPv4 and IPv6 IPs in the set
+func (s *IPSet) familySizes() [2]*big.Int {
+	sizes := [2]*big.Int{big.NewInt(0), big.NewInt(0)}
+	for node := s.tree.first(); node != nil; node = node.next() {
+		i := 0
+		if node.prefix.addrLen == net.IPv6len {
+			i = 1
+		}
+		sizes[i].Add(sizes[i], node.prefix.size())
+	}
+	return sizes
+}
@@ -0,0 +1,99 @@
+package netaddr
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingObserver keeps the calls made to it and the resulting sizes
+type recordingObserver struct {
+	NopObserver
+	calls []string
+	sizes [2]*big.Int
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{sizes: [2]*big.Int{big.NewInt(0), big.NewInt(0)}}
+}
+
+func (o *recordingObserver) SetSizeChanged(family int, delta *big.Int) {
+	o.calls = append(o.calls, fmt.Sprintf("v%d %+d", family, delta))
+	i := 0
+	if family == 6 {
+		i = 1
+	}
+	o.sizes[i].Add(o.sizes[i], delta)
+}
+
+func TestObserverDeltas(t *testing.T) {
+	o := newRecordingObserver()
+	set := &IPSet{}
+	set.SetObserver(o)
+
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.InsertNet(parse("10.0.0.128/25")) // already in the set
+	set.InsertNet(parse("10.0.0.0/23"))
+	set.Insert(ParseIP("2001:db8::1"))
+	set.RemoveNet(parse("10.0.1.0/28"))
+	set.Remove(ParseIP("10.0.1.0")) // already removed
+	set.Remove(ParseIP("2001:db8::1"))
+	set.RemoveNet(parse("10.0.0.0/8"))
+	assert.Equal(t, []string{
+		"v4 +256",
+		"v4 +256",
+		"v6 +1",
+		"v4 -16",
+		"v6 -1",
+		"v4 -496",
+	}, o.calls)
+
+	o.calls = nil
+	set.SetObserver(nil)
+	set.Insert(ParseIP("10.0.0.1"))
+	assert.Equal(t, 0, len(o.calls))
+}
+
+func TestObserverMatchesSize(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	o := newRecordingObserver()
+	set := &IPSet{}
+	set.SetObserver(o)
+	for i := 0; i < 1000; i++ {
+		other := randomSet(r, 3)
+		switch r.Intn(3) {
+		case 0:
+			set.UnionWith(other)
+		case 1:
+			for _, n := range other.GetNetworks() {
+				set.RemoveNet(n)
+			}
+		default:
+			for _, n := range other.GetNetworks() {
+				set.InsertNet(n)
+			}
+		}
+	}
+	sizes := set.familySizes()
+	assert.Equal(t, sizes[0].String(), o.sizes[0].String())
+	assert.Equal(t, sizes[1].String(), o.sizes[1].String())
+}
+
+func TestObserverReplace(t *testing.T) {
+	o := newRecordingObserver()
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.SetObserver(o)
+
+	assert.Nil(t, set.Scan("10.0.0.0/25,2001:db8::/126"))
+	assert.Equal(t, []string{"v4 -128", "v6 +4"}, o.calls)
+
+	// Derived sets don't have the observer
+	o.calls = nil
+	union := set.Union(set)
+	union.Insert(ParseIP("192.0.2.1"))
+	assert.Equal(t, 0, len(o.calls))
+}
@@ -0,0 +1,70 @@
+package netaddr
+
+import (
+	"math/big"
+)
+
+// hostPrefixFromInt returns the host prefix of the given length in bytes
+// whose address is the given integer, which must fit
+func hostPrefixFromInt(i *big.Int, addrLen uint8) ipPrefix {
+	p := ipPrefix{addrLen: addrLen, ones: 8 * addrLen}
+	b := i.Bytes()
+	copy(p.addr[int(addrLen)-len(b):addrLen], b)
+	return p
+}
+
+// Partition splits the set into n disjoint sets, in order by address, whose
+// sizes differ by at most one IP. The first ones are the larger. Together
+// they hold the IPs of the set. A network that crosses from one to the next
+// is split between them. It returns an error if n isn't positive or is more
+// than the number of IPs in the set.
+func (s *IPSet) Partition(n int) ([]*IPSet, error) {
+	total := s.root().size()
+	if n <= 0 || total.Cmp(big.NewInt(int64(n))) < 0 {
+		return nil, errorf(ErrInvalidArgument, "cannot partition %s IPs into %d sets", total, n)
+	}
+	quotient, remainder := new(big.Int).QuoRem(total, big.NewInt(int64(n)), new(big.Int))
+	quota := func(i int) *big.Int {
+		q := new(big.Int).Set(quotient)
+		if big.NewInt(int64(i)).Cmp(remainder) < 0 {
+			q.Add(q, big.NewInt(1))
+		}
+		return q
+	}
+
+	shards := []*IPSet{{}}
+	need := quota(0)
+	one := big.NewInt(1)
+	for node := s.root().first(); node != nil; node = node.next() {
+		p := node.prefix
+		if need.Cmp(p.size()) >= 0 {
+			// The whole network fits in the current set
+			shards[len(shards)-1].insertPrefix(p)
+			need.Sub(need, p.size())
+		} else {
+			start, last := addrToInt(p), addrToInt(p.lastIP())
+			for start.Cmp(last) <= 0 {
+				if need.Sign() == 0 {
+					shards = append(shards, &IPSet{})
+					need = quota(len(shards) - 1)
+				}
+				end := new(big.Int).Add(start, need)
+				end.Sub(end, one)
+				if end.Cmp(last) > 0 {
+					end.Set(last)
+				}
+				for _, q := range rangePrefixes(hostPrefixFromInt(start, p.addrLen), hostPrefixFromInt(end, p.addrLen)) {
+					shards[len(shards)-1].insertPrefix(q)
+				}
+				taken := new(big.Int).Sub(end, start)
+				need.Sub(need, taken.Add(taken, one))
+				start = end.Add(end, one)
+			}
+		}
+		if need.Sign() == 0 && len(shards) < n {
+			shards = append(shards, &IPSet{})
+			need = quota(len(shards) - 1)
+		}
+	}
+	return shards, nil
+}
@@ -0,0 +1,89 @@
+package netaddr
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPSetPartition(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.InsertNet(parse("10.0.2.0/25"))
+	set.InsertNet(parse("2001:db8::/127"))
+
+	shards, err := set.Partition(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(shards))
+	assert.Equal(t, set.String(), shards[0].String())
+
+	// 193 IPs each
+	shards, err = set.Partition(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/25", "10.0.0.128/26", "10.0.0.192/32"}, shards[0].String())
+	assert.Equal(t, []string{"10.0.0.193/32", "10.0.0.194/31", "10.0.0.196/30", "10.0.0.200/29", "10.0.0.208/28",
+		"10.0.0.224/27", "10.0.2.0/25", "2001:db8::/127"}, shards[1].String())
+
+	// 129, 129 and 128 IPs, with the /24 and the /25 split between sets
+	shards, err = set.Partition(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/25", "10.0.0.128/32"}, shards[0].String())
+	assert.Equal(t, []string{"10.0.0.129/32", "10.0.0.130/31", "10.0.0.132/30", "10.0.0.136/29", "10.0.0.144/28",
+		"10.0.0.160/27", "10.0.0.192/26", "10.0.2.0/31"}, shards[1].String())
+	assert.Equal(t, []string{"10.0.2.2/31", "10.0.2.4/30", "10.0.2.8/29", "10.0.2.16/28", "10.0.2.32/27",
+		"10.0.2.64/26", "2001:db8::/127"}, shards[2].String())
+
+	shards, err = set.Partition(386)
+	assert.Nil(t, err)
+	assert.Equal(t, 386, len(shards))
+	assert.Equal(t, []string{"2001:db8::1/128"}, shards[385].String())
+}
+
+func TestIPSetPartitionErrors(t *testing.T) {
+	set := &IPSet{}
+	_, err := set.Partition(1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	set.InsertNet(parse("10.0.0.0/30"))
+	_, err = set.Partition(5)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = set.Partition(0)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = set.Partition(-1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+func TestIPSetPartitionRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(490))
+	for i := 0; i < 200; i++ {
+		set := RandomIPSet(r, 30)
+		if len(set.GetNetworks()) == 0 {
+			continue
+		}
+		n := 1 + r.Intn(20)
+		if set.tree.size().Cmp(big.NewInt(int64(n))) < 0 {
+			continue
+		}
+		shards, err := set.Partition(n)
+		assert.Nil(t, err)
+		assert.Equal(t, n, len(shards))
+
+		union := &IPSet{}
+		min, max := shards[0].tree.size(), shards[0].tree.size()
+		for j, shard := range shards {
+			assert.Nil(t, shard.Validate())
+			assert.Equal(t, 0, len(union.Intersection(shard).GetNetworks()), "shard %d overlaps", j)
+			union = union.Union(shard)
+			if size := shard.tree.size(); size.Cmp(min) < 0 {
+				min = size
+			} else if size.Cmp(max) > 0 {
+				max = size
+			}
+		}
+		assert.Equal(t, "", ExplainDifference(set, union))
+		assert.True(t, max.Sub(max, min).Cmp(big.NewInt(1)) <= 0)
+	}
+}
@@ -0,0 +1,58 @@
+package netaddr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffPatch returns the lines of a patch that turns the set from into the
+// set to when given to ApplyPatch. A line is "-" followed by a network to
+// remove or "+" followed by one to add, like "-10.1.3.0/24" or
+// "+10.1.0.0/16". The networks to remove come first, then the ones to add,
+// each in the order of GetNetworks. Both are aggregated, so no two lines
+// could be combined. Equal sets give no lines.
+func DiffPatch(from, to *IPSet) []string {
+	var lines []string
+	for node := from.Difference(to).tree.first(); node != nil; node = node.next() {
+		lines = append(lines, "-"+node.prefix.String())
+	}
+	for node := to.Difference(from).tree.first(); node != nil; node = node.next() {
+		lines = append(lines, "+"+node.prefix.String())
+	}
+	return lines
+}
+
+// ApplyPatch applies the lines of a patch, like DiffPatch returns, to the
+// set in order. Each network may be a CIDR or a single IP. Blank lines are
+// skipped. Removing IPs that aren't in the set at that point is an error,
+// which matches ErrNotInNetwork, so a patch doesn't apply to a set other than
+// the one it was made for. Adding IPs that are already in it is not. If any
+// line doesn't parse or apply, it returns an error with its line number,
+// starting at 1, and leaves the set alone.
+func (s *IPSet) ApplyPatch(lines []string) error {
+	patched := s.Clone()
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line[0] != '+' && line[0] != '-' {
+			return errorf(ErrInvalidArgument, "line %d: patch line must start with + or -: %q", i+1, line)
+		}
+		n, err := ParseNetOrIP(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		p := prefixFromNet(n)
+		if line[0] == '+' {
+			patched.insertPrefix(p)
+			continue
+		}
+		if !patched.tree.contains(p) {
+			return errorf(ErrNotInNetwork, "line %d: cannot remove %s, which is not all in the set", i+1, p)
+		}
+		patched.removePrefix(p)
+	}
+	s.replaceTree(patched.tree)
+	return nil
+}
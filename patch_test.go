@@ -0,0 +1,85 @@
+package netaddr
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPatch(t *testing.T) {
+	from, to := &IPSet{}, &IPSet{}
+	assert.Nil(t, DiffPatch(from, to))
+
+	from.InsertNet(parse("10.0.0.0/8"))
+	from.InsertNet(parse("2001:db8::/32"))
+	to.InsertNet(parse("10.0.0.0/8"))
+	to.RemoveNet(parse("10.1.3.0/24"))
+	to.InsertNet(parse("192.168.0.0/16"))
+	to.InsertNet(parse("192.0.2.1/32"))
+	assert.Equal(t, []string{
+		"-10.1.3.0/24",
+		"-2001:db8::/32",
+		"+192.0.2.1/32",
+		"+192.168.0.0/16",
+	}, DiffPatch(from, to))
+	assert.Equal(t, []string{
+		"-192.0.2.1/32",
+		"-192.168.0.0/16",
+		"+10.1.3.0/24",
+		"+2001:db8::/32",
+	}, DiffPatch(to, from))
+	assert.Nil(t, DiffPatch(to, to))
+}
+
+func TestApplyPatch(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	assert.Nil(t, set.ApplyPatch([]string{"-10.1.3.0/24", "", " + 192.0.2.1 ", "+2001:db8::/32", "-2001:db8::/33"}))
+	assert.Equal(t, []string{
+		"10.0.0.0/16", "10.1.0.0/23", "10.1.2.0/24", "10.1.4.0/22", "10.1.8.0/21", "10.1.16.0/20",
+		"10.1.32.0/19", "10.1.64.0/18", "10.1.128.0/17", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13",
+		"10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9", "192.0.2.1/32", "2001:db8:8000::/33",
+	}, set.String())
+
+	// Adding what is already there isn't an error
+	assert.Nil(t, set.ApplyPatch([]string{"+10.0.0.0/16"}))
+	assert.Nil(t, set.ApplyPatch(nil))
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	before := set.String()
+
+	err := set.ApplyPatch([]string{"+192.0.2.0/24", "-11.0.0.0/24"})
+	assert.True(t, errors.Is(err, ErrNotInNetwork))
+	assert.Equal(t, "line 2: cannot remove 11.0.0.0/24, which is not all in the set", err.Error())
+
+	// It removes in order, so the second removal finds the IPs gone
+	err = set.ApplyPatch([]string{"-10.1.0.0/16", "-10.0.0.0/8"})
+	assert.True(t, errors.Is(err, ErrNotInNetwork))
+
+	err = set.ApplyPatch([]string{"-10.1.0.0/16", "10.2.0.0/16"})
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	assert.Equal(t, "line 2: patch line must start with + or -: \"10.2.0.0/16\"", err.Error())
+
+	err = set.ApplyPatch([]string{"+10.2.0.1/16"})
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	err = set.ApplyPatch([]string{"+", "-"})
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+
+	assert.Equal(t, before, set.String())
+}
+
+func TestDiffPatchRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(484))
+	for i := 0; i < 20; i++ {
+		a, b := randomSet(r, 500), randomSet(r, 500)
+		patched := a.Union(&IPSet{})
+		assert.Nil(t, patched.ApplyPatch(DiffPatch(a, b)))
+		assert.Equal(t, "", ExplainDifference(patched, b))
+		assert.Nil(t, patched.Validate())
+	}
+}
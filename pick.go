@@ -0,0 +1,56 @@
+package netaddr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"net"
+)
+
+// PickIP maps the given key, like a tenant ID or a flow tuple, to an IP of
+// the set, the same one every time for the same key and set. When networks
+// are added to or removed from the set, only the keys that map to those
+// networks, or would, move to another IP.
+//
+// It uses weighted rendezvous hashing over the networks of the set, in the
+// form GetNetworks returns them. For each network, it takes the SHA-256 hash
+// of the network, in the encoding of IPNet.ToBytes, followed by the key. The
+// first 53 bits of it make a number u between 0 and 1, and the key goes to
+// the network with the highest score, -size / ln(u). The last 128 bits of
+// its hash modulo the size of that network are the offset of the IP in it.
+// A network that combines with its neighbors when it is added changes them,
+// so their keys move too.
+//
+// It takes time in proportion to the number of networks in the set. It
+// returns an error that matches ErrEmptySet if the set is nil or empty.
+func (s *IPSet) PickIP(key []byte) (net.IP, error) {
+	var best ipPrefix
+	var bestSum []byte
+	bestScore := math.Inf(-1)
+	h := sha256.New()
+	var sum, encoded []byte
+	for node := s.root().first(); node != nil; node = node.next() {
+		p := node.prefix
+		h.Reset()
+		encoded = p.appendBinary(encoded[:0], true)
+		h.Write(encoded)
+		h.Write(key)
+		sum = h.Sum(sum[:0])
+
+		// The log of -size / ln(u), which orders the scores the same
+		u := (float64(binary.BigEndian.Uint64(sum)>>11) + 0.5) / (1 << 53)
+		score := float64(p.bits()-int(p.ones))*math.Ln2 - math.Log(-math.Log(u))
+		if score > bestScore {
+			best, bestScore = p, score
+			bestSum = append(bestSum[:0], sum...)
+		}
+	}
+	if bestSum == nil {
+		return nil, errorf(ErrEmptySet, "cannot pick an IP from an empty set")
+	}
+
+	offset := new(big.Int).SetBytes(bestSum[len(bestSum)-16:])
+	offset.Mod(offset, best.size())
+	return intToIP(offset.Add(offset, addrToInt(best)), best.addrLen), nil
+}
@@ -0,0 +1,104 @@
+package netaddr
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPSetPickIP(t *testing.T) {
+	var set *IPSet
+	_, err := set.PickIP([]byte("tenant-1"))
+	assert.True(t, errors.Is(err, ErrEmptySet))
+	set = &IPSet{}
+	_, err = set.PickIP([]byte("tenant-1"))
+	assert.True(t, errors.Is(err, ErrEmptySet))
+
+	set.InsertNet(parse("10.0.0.0/24"))
+	set.InsertNet(parse("192.0.2.0/25"))
+
+	// The scheme is fixed, so these don't change from run to run
+	for key, expected := range map[string]string{
+		"tenant-1": "192.0.2.12",
+		"tenant-2": "192.0.2.100",
+		"tenant-3": "10.0.0.44",
+		"":         "10.0.0.173",
+	} {
+		ip, err := set.PickIP([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, ip.String(), key)
+	}
+
+	set.InsertNet(parse("2001:db8::/64"))
+	ip, err := set.PickIP([]byte("tenant-1"))
+	assert.Nil(t, err)
+	assert.True(t, set.Contains(ip))
+
+	single := &IPSet{}
+	single.InsertNet(parse("10.0.0.7/32"))
+	ip, err = single.PickIP([]byte("anything"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.7", ip.String())
+}
+
+func TestIPSetPickIPSpread(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/22"))
+	set.InsertNet(parse("10.1.0.0/24"))
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		ip, _ := set.PickIP([]byte(fmt.Sprint(i)))
+		assert.True(t, set.Contains(ip))
+		counts[ip.Mask(parse("0.0.0.0/16").Mask).String()]++
+	}
+	// The /22 has 4/5 of the IPs
+	assert.InDelta(t, 8000, counts["10.0.0.0"], 300)
+	assert.InDelta(t, 2000, counts["10.1.0.0"], 300)
+}
+
+func TestIPSetPickIPChurn(t *testing.T) {
+	r := rand.New(rand.NewSource(491))
+	set := &IPSet{}
+	for i := 0; i < 20; i++ {
+		set.InsertNet(parse(fmt.Sprintf("10.%d.0.0/24", 2*i)))
+	}
+	keys := make([][]byte, 5000)
+	before := make([]string, len(keys))
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprint(r.Int63()))
+		ip, _ := set.PickIP(keys[i])
+		before[i] = ip.String()
+	}
+
+	// Adding a network that doesn't combine with others only moves the
+	// keys that go to it, about 1/21 of them
+	added := parse("10.99.0.0/24")
+	grown := set.Union(&IPSet{})
+	grown.InsertNet(added)
+	moved := 0
+	for i, key := range keys {
+		ip, _ := grown.PickIP(key)
+		if ip.String() != before[i] {
+			moved++
+			assert.True(t, added.Contains(ip))
+		}
+	}
+	assert.InDelta(t, len(keys)/21, moved, 100)
+
+	// Removing one only moves the keys that went to it
+	removed := parse("10.4.0.0/24")
+	shrunk := set.Union(&IPSet{})
+	shrunk.RemoveNet(removed)
+	moved = 0
+	for i, key := range keys {
+		ip, _ := shrunk.PickIP(key)
+		if ip.String() != before[i] {
+			moved++
+			assert.True(t, removed.Contains(parse(before[i]+"/32").IP))
+		}
+	}
+	assert.InDelta(t, len(keys)/20, moved, 100)
+}
@@ -0,0 +1,307 @@
+package netaddr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"time"
+)
+
+// ipPrefix is the compact form of a network stored in the nodes of an
+// ipTree. The address lives in a fixed-size array, of which only the first 4
+// bytes are used for IPv4, so a node needs none of the separate allocations
+// of a net.IP and a net.IPMask. Conversion to and from net.IPNet happens at
+// the boundary of the IPSet API.
+type ipPrefix struct {
+	addr    [16]byte
+	addrLen uint8 // length of the address in bytes, 4 or 16
+	ones    uint8 // number of leading ones in the mask
+}
+
+// v4InV6Prefix is the start of an IPv4 address in the 16 byte form
+var v4InV6Prefix = [12]byte{10: 0xff, 11: 0xff}
+
+// prefixFromNet converts the given network to an ipPrefix. A mask of the
+// other length is taken to apply to the end of the address. An IPv4 network
+// in the 16 byte form, one within ::ffff:0:0/96, is converted to the 4 byte
+// form so that both forms of the same network are equal.
+func prefixFromNet(n *net.IPNet) (p ipPrefix) {
+	p.addrLen = uint8(copy(p.addr[:], n.IP))
+	ones, bits := n.Mask.Size()
+	if bits != 0 {
+		ones += 8*len(n.IP) - bits
+	}
+	if ones < 0 {
+		ones = 0
+	}
+	p.ones = uint8(ones)
+	if p.ones >= 96 {
+		p = p.to4()
+	}
+	return
+}
+
+// checkedPrefixFromNet converts the given network like prefixFromNet after
+// checking that it is well formed. It returns an error if the network is
+// nil, the IP or mask has an invalid length or doesn't fit the other, the
+// mask isn't contiguous or the host part of the IP isn't zero.
+func checkedPrefixFromNet(n *net.IPNet) (ipPrefix, error) {
+	if n == nil {
+		return ipPrefix{}, errorf(ErrInvalidCIDR, "network is nil")
+	}
+	if len(n.IP) != net.IPv4len && len(n.IP) != net.IPv6len {
+		return ipPrefix{}, errorf(ErrInvalidCIDR, "invalid IP length in network: %d bytes", len(n.IP))
+	}
+	if !IsContiguousMask(n.Mask) {
+		return ipPrefix{}, errorf(ErrInvalidMask, "invalid mask in network %s: %s", n.IP, maskString(n.Mask))
+	}
+	if ones, bits := n.Mask.Size(); bits-ones > 8*len(n.IP) {
+		return ipPrefix{}, errorf(ErrInvalidMask, "mask /%d is too short for IP %s", ones, n.IP)
+	}
+	p := prefixFromNet(n)
+	if !p.valid() {
+		return ipPrefix{}, errorf(ErrHostBitsSet, "host part of network %s is not zero", n)
+	}
+	return p, nil
+}
+
+// prefixFromIP converts the given IP to a /32 or /128 prefix depending on the
+// type of address. An IPv4 address in the 16 byte form becomes a /32.
+func prefixFromIP(ip net.IP) (p ipPrefix) {
+	p.addrLen = uint8(copy(p.addr[:], ip))
+	p.ones = 8 * p.addrLen
+	return p.to4()
+}
+
+// to4 converts a 16 byte prefix of at least 96 bits within ::ffff:0:0/96 to
+// the equivalent IPv4 prefix. Any other prefix is returned as is.
+func (p ipPrefix) to4() ipPrefix {
+	if p.addrLen != net.IPv6len || p.ones < 96 || !bytes.Equal(p.addr[:12], v4InV6Prefix[:]) {
+		return p
+	}
+	var q ipPrefix
+	copy(q.addr[:], p.addr[12:16])
+	q.addrLen = net.IPv4len
+	q.ones = p.ones - 96
+	return q
+}
+
+// bits returns the number of bits in the address
+func (p ipPrefix) bits() int {
+	return 8 * int(p.addrLen)
+}
+
+// ip returns the address of the prefix as a new net.IP
+func (p ipPrefix) ip() net.IP {
+	ip := make(net.IP, p.addrLen)
+	copy(ip, p.addr[:])
+	return ip
+}
+
+// toNet returns the prefix as a new net.IPNet
+func (p ipPrefix) toNet() *net.IPNet {
+	return &net.IPNet{IP: p.ip(), Mask: net.CIDRMask(int(p.ones), p.bits())}
+}
+
+func (p ipPrefix) String() string {
+	return p.toNet().String()
+}
+
+// valid returns true if the prefix has a proper address length and no bits
+// set in the host part.
+func (p ipPrefix) valid() bool {
+	if p.addrLen != net.IPv4len && p.addrLen != net.IPv6len {
+		return false
+	}
+	return int(p.ones) <= p.bits() && p.addr == p.hostBits(false)
+}
+
+// compare orders prefixes by address with all IPv4 prefixes before IPv6 ones,
+// like IPLessThan.
+func (p ipPrefix) compare(q ipPrefix) int {
+	if p.addrLen != q.addrLen {
+		if p.addrLen < q.addrLen {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(p.addr[:p.addrLen], q.addr[:q.addrLen])
+}
+
+// contains returns true if q is a subset of p, including when they are equal.
+func (p ipPrefix) contains(q ipPrefix) bool {
+	if p.addrLen != q.addrLen || p.ones > q.ones {
+		return false
+	}
+	i := int(p.ones) / 8
+	for j := 0; j < i; j++ {
+		if p.addr[j] != q.addr[j] {
+			return false
+		}
+	}
+	if p.ones%8 == 0 {
+		return true
+	}
+	mask := byte(0xff) << (8 - p.ones%8)
+	return (p.addr[i]^q.addr[i])&mask == 0
+}
+
+// hostBits returns the address with all of the bits after the prefix set, if
+// set is true, or cleared.
+func (p ipPrefix) hostBits(set bool) [16]byte {
+	addr := p.addr
+	i := int(p.ones) / 8
+	if i >= int(p.addrLen) {
+		return addr
+	}
+	mask := byte(0xff) >> (p.ones % 8)
+	if set {
+		addr[i] |= mask
+	} else {
+		addr[i] &^= mask
+	}
+	for i++; i < int(p.addrLen); i++ {
+		if set {
+			addr[i] = 0xff
+		} else {
+			addr[i] = 0
+		}
+	}
+	return addr
+}
+
+// last returns the last address in the prefix, or the broadcast address.
+func (p ipPrefix) last() [16]byte {
+	return p.hostBits(true)
+}
+
+// lastIP returns the last address in the prefix as a host prefix
+func (p ipPrefix) lastIP() ipPrefix {
+	return ipPrefix{addr: p.last(), addrLen: p.addrLen, ones: 8 * p.addrLen}
+}
+
+// halves returns the given prefix as two equally sized halves
+func (p ipPrefix) halves() (a, b ipPrefix) {
+	a, b = p, p
+	a.ones++
+	b.ones++
+	a.addr[p.ones/8] &^= 0x80 >> (p.ones % 8)
+	b.addr[p.ones/8] |= 0x80 >> (p.ones % 8)
+	return
+}
+
+// difference returns the set difference p - q. It returns the list of
+// prefixes in order from largest to smallest. They are *not* sorted by
+// address.
+func (p ipPrefix) difference(q ipPrefix) (result []ipPrefix) {
+	if q.contains(p) {
+		return
+	}
+	if !p.contains(q) {
+		return []ipPrefix{p}
+	}
+
+	// Cut p in half and continue with the one that overlaps until it is q
+	for p.ones < q.ones {
+		first, second := p.halves()
+		if first.contains(q) {
+			result = append(result, second)
+			p = first
+		} else {
+			result = append(result, first)
+			p = second
+		}
+	}
+	return
+}
+
+// combine returns the prefix twice the size of p and true if q is the second
+// half of it and p the first.
+func (p ipPrefix) combine(q ipPrefix) (ipPrefix, bool) {
+	if p.addrLen != q.addrLen || p.ones != q.ones || p.ones == 0 {
+		return ipPrefix{}, false
+	}
+	// The addresses must only differ in the last bit of the prefix, which is
+	// clear in p and set in q.
+	i, bit := (p.ones-1)/8, byte(0x80)>>((p.ones-1)%8)
+	if p.addr[i]&bit != 0 || p.addr[i]|bit != q.addr[i] {
+		return ipPrefix{}, false
+	}
+	for j := uint8(0); j < p.addrLen; j++ {
+		if j != i && p.addr[j] != q.addr[j] {
+			return ipPrefix{}, false
+		}
+	}
+	p.ones--
+	return p, true
+}
+
+// size returns the number of addresses in the prefix
+func (p ipPrefix) size() *big.Int {
+	return big.NewInt(0).Lsh(big.NewInt(1), uint(p.bits()-int(p.ones)))
+}
+
+// prioritySeed keys the hash that priority uses. It is chosen at random for
+// each process, so that no one can choose networks whose priorities leave a
+// tree unbalanced.
+var prioritySeed = newPrioritySeed()
+
+// newPrioritySeed returns a random seed, or the time if there is no source
+// of randomness
+func newPrioritySeed() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// priority returns a well-mixed hash of the prefix to use as the priority of
+// its node. Unlike random priorities, it doesn't need any shared state, and a
+// prefix has the same priority for as long as the process runs.
+func (p ipPrefix) priority() uint32 {
+	// FNV-1a, starting from the seed, over the address and prefix length
+	// followed by the splitmix64 finalizer
+	h := uint64(14695981039346656037) ^ prioritySeed
+	for _, b := range p.addr[:p.addrLen] {
+		h = (h ^ uint64(b)) * 1099511628211
+	}
+	h = (h ^ uint64(p.ones)) * 1099511628211
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return uint32((h ^ (h >> 31)) >> 32)
+}
+
+// rangePrefixes returns the fewest prefixes that cover the IPs from first to
+// last, which must be host prefixes of the same length with first no greater
+// than last. They are in order by address.
+func rangePrefixes(first, last ipPrefix) (prefixes []ipPrefix) {
+	for {
+		// Grow the prefix while it starts at first and ends by last
+		p := first
+		for p.ones > 0 {
+			q := p
+			q.ones--
+			end := q.last()
+			if q.hostBits(false) != first.addr || bytes.Compare(end[:], last.addr[:]) > 0 {
+				break
+			}
+			p = q
+		}
+		prefixes = append(prefixes, p)
+
+		next := p.last()
+		if next == last.addr {
+			return
+		}
+		for i := int(p.addrLen) - 1; i >= 0; i-- {
+			next[i]++
+			if next[i] != 0 {
+				break
+			}
+		}
+		first.addr = next
+	}
+}
@@ -0,0 +1,162 @@
+package netaddr
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixFromNet(t *testing.T) {
+	p := prefixFromNet(Ten24)
+	assert.Equal(t, uint8(4), p.addrLen)
+	assert.Equal(t, uint8(24), p.ones)
+	assert.Equal(t, Ten24, p.toNet())
+	assert.Equal(t, "10.0.0.0/24", p.String())
+
+	p = prefixFromNet(V6Net1)
+	assert.Equal(t, uint8(16), p.addrLen)
+	assert.Equal(t, uint8(64), p.ones)
+	assert.Equal(t, V6Net1, p.toNet())
+
+	// A 16 byte address with a 4 byte mask, like net.ParseCIDR can produce
+	p = prefixFromNet(&net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(24, 32)})
+	assert.Equal(t, prefixFromNet(Ten24), p)
+
+	// A 16 byte address with a 16 byte mask
+	p = prefixFromNet(&net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(120, 128)})
+	assert.Equal(t, prefixFromNet(Ten24), p)
+	p = prefixFromNet(parse("::ffff:0:0/96"))
+	assert.Equal(t, prefixFromNet(parse("0.0.0.0/0")), p)
+
+	// Networks larger than ::ffff:0:0/96 stay IPv6
+	p = prefixFromNet(parse("::ffff:0:0/95"))
+	assert.Equal(t, uint8(16), p.addrLen)
+	assert.Equal(t, uint8(95), p.ones)
+	p = prefixFromNet(parse("::fffe:0:0/96"))
+	assert.Equal(t, uint8(16), p.addrLen)
+}
+
+func TestPrefixFromIP(t *testing.T) {
+	assert.Equal(t, ipToNet(Eights), prefixFromIP(Eights).toNet())
+	assert.Equal(t, ipToNet(V6Net1Router), prefixFromIP(V6Net1Router).toNet())
+	assert.Equal(t, prefixFromIP(Eights), prefixFromIP(Eights.To16()))
+}
+
+func TestPrefixCompareFamilies(t *testing.T) {
+	v4 := prefixFromNet(parse("255.0.0.0/8"))
+	v6 := prefixFromNet(parse("::/8"))
+	assert.Equal(t, -1, v4.compare(v6))
+	assert.Equal(t, 1, v6.compare(v4))
+	assert.Equal(t, 0, v4.compare(v4))
+}
+
+func TestPrefixValid(t *testing.T) {
+	assert.True(t, prefixFromNet(Ten24).valid())
+	assert.True(t, prefixFromNet(V6Net1).valid())
+	assert.True(t, prefixFromNet(parse("0.0.0.0/0")).valid())
+	assert.False(t, prefixFromNet(parse("10.0.0.1/24")).valid())
+	assert.False(t, prefixFromNet(parse("2001:db8::1/127")).valid())
+	assert.False(t, ipPrefix{}.valid())
+}
+
+func TestPrefixContains(t *testing.T) {
+	for _, tc := range []struct {
+		a, b   string
+		result bool
+	}{
+		{"10.0.0.0/24", "10.0.0.0/24", true},
+		{"10.0.0.0/24", "10.0.0.128/25", true},
+		{"10.0.0.0/24", "10.0.0.255/32", true},
+		{"10.0.0.128/25", "10.0.0.0/24", false},
+		{"10.0.0.0/24", "10.0.1.0/24", false},
+		{"10.0.0.0/23", "10.0.1.0/24", true},
+		{"10.0.0.0/23", "10.0.2.0/24", false},
+		{"0.0.0.0/0", "255.255.255.255/32", true},
+		{"0.0.0.0/0", "::/128", false},
+		{"::/0", "0.0.0.0/32", false},
+		{"2001:db8::/32", "2001:db8:ffff::/48", true},
+		{"2001:db8::/33", "2001:db8:ffff::/48", false},
+	} {
+		assert.Equal(t, tc.result, prefixFromNet(parse(tc.a)).contains(prefixFromNet(parse(tc.b))), "%s contains %s", tc.a, tc.b)
+	}
+}
+
+func TestPrefixLast(t *testing.T) {
+	assert.Equal(t, "10.0.0.255/32", prefixFromNet(Ten24).lastIP().String())
+	assert.Equal(t, "10.0.0.0/32", prefixFromIP(Ten24.IP).lastIP().String())
+	assert.Equal(t, "255.255.255.255/32", prefixFromNet(parse("0.0.0.0/0")).lastIP().String())
+	assert.Equal(t, "2001:db8:1234:abcd:ffff:ffff:ffff:ffff/128", prefixFromNet(V6Net1).lastIP().String())
+}
+
+func TestPrefixDifference(t *testing.T) {
+	diff := prefixFromNet(Ten24).difference(prefixFromNet(parse("10.0.0.120/29")))
+	assert.Equal(t, "[10.0.0.128/25 10.0.0.0/26 10.0.0.64/27 10.0.0.96/28 10.0.0.112/29]", fmt.Sprint(diff))
+
+	diff = prefixFromNet(Ten24).difference(prefixFromNet(Ten24))
+	assert.Equal(t, 0, len(diff))
+
+	diff = prefixFromNet(Ten24128).difference(prefixFromNet(Ten24))
+	assert.Equal(t, 0, len(diff))
+
+	diff = prefixFromNet(Ten24).difference(prefixFromNet(TenOne24))
+	assert.Equal(t, "[10.0.0.0/24]", fmt.Sprint(diff))
+
+	diff = prefixFromNet(parse("::/0")).difference(prefixFromIP(ParseIP("::")))
+	assert.Equal(t, 128, len(diff))
+	assert.Equal(t, "::1/128", diff[127].String())
+}
+
+func TestPrefixCombine(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, result string
+	}{
+		{"10.0.0.0/24", "10.0.1.0/24", "10.0.0.0/23"},
+		{"10.0.1.0/24", "10.0.2.0/24", ""},
+		{"10.0.1.0/24", "10.0.0.0/24", ""},
+		{"10.0.0.0/24", "10.0.0.0/24", ""},
+		{"10.0.0.0/24", "10.0.1.0/25", ""},
+		{"0.0.0.0/1", "128.0.0.0/1", "0.0.0.0/0"},
+		{"0.0.0.0/0", "0.0.0.0/0", ""},
+		{"2001:db8::/128", "2001:db8::1/128", "2001:db8::/127"},
+		{"0.0.0.0/32", "::1/128", ""},
+	} {
+		p, ok := prefixFromNet(parse(tc.a)).combine(prefixFromNet(parse(tc.b)))
+		if tc.result == "" {
+			assert.False(t, ok, "%s + %s", tc.a, tc.b)
+		} else {
+			assert.True(t, ok, "%s + %s", tc.a, tc.b)
+			assert.Equal(t, tc.result, p.String())
+		}
+	}
+}
+
+func TestPrefixCompare(t *testing.T) {
+	assert.Equal(t, 0, prefixFromNet(Ten24).compare(prefixFromNet(parse("10.0.0.0/25"))))
+	assert.Equal(t, -1, prefixFromNet(Ten24).compare(prefixFromNet(TenOne24)))
+	assert.Equal(t, 1, prefixFromNet(TenTwo24).compare(prefixFromNet(TenOne24)))
+	assert.Equal(t, -1, prefixFromNet(Ten24).compare(prefixFromNet(V6Net1)))
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		first, last string
+		expected    []string
+	}{
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.1", "10.0.0.1", []string{"10.0.0.1/32"}},
+		{"10.0.0.1", "10.0.0.8", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+		{"2001:db8::ffff", "2001:db8::1:0", []string{"2001:db8::ffff/128", "2001:db8::1:0/128"}},
+	}
+	for _, test := range tests {
+		var str []string
+		for _, p := range rangePrefixes(prefixFromIP(ParseIP(test.first)), prefixFromIP(ParseIP(test.last))) {
+			str = append(str, p.String())
+		}
+		assert.Equal(t, test.expected, str, "%s-%s", test.first, test.last)
+	}
+}
@@ -0,0 +1,166 @@
+package netaddr
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PrefixMatcher matches networks against a rule of a router's prefix list,
+// like "10.0.0.0/8 ge 16 le 24", which matches the networks in 10.0.0.0/8
+// with prefix lengths from 16 to 24
+type PrefixMatcher struct {
+	p      ipPrefix
+	ge, le uint8
+}
+
+// ParsePrefixRule parses a rule of a prefix list: a network optionally
+// followed by "ge" and a prefix length, "le" and a prefix length or both, in
+// that order. A network matches if it is within the network of the rule and
+// its prefix length is at least ge and at most le. Like on Cisco and FRR
+// routers, a rule with neither matches only the network itself, ge alone
+// allows any length up to that of the IP version and le alone any length
+// from that of the rule's network. The lengths must satisfy network length
+// <= ge <= le <= 32 or 128.
+func ParsePrefixRule(s string) (*PrefixMatcher, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errorf(ErrInvalidCIDR, "prefix rule is empty")
+	}
+	n, err := ParseNet(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	m := &PrefixMatcher{p: prefixFromNet(n)}
+	m.ge, m.le = m.p.ones, m.p.ones
+
+	// ge must come before le and neither may repeat
+	last := ""
+	for fields = fields[1:]; len(fields) > 0; fields = fields[2:] {
+		inOrder := (fields[0] == "ge" && last == "") || (fields[0] == "le" && last != "le")
+		if len(fields) < 2 || !inOrder {
+			return nil, errorf(ErrInvalidArgument, "prefix rule %q must be a network followed by ge and le lengths", s)
+		}
+		last = fields[0]
+		length, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil || int(length) > m.p.bits() {
+			return nil, errorf(ErrInvalidPrefixLength, "invalid %s length in prefix rule %q: %s", fields[0], s, fields[1])
+		}
+		if fields[0] == "ge" {
+			m.ge, m.le = uint8(length), uint8(m.p.bits())
+		} else {
+			m.le = uint8(length)
+		}
+	}
+	if m.ge < m.p.ones || m.le < m.ge {
+		return nil, errorf(ErrInvalidPrefixLength, "prefix rule %q needs %d <= ge <= le", s, m.p.ones)
+	}
+	return m, nil
+}
+
+// String returns the rule in the form that ParsePrefixRule parses, leaving
+// out the lengths that go without saying
+func (m *PrefixMatcher) String() string {
+	s := m.p.String()
+	if m.ge != m.p.ones {
+		s += fmt.Sprintf(" ge %d", m.ge)
+		if int(m.le) != m.p.bits() {
+			s += fmt.Sprintf(" le %d", m.le)
+		}
+	} else if m.le != m.p.ones {
+		s += fmt.Sprintf(" le %d", m.le)
+	}
+	return s
+}
+
+// Match returns true if the given network is within the network of the
+// rule and its prefix length is in range. It returns false for a network of
+// the other IP version or a nil or malformed network.
+func (m *PrefixMatcher) Match(n *net.IPNet) bool {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return false
+	}
+	return m.p.contains(p) && p.ones >= m.ge && p.ones <= m.le
+}
+
+// PrefixList is an ordered list of rules that permit or deny networks, like
+// a router's prefix list. The zero value is an empty list, which denies
+// everything.
+type PrefixList struct {
+	rules []prefixListRule
+}
+
+type prefixListRule struct {
+	permit  bool
+	matcher *PrefixMatcher
+}
+
+// ParsePrefixList parses a prefix list with a rule on each line, "permit" or
+// "deny" followed by a rule that ParsePrefixRule parses, like
+// "permit 10.0.0.0/8 ge 16 le 24". Blank lines are skipped. It returns an
+// error with the line number, starting at 1, of the first line that doesn't
+// parse.
+func ParsePrefixList(lines []string) (*PrefixList, error) {
+	l := &PrefixList{}
+	for i, line := range lines {
+		action, rule := strings.TrimSpace(line), ""
+		if space := strings.Index(action, " "); space >= 0 {
+			action, rule = action[:space], action[space+1:]
+		}
+		if action == "" {
+			continue
+		}
+		if action != "permit" && action != "deny" {
+			return nil, errorf(ErrInvalidArgument, "line %d: prefix list rule must start with permit or deny: %q", i+1, line)
+		}
+		m, err := ParsePrefixRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		l.Add(action == "permit", m)
+	}
+	return l, nil
+}
+
+// Add appends a rule that permits the networks the given matcher matches,
+// if permit is true, or denies them
+func (l *PrefixList) Add(permit bool, m *PrefixMatcher) {
+	l.rules = append(l.rules, prefixListRule{permit, m})
+}
+
+// Evaluate returns whether the first rule that matches the given network
+// permits it and the index of that rule. If none matches, the network is
+// denied, as on routers, and the index is -1.
+func (l *PrefixList) Evaluate(n *net.IPNet) (permit bool, rule int) {
+	for i, r := range l.rules {
+		if r.matcher.Match(n) {
+			return r.permit, i
+		}
+	}
+	return false, -1
+}
+
+// Permits returns true if the first rule that matches the given network
+// permits it
+func (l *PrefixList) Permits(n *net.IPNet) bool {
+	permit, _ := l.Evaluate(n)
+	return permit
+}
+
+// String returns the rules of the list in the form that ParsePrefixList
+// parses, one on each line
+func (l *PrefixList) String() string {
+	var b strings.Builder
+	for _, r := range l.rules {
+		if r.permit {
+			b.WriteString("permit ")
+		} else {
+			b.WriteString("deny ")
+		}
+		b.WriteString(r.matcher.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
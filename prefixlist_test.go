@@ -0,0 +1,126 @@
+package netaddr
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePrefixRule(t *testing.T) {
+	for _, c := range []struct {
+		rule, canonical string
+		matches         []string
+		misses          []string
+	}{
+		{"10.0.0.0/8 ge 16 le 24", "10.0.0.0/8 ge 16 le 24",
+			[]string{"10.1.0.0/16", "10.1.2.0/24", "10.255.255.0/24", "10.1.0.0/20"},
+			[]string{"10.0.0.0/8", "10.0.0.0/15", "10.1.2.0/25", "11.1.0.0/16", "::/16"}},
+		{"10.0.0.0/8", "10.0.0.0/8",
+			[]string{"10.0.0.0/8"},
+			[]string{"10.0.0.0/9", "10.0.0.0/7", "10.1.0.0/16"}},
+		{"  10.0.0.0/8   ge   24 ", "10.0.0.0/8 ge 24",
+			[]string{"10.1.2.0/24", "10.1.2.3/32"},
+			[]string{"10.1.0.0/23"}},
+		{"10.0.0.0/8 le 16", "10.0.0.0/8 le 16",
+			[]string{"10.0.0.0/8", "10.128.0.0/9", "10.1.0.0/16"},
+			[]string{"10.1.2.0/24", "0.0.0.0/0"}},
+		{"0.0.0.0/0 le 32", "0.0.0.0/0 le 32",
+			[]string{"0.0.0.0/0", "192.0.2.1/32", "::ffff:10.0.0.0/104"},
+			[]string{"::/0"}},
+		{"10.0.0.0/8 ge 8 le 8", "10.0.0.0/8",
+			[]string{"10.0.0.0/8"},
+			[]string{"10.0.0.0/9"}},
+		{"10.0.0.0/8 ge 32 le 32", "10.0.0.0/8 ge 32",
+			[]string{"10.0.0.1/32"},
+			[]string{"10.0.0.0/31"}},
+		{"2001:db8::/32 ge 48 le 64", "2001:db8::/32 ge 48 le 64",
+			[]string{"2001:db8:1::/48", "2001:db8:1:2::/64"},
+			[]string{"2001:db8::/32", "2001:db8::/128", "2001:db9::/48"}},
+	} {
+		m, err := ParsePrefixRule(c.rule)
+		assert.Nil(t, err, c.rule)
+		assert.Equal(t, c.canonical, m.String())
+		for _, cidr := range c.matches {
+			assert.True(t, m.Match(parse(cidr)), "%s should match %s", c.rule, cidr)
+		}
+		for _, cidr := range c.misses {
+			assert.False(t, m.Match(parse(cidr)), "%s should not match %s", c.rule, cidr)
+		}
+		assert.False(t, m.Match(nil))
+	}
+}
+
+func TestParsePrefixRuleErrors(t *testing.T) {
+	for _, c := range []struct {
+		rule string
+		kind error
+	}{
+		{"", ErrInvalidCIDR},
+		{"10.0.0.1/8", ErrHostBitsSet},
+		{"10.0.0.0/8 ge", ErrInvalidArgument},
+		{"10.0.0.0/8 eq 16", ErrInvalidArgument},
+		{"10.0.0.0/8 le 24 ge 16", ErrInvalidArgument},
+		{"10.0.0.0/8 ge 16 ge 24", ErrInvalidArgument},
+		{"10.0.0.0/8 le 16 le 24", ErrInvalidArgument},
+		{"10.0.0.0/8 ge 33", ErrInvalidPrefixLength},
+		{"10.0.0.0/8 ge -1", ErrInvalidPrefixLength},
+		{"10.0.0.0/8 ge x", ErrInvalidPrefixLength},
+		{"10.0.0.0/16 ge 8", ErrInvalidPrefixLength},
+		{"10.0.0.0/16 le 8", ErrInvalidPrefixLength},
+		{"10.0.0.0/8 ge 24 le 16", ErrInvalidPrefixLength},
+		{"2001:db8::/32 le 129", ErrInvalidPrefixLength},
+	} {
+		_, err := ParsePrefixRule(c.rule)
+		assert.True(t, errors.Is(err, c.kind), "%q: %v", c.rule, err)
+	}
+}
+
+func TestPrefixList(t *testing.T) {
+	l, err := ParsePrefixList([]string{
+		"deny 10.0.0.0/8 ge 25",
+		"",
+		"permit 10.0.0.0/8 le 24",
+		"deny 0.0.0.0/0",
+		"permit 0.0.0.0/0 le 24",
+	})
+	assert.Nil(t, err)
+	for _, c := range []struct {
+		cidr   string
+		permit bool
+		rule   int
+	}{
+		{"10.1.2.128/25", false, 0},
+		{"10.1.2.0/24", true, 1},
+		{"10.0.0.0/8", true, 1},
+		{"0.0.0.0/0", false, 2},
+		{"192.0.2.0/24", true, 3},
+		{"192.0.2.0/25", false, -1},
+		{"2001:db8::/32", false, -1},
+	} {
+		permit, rule := l.Evaluate(parse(c.cidr))
+		assert.Equal(t, c.permit, permit, c.cidr)
+		assert.Equal(t, c.rule, rule, c.cidr)
+		assert.Equal(t, c.permit, l.Permits(parse(c.cidr)), c.cidr)
+	}
+	assert.Equal(t, "deny 10.0.0.0/8 ge 25\npermit 10.0.0.0/8 le 24\ndeny 0.0.0.0/0\npermit 0.0.0.0/0 le 24\n", l.String())
+
+	var empty PrefixList
+	assert.False(t, empty.Permits(parse("10.0.0.0/8")))
+	m, _ := ParsePrefixRule("10.0.0.0/8 le 32")
+	empty.Add(true, m)
+	assert.True(t, empty.Permits(parse("10.0.0.0/8")))
+	assert.False(t, empty.Permits(&net.IPNet{IP: net.IP{10, 0, 0, 1}, Mask: net.CIDRMask(8, 32)}))
+}
+
+func TestParsePrefixListErrors(t *testing.T) {
+	_, err := ParsePrefixList([]string{"permit 10.0.0.0/8", "allow 10.0.0.0/8"})
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	assert.Equal(t, "line 2: prefix list rule must start with permit or deny: \"allow 10.0.0.0/8\"", err.Error())
+
+	_, err = ParsePrefixList([]string{"permit 10.0.0.0/8 le 7"})
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	_, err = ParsePrefixList([]string{"deny"})
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
@@ -0,0 +1,105 @@
+package netaddr
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+)
+
+// randomPrefix returns a random prefix of the given address length within
+// the prefix within, which must be of the same length. It favors the edge
+// cases: the shortest and longest prefix lengths and the first and last
+// networks.
+func randomPrefix(r *rand.Rand, within ipPrefix) ipPrefix {
+	p := within
+	bits := p.bits()
+	switch r.Intn(8) {
+	case 0:
+	case 1:
+		p.ones = uint8(bits)
+	case 2:
+		p.ones = uint8(bits - r.Intn(2))
+	default:
+		p.ones += uint8(r.Intn(bits - int(within.ones) + 1))
+	}
+
+	var addr [16]byte
+	switch r.Intn(8) {
+	case 0:
+	case 1:
+		addr = [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	default:
+		r.Read(addr[:p.addrLen])
+	}
+	// Keep the network bits of within and take the rest from addr
+	free := ipPrefix{addrLen: within.addrLen, ones: within.ones}.hostBits(true)
+	for i := range p.addr {
+		p.addr[i] = within.addr[i] | addr[i]&free[i]
+	}
+	p.addr = p.hostBits(false)
+	return p
+}
+
+// randomFamilyPrefix returns a random IPv4 or IPv6 prefix, of either version
+// if family isn't 4 or 6
+func randomFamilyPrefix(r *rand.Rand, family int) ipPrefix {
+	if family != 4 && family != 6 {
+		family = []int{4, 6}[r.Intn(2)]
+	}
+	all := ipPrefix{addrLen: net.IPv4len}
+	if family == 6 {
+		all.addrLen = net.IPv6len
+	}
+	return randomPrefix(r, all)
+}
+
+// RandomIPNet returns a random network of the given IP version, 4 or 6, or
+// of either version for any other value. It favors the edge cases that
+// tests tend to miss, like /0, /32 and /128 and the networks at the start
+// and the end of the address space.
+func RandomIPNet(r *rand.Rand, family int) IPNet {
+	return IPNet{randomFamilyPrefix(r, family)}
+}
+
+// RandomIPSet returns a random set of up to maxBlocks networks of both IP
+// versions. Most of the networks of a version are drawn from within one
+// random network of 4096 or so addresses, though never all of it, so they
+// tend to overlap, adjoin and aggregate, like those of real sets. The rest
+// are like those of RandomIPNet.
+func RandomIPSet(r *rand.Rand, maxBlocks int) *IPSet {
+	set := &IPSet{}
+	if maxBlocks <= 0 {
+		return set
+	}
+	clusters := [2]ipPrefix{}
+	for i, family := range []int{4, 6} {
+		c := randomFamilyPrefix(r, family)
+		c.ones = uint8(c.bits() - 8 - r.Intn(8))
+		c.addr = c.hostBits(false)
+		clusters[i] = c
+	}
+	for n := r.Intn(maxBlocks + 1); n > 0; n-- {
+		if r.Intn(64) == 0 {
+			set.insertPrefix(randomFamilyPrefix(r, 0))
+			continue
+		}
+		c := clusters[r.Intn(2)]
+		p := randomPrefix(r, c)
+		for p.ones == c.ones {
+			p = randomPrefix(r, c)
+		}
+		set.insertPrefix(p)
+	}
+	return set
+}
+
+// Generate implements testing/quick.Generator with RandomIPNet
+func (IPNet) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(RandomIPNet(r, 0))
+}
+
+// Generate implements testing/quick.Generator with RandomIPSet, taking size
+// as the most networks to insert
+func (*IPSet) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(RandomIPSet(r, size))
+}
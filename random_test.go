@@ -0,0 +1,112 @@
+package netaddr
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomIPNet(t *testing.T) {
+	r := rand.New(rand.NewSource(487))
+	seen := map[string]bool{}
+	for i := 0; i < 2000; i++ {
+		n := RandomIPNet(r, 4)
+		assert.True(t, n.p.valid())
+		assert.Equal(t, net.IPv4len, len(n.NetworkAddr()))
+		_, err := IPNetFromNet(n.Net())
+		assert.Nil(t, err)
+		seen[n.String()] = true
+
+		n = RandomIPNet(r, 6)
+		assert.Equal(t, net.IPv6len, len(n.NetworkAddr()))
+		seen[n.String()] = true
+	}
+	for _, edge := range []string{"0.0.0.0/0", "::/0", "0.0.0.0/32", "255.255.255.255/32", "::/128", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"} {
+		assert.True(t, seen[edge], edge)
+	}
+
+	families := map[int]int{}
+	for i := 0; i < 100; i++ {
+		families[len(RandomIPNet(r, 0).NetworkAddr())]++
+	}
+	assert.True(t, families[net.IPv4len] > 25 && families[net.IPv6len] > 25, "%v", families)
+}
+
+func TestRandomIPSet(t *testing.T) {
+	r := rand.New(rand.NewSource(487))
+	assert.Equal(t, 0, len(RandomIPSet(r, 0).GetNetworks()))
+	for i := 0; i < 100; i++ {
+		set := RandomIPSet(r, 50)
+		assert.Nil(t, set.Validate())
+		assert.True(t, len(set.GetNetworks()) <= 50)
+	}
+}
+
+// The properties of the set operations, with sets from IPSet.Generate
+
+func equalSets(a, b *IPSet) bool {
+	return ExplainDifference(a, b) == ""
+}
+
+func TestIPSetUnionProperties(t *testing.T) {
+	commutative := func(a, b *IPSet) bool {
+		return equalSets(a.Union(b), b.Union(a))
+	}
+	assert.Nil(t, quick.Check(commutative, nil))
+
+	associative := func(a, b, c *IPSet) bool {
+		return equalSets(a.Union(b).Union(c), a.Union(b.Union(c)))
+	}
+	assert.Nil(t, quick.Check(associative, nil))
+
+	superset := func(a, b *IPSet) bool {
+		return equalSets(a.Union(b).Intersection(a), a)
+	}
+	assert.Nil(t, quick.Check(superset, nil))
+}
+
+func TestIPSetDifferenceProperties(t *testing.T) {
+	// (a - b) and (a ∩ b) split a
+	split := func(a, b *IPSet) bool {
+		difference, intersection := a.Difference(b), a.Intersection(b)
+		return equalSets(difference.Union(intersection), a) &&
+			len(difference.Intersection(intersection).GetNetworks()) == 0
+	}
+	assert.Nil(t, quick.Check(split, nil))
+
+	// a - (a - b) = a ∩ b
+	twice := func(a, b *IPSet) bool {
+		return equalSets(a.Difference(a.Difference(b)), a.Intersection(b))
+	}
+	assert.Nil(t, quick.Check(twice, nil))
+
+	disjoint := func(a, b *IPSet) bool {
+		return len(a.Difference(b).Intersection(b).GetNetworks()) == 0
+	}
+	assert.Nil(t, quick.Check(disjoint, nil))
+}
+
+func TestIPSetIntersectionProperties(t *testing.T) {
+	commutative := func(a, b *IPSet) bool {
+		return equalSets(a.Intersection(b), b.Intersection(a))
+	}
+	assert.Nil(t, quick.Check(commutative, nil))
+
+	sizes := func(a, b *IPSet) bool {
+		union := a.Union(b).tree.size()
+		sum := a.tree.size()
+		sum.Add(sum, b.tree.size())
+		return union.Add(union, a.Intersection(b).tree.size()).Cmp(sum) == 0
+	}
+	assert.Nil(t, quick.Check(sizes, nil))
+
+	within := func(a IPNet, b *IPSet) bool {
+		single := &IPSet{}
+		single.insertPrefix(a.p)
+		return b.CountWithin(a.Net()).Cmp(b.Intersection(single).tree.size()) == 0
+	}
+	assert.Nil(t, quick.Check(within, nil))
+}
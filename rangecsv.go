@@ -0,0 +1,198 @@
+package netaddr
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// WriteRangeCSV writes the IPs in the set to w as CSV records of the first
+// and last IPs of each range of consecutive IPs, in order by address.
+func (s *IPSet) WriteRangeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	write := func(first, last ipPrefix) {
+		cw.Write([]string{first.ip().String(), last.ip().String()})
+	}
+
+	var first, last ipPrefix
+	started := false
+	for node := s.root().first(); node != nil; node = node.next() {
+		p := node.prefix
+		p.ones = 8 * p.addrLen
+		if started && !adjacent(last, p) {
+			write(first, last)
+			started = false
+		}
+		if !started {
+			first, started = p, true
+		}
+		last = node.prefix.lastIP()
+	}
+	if started {
+		write(first, last)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// adjacent returns true if the host prefix q is the IP right after the host
+// prefix p
+func adjacent(p, q ipPrefix) bool {
+	if p.addrLen != q.addrLen {
+		return false
+	}
+	next := p.addr
+	for i := int(p.addrLen) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next == q.addr
+		}
+	}
+	return false
+}
+
+// ReadRangeCSV reads a set from CSV records, like those of geolocation and
+// reputation feeds, that each hold a range of IPs. The first and last IPs of
+// each range are in the columns of the given indexes and the other columns
+// are ignored. The ranges may overlap and be of both IP versions. It returns
+// an error, with its line number, for the first record that is malformed.
+func ReadRangeCSV(r io.Reader, ipCols [2]int) (*IPSet, error) {
+	set, errs := readRangeCSV(r, ipCols, false)
+	if len(errs) != 0 {
+		return nil, errs[0]
+	}
+	return set, nil
+}
+
+// ReadRangeCSVSkipErrors is like ReadRangeCSV except that it skips malformed
+// records, like a header, and returns an error for each one. It only stops
+// early if reading from r fails.
+func ReadRangeCSVSkipErrors(r io.Reader, ipCols [2]int) (*IPSet, []error) {
+	return readRangeCSV(r, ipCols, true)
+}
+
+// readRangeCSV reads the ranges from r and stops at the first error unless
+// skipErrors is true
+func readRangeCSV(r io.Reader, ipCols [2]int, skipErrors bool) (*IPSet, []error) {
+	if ipCols[0] < 0 || ipCols[1] < 0 {
+		return nil, []error{errorf(ErrInvalidArgument, "column indexes must not be negative: %v", ipCols)}
+	}
+	cr := &csvLineReader{r: bufio.NewReader(r)}
+
+	set := &IPSet{}
+	errs := []error{}
+	for {
+		record, line, err := cr.read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			errs = append(errs, wrapKind(ErrInvalidEncoding, err))
+			if !skipErrors {
+				return nil, errs
+			}
+			continue
+		}
+		if err != nil {
+			return nil, append(errs, err)
+		}
+
+		first, last, err := rangeFromRecord(record, ipCols)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			if !skipErrors {
+				return nil, errs
+			}
+			continue
+		}
+		for _, p := range rangePrefixes(first, last) {
+			set.insertPrefix(p)
+		}
+	}
+	return set, errs
+}
+
+// csvLineReader reads CSV records along with the number of the line that each
+// starts on
+type csvLineReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// read returns the next record and the number of its first line. A record
+// ends at the end of a line that isn't inside quotes. Blank lines are skipped.
+func (c *csvLineReader) read() ([]string, int, error) {
+	var text strings.Builder
+	start := 0
+	for {
+		chunk, err := c.r.ReadString('\n')
+		if chunk != "" {
+			c.line++
+		}
+		if text.Len() == 0 && strings.TrimRight(chunk, "\r\n") == "" {
+			if err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if text.Len() == 0 {
+			start = c.line
+		}
+		text.WriteString(chunk)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if strings.Count(text.String(), `"`)%2 == 0 {
+			break
+		}
+	}
+	record, err := csv.NewReader(strings.NewReader(text.String())).Read()
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		parseErr.StartLine += start - 1
+		parseErr.Line += start - 1
+	}
+	return record, start, err
+}
+
+// rangeFromRecord returns the first and last IPs of the range in the given
+// columns of a CSV record as host prefixes
+func rangeFromRecord(record []string, ipCols [2]int) (first, last ipPrefix, err error) {
+	var ips [2]net.IP
+	for i, col := range ipCols {
+		if col >= len(record) {
+			return first, last, errorf(ErrInvalidArgument, "record has %d columns, want at least %d", len(record), col+1)
+		}
+		ips[i] = ParseIP(record[col])
+		if ips[i] == nil {
+			return first, last, wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: record[col]})
+		}
+	}
+	return rangeBounds(ips[0], ips[1])
+}
+
+// rangeBounds returns the first and last IPs of a range as host prefixes. It
+// returns an error if either isn't an IP, they are of different IP versions
+// or the last is before the first.
+func rangeBounds(firstIP, lastIP net.IP) (first, last ipPrefix, err error) {
+	for _, ip := range []net.IP{firstIP, lastIP} {
+		if !validIPLen(ip) {
+			return first, last, errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+		}
+	}
+	first, last = prefixFromIP(firstIP), prefixFromIP(lastIP)
+	if first.addrLen != last.addrLen {
+		return first, last, errorf(ErrFamilyMismatch, "range from %s to %s mixes IP versions", firstIP, lastIP)
+	}
+	if first.compare(last) > 0 {
+		return first, last, errorf(ErrInvalidArgument, "range from %s to %s ends before it starts", firstIP, lastIP)
+	}
+	return first, last, nil
+}
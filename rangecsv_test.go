@@ -0,0 +1,113 @@
+package netaddr
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRangeCSV(t *testing.T) {
+	set := &IPSet{}
+	set.Insert(ParseIP("10.0.0.1"))
+	set.InsertNet(parse("10.0.0.2/31"))
+	set.InsertNet(parse("10.0.0.4/30"))
+	set.InsertNet(parse("10.0.1.0/24"))
+	set.InsertNet(parse("2001:db8::/126"))
+	set.Insert(ParseIP("2001:db8::4"))
+	set.Insert(ParseIP("255.255.255.255"))
+
+	var b bytes.Buffer
+	assert.Nil(t, set.WriteRangeCSV(&b))
+	assert.Equal(t, `10.0.0.1,10.0.0.7
+10.0.1.0,10.0.1.255
+255.255.255.255,255.255.255.255
+2001:db8::,2001:db8::4
+`, b.String())
+
+	b.Reset()
+	assert.Nil(t, (&IPSet{}).WriteRangeCSV(&b))
+	assert.Equal(t, "", b.String())
+
+	assert.NotNil(t, set.WriteRangeCSV(&failingWriter{}))
+}
+
+func TestReadRangeCSV(t *testing.T) {
+	csv := `1.0.0.0,1.0.0.255,AU,"Sydney, NSW"
+10.0.0.1,10.0.0.6,ZZ,
+"10.0.0.5","10.0.0.9",ZZ,
+2001:db8::,2001:db8::ffff:ffff,ZZ,x
+`
+	set, err := ReadRangeCSV(strings.NewReader(csv), [2]int{0, 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"1.0.0.0/24",
+		"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/31",
+		"2001:db8::/96",
+	}, set.String())
+	assert.Nil(t, set.Validate())
+
+	// Round trip
+	var b bytes.Buffer
+	assert.Nil(t, set.WriteRangeCSV(&b))
+	again, err := ReadRangeCSV(&b, [2]int{0, 1})
+	assert.Nil(t, err)
+	assert.Equal(t, set.String(), again.String())
+
+	// Columns in another order
+	set, err = ReadRangeCSV(strings.NewReader("a,10.0.0.255,b,10.0.0.0\n"), [2]int{3, 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/24"}, set.String())
+}
+
+func TestReadRangeCSVErrors(t *testing.T) {
+	tests := []struct {
+		csv  string
+		err  string
+		kind error
+	}{
+		{"start,end\n", `line 1: invalid IP address: start`, ErrInvalidIP},
+		{"10.0.0.0,10.0.0.1\n10.0.0.9,10.0.0.1\n", "line 2: range from 10.0.0.9 to 10.0.0.1 ends before it starts", ErrInvalidArgument},
+		{"10.0.0.0,::1\n", "line 1: range from 10.0.0.0 to ::1 mixes IP versions", ErrFamilyMismatch},
+		{"10.0.0.0\n", "line 1: record has 1 columns, want at least 2", ErrInvalidArgument},
+		{"10.0.0.0,\"10.0.0.1\n", "", ErrInvalidEncoding},
+	}
+	for _, test := range tests {
+		set, err := ReadRangeCSV(strings.NewReader(test.csv), [2]int{0, 1})
+		assert.Nil(t, set)
+		assert.True(t, errors.Is(err, test.kind), "%q: %v", test.csv, err)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err)
+		}
+	}
+
+	_, err := ReadRangeCSV(strings.NewReader(""), [2]int{-1, 1})
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+func TestReadRangeCSVSkipErrors(t *testing.T) {
+	csv := `start,end,country
+10.0.0.0,10.0.0.255,ZZ
+10.0.2.0,10.0.1.0,ZZ
+10.0.1.0,10.0.1.255,ZZ
+`
+	set, errs := ReadRangeCSVSkipErrors(strings.NewReader(csv), [2]int{0, 1})
+	assert.Equal(t, []string{"10.0.0.0/23"}, set.String())
+	assert.Equal(t, 2, len(errs))
+	assert.EqualError(t, errs[0], "line 1: invalid IP address: start")
+	assert.EqualError(t, errs[1], "line 3: range from 10.0.2.0 to 10.0.1.0 ends before it starts")
+}
+
+func TestReadRangeCSVLines(t *testing.T) {
+	text := "\n10.0.0.0,10.0.0.255,\"two\nlines\"\n\r\n10.0.2.0,10.0.1.0\n10.0.1.0,10.0.1.255\n10.0.3.0,\"10.0.3.1\n"
+	set, errs := ReadRangeCSVSkipErrors(strings.NewReader(text), [2]int{0, 1})
+	assert.Equal(t, []string{"10.0.0.0/23"}, set.String())
+	assert.Equal(t, 2, len(errs))
+	assert.EqualError(t, errs[0], "line 5: range from 10.0.2.0 to 10.0.1.0 ends before it starts")
+	var parseErr *csv.ParseError
+	assert.True(t, errors.As(errs[1], &parseErr))
+	assert.Equal(t, 7, parseErr.StartLine)
+}
@@ -0,0 +1,207 @@
+package netaddr
+
+import (
+	"net"
+)
+
+// RegistryEntry is an entry of the IANA IPv4 or IPv6 Special-Purpose Address
+// Registry. The flags are false where the registry has N/A.
+type RegistryEntry struct {
+	Net  *net.IPNet
+	Name string
+	RFC  string
+
+	// Source and Destination tell whether an address in the block is valid
+	// as the source or destination of a packet.
+	Source, Destination bool
+	// Forwardable tells whether a router may forward a packet with an address
+	// in the block as its destination.
+	Forwardable bool
+	// GloballyReachable tells whether a destination in the block is reachable
+	// beyond the network of the source.
+	GloballyReachable bool
+	// ReservedByProtocol tells whether the block is reserved by the protocol
+	// itself rather than assigned for a use.
+	ReservedByProtocol bool
+}
+
+// SpecialPurposeRegistry holds the entries of the IANA IPv4 and IPv6
+// Special-Purpose Address Registries, the IPv4 ones first. Blocks may nest
+// within each other. It is only meant to be read: changing it doesn't change
+// what SpecialPurpose and SpecialPurposeNet find.
+var SpecialPurposeRegistry = []*RegistryEntry{
+	{Net: registryNet("0.0.0.0/8"), Name: "\"This network\"", RFC: "RFC 791, Section 3.2", Source: true, ReservedByProtocol: true},
+	{Net: registryNet("0.0.0.0/32"), Name: "\"This host on this network\"", RFC: "RFC 1122, Section 3.2.1.3", Source: true, ReservedByProtocol: true},
+	{Net: registryNet("10.0.0.0/8"), Name: "Private-Use", RFC: "RFC 1918", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("100.64.0.0/10"), Name: "Shared Address Space", RFC: "RFC 6598", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("127.0.0.0/8"), Name: "Loopback", RFC: "RFC 1122, Section 3.2.1.3", ReservedByProtocol: true},
+	{Net: registryNet("169.254.0.0/16"), Name: "Link Local", RFC: "RFC 3927", Source: true, Destination: true, ReservedByProtocol: true},
+	{Net: registryNet("172.16.0.0/12"), Name: "Private-Use", RFC: "RFC 1918", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("192.0.0.0/24"), Name: "IETF Protocol Assignments", RFC: "RFC 6890, Section 2.1"},
+	{Net: registryNet("192.0.0.0/29"), Name: "IPv4 Service Continuity Prefix", RFC: "RFC 7335", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("192.0.0.8/32"), Name: "IPv4 dummy address", RFC: "RFC 7600", Source: true},
+	{Net: registryNet("192.0.0.9/32"), Name: "Port Control Protocol Anycast", RFC: "RFC 7723", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("192.0.0.10/32"), Name: "Traversal Using Relays around NAT Anycast", RFC: "RFC 8155", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("192.0.0.170/32"), Name: "NAT64/DNS64 Discovery", RFC: "RFC 8880, RFC 7050, Section 2.2", ReservedByProtocol: true},
+	{Net: registryNet("192.0.0.171/32"), Name: "NAT64/DNS64 Discovery", RFC: "RFC 8880, RFC 7050, Section 2.2", ReservedByProtocol: true},
+	{Net: registryNet("192.0.2.0/24"), Name: "Documentation (TEST-NET-1)", RFC: "RFC 5737"},
+	{Net: registryNet("192.31.196.0/24"), Name: "AS112-v4", RFC: "RFC 7535", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("192.52.193.0/24"), Name: "AMT", RFC: "RFC 7450", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("192.88.99.0/24"), Name: "Deprecated (6to4 Relay Anycast)", RFC: "RFC 7526"},
+	{Net: registryNet("192.168.0.0/16"), Name: "Private-Use", RFC: "RFC 1918", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("192.175.48.0/24"), Name: "Direct Delegation AS112 Service", RFC: "RFC 7534", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("198.18.0.0/15"), Name: "Benchmarking", RFC: "RFC 2544", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("198.51.100.0/24"), Name: "Documentation (TEST-NET-2)", RFC: "RFC 5737"},
+	{Net: registryNet("203.0.113.0/24"), Name: "Documentation (TEST-NET-3)", RFC: "RFC 5737"},
+	{Net: registryNet("240.0.0.0/4"), Name: "Reserved", RFC: "RFC 1112, Section 4", ReservedByProtocol: true},
+	{Net: registryNet("255.255.255.255/32"), Name: "Limited Broadcast", RFC: "RFC 8190, RFC 919, Section 7", Destination: true, ReservedByProtocol: true},
+
+	{Net: registryNet("::1/128"), Name: "Loopback Address", RFC: "RFC 4291", ReservedByProtocol: true},
+	{Net: registryNet("::/128"), Name: "Unspecified Address", RFC: "RFC 4291", Source: true, ReservedByProtocol: true},
+	{Net: registryNet("::ffff:0:0/96"), Name: "IPv4-mapped Address", RFC: "RFC 4291", ReservedByProtocol: true},
+	{Net: registryNet("64:ff9b::/96"), Name: "IPv4-IPv6 Translat.", RFC: "RFC 6052", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("64:ff9b:1::/48"), Name: "IPv4-IPv6 Translat.", RFC: "RFC 8215", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("100::/64"), Name: "Discard-Only Address Block", RFC: "RFC 6666", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("2001::/23"), Name: "IETF Protocol Assignments", RFC: "RFC 2928"},
+	{Net: registryNet("2001::/32"), Name: "TEREDO", RFC: "RFC 4380, RFC 8190", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("2001:1::1/128"), Name: "Port Control Protocol Anycast", RFC: "RFC 7723", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:1::2/128"), Name: "Traversal Using Relays around NAT Anycast", RFC: "RFC 8155", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:1::3/128"), Name: "DNS-SD Service Registration Protocol Anycast", RFC: "RFC 9665", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:2::/48"), Name: "Benchmarking", RFC: "RFC 5180, RFC Errata 1752", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("2001:3::/32"), Name: "AMT", RFC: "RFC 7450", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:4:112::/48"), Name: "AS112-v6", RFC: "RFC 7535", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:10::/28"), Name: "Deprecated (previously ORCHID)", RFC: "RFC 4843"},
+	{Net: registryNet("2001:20::/28"), Name: "ORCHIDv2", RFC: "RFC 7343", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:30::/28"), Name: "Drone Remote ID Protocol Entity Tags (DETs) Prefix", RFC: "RFC 9374", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("2001:db8::/32"), Name: "Documentation", RFC: "RFC 3849"},
+	{Net: registryNet("2002::/16"), Name: "6to4", RFC: "RFC 3056", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("2620:4f:8000::/48"), Name: "Direct Delegation AS112 Service", RFC: "RFC 7534", Source: true, Destination: true, Forwardable: true, GloballyReachable: true},
+	{Net: registryNet("3fff::/20"), Name: "Documentation", RFC: "RFC 9637"},
+	{Net: registryNet("5f00::/16"), Name: "Segment Routing (SRv6) SIDs", RFC: "RFC 9602", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("fc00::/7"), Name: "Unique-Local", RFC: "RFC 4193, RFC 8190", Source: true, Destination: true, Forwardable: true},
+	{Net: registryNet("fe80::/10"), Name: "Link-Local Unicast", RFC: "RFC 4291", Source: true, Destination: true, ReservedByProtocol: true},
+}
+
+// registryNet parses a network of the registry
+func registryNet(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// registryNode is a node of a binary trie of the registry entries. The
+// children of a node at depth d extend its prefix with a 0 or 1 bit at
+// position d.
+type registryNode struct {
+	children [2]*registryNode
+	entry    *RegistryEntry
+}
+
+// registryRoots holds the tries of the IPv4 and IPv6 registries. It is built
+// from a copy of the entries so that changes to SpecialPurposeRegistry don't
+// affect it.
+var registryRoots = buildRegistry(SpecialPurposeRegistry)
+
+// registryRoot returns the trie for the addresses of the given length
+func registryRoot(roots [2]*registryNode, addrLen uint8) *registryNode {
+	if addrLen == net.IPv4len {
+		return roots[0]
+	}
+	return roots[1]
+}
+
+// buildRegistry builds the tries of the given entries. The networks aren't
+// converted like prefixFromNet would so that ::ffff:0:0/96 stays IPv6.
+func buildRegistry(entries []*RegistryEntry) (roots [2]*registryNode) {
+	roots = [2]*registryNode{{}, {}}
+	for _, e := range entries {
+		e := *e
+		e.Net = &net.IPNet{
+			IP:   append(net.IP(nil), e.Net.IP...),
+			Mask: append(net.IPMask(nil), e.Net.Mask...),
+		}
+		ones, _ := e.Net.Mask.Size()
+		var addr [16]byte
+		addrLen := uint8(copy(addr[:], e.Net.IP))
+
+		node := registryRoot(roots, addrLen)
+		for i := 0; i < ones; i++ {
+			bit := registryBit(addr, i)
+			if node.children[bit] == nil {
+				node.children[bit] = &registryNode{}
+			}
+			node = node.children[bit]
+		}
+		node.entry = &e
+	}
+	return
+}
+
+// registryBit returns the bit of the address at position i
+func registryBit(addr [16]byte, i int) int {
+	return int(addr[i/8]>>(7-i%8)) & 1
+}
+
+// SpecialPurpose returns the most specific entry of the special-purpose
+// registries that covers the given IP and true, or false if none does. An
+// IPv4 address in the 16 byte form is looked up as IPv4. The entry must not
+// be modified.
+func SpecialPurpose(ip net.IP) (*RegistryEntry, bool) {
+	if !validIPLen(ip) {
+		return nil, false
+	}
+	p := prefixFromIP(ip)
+
+	var found *RegistryEntry
+	node := registryRoot(registryRoots, p.addrLen)
+	for i := 0; node != nil; i++ {
+		if node.entry != nil {
+			found = node.entry
+		}
+		if i == int(p.ones) {
+			break
+		}
+		node = node.children[registryBit(p.addr, i)]
+	}
+	return found, found != nil
+}
+
+// SpecialPurposeNet returns the entries of the special-purpose registries
+// that share any addresses with the given network and true, or false if
+// there are none. The network may straddle several entries and be within
+// others. The entries that contain it come first, from the least specific,
+// followed by the ones within it in order by address. A 16 byte network
+// within ::ffff:0:0/96 is looked up as IPv4. It returns false for a
+// malformed network. The entries must not be modified.
+func SpecialPurposeNet(n *net.IPNet) ([]*RegistryEntry, bool) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return nil, false
+	}
+
+	var found []*RegistryEntry
+	node := registryRoot(registryRoots, p.addrLen)
+	for i := 0; node != nil && i < int(p.ones); i++ {
+		if node.entry != nil {
+			found = append(found, node.entry)
+		}
+		node = node.children[registryBit(p.addr, i)]
+	}
+
+	// Everything in the subtree is within the network
+	stack := []*registryNode{node}
+	for len(stack) != 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		if node.entry != nil {
+			found = append(found, node.entry)
+		}
+		stack = append(stack, node.children[1], node.children[0])
+	}
+	return found, found != nil
+}
@@ -0,0 +1,125 @@
+package netaddr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// specialPurposeByScan finds the most specific entry that covers ip the slow
+// way
+func specialPurposeByScan(ip net.IP) *RegistryEntry {
+	var found *RegistryEntry
+	foundOnes := -1
+	for _, e := range SpecialPurposeRegistry {
+		if len(e.Net.IP) != len(ip) || !e.Net.Contains(ip) {
+			continue
+		}
+		if ones, _ := e.Net.Mask.Size(); ones > foundOnes {
+			found, foundOnes = e, ones
+		}
+	}
+	return found
+}
+
+func TestSpecialPurposeBoundaries(t *testing.T) {
+	for _, e := range SpecialPurposeRegistry {
+		// Addresses in the mapped block are looked up as IPv4
+		if e.Name == "IPv4-mapped Address" {
+			continue
+		}
+		first := e.Net.IP
+		last := prefixFromNet(e.Net).lastIP().ip()
+		before, _ := decrementIP(first)
+		after, _ := incrementIP(last)
+		for _, ip := range []net.IP{first, last, before, after} {
+			expected := specialPurposeByScan(ip)
+			found, ok := SpecialPurpose(ip)
+			assert.Equal(t, expected != nil, ok, "%s: %s", e.Net, ip)
+			assert.Equal(t, expected, found, "%s: %s", e.Net, ip)
+		}
+
+		// The ends of the entry itself find it or a more specific entry
+		// within it
+		for _, ip := range []net.IP{first, last} {
+			found, _ := SpecialPurpose(ip)
+			assert.True(t, ContainsNet(e.Net, found.Net), "%s: %s", e.Net, ip)
+		}
+	}
+}
+
+func TestSpecialPurpose(t *testing.T) {
+	e, ok := SpecialPurpose(net.ParseIP("192.168.1.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "Private-Use", e.Name)
+	assert.Equal(t, "RFC 1918", e.RFC)
+	assert.True(t, e.Forwardable)
+	assert.False(t, e.GloballyReachable)
+
+	// The most specific of nested entries
+	e, ok = SpecialPurpose(net.ParseIP("192.0.0.9"))
+	assert.True(t, ok)
+	assert.Equal(t, "Port Control Protocol Anycast", e.Name)
+	assert.True(t, e.GloballyReachable)
+	e, _ = SpecialPurpose(net.ParseIP("192.0.0.11"))
+	assert.Equal(t, "IETF Protocol Assignments", e.Name)
+	e, _ = SpecialPurpose(net.ParseIP("2001:1::1"))
+	assert.Equal(t, "Port Control Protocol Anycast", e.Name)
+	e, _ = SpecialPurpose(net.ParseIP("2001:1::4"))
+	assert.Equal(t, "IETF Protocol Assignments", e.Name)
+	e, _ = SpecialPurpose(net.ParseIP("2001::4"))
+	assert.Equal(t, "TEREDO", e.Name)
+
+	// Mapped addresses are IPv4
+	e, _ = SpecialPurpose(net.ParseIP("::ffff:127.0.0.1"))
+	assert.Equal(t, "Loopback", e.Name)
+	e, _ = SpecialPurpose(net.IP{127, 0, 0, 1})
+	assert.Equal(t, "Loopback", e.Name)
+
+	for _, ip := range []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("2606:4700::1"), nil, {1, 2, 3}} {
+		e, ok = SpecialPurpose(ip)
+		assert.False(t, ok, "%s", ip)
+		assert.Nil(t, e)
+	}
+}
+
+func TestSpecialPurposeNet(t *testing.T) {
+	names := func(entries []*RegistryEntry) (nets []string) {
+		for _, e := range entries {
+			nets = append(nets, e.Net.String())
+		}
+		return
+	}
+
+	// Within one entry
+	entries, ok := SpecialPurposeNet(parse("10.1.0.0/16"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"10.0.0.0/8"}, names(entries))
+
+	// Straddling entries, with those containing it first
+	entries, _ = SpecialPurposeNet(parse("192.0.0.0/16"))
+	assert.Equal(t, []string{"192.0.0.0/24", "192.0.0.0/29", "192.0.0.8/32", "192.0.0.9/32", "192.0.0.10/32", "192.0.0.170/32", "192.0.0.171/32", "192.0.2.0/24"}, names(entries))
+	entries, _ = SpecialPurposeNet(parse("192.0.0.8/30"))
+	assert.Equal(t, []string{"192.0.0.0/24", "192.0.0.8/32", "192.0.0.9/32", "192.0.0.10/32"}, names(entries))
+	entries, _ = SpecialPurposeNet(parse("2001::/16"))
+	assert.Equal(t, 12, len(entries))
+	assert.Equal(t, "2001::/23", entries[0].Net.String())
+
+	// The mapped block is only found from IPv6. Its network prints as
+	// 0.0.0.0/0.
+	entries, _ = SpecialPurposeNet(parse("::/64"))
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, []string{"::/128", "::1/128"}, names(entries[:2]))
+	assert.Equal(t, "IPv4-mapped Address", entries[2].Name)
+	entries, _ = SpecialPurposeNet(&net.IPNet{IP: net.ParseIP("127.0.0.0"), Mask: net.CIDRMask(104, 128)})
+	assert.Equal(t, []string{"127.0.0.0/8"}, names(entries))
+
+	entries, ok = SpecialPurposeNet(parse("8.8.8.0/24"))
+	assert.False(t, ok)
+	assert.Nil(t, entries)
+	_, ok = SpecialPurposeNet(nil)
+	assert.False(t, ok)
+	_, ok = SpecialPurposeNet(parse("10.0.0.1/8"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,152 @@
+package netaddr
+
+import (
+	"container/heap"
+	"math/big"
+)
+
+// AggregateWithSlack returns a set that covers the set with fewer networks by
+// including at most maxExtra IPs that aren't in it, and the set of those
+// extra IPs. A nil or negative maxExtra is the same as zero.
+//
+// It repeatedly replaces neighboring networks with the smallest network that
+// covers them, along with any others within it, picking the replacement that
+// adds the fewest extra IPs each time until the next one would exceed
+// maxExtra. This greedy choice doesn't always find the fewest networks
+// possible within the limit.
+func (s *IPSet) AggregateWithSlack(maxExtra *big.Int) (*IPSet, *IPSet) {
+	budget := big.NewInt(0)
+	if maxExtra != nil && maxExtra.Sign() > 0 {
+		budget.Set(maxExtra)
+	}
+
+	// Link the networks of the set into a list and queue the replacement of
+	// each neighboring pair.
+	var head, tail *slackNode
+	for node := s.root().first(); node != nil; node = node.next() {
+		n := &slackNode{prefix: node.prefix, prev: tail}
+		if tail != nil {
+			tail.next = n
+		} else {
+			head = n
+		}
+		tail = n
+	}
+	candidates := &slackHeap{}
+	for n := head; n != nil && n.next != nil; n = n.next {
+		candidates.push(n, n.next)
+	}
+
+	for candidates.Len() != 0 {
+		c := heap.Pop(candidates).(*slackCandidate)
+		if c.a.dead || c.b.dead {
+			continue
+		}
+		if c.extra.Cmp(budget) > 0 {
+			break
+		}
+		budget.Sub(budget, c.extra)
+
+		// Replace the networks within the covering one
+		first, last := c.a, c.b
+		for first.prev != nil && c.cover.contains(first.prev.prefix) {
+			first = first.prev
+		}
+		for last.next != nil && c.cover.contains(last.next.prefix) {
+			last = last.next
+		}
+		n := &slackNode{prefix: c.cover, prev: first.prev, next: last.next}
+		for old := first; old != n.next; old = old.next {
+			old.dead = true
+		}
+		if n.prev != nil {
+			n.prev.next = n
+			candidates.push(n.prev, n)
+		} else {
+			head = n
+		}
+		if n.next != nil {
+			n.next.prev = n
+			candidates.push(n, n.next)
+		}
+	}
+
+	result := &IPSet{}
+	for n := head; n != nil; n = n.next {
+		result.insertPrefix(n.prefix)
+	}
+	return result, result.Difference(s)
+}
+
+// slackNode is a network in the list that AggregateWithSlack works on
+type slackNode struct {
+	prefix     ipPrefix
+	prev, next *slackNode
+	dead       bool
+}
+
+// slackCandidate is the replacement of the neighboring networks a and b, and
+// any others within cover, by cover, which adds extra IPs. It no longer
+// applies once a or b has been replaced.
+type slackCandidate struct {
+	a, b  *slackNode
+	cover ipPrefix
+	extra *big.Int
+}
+
+// slackHeap is a priority queue of candidates, the one that adds the fewest
+// extra IPs first
+type slackHeap []*slackCandidate
+
+func (h slackHeap) Len() int { return len(h) }
+
+func (h slackHeap) Less(i, j int) bool {
+	if c := h[i].extra.Cmp(h[j].extra); c != 0 {
+		return c < 0
+	}
+	return h[i].cover.compare(h[j].cover) < 0
+}
+
+func (h slackHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *slackHeap) Push(x interface{}) { *h = append(*h, x.(*slackCandidate)) }
+
+func (h *slackHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// push queues the replacement of the neighboring networks a and b if they
+// are of the same IP version
+func (h *slackHeap) push(a, b *slackNode) {
+	if a.prefix.addrLen != b.prefix.addrLen {
+		return
+	}
+	cover := commonPrefix(a.prefix, b.prefix)
+	extra := cover.size()
+	for n := a; n != nil && cover.contains(n.prefix); n = n.prev {
+		extra.Sub(extra, n.prefix.size())
+	}
+	for n := b; n != nil && cover.contains(n.prefix); n = n.next {
+		extra.Sub(extra, n.prefix.size())
+	}
+	heap.Push(h, &slackCandidate{a: a, b: b, cover: cover, extra: extra})
+}
+
+// commonPrefix returns the smallest prefix that contains both p and q, which
+// must be of the same IP version
+func commonPrefix(p, q ipPrefix) ipPrefix {
+	ones := p.ones
+	if q.ones < ones {
+		ones = q.ones
+	}
+	var i uint8
+	for i < ones && p.addr[i/8]&(0x80>>(i%8)) == q.addr[i/8]&(0x80>>(i%8)) {
+		i++
+	}
+	p.ones = i
+	p.addr = p.hostBits(false)
+	return p
+}
@@ -0,0 +1,65 @@
+package netaddr
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkSlack checks the invariants of AggregateWithSlack
+func checkSlack(t *testing.T, s *IPSet, maxExtra int64) *IPSet {
+	result, extra := s.AggregateWithSlack(big.NewInt(maxExtra))
+	assert.Nil(t, result.Validate())
+	assert.Nil(t, s.Difference(result).tree, "result must contain the set")
+	assert.Equal(t, "", ExplainDifference(result.Difference(s), extra))
+	assert.True(t, extra.tree.size().Cmp(big.NewInt(maxExtra)) <= 0, "%s extra", extra.tree.size())
+	assert.True(t, result.tree.numNodes() <= s.tree.numNodes())
+	return result
+}
+
+func TestAggregateWithSlack(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/25"))
+	set.InsertNet(parse("10.0.0.128/26"))
+	set.InsertNet(parse("10.0.1.0/32"))
+	set.InsertNet(parse("10.0.1.2/32"))
+	set.InsertNet(parse("2001:db8::/127"))
+	set.InsertNet(parse("2001:db8::3/128"))
+
+	// Nothing fits
+	result, extra := set.AggregateWithSlack(big.NewInt(0))
+	assert.Equal(t, set.String(), result.String())
+	assert.Nil(t, extra.tree)
+	result, _ = set.AggregateWithSlack(nil)
+	assert.Equal(t, set.String(), result.String())
+
+	// The cheapest first
+	result = checkSlack(t, set, 1)
+	assert.Equal(t, []string{"10.0.0.0/25", "10.0.0.128/26", "10.0.1.0/32", "10.0.1.2/32", "2001:db8::/126"}, result.String())
+	result = checkSlack(t, set, 3)
+	assert.Equal(t, []string{"10.0.0.0/25", "10.0.0.128/26", "10.0.1.0/30", "2001:db8::/126"}, result.String())
+	result = checkSlack(t, set, 66)
+	assert.Equal(t, []string{"10.0.0.0/25", "10.0.0.128/26", "10.0.1.0/30", "2001:db8::/126"}, result.String())
+	result, extra = set.AggregateWithSlack(big.NewInt(67))
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.1.0/30", "2001:db8::/126"}, result.String())
+	assert.Equal(t, []string{"10.0.0.192/26", "10.0.1.1/32", "10.0.1.3/32", "2001:db8::2/128"}, extra.String())
+
+	// Everything within one network of each IP version
+	result = checkSlack(t, set, 1000)
+	assert.Equal(t, []string{"10.0.0.0/23", "2001:db8::/126"}, result.String())
+	result, extra = set.AggregateWithSlack(big.NewInt(-5))
+	assert.Equal(t, set.String(), result.String())
+	assert.Nil(t, extra.tree)
+}
+
+func TestAggregateWithSlackRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		set := randomSet(r, 500)
+		for _, maxExtra := range []int64{0, 1, 10, 1000, 100000, 1 << 40} {
+			checkSlack(t, set, maxExtra)
+		}
+	}
+}
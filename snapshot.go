@@ -0,0 +1,117 @@
+package netaddr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// fileMagic starts a file saved by IPSet.SaveFile, followed by a version
+var fileMagic = [4]byte{'I', 'P', 'S', 'T'}
+
+const fileVersion = 1
+
+// SaveFile writes the set to the file with the given path, replacing it
+// atomically, so that a reader or a crash never sees part of a file. It
+// writes a temporary file in the same directory, syncs it to disk and then
+// renames it to path. The file holds the magic "IPST", a version byte, the
+// networks of the set as IPNet.ToBytes encodes them, in order, and finally the
+// CRC-32 (IEEE) of all of that as 4 bytes, big endian. It is readable by
+// anyone, like a file made by os.WriteFile with the usual umask.
+func (s *IPSet) SaveFile(path string) (err error) {
+	data := append(fileMagic[:0:0], fileMagic[:]...)
+	data = append(data, fileVersion)
+	for node := s.root().first(); node != nil; node = node.next() {
+		data = node.prefix.appendBinary(data, true)
+	}
+	data = appendUint32(data, crc32.ChecksumIEEE(data))
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// Syncing the directory makes the rename durable. Not every system can
+	// open a directory for that, so it is done when possible.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// appendUint32 appends v to b as 4 big endian bytes
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// LoadIPSetFile reads a set saved by SaveFile. It returns an error matching
+// ErrCorruptFile if the file is cut short or doesn't match its checksum, in
+// which case the set should be rebuilt from where it came from, and one
+// matching ErrInvalidEncoding if it is of an unknown version or otherwise
+// malformed.
+func LoadIPSetFile(path string) (*IPSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(fileMagic)+1+crc32.Size || !bytes.Equal(data[:4], fileMagic[:]) {
+		return nil, errorf(ErrCorruptFile, "%s is not an IPSet file", path)
+	}
+	body := data[:len(data)-crc32.Size]
+	if sum := binary.BigEndian.Uint32(data[len(body):]); sum != crc32.ChecksumIEEE(body) {
+		return nil, errorf(ErrCorruptFile, "checksum of %s doesn't match", path)
+	}
+	if body[4] != fileVersion {
+		return nil, errorf(ErrInvalidEncoding, "unknown IPSet file version in %s: %d", path, body[4])
+	}
+
+	var nets []*net.IPNet
+	for body = body[5:]; len(body) != 0; {
+		size := 2
+		if len(body) >= 2 {
+			size += (int(body[1]) + 7) / 8
+		}
+		if size > len(body) {
+			size = len(body)
+		}
+		n, err := IPNetFromBytes(body[:size])
+		if err != nil {
+			return nil, wrapKind(ErrInvalidEncoding, err)
+		}
+		nets = append(nets, n.Net())
+		body = body[size:]
+	}
+	set, err := NewIPSetFromSorted(nets)
+	if err != nil {
+		return nil, wrapKind(ErrInvalidEncoding, err)
+	}
+	return set, nil
+}
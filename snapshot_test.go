@@ -0,0 +1,106 @@
+package netaddr
+
+import (
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tempDir makes a temporary directory and returns it with a function that
+// removes it
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "netaddr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestIPSetSaveFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "set")
+	set := randomSet(rand.New(rand.NewSource(481)), 1000)
+	set.InsertNet(parse("0.0.0.0/1"))
+	set.InsertNet(parse("::/0"))
+	assert.Nil(t, set.SaveFile(path))
+
+	loaded, err := LoadIPSetFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ExplainDifference(set, loaded))
+	assert.Nil(t, loaded.Validate())
+
+	// Saving again replaces the file and leaves no temporary file behind
+	empty := &IPSet{}
+	assert.Nil(t, empty.SaveFile(path))
+	loaded, err = LoadIPSetFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(loaded.GetNetworks()))
+	entries, _ := ioutil.ReadDir(filepath.Dir(path))
+	assert.Equal(t, 1, len(entries))
+
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	set = &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	set.InsertNet(parse("2001:db8::/32"))
+	assert.Nil(t, set.SaveFile(path))
+	data, _ := ioutil.ReadFile(path)
+	body := []byte{'I', 'P', 'S', 'T', 1, 4, 8, 10, 6, 32, 0x20, 0x01, 0x0d, 0xb8}
+	assert.Equal(t, appendUint32(body, crc32.ChecksumIEEE(body)), data)
+}
+
+func TestIPSetSaveFileErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	assert.NotNil(t, set.SaveFile(filepath.Join(dir, "missing", "set")))
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 0, len(entries))
+}
+
+func TestLoadIPSetFileErrors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "set")
+	set := &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	set.InsertNet(parse("2001:db8::/32"))
+	assert.Nil(t, set.SaveFile(path))
+	data, _ := ioutil.ReadFile(path)
+
+	_, err := LoadIPSetFile(filepath.Join(dir, "missing"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	load := func(data []byte) error {
+		ioutil.WriteFile(path, data, 0644)
+		_, err := LoadIPSetFile(path)
+		return err
+	}
+	corrupt := append([]byte{}, data...)
+	corrupt[6]++
+	assert.True(t, errors.Is(load(corrupt), ErrCorruptFile))
+	assert.True(t, errors.Is(load(data[:len(data)-1]), ErrCorruptFile))
+	assert.True(t, errors.Is(load(data[:6]), ErrCorruptFile))
+	assert.True(t, errors.Is(load(nil), ErrCorruptFile))
+	assert.True(t, errors.Is(load([]byte("10.0.0.0/8\n")), ErrCorruptFile))
+
+	// A checksum over a newer version or bad networks is not corruption
+	withSum := func(body ...byte) []byte {
+		return appendUint32(body, crc32.ChecksumIEEE(body))
+	}
+	err = load(withSum('I', 'P', 'S', 'T', 2))
+	assert.True(t, errors.Is(err, ErrInvalidEncoding))
+	assert.False(t, errors.Is(err, ErrCorruptFile))
+	assert.True(t, errors.Is(load(withSum('I', 'P', 'S', 'T', 1, 4, 8, 10, 4, 16, 10)), ErrInvalidEncoding))
+	assert.True(t, errors.Is(load(withSum('I', 'P', 'S', 'T', 1, 4, 16, 10, 1, 4, 8, 10)), ErrInvalidEncoding))
+	assert.True(t, errors.Is(load(withSum('I', 'P', 'S', 'T', 1, 4, 8, 10, 9, 0)), ErrInvalidEncoding))
+}
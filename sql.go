@@ -0,0 +1,109 @@
+package netaddr
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Value implements driver.Valuer. It stores the set as its aggregated
+// networks separated by commas, for example "10.0.0.0/8,192.168.0.0/16". A
+// nil set is stored as NULL.
+func (s *IPSet) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return strings.Join(s.String(), ","), nil
+}
+
+// Scan implements sql.Scanner. It accepts a string or []byte of networks
+// separated by commas, as written by Value, or a Postgres array literal like
+// "{10.0.0.0/8,192.168.0.0/16}" as returned for a cidr[] column. Each element
+// may be a CIDR or a bare IP address. NULL scans as the empty set. The set is
+// replaced only if every element parses.
+func (s *IPSet) Scan(src interface{}) error {
+	var str string
+	switch src := src.(type) {
+	case nil:
+	case string:
+		str = src
+	case []byte:
+		str = string(src)
+	default:
+		return errorf(ErrInvalidArgument, "cannot scan %T into IPSet", src)
+	}
+
+	elements, err := splitSQLSet(str)
+	if err != nil {
+		return err
+	}
+	nets := make([]*net.IPNet, 0, len(elements))
+	for i, e := range elements {
+		n, err := ParseNetOrIP(e)
+		if err != nil {
+			return fmt.Errorf("element %d (%q) of IPSet: %w", i, e, err)
+		}
+		nets = append(nets, n)
+	}
+
+	set := &IPSet{}
+	for _, n := range nets {
+		set.InsertNet(n)
+	}
+	s.replaceTree(set.tree)
+	return nil
+}
+
+// splitSQLSet splits the given string, either a list separated by commas or a
+// Postgres array literal, into its trimmed elements.
+func splitSQLSet(str string) ([]string, error) {
+	str = strings.TrimSpace(str)
+	if strings.HasPrefix(str, "{") {
+		if !strings.HasSuffix(str, "}") {
+			return nil, errorf(ErrInvalidCIDR, "unterminated array literal: %q", str)
+		}
+		str = strings.TrimSpace(str[1 : len(str)-1])
+	}
+	if str == "" {
+		return nil, nil
+	}
+
+	elements := strings.Split(str, ",")
+	for i, e := range elements {
+		e = strings.TrimSpace(e)
+		if len(e) >= 2 && e[0] == '"' && e[len(e)-1] == '"' {
+			e = e[1 : len(e)-1]
+		}
+		elements[i] = e
+	}
+	return elements, nil
+}
+
+// IPSetArray wraps an IPSet to store it as a Postgres array literal, for
+// example "{10.0.0.0/8,192.168.0.0/16}", suitable for a cidr[] column. It
+// scans the same formats as IPSet.
+type IPSetArray struct {
+	IPSet *IPSet
+}
+
+// Value implements driver.Valuer
+func (a IPSetArray) Value() (driver.Value, error) {
+	if a.IPSet == nil {
+		return nil, nil
+	}
+	return "{" + strings.Join(a.IPSet.String(), ",") + "}", nil
+}
+
+// Scan implements sql.Scanner. It creates the IPSet if needed.
+func (a *IPSetArray) Scan(src interface{}) error {
+	set := a.IPSet
+	if set == nil {
+		set = &IPSet{}
+	}
+	if err := set.Scan(src); err != nil {
+		return err
+	}
+	a.IPSet = set
+	return nil
+}
@@ -0,0 +1,110 @@
+package netaddr
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _ driver.Valuer = &IPSet{}
+var _ sql.Scanner = &IPSet{}
+var _ driver.Valuer = IPSetArray{}
+var _ sql.Scanner = &IPSetArray{}
+
+func TestIPSetValue(t *testing.T) {
+	var nilSet *IPSet
+	v, err := nilSet.Value()
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+
+	set := &IPSet{}
+	v, err = set.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "", v)
+
+	for _, s := range []string{"10.0.0.0/8", "2001:db8::/32", "192.168.0.1/32"} {
+		n, _ := ParseNet(s)
+		set.InsertNet(n)
+	}
+	v, err = set.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.0/8,192.168.0.1/32,2001:db8::/32", v)
+
+	v, err = IPSetArray{set}.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "{10.0.0.0/8,192.168.0.1/32,2001:db8::/32}", v)
+
+	v, err = IPSetArray{}.Value()
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
+
+func TestIPSetScan(t *testing.T) {
+	tests := []struct {
+		src      interface{}
+		expected []string
+	}{
+		{nil, nil},
+		{"", nil},
+		{"{}", nil},
+		{[]byte("10.0.0.0/8"), []string{"10.0.0.0/8"}},
+		// Postgres cidr[] output, both families
+		{"{10.0.0.0/8,192.168.0.0/16,2001:db8::/32}", []string{"10.0.0.0/8", "192.168.0.0/16", "2001:db8::/32"}},
+		{[]byte("{10.0.0.0/25,10.0.0.128/25}"), []string{"10.0.0.0/24"}},
+		// Postgres inet[] output omits the length of host addresses
+		{`{192.168.0.1,"2001:db8::1"}`, []string{"192.168.0.1/32", "2001:db8::1/128"}},
+		{" 10.0.0.0/8 , 192.168.0.1 ", []string{"10.0.0.0/8", "192.168.0.1/32"}},
+	}
+	for _, test := range tests {
+		set := &IPSet{}
+		set.Insert(ParseIP("172.16.0.1"))
+		assert.Nil(t, set.Scan(test.src), test.src)
+		assert.Equal(t, test.expected, set.String(), test.src)
+
+		array := &IPSetArray{}
+		assert.Nil(t, array.Scan(test.src), test.src)
+		assert.Equal(t, test.expected, array.IPSet.String(), test.src)
+	}
+}
+
+func TestIPSetScanRoundTrip(t *testing.T) {
+	set := &IPSet{}
+	for _, s := range []string{"10.0.0.0/8", "fd00::/8", "192.168.1.1/32"} {
+		n, _ := ParseNet(s)
+		set.InsertNet(n)
+	}
+
+	for _, valuer := range []driver.Valuer{set, IPSetArray{set}} {
+		v, err := valuer.Value()
+		assert.Nil(t, err)
+		scanned := &IPSet{}
+		assert.Nil(t, scanned.Scan(v))
+		assert.Equal(t, set.String(), scanned.String())
+	}
+}
+
+func TestIPSetScanErrors(t *testing.T) {
+	tests := []struct {
+		src     interface{}
+		message string
+	}{
+		{42, "cannot scan int into IPSet"},
+		{"{10.0.0.0/8", `unterminated array literal: "{10.0.0.0/8"`},
+		{"10.0.0.0/8,10.0.0.1/8", `element 1 ("10.0.0.1/8") of IPSet: Host part is not zero`},
+		{"{10.0.0.0/8,NULL}", `element 1 ("NULL") of IPSet: invalid IP address: NULL`},
+		{"10.0.0.0/8,", `element 1 ("") of IPSet: invalid IP address: `},
+	}
+	for _, test := range tests {
+		set := &IPSet{}
+		set.Insert(ParseIP("172.16.0.1"))
+		err := set.Scan(test.src)
+		assert.NotNil(t, err)
+		if err != nil {
+			assert.Equal(t, test.message, err.Error())
+		}
+		// The set is left alone on error
+		assert.Equal(t, []string{"172.16.0.1/32"}, set.String())
+	}
+}
@@ -0,0 +1,97 @@
+package netaddr
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseIPStrict parses an IP address for use at trust boundaries. It rejects
+// any form that other tools may read differently: IPv4 addresses, including
+// ones embedded in IPv6, must have exactly four decimal components from 0 to
+// 255 without leading zeros, and zones are not allowed. IPv4 addresses are
+// returned in the 4 byte form.
+func ParseIPStrict(s string) (net.IP, error) {
+	if err := checkStrictIP(s); err != nil {
+		return nil, err
+	}
+	ip := ParseIP(s)
+	if ip == nil {
+		return nil, wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: s})
+	}
+	return ip, nil
+}
+
+// ParseNetStrict parses a CIDR like ParseNet with the checks of
+// ParseIPStrict. The prefix length must be decimal without leading zeros.
+func ParseNetStrict(cidr string) (*net.IPNet, error) {
+	i := strings.IndexByte(cidr, '/')
+	if i < 0 {
+		return nil, wrapKind(ErrInvalidCIDR, &net.ParseError{Type: "CIDR address", Text: cidr})
+	}
+	if err := checkStrictIP(cidr[:i]); err != nil {
+		return nil, err
+	}
+	if !strictDecimal(cidr[i+1:], 128) {
+		return nil, errorf(ErrInvalidCIDR, "ambiguous prefix length in %q", cidr)
+	}
+	return ParseNet(cidr)
+}
+
+// ParseNetOrIPStrict parses a network like ParseNetOrIP with the checks of
+// ParseIPStrict.
+func ParseNetOrIPStrict(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		return ParseNetStrict(s)
+	}
+	ip, err := ParseIPStrict(s)
+	if err != nil {
+		return nil, err
+	}
+	return ipToNet(ip), nil
+}
+
+// checkStrictIP returns an error if the address has a zone or an IPv4 part
+// that isn't in the strict dotted decimal form.
+func checkStrictIP(s string) error {
+	if strings.Contains(s, "%") {
+		return errorf(ErrInvalidIP, "zone not allowed in %q", s)
+	}
+	// Only the last group of an IPv6 address may be dotted
+	v4 := s
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		v4 = s[i+1:]
+		if !strings.Contains(v4, ".") {
+			return nil
+		}
+	}
+
+	parts := strings.Split(v4, ".")
+	if len(parts) != 4 {
+		return errorf(ErrInvalidIP, "IPv4 address must have 4 components: %q", s)
+	}
+	for _, part := range parts {
+		if !strictDecimal(part, 255) {
+			return errorf(ErrInvalidIP, "ambiguous IPv4 component %q in %q", part, s)
+		}
+	}
+	return nil
+}
+
+// strictDecimal returns true if s is a decimal number no greater than max
+// without a sign or leading zeros.
+func strictDecimal(s string, max int) bool {
+	if s == "" || len(s) > 1 && s[0] == '0' {
+		return false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		n = 10*n + int(s[i]-'0')
+		if n > max {
+			return false
+		}
+	}
+	return true
+}
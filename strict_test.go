@@ -0,0 +1,87 @@
+package netaddr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPStrict(t *testing.T) {
+	for _, s := range []string{
+		"10.1.1.1",
+		"0.0.0.0",
+		"255.255.255.255",
+		"2001:db8::1",
+		"::ffff:10.1.1.1",
+		"::",
+	} {
+		ip, err := ParseIPStrict(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, ParseIP(s), ip, s)
+	}
+}
+
+func TestParseIPStrictAmbiguous(t *testing.T) {
+	for _, s := range []string{
+		"010.1.1.1",        // octal in inet_aton
+		"10.01.1.1",        // octal in inet_aton
+		"10.1.1.00",        // octal in inet_aton
+		"0x0a.1.1.1",       // hexadecimal in inet_aton
+		"0xa010101",        // a single hexadecimal number
+		"167837953",        // a single decimal number
+		"10.1.257",         // the last component fills 16 bits
+		"10.65793",         // the last component fills 24 bits
+		"10.1.1",           // too few components
+		"10.1.1.1.1",       // too many components
+		"10.1.1.256",       // out of range
+		"10.1.1.-1",        // signed
+		"10.1.1.+1",        // signed
+		"10..1.1",          // empty component
+		"10.1.1.1.",        // trailing dot
+		" 10.1.1.1",        // whitespace
+		"::ffff:010.1.1.1", // embedded in IPv6
+		"::ffff:10.1.1",    // embedded in IPv6
+		"fe80::1%eth0",     // zone
+		"",
+		"bogus",
+	} {
+		ip, err := ParseIPStrict(s)
+		assert.NotNil(t, err, s)
+		assert.Nil(t, ip, s)
+
+		n, err := ParseNetOrIPStrict(s)
+		assert.NotNil(t, err, s)
+		assert.Nil(t, n, s)
+	}
+}
+
+func TestParseNetStrict(t *testing.T) {
+	for _, s := range []string{"10.0.0.0/8", "0.0.0.0/0", "2001:db8::/32", "::ffff:10.0.0.0/104"} {
+		n, err := ParseNetStrict(s)
+		assert.Nil(t, err, s)
+		expected, _ := ParseNet(s)
+		assert.Equal(t, expected, n, s)
+
+		n, err = ParseNetOrIPStrict(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+
+	for _, s := range []string{
+		"010.0.0.0/8",
+		"10.0.0.0/08",
+		"10.0.0.0/+8",
+		"10.0.0.0/",
+		"10.0.0.0/33",
+		"10.0.0.0/129",
+		"10.0.0.1/8",
+		"10.0.0.0",
+		"10.0.0/24",
+		"fe80::%eth0/64",
+		"2001:db8::/032",
+	} {
+		n, err := ParseNetStrict(s)
+		assert.NotNil(t, err, s)
+		assert.Nil(t, n, s)
+	}
+}
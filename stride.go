@@ -0,0 +1,130 @@
+package netaddr
+
+import (
+	"math/big"
+	"net"
+)
+
+// addrToInt returns the address of the prefix as an integer
+func addrToInt(p ipPrefix) *big.Int {
+	return big.NewInt(0).SetBytes(p.addr[:p.addrLen])
+}
+
+// intToIP returns the given integer as an IP address with the given length
+// in bytes. The integer must fit.
+func intToIP(i *big.Int, addrLen uint8) net.IP {
+	ip := make(net.IP, addrLen)
+	b := i.Bytes()
+	copy(ip[len(ip)-len(b):], b)
+	return ip
+}
+
+// checkStride checks that there is a start address and that the stride is
+// positive
+func checkStride(start net.IP, stride *big.Int) error {
+	if start == nil {
+		return errorf(ErrInvalidIP, "start address is required")
+	}
+	if stride == nil || stride.Sign() <= 0 {
+		return errorf(ErrInvalidArgument, "stride must be positive: %v", stride)
+	}
+	return nil
+}
+
+// strideLimit returns the number of IPs to expand for the given limit when
+// there are remaining IPs from the start onward. Like GetIPs, it never
+// expands more than 2^30 of them, and a limit of 0, for all of them, is an
+// error if there are more than that.
+func strideLimit(limit int, remaining, stride *big.Int) (int, error) {
+	if limit < 0 {
+		return 0, errorf(ErrInvalidArgument, "limit must not be negative: %d", limit)
+	}
+	if limit > 1<<30 {
+		limit = 1 << 30
+	}
+	if limit != 0 {
+		return limit, nil
+	}
+	count := big.NewInt(0).Sub(remaining, big.NewInt(1))
+	count.Div(count, stride).Add(count, big.NewInt(1))
+	if count.Cmp(big.NewInt(1<<30)) > 0 {
+		return 0, errorf(ErrTooLarge, "%s IPs are too many to expand without a limit", count)
+	}
+	return int(count.Int64()), nil
+}
+
+// ExpandNetStride returns every stride'th IP in the given network, beginning
+// with start and up to the given limit. A limit of 0 returns them all, but
+// no more than 2^30. It returns an error if the stride isn't positive, start
+// is not in the network or there are too many IPs for a limit of 0.
+func ExpandNetStride(n *net.IPNet, start net.IP, stride *big.Int, limit int) ([]net.IP, error) {
+	if err := checkStride(start, stride); err != nil {
+		return nil, err
+	}
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return nil, err
+	}
+	sp := prefixFromIP(start)
+	if !p.contains(sp) {
+		return nil, errorf(ErrNotInNetwork, "start address %s is not in %s", start, n)
+	}
+
+	first, last := addrToInt(sp), addrToInt(p.lastIP())
+	remaining := big.NewInt(0).Sub(last, first)
+	limit, err = strideLimit(limit, remaining.Add(remaining, big.NewInt(1)), stride)
+	if err != nil {
+		return nil, err
+	}
+	ips := []net.IP{}
+	for i := first; i.Cmp(last) <= 0; i.Add(i, stride) {
+		if len(ips) == limit {
+			break
+		}
+		ips = append(ips, intToIP(i, p.addrLen))
+	}
+	return ips, nil
+}
+
+// ExpandStride returns every stride'th IP in the set, beginning with start
+// and up to the given limit. A limit of 0 returns them all, but no more than
+// 2^30. The IPs are counted in order across the networks in the set of the
+// IP version of start, so a stride larger than a network carries on into the
+// following ones of that version. It returns an error if the stride isn't positive, start is not in the set or
+// there are too many IPs for a limit of 0.
+func (s *IPSet) ExpandStride(start net.IP, stride *big.Int, limit int) ([]net.IP, error) {
+	if err := checkStride(start, stride); err != nil {
+		return nil, err
+	}
+	sp := prefixFromIP(start)
+	node := s.root().find(sp)
+	if node == nil {
+		return nil, errorf(ErrNotInNetwork, "start address %s is not in the set", start)
+	}
+
+	// offset is the position of the next IP relative to the start of node
+	offset := big.NewInt(0).Sub(addrToInt(sp), addrToInt(node.prefix))
+	remaining := big.NewInt(0).Neg(offset)
+	for n := node; n != nil && n.prefix.addrLen == sp.addrLen; n = n.next() {
+		remaining.Add(remaining, n.prefix.size())
+	}
+	limit, err := strideLimit(limit, remaining, stride)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := []net.IP{}
+	ip := big.NewInt(0)
+	for ; node != nil && node.prefix.addrLen == sp.addrLen; node = node.next() {
+		size := node.prefix.size()
+		base := addrToInt(node.prefix)
+		for ; offset.Cmp(size) < 0; offset.Add(offset, stride) {
+			if len(ips) == limit {
+				return ips, nil
+			}
+			ips = append(ips, intToIP(ip.Add(base, offset), node.prefix.addrLen))
+		}
+		offset.Sub(offset, size)
+	}
+	return ips, nil
+}
@@ -0,0 +1,168 @@
+package netaddr
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ipStrings(ips []net.IP) []string {
+	strs := []string{}
+	for _, ip := range ips {
+		strs = append(strs, ip.String())
+	}
+	return strs
+}
+
+func TestExpandNetStride(t *testing.T) {
+	n, _ := ParseNet("10.0.0.0/22")
+	ips, err := ExpandNetStride(n, ParseIP("10.0.0.1"), big.NewInt(256), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.1.1", "10.0.2.1", "10.0.3.1"}, ipStrings(ips))
+
+	ips, err = ExpandNetStride(n, ParseIP("10.0.0.1"), big.NewInt(256), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.1.1"}, ipStrings(ips))
+
+	ips, err = ExpandNetStride(n, ParseIP("10.0.3.255"), big.NewInt(1), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.3.255"}, ipStrings(ips))
+
+	// A stride larger than the network
+	ips, err = ExpandNetStride(n, ParseIP("10.0.0.0"), big.NewInt(1<<40), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0"}, ipStrings(ips))
+
+	n, _ = ParseNet("2001:db8::/32")
+	stride := big.NewInt(0).Lsh(big.NewInt(1), 80)
+	ips, err = ExpandNetStride(n, ParseIP("2001:db8::1"), stride, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::1", "2001:db8:1::1", "2001:db8:2::1"}, ipStrings(ips))
+}
+
+func TestExpandNetStrideErrors(t *testing.T) {
+	n, _ := ParseNet("10.0.0.0/24")
+	for _, test := range []struct {
+		start  net.IP
+		stride *big.Int
+	}{
+		{ParseIP("10.0.0.1"), big.NewInt(0)},
+		{ParseIP("10.0.0.1"), big.NewInt(-1)},
+		{ParseIP("10.0.0.1"), nil},
+		{ParseIP("10.0.1.0"), big.NewInt(1)},
+		{ParseIP("2001:db8::"), big.NewInt(1)},
+		{nil, big.NewInt(1)},
+	} {
+		ips, err := ExpandNetStride(n, test.start, test.stride, 0)
+		assert.NotNil(t, err)
+		assert.Nil(t, ips)
+
+		set := &IPSet{}
+		set.InsertNet(n)
+		ips, err = set.ExpandStride(test.start, test.stride, 0)
+		assert.NotNil(t, err)
+		assert.Nil(t, ips)
+	}
+}
+
+func TestIPSetExpandStride(t *testing.T) {
+	set := &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/30", "10.0.1.0/31", "10.0.2.0/29"} {
+		n, _ := ParseNet(cidr)
+		set.InsertNet(n)
+	}
+
+	ips, err := set.ExpandStride(ParseIP("10.0.0.1"), big.NewInt(3), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.1.0", "10.0.2.1", "10.0.2.4", "10.0.2.7"}, ipStrings(ips))
+
+	// Strides larger than a network skip across networks
+	ips, err = set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(7), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.2.1"}, ipStrings(ips))
+
+	ips, err = set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(100), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0"}, ipStrings(ips))
+
+	ips, err = set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(1), 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}, ipStrings(ips))
+
+	// A stride of one matches GetIPs
+	ips, err = set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(1), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, ipStrings(set.GetIPs(0)), ipStrings(ips))
+}
+
+func TestExpandStrideLimits(t *testing.T) {
+	// Expanding all of the IPs is only for up to 2^30 of them
+	n, _ := ParseNet("2001:db8::/64")
+	_, err := ExpandNetStride(n, ParseIP("2001:db8::"), big.NewInt(1), 0)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	ips, err := ExpandNetStride(n, ParseIP("2001:db8::"), big.NewInt(1), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::", "2001:db8::1", "2001:db8::2"}, ipStrings(ips))
+	stride := big.NewInt(0).Lsh(big.NewInt(1), 60)
+	ips, err = ExpandNetStride(n, ParseIP("2001:db8::"), stride, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, len(ips))
+	assert.Equal(t, "2001:db8:0:0:f000::", ips[15].String())
+
+	set := &IPSet{}
+	set.InsertNet(n)
+	_, err = set.ExpandStride(ParseIP("2001:db8::"), big.NewInt(1), 0)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	ips, err = set.ExpandStride(ParseIP("2001:db8::ffff:ffff:ffff:fffe"), big.NewInt(1), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::ffff:ffff:ffff:fffe", "2001:db8::ffff:ffff:ffff:ffff"}, ipStrings(ips))
+
+	_, err = ExpandNetStride(n, ParseIP("2001:db8::"), big.NewInt(1), -1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = set.ExpandStride(ParseIP("2001:db8::"), big.NewInt(1), -1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+
+	// A nil set has no IPs to start from
+	var nilSet *IPSet
+	ips, err = nilSet.ExpandStride(ParseIP("2001:db8::"), big.NewInt(1), 0)
+	assert.True(t, errors.Is(err, ErrNotInNetwork))
+	assert.Nil(t, ips)
+}
+
+func TestExpandStrideFamilies(t *testing.T) {
+	// The IPv4 networks don't carry on into the IPv6 ones
+	set := NewIPSet(parse("10.0.0.0/31"), parse("2001:db8::/127"))
+	ips, err := set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(1), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.1"}, ipStrings(ips))
+	ips, err = set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(1), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0", "10.0.0.1"}, ipStrings(ips))
+	ips, err = set.ExpandStride(ParseIP("2001:db8::"), big.NewInt(1), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2001:db8::", "2001:db8::1"}, ipStrings(ips))
+
+	// Nor does counting what remains
+	set.InsertNet(parse("2001:db8:1::/64"))
+	ips, err = set.ExpandStride(ParseIP("10.0.0.0"), big.NewInt(1), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ips))
+}
+
+func TestExpandNetStrideMalformed(t *testing.T) {
+	for _, n := range []*net.IPNet{
+		nil,
+		{IP: ParseIP("10.0.0.0"), Mask: net.IPMask{255, 0, 255, 0}},
+		{IP: ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)},
+		{IP: net.IP{10, 0, 0}, Mask: net.CIDRMask(24, 32)},
+	} {
+		ips, err := ExpandNetStride(n, ParseIP("10.0.0.1"), big.NewInt(1), 0)
+		assert.NotNil(t, err, "%v", n)
+		assert.Nil(t, ips)
+	}
+	_, err := ExpandNetStride(nil, ParseIP("10.0.0.1"), big.NewInt(1), 0)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
@@ -0,0 +1,102 @@
+package netaddr
+
+import (
+	"math/big"
+	"net"
+)
+
+// translateOffset returns the address at the given offset in to. It returns
+// an error if that is past the end of to.
+func translateOffset(offset *big.Int, to ipPrefix) (ipPrefix, error) {
+	if offset.Cmp(to.size()) >= 0 {
+		return ipPrefix{}, errorf(ErrNotInNetwork, "offset %s is past the end of %s", offset, to)
+	}
+	return hostPrefixFromInt(offset.Add(offset, addrToInt(to)), to.addrLen), nil
+}
+
+// checkTranslation checks the networks of a translation from one to the
+// other and converts them
+func checkTranslation(from, to *net.IPNet, crossFamily bool) (ipPrefix, ipPrefix, error) {
+	f, err := checkedPrefixFromNet(from)
+	if err != nil {
+		return ipPrefix{}, ipPrefix{}, err
+	}
+	t, err := checkedPrefixFromNet(to)
+	if err != nil {
+		return ipPrefix{}, ipPrefix{}, err
+	}
+	if f.addrLen != t.addrLen && !crossFamily {
+		return ipPrefix{}, ipPrefix{}, errorf(ErrFamilyMismatch, "cannot translate from %s to %s of another IP version", f, t)
+	}
+	return f, t, nil
+}
+
+// TranslateIP returns the IP at the same offset in the network to as the
+// given IP is in the network from, such as 192.168.50.77 for 10.1.2.77 from
+// 10.1.2.0/24 to 192.168.50.0/24, as for renumbering or 1:1 NAT. The IP must
+// be in from, and to must be large enough to have an IP at its offset. The
+// networks must be of the same IP version unless crossFamily is true, which
+// allows offsets to carry over from IPv4 to IPv6, like into a /96, or the
+// other way. The result is of the IP version of to, and IPv4 addresses are
+// in the 4 byte form.
+func TranslateIP(ip net.IP, from, to *net.IPNet, crossFamily bool) (net.IP, error) {
+	if !validIPLen(ip) {
+		return nil, errorf(ErrInvalidIP, "invalid IP address length: %d", len(ip))
+	}
+	f, t, err := checkTranslation(from, to, crossFamily)
+	if err != nil {
+		return nil, err
+	}
+	host := prefixFromIP(ip)
+	if !f.contains(host) {
+		return nil, errorf(ErrNotInNetwork, "%s is not in %s", ip, f)
+	}
+	offset := addrToInt(host)
+	translated, err := translateOffset(offset.Sub(offset, addrToInt(f)), t)
+	if err != nil {
+		return nil, err
+	}
+	return translated.ip(), nil
+}
+
+// TranslatePrefix returns a new set with the networks of this one that are
+// in the network from moved to the same place in the network to, keeping
+// their sizes and their offsets, such as 10.96.5.0/24 to 10.224.5.0/24 from
+// 10.96.0.0/12 to 10.224.0.0/12. The two networks must be of the same IP
+// version and prefix length. A network of the set that contains from is
+// split, so that only the part of it in from moves. The networks outside of
+// from stay where they are, or are left out if dropOutside is true. Any of
+// those already in to are merged with the ones that move there.
+func (s *IPSet) TranslatePrefix(from, to *net.IPNet, dropOutside bool) (*IPSet, error) {
+	f, t, err := checkTranslation(from, to, false)
+	if err != nil {
+		return nil, err
+	}
+	if f.ones != t.ones {
+		return nil, errorf(ErrInvalidArgument, "cannot translate from %s to %s of another prefix length", f, t)
+	}
+
+	// The host bits of from, which carry over to to
+	hosts := ipPrefix{addrLen: f.addrLen, ones: f.ones}.hostBits(true)
+	translated := &IPSet{}
+	for node := s.root().first(); node != nil; node = node.next() {
+		p := node.prefix
+		switch {
+		case f.contains(p):
+			for i := range p.addr {
+				p.addr[i] = t.addr[i] | p.addr[i]&hosts[i]
+			}
+			translated.insertPrefix(p)
+		case p.contains(f):
+			translated.insertPrefix(t)
+			if !dropOutside {
+				for _, q := range p.difference(f) {
+					translated.insertPrefix(q)
+				}
+			}
+		case !dropOutside:
+			translated.insertPrefix(p)
+		}
+	}
+	return translated, nil
+}
@@ -0,0 +1,116 @@
+package netaddr
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateIP(t *testing.T) {
+	for _, c := range []struct {
+		ip, from, to string
+		crossFamily  bool
+		expected     string
+	}{
+		{"10.1.2.77", "10.1.2.0/24", "192.168.50.0/24", false, "192.168.50.77"},
+		{"10.1.2.0", "10.1.2.0/24", "192.168.50.0/24", false, "192.168.50.0"},
+		{"10.1.2.255", "10.1.2.0/24", "192.168.50.0/24", false, "192.168.50.255"},
+		{"10.1.2.77", "10.1.2.0/24", "172.16.0.0/12", false, "172.16.0.77"},
+		{"10.1.2.77", "10.1.2.64/26", "192.168.50.0/28", false, "192.168.50.13"},
+		{"10.1.2.77", "10.0.0.0/8", "11.0.0.0/8", false, "11.1.2.77"},
+		{"2001:db8::1:2", "2001:db8::/64", "2001:db8:1::/64", false, "2001:db8:1::1:2"},
+		{"10.1.2.77", "10.0.0.0/8", "64:ff9b::/96", true, "64:ff9b::1:24d"},
+		{"10.1.2.77", "10.1.2.0/24", "2001:db8::/120", true, "2001:db8::4d"},
+		{"2001:db8::4d", "2001:db8::/120", "10.1.2.0/24", true, "10.1.2.77"},
+		{"10.1.2.77", "10.1.2.0/24", "10.1.3.0/24", true, "10.1.3.77"},
+	} {
+		ip, err := TranslateIP(ParseIP(c.ip), parse(c.from), parse(c.to), c.crossFamily)
+		assert.Nil(t, err, c.ip)
+		assert.Equal(t, c.expected, ip.String(), c.ip)
+	}
+
+	// IPv4 in the 16 byte form is translated like IPv4
+	ip, err := TranslateIP(net.ParseIP("10.1.2.77"), parse("10.1.2.0/24"), parse("192.168.50.0/24"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, net.IP{192, 168, 50, 77}, ip)
+}
+
+func TestTranslateIPErrors(t *testing.T) {
+	for _, c := range []struct {
+		ip, from, to string
+		crossFamily  bool
+		kind         error
+	}{
+		{"10.1.3.1", "10.1.2.0/24", "192.168.50.0/24", false, ErrNotInNetwork},
+		{"10.1.2.77", "10.1.2.0/24", "192.168.50.0/26", false, ErrNotInNetwork},
+		{"10.1.2.77", "10.1.2.0/24", "2001:db8::/96", false, ErrFamilyMismatch},
+		{"2001:db8::100:0", "2001:db8::/64", "10.0.0.0/8", true, ErrNotInNetwork},
+		{"2001:db8::ff:ffff", "2001:db8::/64", "10.0.0.0/7", false, ErrFamilyMismatch},
+		{"2001:db8::1", "10.0.0.0/8", "10.0.0.0/8", false, ErrNotInNetwork},
+	} {
+		_, err := TranslateIP(ParseIP(c.ip), parse(c.from), parse(c.to), c.crossFamily)
+		assert.True(t, errors.Is(err, c.kind), "%s: %v", c.ip, err)
+	}
+
+	_, err := TranslateIP(net.IP{1, 2, 3}, parse("10.0.0.0/8"), parse("11.0.0.0/8"), false)
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+	_, err = TranslateIP(ParseIP("10.0.0.1"), nil, parse("11.0.0.0/8"), false)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+	_, err = TranslateIP(ParseIP("10.0.0.1"), parse("10.0.0.0/8"), &net.IPNet{IP: net.IP{11, 0, 0, 1}, Mask: net.CIDRMask(8, 32)}, false)
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+}
+
+func TestIPSetTranslatePrefix(t *testing.T) {
+	set := &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/16", "10.96.5.0/24", "10.97.0.0/16", "10.111.255.255/32", "2001:db8::/32"} {
+		set.InsertNet(parse(cidr))
+	}
+	from, to := parse("10.96.0.0/12"), parse("10.224.0.0/12")
+
+	translated, err := set.TranslatePrefix(from, to, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/16", "10.224.5.0/24", "10.225.0.0/16", "10.239.255.255/32", "2001:db8::/32"},
+		translated.String())
+	assert.Equal(t, set.tree.size(), translated.tree.size())
+	assert.Equal(t, 5, len(set.String()))
+
+	translated, err = set.TranslatePrefix(from, to, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.224.5.0/24", "10.225.0.0/16", "10.239.255.255/32"}, translated.String())
+
+	// A network that contains from is split
+	set = &IPSet{}
+	set.InsertNet(parse("10.0.0.0/8"))
+	translated, err = set.TranslatePrefix(from, to, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/10", "10.64.0.0/11", "10.112.0.0/12", "10.128.0.0/9"}, translated.String())
+	translated, err = set.TranslatePrefix(from, to, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.224.0.0/12"}, translated.String())
+
+	// What moves merges with what is already there
+	set = &IPSet{}
+	set.InsertNet(parse("10.96.0.0/13"))
+	set.InsertNet(parse("10.232.0.0/13"))
+	translated, err = set.TranslatePrefix(from, to, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.224.0.0/12"}, translated.String())
+	assert.Nil(t, translated.Validate())
+
+	translated, err = set.TranslatePrefix(parse("2001:db8::/32"), parse("2001:db9::/32"), false)
+	assert.Nil(t, err)
+	assert.Equal(t, set.String(), translated.String())
+}
+
+func TestIPSetTranslatePrefixErrors(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(parse("10.96.0.0/16"))
+	_, err := set.TranslatePrefix(parse("10.96.0.0/12"), parse("10.224.0.0/11"), false)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = set.TranslatePrefix(parse("10.96.0.0/12"), parse("2000::/12"), false)
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, err = set.TranslatePrefix(nil, parse("10.224.0.0/12"), false)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+}
@@ -0,0 +1,114 @@
+package netaddr
+
+import (
+	"math/big"
+	"net"
+)
+
+// IPSetView is the part of an IPSet of one IP version. It reads the set it
+// comes from, without a copy, so it always reflects the current contents of
+// the set. Like the set, it isn't safe to use while the set is changing.
+type IPSetView struct {
+	set     *IPSet
+	addrLen uint8
+}
+
+// V4 returns a view of the IPv4 part of the set
+func (s *IPSet) V4() IPSetView {
+	return IPSetView{set: s, addrLen: net.IPv4len}
+}
+
+// V6 returns a view of the IPv6 part of the set
+func (s *IPSet) V6() IPSetView {
+	return IPSetView{set: s, addrLen: net.IPv6len}
+}
+
+// Family returns the IP version of the view, 4 or 6
+func (v IPSetView) Family() int {
+	return ipPrefix{addrLen: v.addrLen}.family()
+}
+
+// first returns the first node of the view's version in the set or nil if
+// there are none. The IPv4 networks come before all of the IPv6 ones.
+func (v IPSetView) first() *ipTree {
+	if v.set == nil {
+		return nil
+	}
+	node := v.set.tree.lowerBound(ipPrefix{addrLen: v.addrLen})
+	if node == nil || node.prefix.addrLen != v.addrLen {
+		return nil
+	}
+	return node
+}
+
+// last returns the last node of the view's version in the set or nil if
+// there are none
+func (v IPSetView) last() *ipTree {
+	if v.first() == nil {
+		return nil
+	}
+	if v.addrLen == net.IPv4len {
+		if node := v.set.tree.lowerBound(ipPrefix{addrLen: net.IPv6len}); node != nil {
+			return node.prev()
+		}
+	}
+	return v.set.tree.last()
+}
+
+// Span returns the smallest network that contains all of the networks of the
+// view's version in the set, or nil if there are none
+func (v IPSetView) Span() *net.IPNet {
+	first, last := v.first(), v.last()
+	if first == nil {
+		return nil
+	}
+	return commonPrefix(first.prefix, last.prefix).toNet()
+}
+
+// Span returns the smallest IPv4 network and the smallest IPv6 network that
+// contain all of the networks of the set of each version. Either is nil if
+// the set has no IPs of that version. Any IP of the set is in one of them,
+// so they can rule out IPs quickly, though they may hold many IPs that
+// aren't in the set.
+func (s *IPSet) Span() (v4, v6 *net.IPNet) {
+	return s.V4().Span(), s.V6().Span()
+}
+
+// Contains returns true if the given IP is of the view's version and in the
+// set
+func (v IPSetView) Contains(ip net.IP) bool {
+	if !validIPLen(ip) || prefixFromIP(ip).addrLen != v.addrLen {
+		return false
+	}
+	return v.set.Contains(ip)
+}
+
+// ContainsNet returns true if the given network is of the view's version and
+// all of its IPs are in the set. It returns false for a nil or malformed
+// network.
+func (v IPSetView) ContainsNet(n *net.IPNet) bool {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil || p.addrLen != v.addrLen || v.set == nil {
+		return false
+	}
+	return v.set.tree.contains(p)
+}
+
+// Size returns the number of IPs of the view's version in the set
+func (v IPSetView) Size() *big.Int {
+	size := big.NewInt(0)
+	for node := v.first(); node != nil && node.prefix.addrLen == v.addrLen; node = node.next() {
+		size.Add(size, node.prefix.size())
+	}
+	return size
+}
+
+// Walk calls fn with each network of the view's version in the set, in the
+// order of GetNetworks, until it returns false
+func (v IPSetView) Walk(fn func(*net.IPNet) bool) {
+	for node := v.first(); node != nil && node.prefix.addrLen == v.addrLen; node = node.next() {
+		if !fn(node.prefix.toNet()) {
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package netaddr
+
+import (
+	"math/big"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func viewNets(v IPSetView) []string {
+	nets := []string{}
+	v.Walk(func(n *net.IPNet) bool {
+		nets = append(nets, n.String())
+		return true
+	})
+	return nets
+}
+
+func TestIPSetView(t *testing.T) {
+	set := &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/24", "192.0.2.0/31", "2001:db8::/64", "::/127"} {
+		set.InsertNet(parse(cidr))
+	}
+	v4, v6 := set.V4(), set.V6()
+	assert.Equal(t, 4, v4.Family())
+	assert.Equal(t, 6, v6.Family())
+
+	assert.Equal(t, []string{"10.0.0.0/24", "192.0.2.0/31"}, viewNets(v4))
+	assert.Equal(t, []string{"::/127", "2001:db8::/64"}, viewNets(v6))
+	assert.Equal(t, big.NewInt(258), v4.Size())
+	assert.Equal(t, "18446744073709551618", v6.Size().String())
+
+	assert.True(t, v4.Contains(ParseIP("10.0.0.7")))
+	assert.True(t, v4.Contains(net.ParseIP("10.0.0.7")))
+	assert.False(t, v6.Contains(ParseIP("10.0.0.7")))
+	assert.False(t, v6.Contains(net.ParseIP("10.0.0.7")))
+	assert.True(t, v6.Contains(ParseIP("2001:db8::7")))
+	assert.False(t, v4.Contains(ParseIP("2001:db8::7")))
+	assert.False(t, v4.Contains(net.IP{1, 2, 3}))
+
+	assert.True(t, v4.ContainsNet(parse("10.0.0.128/25")))
+	assert.False(t, v6.ContainsNet(parse("10.0.0.128/25")))
+	assert.True(t, v6.ContainsNet(parse("2001:db8::/96")))
+	assert.False(t, v4.ContainsNet(parse("2001:db8::/96")))
+	assert.False(t, v4.ContainsNet(nil))
+
+	var stopped []string
+	v4.Walk(func(n *net.IPNet) bool {
+		stopped = append(stopped, n.String())
+		return false
+	})
+	assert.Equal(t, []string{"10.0.0.0/24"}, stopped)
+}
+
+func TestIPSetViewFollowsSet(t *testing.T) {
+	set := &IPSet{}
+	v4, v6 := set.V4(), set.V6()
+	assert.Equal(t, []string{}, viewNets(v4))
+	assert.Equal(t, big.NewInt(0), v6.Size())
+
+	set.Insert(ParseIP("2001:db8::1"))
+	assert.Equal(t, []string{}, viewNets(v4))
+	assert.Equal(t, []string{"2001:db8::1/128"}, viewNets(v6))
+
+	set.Insert(ParseIP("10.0.0.1"))
+	assert.Equal(t, []string{"10.0.0.1/32"}, viewNets(v4))
+	assert.True(t, v4.Contains(ParseIP("10.0.0.1")))
+
+	set.Remove(ParseIP("2001:db8::1"))
+	assert.Equal(t, []string{}, viewNets(v6))
+	assert.Equal(t, big.NewInt(1), v4.Size())
+
+	var none *IPSet
+	assert.False(t, none.V4().Contains(ParseIP("10.0.0.1")))
+	assert.False(t, none.V6().ContainsNet(parse("::/0")))
+	assert.Equal(t, big.NewInt(0), none.V4().Size())
+	assert.Equal(t, []string{}, viewNets(none.V6()))
+}
+
+func TestIPSetSpan(t *testing.T) {
+	set := &IPSet{}
+	v4, v6 := set.Span()
+	assert.Nil(t, v4)
+	assert.Nil(t, v6)
+
+	set.InsertNet(parse("10.0.0.0/24"))
+	v4, v6 = set.Span()
+	assert.Equal(t, "10.0.0.0/24", v4.String())
+	assert.Nil(t, v6)
+
+	set.InsertNet(parse("10.0.3.7/32"))
+	set.InsertNet(parse("2001:db8::/64"))
+	v4, v6 = set.Span()
+	assert.Equal(t, "10.0.0.0/22", v4.String())
+	assert.Equal(t, "2001:db8::/64", v6.String())
+
+	set.InsertNet(parse("2001:db8:0:1::1/128"))
+	set.InsertNet(parse("128.0.0.0/32"))
+	v4, v6 = set.Span()
+	assert.Equal(t, "0.0.0.0/0", v4.String())
+	assert.Equal(t, "2001:db8::/63", v6.String())
+	assert.Equal(t, v6.String(), set.V6().Span().String())
+
+	set.RemoveNet(parse("0.0.0.0/0"))
+	v4, v6 = set.Span()
+	assert.Nil(t, v4)
+	assert.Equal(t, "2001:db8::/63", v6.String())
+}
+
+func TestIPSetSpanRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(482))
+	for i := 0; i < 200; i++ {
+		set := randomSet(r, 1+r.Intn(50))
+		for _, v := range []IPSetView{set.V4(), set.V6()} {
+			span := v.Span()
+			if v.first() == nil {
+				assert.Nil(t, span)
+				continue
+			}
+			p := prefixFromNet(span)
+			v.Walk(func(n *net.IPNet) bool {
+				assert.True(t, p.contains(prefixFromNet(n)), "%s in %s", n, span)
+				return true
+			})
+
+			// Neither half of the span holds all of the networks
+			if p.ones < 8*p.addrLen {
+				a, b := p.halves()
+				assert.False(t, a.contains(v.first().prefix) && a.contains(v.last().prefix), span.String())
+				assert.False(t, b.contains(v.first().prefix) && b.contains(v.last().prefix), span.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package netaddr
+
+import (
+	"math/big"
+	"net"
+)
+
+// WildcardMatcher matches IPs against an address and a wildcard mask, like a
+// Cisco ACL entry such as "10.0.0.0 0.0.254.255". A bit set in the wildcard
+// means that bit of an IP doesn't matter. Unlike a network mask, the set bits
+// need not be contiguous.
+type WildcardMatcher struct {
+	addr, wildcard net.IP
+}
+
+// ParseWildcardMatcher parses the address and wildcard mask of a matcher.
+// Both must be of the same IP version. Bits of the address that the wildcard
+// ignores are cleared, as routers do.
+func ParseWildcardMatcher(addr, wildcard string) (*WildcardMatcher, error) {
+	a := ParseIP(addr)
+	if a == nil {
+		return nil, wrapKind(ErrInvalidIP, &net.ParseError{Type: "IP address", Text: addr})
+	}
+	w := ParseIP(wildcard)
+	if w == nil {
+		return nil, wrapKind(ErrInvalidMask, &net.ParseError{Type: "wildcard mask", Text: wildcard})
+	}
+	if a4, w4 := a.To4(), w.To4(); a4 != nil && w4 != nil {
+		a, w = a4, w4
+	} else if a4 != nil || w4 != nil {
+		return nil, errorf(ErrFamilyMismatch, "address %s and wildcard %s are of different IP versions", addr, wildcard)
+	}
+
+	m := &WildcardMatcher{addr: make(net.IP, len(a)), wildcard: w}
+	for i := range a {
+		m.addr[i] = a[i] &^ w[i]
+	}
+	return m, nil
+}
+
+// String returns the address and the wildcard mask separated by a space
+func (m *WildcardMatcher) String() string {
+	return m.addr.String() + " " + m.wildcard.String()
+}
+
+// Match returns true if the given IP matches the address in all of the bits
+// that the wildcard doesn't ignore. An IP of the other version never matches.
+func (m *WildcardMatcher) Match(ip net.IP) bool {
+	if len(m.addr) == net.IPv4len {
+		ip = ip.To4()
+	} else if ip.To4() != nil {
+		return false
+	}
+	if len(ip) != len(m.addr) {
+		return false
+	}
+	for i := range ip {
+		if ip[i]&^m.wildcard[i] != m.addr[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ToIPSet returns the set of IPs that the matcher matches. The trailing set
+// bits of the wildcard make up the host part of each network in the set and
+// every combination of the other set bits, the holes, takes a network of its
+// own. None of them can be combined, so a wildcard with n holes takes 2^n
+// networks. If that is more than maxBlocks, it returns an error instead.
+func (m *WildcardMatcher) ToIPSet(maxBlocks int) (*IPSet, error) {
+	if maxBlocks < 0 {
+		return nil, errorf(ErrInvalidArgument, "maxBlocks must not be negative: %d", maxBlocks)
+	}
+
+	// Find the holes, from the most significant bit
+	size := 8 * len(m.addr)
+	hostBits := 0
+	for hostBits < size && m.wildcard[(size-1-hostBits)/8]&(1<<(hostBits%8)) != 0 {
+		hostBits++
+	}
+	var holes []int
+	for i := 0; i < size-hostBits; i++ {
+		if m.wildcard[i/8]&(0x80>>(i%8)) != 0 {
+			holes = append(holes, i)
+		}
+	}
+
+	blocks := big.NewInt(0).Lsh(big.NewInt(1), uint(len(holes)))
+	if blocks.Cmp(big.NewInt(int64(maxBlocks))) > 0 {
+		return nil, errorf(ErrTooLarge, "wildcard %s takes %s networks which is more than %d", m, blocks, maxBlocks)
+	}
+
+	// Counting up through the combinations of the holes, with the first hole
+	// as the most significant bit, gives the networks in order by address.
+	var base ipPrefix
+	base.addrLen = uint8(copy(base.addr[:], m.addr))
+	base.ones = uint8(size - hostBits)
+	prefixes := make([]ipPrefix, 0, blocks.Int64())
+	for combination := uint64(0); combination < uint64(blocks.Int64()); combination++ {
+		p := base
+		for j, hole := range holes {
+			if combination&(1<<(len(holes)-1-j)) != 0 {
+				p.addr[hole/8] |= 0x80 >> (hole % 8)
+			}
+		}
+		prefixes = append(prefixes, p)
+	}
+	return &IPSet{tree: buildTree(prefixes)}, nil
+}
@@ -0,0 +1,107 @@
+package netaddr
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWildcardMatcher(t *testing.T) {
+	// Every even third octet
+	m, err := ParseWildcardMatcher("10.0.0.0", "0.0.254.255")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.0 0.0.254.255", m.String())
+	for ip, match := range map[string]bool{
+		"10.0.0.0":     true,
+		"10.0.0.255":   true,
+		"10.0.2.1":     true,
+		"10.0.254.255": true,
+		"10.0.1.0":     false,
+		"10.0.255.255": false,
+		"10.1.0.0":     false,
+		"11.0.0.0":     false,
+	} {
+		assert.Equal(t, match, m.Match(net.ParseIP(ip)), ip)
+		assert.Equal(t, match, m.Match(net.ParseIP(ip).To4()), ip)
+	}
+	assert.False(t, m.Match(net.ParseIP("::a00:0")))
+	assert.False(t, m.Match(nil))
+
+	// Ignored bits of the address are cleared
+	m, err = ParseWildcardMatcher("10.0.3.7", "0.0.0.255")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.3.0 0.0.0.255", m.String())
+
+	m, err = ParseWildcardMatcher("2001:db8::", "0:0:ffff::ffff")
+	assert.Nil(t, err)
+	assert.True(t, m.Match(net.ParseIP("2001:db8:1234::ab")))
+	assert.False(t, m.Match(net.ParseIP("2001:db8:1234::1:ab")))
+	assert.False(t, m.Match(net.ParseIP("10.0.0.0")))
+}
+
+func TestParseWildcardMatcherErrors(t *testing.T) {
+	_, err := ParseWildcardMatcher("10.0.0", "0.0.0.255")
+	assert.True(t, errors.Is(err, ErrInvalidIP))
+	_, err = ParseWildcardMatcher("10.0.0.0", "/24")
+	assert.True(t, errors.Is(err, ErrInvalidMask))
+	_, err = ParseWildcardMatcher("10.0.0.0", "::ff")
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+	_, err = ParseWildcardMatcher("2001:db8::", "0.0.0.255")
+	assert.True(t, errors.Is(err, ErrFamilyMismatch))
+}
+
+func TestWildcardMatcherToIPSet(t *testing.T) {
+	m, _ := ParseWildcardMatcher("10.0.0.0", "0.0.6.255")
+	set, err := m.ToIPSet(4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/24", "10.0.2.0/24", "10.0.4.0/24", "10.0.6.0/24"}, set.String())
+	assert.Nil(t, set.Validate())
+
+	_, err = m.ToIPSet(3)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	assert.EqualError(t, err, "wildcard 10.0.0.0 0.0.6.255 takes 4 networks which is more than 3")
+
+	// A contiguous wildcard is a network
+	m, _ = ParseWildcardMatcher("192.168.0.0", "0.0.255.255")
+	set, err = m.ToIPSet(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.168.0.0/16"}, set.String())
+
+	// Holes in the last bits and in several octets
+	m, _ = ParseWildcardMatcher("10.0.0.0", "0.128.1.2")
+	set, err = m.ToIPSet(8)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.0/32", "10.0.0.2/32", "10.0.1.0/32", "10.0.1.2/32",
+		"10.128.0.0/32", "10.128.0.2/32", "10.128.1.0/32", "10.128.1.2/32",
+	}, set.String())
+
+	// All IPs and no IPs but the address
+	m, _ = ParseWildcardMatcher("0.0.0.0", "255.255.255.255")
+	set, _ = m.ToIPSet(1)
+	assert.Equal(t, []string{"0.0.0.0/0"}, set.String())
+	m, _ = ParseWildcardMatcher("10.0.0.1", "0.0.0.0")
+	set, _ = m.ToIPSet(1)
+	assert.Equal(t, []string{"10.0.0.1/32"}, set.String())
+
+	m, _ = ParseWildcardMatcher("2001:db8::", "0:0:ffff::ffff")
+	_, err = m.ToIPSet(1<<16 - 1)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	_, err = m.ToIPSet(-1)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+func TestWildcardMatcherToIPSetMatches(t *testing.T) {
+	m, _ := ParseWildcardMatcher("172.16.0.0", "0.0.5.3")
+	set, err := m.ToIPSet(4)
+	assert.Nil(t, err)
+	for _, n := range set.GetNetworks() {
+		assert.True(t, m.Match(n.IP), n)
+	}
+	for i := 0; i < 1<<16; i++ {
+		ip := net.IP{172, 16, byte(i >> 8), byte(i)}
+		assert.Equal(t, m.Match(ip), set.Contains(ip), ip)
+	}
+}
@@ -0,0 +1,152 @@
+package netaddr
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+)
+
+// MaxUnlimitedWrite is the largest number of addresses that WriteIPs and
+// WriteNetIPs write without a limit. Asking for more, which can only happen
+// with IPv6, without giving a limit returns an error instead of writing
+// practically forever.
+const MaxUnlimitedWrite = 1 << 32
+
+// ipWriter streams addresses to a writer one at a time
+type ipWriter struct {
+	w     io.Writer
+	sep   string
+	limit int64
+	count int64
+	buf   []byte
+}
+
+func newIPWriter(w io.Writer, sep string, limit int, size *big.Int) (*ipWriter, error) {
+	if limit < 0 {
+		return nil, errorf(ErrInvalidArgument, "limit must not be negative: %d", limit)
+	}
+	if limit == 0 && size.Cmp(big.NewInt(MaxUnlimitedWrite)) > 0 {
+		return nil, errorf(ErrTooLarge, "a limit is required to write %s addresses", size)
+	}
+	if sep == "" {
+		sep = "\n"
+	}
+	return &ipWriter{w: w, sep: sep, limit: int64(limit)}, nil
+}
+
+// writePrefix writes the addresses in the given prefix in order. It returns
+// false if it stopped at the limit.
+func (iw *ipWriter) writePrefix(p ipPrefix) (bool, error) {
+	addr, last := p.addr, p.last()
+	for {
+		if iw.limit != 0 && iw.count == iw.limit {
+			return false, nil
+		}
+		iw.buf = iw.buf[:0]
+		if iw.count != 0 {
+			iw.buf = append(iw.buf, iw.sep...)
+		}
+		iw.buf = appendAddr(iw.buf, addr, p.addrLen)
+		if _, err := iw.w.Write(iw.buf); err != nil {
+			return false, err
+		}
+		iw.count++
+
+		if addr == last {
+			return true, nil
+		}
+		for i := int(p.addrLen) - 1; i >= 0; i-- {
+			addr[i]++
+			if addr[i] != 0 {
+				break
+			}
+		}
+	}
+}
+
+// appendAddr appends the text form of the given address, as net.IP would
+// format it, without allocating
+func appendAddr(b []byte, addr [16]byte, addrLen uint8) []byte {
+	if addrLen == net.IPv4len {
+		return appendIPv4(b, addr[:4])
+	}
+	if bytes.Equal(addr[:12], v4InV6Prefix[:]) {
+		return appendIPv4(b, addr[12:])
+	}
+
+	// The longest run of at least two zero groups, the first if there is a
+	// tie, is shortened to "::"
+	zeros, zerosLen := -1, 2
+	for i := 0; i < net.IPv6len; i += 2 {
+		j := i
+		for j < net.IPv6len && addr[j] == 0 && addr[j+1] == 0 {
+			j += 2
+		}
+		if j-i > zerosLen {
+			zeros, zerosLen = i, j-i
+		}
+		if j > i {
+			i = j
+		}
+	}
+	for i := 0; i < net.IPv6len; i += 2 {
+		if i == zeros {
+			b = append(b, ':', ':')
+			i += zerosLen - 2
+			continue
+		}
+		if i > 0 && i != zeros+zerosLen {
+			b = append(b, ':')
+		}
+		b = strconv.AppendUint(b, uint64(addr[i])<<8|uint64(addr[i+1]), 16)
+	}
+	return b
+}
+
+// appendIPv4 appends the given 4 byte address in dotted decimal form
+func appendIPv4(b []byte, addr []byte) []byte {
+	for i, octet := range addr {
+		if i > 0 {
+			b = append(b, '.')
+		}
+		b = strconv.AppendUint(b, uint64(octet), 10)
+	}
+	return b
+}
+
+// WriteIPs writes the IPs in the set to w in order by address, separated by
+// sep, which defaults to a newline. It stops after limit addresses. A limit
+// of 0 writes them all unless there are more than MaxUnlimitedWrite, in which
+// case it returns an error without writing anything. It returns the number
+// of addresses written, including when the writer returns an error.
+func (s *IPSet) WriteIPs(w io.Writer, sep string, limit int) (int64, error) {
+	iw, err := newIPWriter(w, sep, limit, s.root().size())
+	if err != nil {
+		return 0, err
+	}
+	for node := s.root().first(); node != nil; node = node.next() {
+		more, err := iw.writePrefix(node.prefix)
+		if err != nil || !more {
+			return iw.count, err
+		}
+	}
+	return iw.count, nil
+}
+
+// WriteNetIPs writes the IPs in the given network to w like IPSet.WriteIPs.
+// It returns an error, without writing anything, if the network is
+// malformed.
+func WriteNetIPs(w io.Writer, n *net.IPNet, sep string, limit int) (int64, error) {
+	p, err := checkedPrefixFromNet(n)
+	if err != nil {
+		return 0, err
+	}
+	iw, err := newIPWriter(w, sep, limit, p.size())
+	if err != nil {
+		return 0, err
+	}
+	_, err = iw.writePrefix(p)
+	return iw.count, err
+}
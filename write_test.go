@@ -0,0 +1,174 @@
+package netaddr
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWriter fails all writes after the first n
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestWriteIPs(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(&net.IPNet{IP: ParseIP("10.0.0.254"), Mask: net.CIDRMask(31, 32)})
+	set.Insert(ParseIP("10.0.1.0"))
+	set.Insert(ParseIP("2001:db8::1"))
+
+	var buf bytes.Buffer
+	count, err := set.WriteIPs(&buf, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+	assert.Equal(t, "10.0.0.254\n10.0.0.255\n10.0.1.0\n2001:db8::1", buf.String())
+
+	buf.Reset()
+	count, err = set.WriteIPs(&buf, ", ", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, "10.0.0.254, 10.0.0.255", buf.String())
+
+	buf.Reset()
+	count, err = (&IPSet{}).WriteIPs(&buf, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, "", buf.String())
+}
+
+func TestWriteIPsMatchesGetIPs(t *testing.T) {
+	set := &IPSet{}
+	for _, cidr := range []string{"10.0.0.0/22", "192.168.0.0/30", "2001:db8::/120"} {
+		n, _ := ParseNet(cidr)
+		set.InsertNet(n)
+	}
+	var buf bytes.Buffer
+	_, err := set.WriteIPs(&buf, "", 0)
+	assert.Nil(t, err)
+
+	ips := []string{}
+	for _, ip := range set.GetIPs(0) {
+		ips = append(ips, ip.String())
+	}
+	assert.Equal(t, strings.Join(ips, "\n"), buf.String())
+}
+
+func TestWriteIPsLimitRequired(t *testing.T) {
+	set := &IPSet{}
+	n, _ := ParseNet("2001:db8::/64")
+	set.InsertNet(n)
+
+	var buf bytes.Buffer
+	count, err := set.WriteIPs(&buf, "", 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, "", buf.String())
+
+	count, err = set.WriteIPs(&buf, "", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.Equal(t, "2001:db8::\n2001:db8::1\n2001:db8::2", buf.String())
+
+	_, err = set.WriteIPs(&buf, "", -1)
+	assert.NotNil(t, err)
+}
+
+func TestWriteIPsWriterError(t *testing.T) {
+	set := &IPSet{}
+	set.InsertNet(Ten24)
+
+	count, err := set.WriteIPs(&failingWriter{n: 5}, "", 0)
+	assert.Equal(t, "disk full", err.Error())
+	assert.Equal(t, int64(5), count)
+
+	count, err = WriteNetIPs(&failingWriter{n: 0}, Ten24, "", 0)
+	assert.Equal(t, "disk full", err.Error())
+	assert.Equal(t, int64(0), count)
+}
+
+func TestWriteNetIPs(t *testing.T) {
+	var buf bytes.Buffer
+	n, _ := ParseNet("10.0.0.252/30")
+	count, err := WriteNetIPs(&buf, n, " ", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), count)
+	assert.Equal(t, "10.0.0.252 10.0.0.253 10.0.0.254 10.0.0.255", buf.String())
+
+	// Counting doesn't wrap at the end of the address space
+	buf.Reset()
+	n, _ = ParseNet("255.255.255.254/31")
+	count, err = WriteNetIPs(&buf, n, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, "255.255.255.254\n255.255.255.255", buf.String())
+
+	n, _ = ParseNet("::/0")
+	_, err = WriteNetIPs(&buf, n, "", 0)
+	assert.NotNil(t, err)
+
+	buf.Reset()
+	count, err = WriteNetIPs(&buf, nil, "", 0)
+	assert.True(t, errors.Is(err, ErrInvalidCIDR))
+	assert.Equal(t, int64(0), count)
+	_, err = WriteNetIPs(&buf, &net.IPNet{IP: ParseIP("10.0.0.0"), Mask: net.IPMask{255, 0, 255, 0}}, "", 0)
+	assert.True(t, errors.Is(err, ErrInvalidMask))
+	assert.Equal(t, "", buf.String())
+}
+
+func BenchmarkWriteIPs(b *testing.B) {
+	set := &IPSet{}
+	n, _ := ParseNet("10.0.0.0/16")
+	set.InsertNet(n)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		set.WriteIPs(&buf, "", 0)
+	}
+}
+
+func TestWriteNetIPsMapped(t *testing.T) {
+	// Addresses format the same as net.IP.String
+	var buf bytes.Buffer
+	n := &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(127, 128)}
+	_, err := WriteNetIPs(&buf, n, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.0\n10.0.0.1", buf.String())
+}
+
+func TestAppendAddr(t *testing.T) {
+	ips := []string{
+		"0.0.0.0", "10.0.0.255", "255.255.255.255", "::", "::1", "1::",
+		"2001:db8::1", "2001:db8:0:1:1:1:1:1", "2001:0:0:1::1", "1:0:0:2:0:0:0:3",
+		"fe80::ffff:1.2.3.4", "::ffff:1.2.3.4", "::1.2.3.4", "1:2:3:4:5:6:7:8",
+	}
+	rnd := rand.New(rand.NewSource(430))
+	for i := 0; i < 1000; i++ {
+		ip := make(net.IP, net.IPv6len)
+		for j := 0; j < net.IPv6len; j += 2 {
+			if rnd.Intn(2) == 0 {
+				ip[j], ip[j+1] = byte(rnd.Intn(256)), byte(rnd.Intn(3))
+			}
+		}
+		ips = append(ips, ip.String())
+	}
+	for _, text := range ips {
+		ip := ParseIP(text)
+		var addr [16]byte
+		copy(addr[:], ip)
+		assert.Equal(t, ip.String(), string(appendAddr(nil, addr, uint8(len(ip)))), text)
+	}
+}
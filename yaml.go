@@ -0,0 +1,45 @@
+package netaddr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The YAML methods use the signatures understood by both gopkg.in/yaml.v2 and
+// gopkg.in/yaml.v3, so this package doesn't need to import either.
+
+// MarshalYAML encodes the set as a sequence of its aggregated networks. An
+// empty set is an empty sequence rather than null.
+func (s *IPSet) MarshalYAML() (interface{}, error) {
+	nets := s.String()
+	if nets == nil {
+		nets = []string{}
+	}
+	return nets, nil
+}
+
+// UnmarshalYAML decodes the set from a sequence of CIDRs or bare IP
+// addresses. For convenience, it also accepts a single scalar with the
+// networks separated by commas. The set is replaced only if every network
+// parses.
+func (s *IPSet) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var values []string
+	if err := unmarshal(&values); err != nil {
+		var value string
+		if err := unmarshal(&value); err != nil {
+			return err
+		}
+		values = strings.Split(value, ",")
+	}
+
+	set := &IPSet{}
+	for _, value := range values {
+		n, err := ParseNetOrIP(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("cannot decode %q into IPSet: %w", value, err)
+		}
+		set.InsertNet(n)
+	}
+	s.replaceTree(set.tree)
+	return nil
+}
@@ -0,0 +1,82 @@
+package netaddr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// yamlValue returns an unmarshal func like the yaml packages pass to
+// UnmarshalYAML, decoding from the given node value, which is either a
+// string scalar or a sequence of strings.
+func yamlValue(node interface{}) func(interface{}) error {
+	return func(v interface{}) error {
+		switch v := v.(type) {
+		case *string:
+			if s, ok := node.(string); ok {
+				*v = s
+				return nil
+			}
+		case *[]string:
+			if s, ok := node.([]string); ok {
+				*v = s
+				return nil
+			}
+		}
+		return errors.New("yaml: cannot unmarshal")
+	}
+}
+
+func TestIPSetMarshalYAML(t *testing.T) {
+	set := &IPSet{}
+	v, err := set.MarshalYAML()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, v)
+
+	set.InsertNet(Ten24)
+	set.Insert(ParseIP("2001:db8::1"))
+	v, err = set.MarshalYAML()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/24", "2001:db8::1/128"}, v)
+}
+
+func TestIPSetUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		node     interface{}
+		expected []string
+	}{
+		{[]string{}, nil},
+		{[]string{"10.0.0.0/25", "10.0.0.128/25", "2001:db8::1"}, []string{"10.0.0.0/24", "2001:db8::1/128"}},
+		{"10.0.0.0/8, 192.168.0.1", []string{"10.0.0.0/8", "192.168.0.1/32"}},
+		{"10.0.0.0/8", []string{"10.0.0.0/8"}},
+	}
+	for _, test := range tests {
+		set := &IPSet{}
+		set.Insert(ParseIP("172.16.0.1"))
+		assert.Nil(t, set.UnmarshalYAML(yamlValue(test.node)))
+		assert.Equal(t, test.expected, set.String())
+		assert.Nil(t, set.Validate())
+	}
+}
+
+func TestIPSetUnmarshalYAMLErrors(t *testing.T) {
+	tests := []struct {
+		node    interface{}
+		message string
+	}{
+		{[]string{"10.0.0.0/8", "10.0.0.1/8"}, `cannot decode "10.0.0.1/8" into IPSet: Host part is not zero`},
+		{"10.0.0.0/8,bogus", `cannot decode "bogus" into IPSet: invalid IP address: bogus`},
+		{42, "yaml: cannot unmarshal"},
+	}
+	for _, test := range tests {
+		set := &IPSet{}
+		set.Insert(ParseIP("172.16.0.1"))
+		err := set.UnmarshalYAML(yamlValue(test.node))
+		assert.NotNil(t, err)
+		if err != nil {
+			assert.Equal(t, test.message, err.Error())
+		}
+		assert.Equal(t, []string{"172.16.0.1/32"}, set.String())
+	}
+}